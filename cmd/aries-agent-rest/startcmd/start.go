@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -17,6 +18,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	arieshttp "github.com/hyperledger/aries-framework-go/pkg/didcomm/transport/http"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport/ws"
@@ -117,6 +119,26 @@ const (
 		" Possible values [http] [ws]. Defaults to http if not set." +
 		" Alternatively, this can be set with the following environment variable: " + agentInboundTransportEnvKey
 
+	agentAutoAcceptPolicyEnvKey = "ARIESD_AUTO_ACCEPT_POLICY"
+
+	agentAutoAcceptPolicyFlagName = "auto-accept-policy"
+
+	agentAutoAcceptPolicyFlagShorthand = "p"
+
+	agentAutoAcceptPolicyFlagUsage = "Path to the JSON file with the auto-accept policy rules for the DID Exchange" +
+		" action events. Action events are accepted manually if not set." +
+		" Alternatively, this can be set with the following environment variable: " + agentAutoAcceptPolicyEnvKey
+
+	agentMultiTenancyEnvKey = "ARIESD_MULTI_TENANCY"
+
+	agentMultiTenancyFlagName = "multi-tenancy"
+
+	agentMultiTenancyFlagShorthand = "m"
+
+	agentMultiTenancyFlagUsage = "Enables the tenants sharing the agent, managed through the /tenants endpoints." +
+		" Possible values [true] [false]. Defaults to false if not set." +
+		" Alternatively, this can be set with the following environment variable: " + agentMultiTenancyEnvKey
+
 	httpProtocol      = "http"
 	websocketProtocol = "ws"
 )
@@ -130,6 +152,8 @@ var logger = log.New("aries-framework/agent-rest")
 type agentParameters struct {
 	server                                                                                 server
 	host, inboundHostInternal, inboundHostExternal, dbPath, defaultLabel, inboundTransport string
+	autoAcceptPolicy                                                                       string
+	multiTenancy                                                                           bool
 	webhookURLs, httpResolvers, outboundTransports                                         []string
 }
 
@@ -209,9 +233,20 @@ func createStartCMD(server server) *cobra.Command {
 				return err
 			}
 
+			autoAcceptPolicy, err := getUserSetVar(cmd, agentAutoAcceptPolicyFlagName, agentAutoAcceptPolicyEnvKey, true)
+			if err != nil {
+				return err
+			}
+
+			multiTenancy, err := getMultiTenancy(cmd)
+			if err != nil {
+				return err
+			}
+
 			parameters := &agentParameters{server: server, host: host, inboundHostInternal: inboundHost,
 				inboundHostExternal: inboundHostExternal, dbPath: dbPath, defaultLabel: defaultLabel, webhookURLs: webhookURLs,
-				httpResolvers: httpResolvers, outboundTransports: outboundTransports, inboundTransport: inboundTransport}
+				httpResolvers: httpResolvers, outboundTransports: outboundTransports, inboundTransport: inboundTransport,
+				autoAcceptPolicy: autoAcceptPolicy, multiTenancy: multiTenancy}
 			return startAgent(parameters)
 		},
 	}
@@ -234,6 +269,24 @@ func createFlags(startCmd *cobra.Command) {
 		agentOutboundTransportFlagUsage)
 	startCmd.Flags().StringP(agentInboundTransportFlagName, agentInboundTransportFlagShorthand, "",
 		agentInboundTransportFlagUsage)
+	startCmd.Flags().StringP(agentAutoAcceptPolicyFlagName, agentAutoAcceptPolicyFlagShorthand, "",
+		agentAutoAcceptPolicyFlagUsage)
+	startCmd.Flags().StringP(agentMultiTenancyFlagName, agentMultiTenancyFlagShorthand, "",
+		agentMultiTenancyFlagUsage)
+}
+
+func getMultiTenancy(cmd *cobra.Command) (bool, error) {
+	multiTenancy, err := getUserSetVar(cmd, agentMultiTenancyFlagName, agentMultiTenancyEnvKey, true)
+	if err != nil || multiTenancy == "" {
+		return false, err
+	}
+
+	enabled, err := strconv.ParseBool(multiTenancy)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value [%s]: %w", agentMultiTenancyFlagName, multiTenancy, err)
+	}
+
+	return enabled, nil
 }
 
 func getUserSetVar(cmd *cobra.Command, hostFlagName, envKey string, isOptional bool) (string, error) {
@@ -359,14 +412,30 @@ func startAgent(parameters *agentParameters) error {
 		return errMissingInboundHost
 	}
 
-	ctx, err := createAriesAgent(parameters)
+	framework, ctx, err := createAriesAgent(parameters)
 	if err != nil {
 		return err
 	}
 
+	restOpts := []restapi.Opt{restapi.WithWebhookURLs(parameters.webhookURLs...),
+		restapi.WithDefaultLabel(parameters.defaultLabel)}
+
+	if parameters.autoAcceptPolicy != "" {
+		p, e := policy.LoadFile(parameters.autoAcceptPolicy)
+		if e != nil {
+			return fmt.Errorf("failed to start aries agent rest on port [%s], failed to load auto-accept policy :  %w",
+				parameters.host, e)
+		}
+
+		restOpts = append(restOpts, restapi.WithAutoAcceptPolicy(p))
+	}
+
+	if parameters.multiTenancy {
+		restOpts = append(restOpts, restapi.WithTenants(framework))
+	}
+
 	// get all HTTP REST API handlers available for controller API
-	restService, err := restapi.New(ctx, restapi.WithWebhookURLs(parameters.webhookURLs...),
-		restapi.WithDefaultLabel(parameters.defaultLabel))
+	restService, err := restapi.New(ctx, restOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to start aries agent rest on port [%s], failed to get rest service api :  %w",
 			parameters.host, err)
@@ -391,7 +460,7 @@ func startAgent(parameters *agentParameters) error {
 	return nil
 }
 
-func createAriesAgent(parameters *agentParameters) (*context.Provider, error) {
+func createAriesAgent(parameters *agentParameters) (*aries.Aries, *context.Provider, error) {
 	var opts []aries.Option
 
 	if parameters.dbPath != "" {
@@ -401,7 +470,7 @@ func createAriesAgent(parameters *agentParameters) (*context.Provider, error) {
 	inboundTransportOpt, err := getInboundTransportOpts(parameters.inboundTransport,
 		parameters.inboundHostInternal, parameters.inboundHostExternal)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to inbound tranpsort opt : %w",
+		return nil, nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to inbound tranpsort opt : %w",
 			parameters.host, err)
 	}
 
@@ -409,7 +478,7 @@ func createAriesAgent(parameters *agentParameters) (*context.Provider, error) {
 
 	resolverOpts, err := getResolverOpts(parameters.httpResolvers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to resolver opts : %w",
+		return nil, nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to resolver opts : %w",
 			parameters.host, err)
 	}
 
@@ -417,23 +486,27 @@ func createAriesAgent(parameters *agentParameters) (*context.Provider, error) {
 
 	outboundTransportOpts, err := getOutboundTransportOpts(parameters.outboundTransports)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to outbound transport opts : %w",
+		return nil, nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to outbound transport opts : %w",
 			parameters.host, err)
 	}
 
 	opts = append(opts, outboundTransportOpts...)
 
+	if parameters.multiTenancy {
+		opts = append(opts, aries.WithMultiTenancy())
+	}
+
 	framework, err := aries.New(opts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to initialize framework :  %w",
+		return nil, nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to initialize framework :  %w",
 			parameters.host, err)
 	}
 
 	ctx, err := framework.Context()
 	if err != nil {
-		return nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to get aries context : %w",
+		return nil, nil, fmt.Errorf("failed to start aries agent rest on port [%s], failed to get aries context : %w",
 			parameters.host, err)
 	}
 
-	return ctx, nil
+	return framework, ctx, nil
 }
@@ -14,6 +14,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -322,6 +323,72 @@ func TestStartCmdValidArgs(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestStartCmdWithAutoAcceptPolicy(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	policyFile := filepath.Join(path, "policy.json")
+	err := ioutil.WriteFile(policyFile, []byte(`{"rules": [{"action": "accept", "labels": ["acme-*"]}]}`), 0600)
+	require.NoError(t, err)
+
+	t.Run("valid policy", func(t *testing.T) {
+		startCmd, err := Cmd(&mockServer{})
+		require.NoError(t, err)
+
+		args := []string{"--" + agentHostFlagName, randomURL(), "--" + agentInboundHostFlagName,
+			randomURL(), "--" + agentDBPathFlagName, filepath.Join(path, "db1"),
+			"--" + agentWebhookFlagName, "", "--" + agentAutoAcceptPolicyFlagName, policyFile}
+		startCmd.SetArgs(args)
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("missing policy file", func(t *testing.T) {
+		startCmd, err := Cmd(&mockServer{})
+		require.NoError(t, err)
+
+		args := []string{"--" + agentHostFlagName, randomURL(), "--" + agentInboundHostFlagName,
+			randomURL(), "--" + agentDBPathFlagName, filepath.Join(path, "db2"),
+			"--" + agentWebhookFlagName, "", "--" + agentAutoAcceptPolicyFlagName, policyFile + "-missing"}
+		startCmd.SetArgs(args)
+
+		err = startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to load auto-accept policy")
+	})
+}
+
+func TestStartCmdWithMultiTenancy(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	t.Run("multi-tenancy enabled", func(t *testing.T) {
+		startCmd, err := Cmd(&mockServer{})
+		require.NoError(t, err)
+
+		args := []string{"--" + agentHostFlagName, randomURL(), "--" + agentInboundHostFlagName,
+			randomURL(), "--" + agentDBPathFlagName, filepath.Join(path, "db1"),
+			"--" + agentWebhookFlagName, "", "--" + agentMultiTenancyFlagName, "true"}
+		startCmd.SetArgs(args)
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("invalid multi-tenancy value", func(t *testing.T) {
+		startCmd, err := Cmd(&mockServer{})
+		require.NoError(t, err)
+
+		args := []string{"--" + agentHostFlagName, randomURL(), "--" + agentInboundHostFlagName,
+			randomURL(), "--" + agentDBPathFlagName, filepath.Join(path, "db2"),
+			"--" + agentWebhookFlagName, "", "--" + agentMultiTenancyFlagName, "maybe"}
+		startCmd.SetArgs(args)
+
+		err = startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid multi-tenancy value [maybe]")
+	})
+}
+
 func TestStartCmdValidArgsEnvVar(t *testing.T) {
 	startCmd, err := Cmd(&mockServer{})
 	require.NoError(t, err)
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package didexchange
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
@@ -33,22 +35,31 @@ const (
 // ErrConnectionNotFound is returned when connection not found
 var ErrConnectionNotFound = errors.New("connection not found")
 
+// ErrMessageHistoryDisabled is returned when the message history is queried but it is not enabled
+var ErrMessageHistoryDisabled = errors.New("message history is not enabled")
+
 // provider contains dependencies for the DID exchange protocol and is typically created by using aries.Context()
 type provider interface {
 	Service(id string) (interface{}, error)
 	KMS() kms.KeyManager
-	InboundTransportEndpoint() string
+	InboundTransportEndpoints() []string
 	StorageProvider() storage.Provider
 	TransientStorageProvider() storage.Provider
 }
 
+// historyProvider is implemented by the providers archiving the messages, e.g. aries.Context()
+type historyProvider interface {
+	MessageHistory() *history.Archive
+}
+
 // Client enable access to didexchange api
 type Client struct {
 	service.Event
-	didexchangeSvc           protocolService
-	kms                      kms.KeyManager
-	inboundTransportEndpoint string
-	connectionStore          *didexchange.ConnectionRecorder
+	didexchangeSvc            protocolService
+	kms                       kms.KeyManager
+	inboundTransportEndpoints []string
+	connectionStore           *didexchange.ConnectionRecorder
+	history                   *history.Archive
 }
 
 // protocolService defines DID Exchange service.
@@ -66,6 +77,19 @@ type protocolService interface {
 	CreateImplicitInvitation(label, toDID string) (string, error)
 }
 
+// contextService is implemented by the DID Exchange services which accept the connection with the context
+// of the caller, e.g. the context of the REST request.
+type contextService interface {
+	AcceptExchangeRequestContext(ctx context.Context, connectionID, publicDID, label string) error
+	AcceptInvitationContext(ctx context.Context, connectionID, publicDID, label string) error
+	CreateImplicitInvitationContext(ctx context.Context, label, toDID string) (string, error)
+}
+
+// pendingActionsService is implemented by the DID Exchange services which persist the action events.
+type pendingActionsService interface {
+	PendingActions() ([]*didexchange.PendingAction, error)
+}
+
 // New return new instance of didexchange client
 func New(ctx provider) (*Client, error) {
 	svc, err := ctx.Service(didexchange.DIDExchange)
@@ -88,13 +112,19 @@ func New(ctx provider) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{
-		Event:                    didexchangeSvc,
-		didexchangeSvc:           didexchangeSvc,
-		kms:                      ctx.KMS(),
-		inboundTransportEndpoint: ctx.InboundTransportEndpoint(),
-		connectionStore:          didexchange.NewConnectionRecorder(transientStore, store),
-	}, nil
+	client := &Client{
+		Event:                     didexchangeSvc,
+		didexchangeSvc:            didexchangeSvc,
+		kms:                       ctx.KMS(),
+		inboundTransportEndpoints: ctx.InboundTransportEndpoints(),
+		connectionStore:           didexchange.NewConnectionRecorder(transientStore, store),
+	}
+
+	if hp, ok := ctx.(historyProvider); ok {
+		client.history = hp.MessageHistory()
+	}
+
+	return client, nil
 }
 
 // CreateInvitation creates an invitation. New key pair will be generated and base58 encoded public key will be
@@ -109,11 +139,17 @@ func (c *Client) CreateInvitation(label string) (*Invitation, error) {
 	}
 
 	invitation := &didexchange.Invitation{
-		ID:              uuid.New().String(),
-		Label:           label,
-		RecipientKeys:   []string{sigPubKey},
-		ServiceEndpoint: c.inboundTransportEndpoint,
-		Type:            didexchange.InvitationMsgType,
+		ID:            uuid.New().String(),
+		Label:         label,
+		RecipientKeys: []string{sigPubKey},
+		Type:          didexchange.InvitationMsgType,
+	}
+
+	// the endpoint of the inbound transport with the highest priority is the service endpoint, the invitee
+	// falls back to the other endpoints
+	if len(c.inboundTransportEndpoints) > 0 {
+		invitation.ServiceEndpoint = c.inboundTransportEndpoints[0]
+		invitation.FallbackServiceEndpoints = c.inboundTransportEndpoints[1:]
 	}
 
 	err = c.connectionStore.SaveInvitation(invitation)
@@ -146,6 +182,12 @@ func (c *Client) CreateInvitationWithDID(label, did string) (*Invitation, error)
 // of did exchange protocol. Upon successful completion of did exchange protocol connection details will be used
 // for securing communication between agents.
 func (c *Client) HandleInvitation(invitation *Invitation) (string, error) {
+	return c.HandleInvitationContext(context.Background(), invitation)
+}
+
+// HandleInvitationContext handles the incoming invitation like HandleInvitation, the invitation is handled
+// with the context: the resolution of the invitation DID is aborted when the context is done.
+func (c *Client) HandleInvitationContext(ctx context.Context, invitation *Invitation) (string, error) {
 	payload, err := json.Marshal(invitation)
 	if err != nil {
 		return "", fmt.Errorf("failed marshal invitation: %w", err)
@@ -156,7 +198,7 @@ func (c *Client) HandleInvitation(invitation *Invitation) (string, error) {
 		return "", fmt.Errorf("failed to create DIDCommMsg: %w", err)
 	}
 
-	connectionID, err := c.didexchangeSvc.HandleInbound(msg)
+	connectionID, err := service.HandleInboundContext(ctx, c.didexchangeSvc, msg)
 	if err != nil {
 		return "", fmt.Errorf("failed from didexchange service handle: %w", err)
 	}
@@ -169,7 +211,21 @@ func (c *Client) HandleInvitation(invitation *Invitation) (string, error) {
 // AcceptInvitation accepts/approves exchange invitation. This call is not used if auto execute is setup
 // for this client (see package example for more details about how to setup auto execute)
 func (c *Client) AcceptInvitation(connectionID, publicDID, label string) error {
-	if err := c.didexchangeSvc.AcceptInvitation(connectionID, publicDID, label); err != nil {
+	return c.AcceptInvitationContext(context.Background(), connectionID, publicDID, label)
+}
+
+// AcceptInvitationContext accepts the exchange invitation like AcceptInvitation, the exchange request is sent
+// with the context: the DID resolution and the sending are aborted when the context is done.
+func (c *Client) AcceptInvitationContext(ctx context.Context, connectionID, publicDID, label string) error {
+	var err error
+
+	if svc, ok := c.didexchangeSvc.(contextService); ok {
+		err = svc.AcceptInvitationContext(ctx, connectionID, publicDID, label)
+	} else if err = ctx.Err(); err == nil {
+		err = c.didexchangeSvc.AcceptInvitation(connectionID, publicDID, label)
+	}
+
+	if err != nil {
 		return fmt.Errorf("did exchange client - accept exchange invitation: %w", err)
 	}
 
@@ -179,7 +235,21 @@ func (c *Client) AcceptInvitation(connectionID, publicDID, label string) error {
 // AcceptExchangeRequest accepts/approves exchange request. This call is not used if auto execute is setup
 // for this client (see package example for more details about how to setup auto execute)
 func (c *Client) AcceptExchangeRequest(connectionID, publicDID, label string) error {
-	if err := c.didexchangeSvc.AcceptExchangeRequest(connectionID, publicDID, label); err != nil {
+	return c.AcceptExchangeRequestContext(context.Background(), connectionID, publicDID, label)
+}
+
+// AcceptExchangeRequestContext accepts the exchange request like AcceptExchangeRequest, the exchange response
+// is sent with the context: the DID resolution and the sending are aborted when the context is done.
+func (c *Client) AcceptExchangeRequestContext(ctx context.Context, connectionID, publicDID, label string) error {
+	var err error
+
+	if svc, ok := c.didexchangeSvc.(contextService); ok {
+		err = svc.AcceptExchangeRequestContext(ctx, connectionID, publicDID, label)
+	} else if err = ctx.Err(); err == nil {
+		err = c.didexchangeSvc.AcceptExchangeRequest(connectionID, publicDID, label)
+	}
+
+	if err != nil {
 		return fmt.Errorf("did exchange client - accept exchange request: %w", err)
 	}
 
@@ -189,9 +259,44 @@ func (c *Client) AcceptExchangeRequest(connectionID, publicDID, label string) er
 // CreateImplicitInvitation creates and sends an exchange request to create connection
 // to specified public DID.
 func (c *Client) CreateImplicitInvitation(label, toDID string) (string, error) {
+	return c.CreateImplicitInvitationContext(context.Background(), label, toDID)
+}
+
+// CreateImplicitInvitationContext creates the implicit invitation like CreateImplicitInvitation,
+// the public DID is resolved with the context.
+func (c *Client) CreateImplicitInvitationContext(ctx context.Context, label, toDID string) (string, error) {
+	if svc, ok := c.didexchangeSvc.(contextService); ok {
+		return svc.CreateImplicitInvitationContext(ctx, label, toDID)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	return c.didexchangeSvc.CreateImplicitInvitation(label, toDID)
 }
 
+// PendingActions returns the action events which were not accepted yet. The actions which were pending
+// when the agent stopped are re-emitted to the action event channel registered after the restart.
+func (c *Client) PendingActions() ([]*PendingAction, error) {
+	svc, ok := c.didexchangeSvc.(pendingActionsService)
+	if !ok {
+		return nil, errors.New("did exchange client - pending actions: not supported by the service")
+	}
+
+	actions, err := svc.PendingActions()
+	if err != nil {
+		return nil, fmt.Errorf("did exchange client - pending actions: %w", err)
+	}
+
+	result := make([]*PendingAction, len(actions))
+	for i, action := range actions {
+		result[i] = &PendingAction{action}
+	}
+
+	return result, nil
+}
+
 // QueryConnections queries connections matching given criteria(parameters)
 func (c *Client) QueryConnections(request *QueryConnectionsParams) ([]*Connection, error) {
 	// TODO https://github.com/hyperledger/aries-framework-go/issues/655 - query all connections from all criteria and
@@ -208,6 +313,14 @@ func (c *Client) QueryConnections(request *QueryConnectionsParams) ([]*Connectio
 			continue
 		}
 
+		if request.Alias != "" && request.Alias != record.Alias {
+			continue
+		}
+
+		if request.Tag != "" && !record.HasTag(request.Tag) {
+			continue
+		}
+
 		result = append(result, &Connection{ConnectionRecord: record})
 	}
 
@@ -246,6 +359,64 @@ func (c *Client) GetConnectionAtState(connectionID, stateID string) (*Connection
 	}, nil
 }
 
+// SaveConnectionMetadata saves the alias, tags and JSON metadata for the given connection. The data is stored
+// alongside the connection record and returned as part of it by GetConnection and QueryConnections.
+func (c *Client) SaveConnectionMetadata(connectionID string, meta *ConnectionMetadata) error {
+	if meta == nil {
+		return errors.New("connection metadata can't be nil")
+	}
+
+	err := c.connectionStore.SaveConnectionMetadata(connectionID, meta.ConnectionMetadata)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return ErrConnectionNotFound
+		}
+
+		return fmt.Errorf("did exchange client - save connection metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetConnectionMetadata fetches the alias, tags and JSON metadata saved for the given connection.
+func (c *Client) GetConnectionMetadata(connectionID string) (*ConnectionMetadata, error) {
+	meta, err := c.connectionStore.GetConnectionMetadata(connectionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, ErrConnectionNotFound
+		}
+
+		return nil, fmt.Errorf("did exchange client - get connection metadata: %w", err)
+	}
+
+	return &ConnectionMetadata{meta}, nil
+}
+
+// MessageHistory returns the messages exchanged over the connection and the state transitions of the connection
+// ordered by time. The DID exchange messages received before the connection record was created are included.
+func (c *Client) MessageHistory(connectionID string) ([]*history.Entry, error) {
+	if c.history == nil {
+		return nil, ErrMessageHistoryDisabled
+	}
+
+	var threadIDs []string
+
+	record, err := c.connectionStore.GetConnectionRecord(connectionID)
+	if err == nil {
+		threadIDs = append(threadIDs, record.ThreadID)
+	} else if !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("did exchange client - message history: %w", err)
+	}
+
+	// the history of the removed connection is still returned
+	entries, err := c.history.Messages(connectionID, threadIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("did exchange client - message history: %w", err)
+	}
+
+	return entries, nil
+}
+
 // RemoveConnection removes connection record for given id
 func (c *Client) RemoveConnection(id string) error {
 	// TODO https://github.com/hyperledger/aries-framework-go/issues/553 RemoveConnection from did exchange service
@@ -6,6 +6,7 @@ SPDX-License-Identifier: Apache-2.0
 package didexchange
 
 import (
+	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/json"
@@ -18,6 +19,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
 	mockprotocol "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
@@ -104,6 +106,25 @@ func TestClient_CreateInvitation(t *testing.T) {
 		require.NotEmpty(t, inviteReq.Label)
 		require.NotEmpty(t, inviteReq.ID)
 		require.Equal(t, "endpoint", inviteReq.ServiceEndpoint)
+		require.Empty(t, inviteReq.FallbackServiceEndpoints)
+	})
+
+	t.Run("test multiple inbound transport endpoints", func(t *testing.T) {
+		svc, err := didexchange.New(&mockprotocol.MockProvider{})
+		require.NoError(t, err)
+
+		c, err := New(&mockprovider.Provider{
+			TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+			StorageProviderValue:          mockstore.NewMockStoreProvider(),
+			ServiceValue:                  svc,
+			KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"},
+			InboundEndpointsValue:         []string{"ws://endpoint", "http://endpoint"}})
+		require.NoError(t, err)
+
+		inviteReq, err := c.CreateInvitation("agent")
+		require.NoError(t, err)
+		require.Equal(t, "ws://endpoint", inviteReq.ServiceEndpoint)
+		require.Equal(t, []string{"http://endpoint"}, inviteReq.FallbackServiceEndpoints)
 	})
 
 	t.Run("test error from createSigningKey", func(t *testing.T) {
@@ -335,6 +356,35 @@ func TestClient_HandleInvitation(t *testing.T) {
 	})
 }
 
+func TestClient_Context(t *testing.T) {
+	c, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          mockstore.NewMockStoreProvider(),
+		ServiceValue:                  &mockprotocol.MockDIDExchangeSvc{},
+		KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"},
+		InboundEndpointValue:          "endpoint"})
+	require.NoError(t, err)
+
+	inviteReq, err := c.CreateInvitation("agent")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the service which cannot be cancelled is not called once the context is done
+	_, err = c.HandleInvitationContext(ctx, inviteReq)
+	require.True(t, errors.Is(err, context.Canceled))
+
+	err = c.AcceptInvitationContext(ctx, "id", "", "")
+	require.True(t, errors.Is(err, context.Canceled))
+
+	err = c.AcceptExchangeRequestContext(ctx, "id", "", "")
+	require.True(t, errors.Is(err, context.Canceled))
+
+	_, err = c.CreateImplicitInvitationContext(ctx, "alice", "did:example:123")
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
 func TestClient_CreateImplicitInvitation(t *testing.T) {
 	t.Run("test success", func(t *testing.T) {
 		c, err := New(&mockprovider.Provider{
@@ -467,6 +517,145 @@ func TestClient_QueryConnectionsByParams(t *testing.T) {
 	})
 }
 
+func TestClient_ConnectionMetadata(t *testing.T) {
+	svc, err := didexchange.New(&mockprotocol.MockProvider{})
+	require.NoError(t, err)
+
+	storageProvider := mockstore.NewMockStoreProvider()
+	c, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          storageProvider,
+		ServiceValue:                  svc})
+	require.NoError(t, err)
+
+	t.Run("test connection not found", func(t *testing.T) {
+		err = c.SaveConnectionMetadata("unknown", &ConnectionMetadata{&didexchange.ConnectionMetadata{Alias: "a"}})
+		require.Equal(t, ErrConnectionNotFound, err)
+
+		_, err = c.GetConnectionMetadata("unknown")
+		require.Equal(t, ErrConnectionNotFound, err)
+	})
+
+	t.Run("test invalid metadata", func(t *testing.T) {
+		require.Error(t, c.SaveConnectionMetadata("id1", nil))
+		require.Error(t, c.SaveConnectionMetadata("id1", &ConnectionMetadata{}))
+	})
+
+	t.Run("test save, get and query by tag and alias", func(t *testing.T) {
+		for _, id := range []string{"id1", "id2"} {
+			val, e := json.Marshal(&didexchange.ConnectionRecord{ConnectionID: id, State: "completed"})
+			require.NoError(t, e)
+			require.NoError(t, storageProvider.Store.Put("conn_"+id, val))
+		}
+
+		meta := &ConnectionMetadata{&didexchange.ConnectionMetadata{
+			Alias:    "bob",
+			Tags:     []string{"partner"},
+			Metadata: json.RawMessage(`{"customerID":"c-1"}`),
+		}}
+		require.NoError(t, c.SaveConnectionMetadata("id1", meta))
+
+		result, err := c.GetConnectionMetadata("id1")
+		require.NoError(t, err)
+		require.Equal(t, meta, result)
+
+		conn, err := c.GetConnection("id1")
+		require.NoError(t, err)
+		require.Equal(t, "bob", conn.Alias)
+
+		results, err := c.QueryConnections(&QueryConnectionsParams{Tag: "partner"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.Equal(t, "id1", results[0].ConnectionID)
+
+		results, err = c.QueryConnections(&QueryConnectionsParams{Alias: "bob"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+
+		results, err = c.QueryConnections(&QueryConnectionsParams{Tag: "unknown"})
+		require.NoError(t, err)
+		require.Empty(t, results)
+
+		results, err = c.QueryConnections(&QueryConnectionsParams{})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+	})
+
+	t.Run("test store error", func(t *testing.T) {
+		storageProvider.Store.ErrGet = errors.New("get error")
+		defer func() { storageProvider.Store.ErrGet = nil }()
+
+		err = c.SaveConnectionMetadata("id1", &ConnectionMetadata{&didexchange.ConnectionMetadata{Alias: "a"}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get error")
+
+		_, err = c.GetConnectionMetadata("id1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get error")
+	})
+}
+
+func TestClient_MessageHistory(t *testing.T) {
+	svc, err := didexchange.New(&mockprotocol.MockProvider{})
+	require.NoError(t, err)
+
+	t.Run("test message history is not enabled", func(t *testing.T) {
+		c, err := New(&mockprovider.Provider{
+			TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+			StorageProviderValue:          mockstore.NewMockStoreProvider(),
+			ServiceValue:                  svc})
+		require.NoError(t, err)
+
+		_, err = c.MessageHistory("id1")
+		require.Equal(t, ErrMessageHistoryDisabled, err)
+	})
+
+	storageProvider := mockstore.NewMockStoreProvider()
+
+	archive, err := history.New(&mockprovider.Provider{StorageProviderValue: mockstore.NewMockStoreProvider()})
+	require.NoError(t, err)
+
+	c, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          storageProvider,
+		ServiceValue:                  svc,
+		MessageHistoryValue:           archive})
+	require.NoError(t, err)
+
+	t.Run("test messages of the connection and its thread", func(t *testing.T) {
+		val, err := json.Marshal(&didexchange.ConnectionRecord{ConnectionID: "id1", ThreadID: "thid1",
+			State: "completed"})
+		require.NoError(t, err)
+		require.NoError(t, storageProvider.Store.Put("conn_id1", val))
+
+		require.NoError(t, archive.Record(&history.Entry{ThreadID: "thid1", Direction: history.Inbound}))
+		require.NoError(t, archive.Record(&history.Entry{ConnectionID: "id1", Direction: history.Outbound}))
+		require.NoError(t, archive.Record(&history.Entry{ConnectionID: "id2", Direction: history.Outbound}))
+
+		entries, err := c.MessageHistory("id1")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		// the history of the removed connection is returned
+		entries, err = c.MessageHistory("id2")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("test message history errors", func(t *testing.T) {
+		_, err := c.MessageHistory("")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "did exchange client - message history")
+
+		storageProvider.Store.ErrGet = errors.New("get error")
+		defer func() { storageProvider.Store.ErrGet = nil }()
+
+		_, err = c.MessageHistory("id1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get error")
+	})
+}
+
 func TestServiceEvents(t *testing.T) {
 	transientStore := mockstore.NewMockStoreProvider()
 	store := mockstore.NewMockStoreProvider()
@@ -729,3 +918,180 @@ func generateKeyPair() (string, []byte) {
 
 	return base58.Encode(pubKey[:]), privKey
 }
+
+func TestClient_PendingActions(t *testing.T) {
+	t.Run("pending action is re-emitted after restart", func(t *testing.T) {
+		store := mockstore.NewMockStoreProvider()
+
+		newClient := func() (*Client, *didexchange.Service) {
+			svc, err := didexchange.New(&mockprotocol.MockProvider{StoreProvider: store})
+			require.NoError(t, err)
+
+			c, err := New(&mockprovider.Provider{
+				TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+				StorageProviderValue:          store,
+				ServiceValue:                  svc,
+				KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"}},
+			)
+			require.NoError(t, err)
+
+			return c, svc
+		}
+
+		c, svc := newClient()
+
+		aCh := make(chan service.DIDCommAction, 10)
+		require.NoError(t, c.RegisterActionEvent(aCh))
+
+		invitation, err := c.CreateInvitation("alice")
+		require.NoError(t, err)
+
+		newDidDoc, err := (&mockvdri.MockVDRIRegistry{}).Create("test")
+		require.NoError(t, err)
+
+		request, err := json.Marshal(&didexchange.Request{
+			Type:       didexchange.RequestMsgType,
+			ID:         "pending-thread-id",
+			Label:      "test",
+			Thread:     &decorator.Thread{PID: invitation.ID},
+			Connection: &didexchange.Connection{DID: newDidDoc.ID, DIDDoc: newDidDoc},
+		})
+		require.NoError(t, err)
+
+		msg, err := service.NewDIDCommMsg(request)
+		require.NoError(t, err)
+		_, err = svc.HandleInbound(msg)
+		require.NoError(t, err)
+
+		var connectionID string
+
+		select {
+		case e := <-aCh:
+			connectionID = e.Properties.(Event).ConnectionID()
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "tests are not validated due to timeout")
+		}
+
+		actions, err := c.PendingActions()
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, connectionID, actions[0].ConnectionID)
+		require.Equal(t, "pending-thread-id", actions[0].ThreadID)
+		require.Equal(t, didexchange.RequestMsgType, actions[0].MessageType)
+
+		// the agent restarts, the action event was neither continued nor stopped
+		c, _ = newClient()
+
+		actions, err = c.PendingActions()
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+
+		aCh = make(chan service.DIDCommAction, 10)
+		require.NoError(t, c.RegisterActionEvent(aCh))
+
+		mCh := make(chan service.StateMsg, 10)
+		require.NoError(t, c.RegisterMsgEvent(mCh))
+
+		select {
+		case e := <-aCh:
+			require.Equal(t, connectionID, e.Properties.(Event).ConnectionID())
+			require.NoError(t, c.AcceptExchangeRequest(connectionID, "", ""))
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "tests are not validated due to timeout")
+		}
+
+		for responded := false; !responded; {
+			select {
+			case e := <-mCh:
+				responded = e.Type == service.PostState && e.StateID == "responded"
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "tests are not validated due to timeout")
+			}
+		}
+
+		actions, err = c.PendingActions()
+		require.NoError(t, err)
+		require.Empty(t, actions)
+	})
+
+	t.Run("not supported by the service", func(t *testing.T) {
+		c, err := New(&mockprovider.Provider{
+			TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+			StorageProviderValue:          mockstore.NewMockStoreProvider(),
+			ServiceValue:                  &mockprotocol.MockDIDExchangeSvc{},
+		})
+		require.NoError(t, err)
+
+		_, err = c.PendingActions()
+		require.EqualError(t, err, "did exchange client - pending actions: not supported by the service")
+	})
+}
+
+func TestClient_MultipleActionSubscribers(t *testing.T) {
+	store := mockstore.NewMockStoreProvider()
+	svc, err := didexchange.New(&mockprotocol.MockProvider{StoreProvider: store})
+	require.NoError(t, err)
+
+	c, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          store,
+		ServiceValue:                  svc,
+		KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"}},
+	)
+	require.NoError(t, err)
+
+	observerCh := make(chan service.DIDCommAction, 1)
+	require.NoError(t, c.RegisterActionEvent(observerCh, service.AsObserver()))
+
+	invitedCh := make(chan service.DIDCommAction, 1)
+	require.NoError(t, c.RegisterActionEvent(invitedCh, service.WithStates("invited")))
+
+	ownerCh := make(chan service.DIDCommAction, 1)
+	require.NoError(t, c.RegisterActionEvent(ownerCh, service.WithProtocols(didexchange.DIDExchange),
+		service.WithStates("requested")))
+
+	mCh := make(chan service.StateMsg, 10)
+	require.NoError(t, c.RegisterMsgEvent(mCh, service.WithStates("responded")))
+
+	invitation, err := c.CreateInvitation("alice")
+	require.NoError(t, err)
+
+	newDidDoc, err := (&mockvdri.MockVDRIRegistry{}).Create("test")
+	require.NoError(t, err)
+
+	request, err := json.Marshal(&didexchange.Request{
+		Type:       didexchange.RequestMsgType,
+		ID:         "multiple-subscribers-thread-id",
+		Label:      "test",
+		Thread:     &decorator.Thread{PID: invitation.ID},
+		Connection: &didexchange.Connection{DID: newDidDoc.ID, DIDDoc: newDidDoc},
+	})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(request)
+	require.NoError(t, err)
+	_, err = svc.HandleInbound(msg)
+	require.NoError(t, err)
+
+	for _, ch := range []chan service.DIDCommAction{observerCh, ownerCh} {
+		select {
+		case e := <-ch:
+			require.Equal(t, "requested", e.StateID)
+			e.Continue(&service.Empty{})
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "tests are not validated due to timeout")
+		}
+	}
+
+	require.Empty(t, invitedCh)
+
+	for _, stateMsgType := range []service.StateMsgType{service.PreState, service.PostState} {
+		select {
+		case e := <-mCh:
+			require.Equal(t, stateMsgType, e.Type)
+			require.Equal(t, "responded", e.StateID)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "tests are not validated due to timeout")
+		}
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didexchange
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+)
+
+var logger = log.New("aries-framework/didexchange/client")
+
+const (
+	stateCompleted = "completed"
+	stateAbandoned = "abandoned"
+
+	// connectEventBuffer is the capacity of the event channels of the connect helpers, the events sent
+	// while the helper is not reading them (e.g. while the invitation is delivered) are buffered.
+	connectEventBuffer = 20
+)
+
+// ErrConnectTimeout is returned when the connection was not completed before the timeout
+var ErrConnectTimeout = errors.New("timeout waiting for the connection to complete")
+
+// ErrConnectionAbandoned is returned when the DID exchange of the connection was abandoned
+var ErrConnectionAbandoned = errors.New("connection was abandoned")
+
+// ConnectError is returned by the connect helpers when the connection was not completed. Err is
+// ErrConnectTimeout or wraps ErrConnectionAbandoned.
+type ConnectError struct {
+	// ID of the connection, empty if the inviter did not receive the exchange request
+	ConnectionID string
+
+	// State the connection failed at: the state executed when the exchange was abandoned or the last
+	// state reached before the timeout, empty if the inviter did not receive the exchange request
+	State string
+
+	Err error
+}
+
+// Error implements error interface.
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("did exchange client - connect: connection %q at state %q: %s", e.ConnectionID, e.State, e.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectOption configures the exchange run by the connect helpers.
+type ConnectOption func(opts *connectOpts)
+
+// WithPublicDID sets the public DID the agent uses in the exchange instead of creating the peer DID.
+func WithPublicDID(did string) ConnectOption {
+	return func(opts *connectOpts) {
+		opts.publicDID = did
+	}
+}
+
+// WithLabel sets the label the agent sends to the other party.
+func WithLabel(label string) ConnectOption {
+	return func(opts *connectOpts) {
+		opts.label = label
+	}
+}
+
+// connectOpts are passed to the DID exchange service when the action events are continued.
+type connectOpts struct {
+	publicDID string
+	label     string
+}
+
+// PublicDID returns the public DID used in the exchange.
+func (o *connectOpts) PublicDID() string {
+	return o.publicDID
+}
+
+// Label returns the label sent to the other party.
+func (o *connectOpts) Label() string {
+	return o.label
+}
+
+// HandleInvitationAndConnect handles the invitation like HandleInvitation and blocks until the connection
+// is completed. The action events of the exchange are continued with the options, unless the application
+// registered its own action event channel before, then the application continues them. ConnectError tells
+// the state the connection failed at if it was abandoned or not completed before the timeout.
+func (c *Client) HandleInvitationAndConnect(invitation *Invitation, timeout time.Duration,
+	opts ...ConnectOption) (*Connection, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	w, err := c.newConnectWaiter(invitation.ID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.close()
+
+	connectionID, err := c.HandleInvitation(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.wait(connectionID, deadline.C)
+}
+
+// CreateInvitationAndConnect creates the invitation like CreateInvitation, passes it to deliver and blocks
+// until the first connection requested with the invitation is completed. The timeout includes the delivery
+// of the invitation. The exchange requests received for the invitation while waiting are accepted with
+// the options, unless the application registered its own action event channel before, then the application
+// accepts them. ConnectError tells the state the connection failed at if it was abandoned or not completed
+// before the timeout.
+func (c *Client) CreateInvitationAndConnect(label string, deliver func(*Invitation) error, timeout time.Duration,
+	opts ...ConnectOption) (*Connection, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	invitation, err := c.CreateInvitation(label)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := c.newConnectWaiter(invitation.ID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer w.close()
+
+	if err := deliver(invitation); err != nil {
+		return nil, fmt.Errorf("did exchange client - deliver invitation: %w", err)
+	}
+
+	return w.wait("", deadline.C)
+}
+
+// connectWaiter follows the events of the connections created from the invitation.
+type connectWaiter struct {
+	client  *Client
+	opts    *connectOpts
+	actions chan service.DIDCommAction
+	states  chan service.StateMsg
+}
+
+func (c *Client) newConnectWaiter(invitationID string, opts []ConnectOption) (*connectWaiter, error) {
+	w := &connectWaiter{
+		client:  c,
+		opts:    &connectOpts{},
+		actions: make(chan service.DIDCommAction, connectEventBuffer),
+		states:  make(chan service.StateMsg, connectEventBuffer),
+	}
+
+	for _, opt := range opts {
+		opt(w.opts)
+	}
+
+	filter := []service.EventOption{
+		service.WithProtocols(didexchange.DIDExchange),
+		service.WithInvitationIDs(invitationID),
+	}
+
+	if err := c.RegisterActionEvent(w.actions, filter...); err != nil {
+		return nil, fmt.Errorf("did exchange client - connect: %w", err)
+	}
+
+	if err := c.RegisterMsgEvent(w.states, filter...); err != nil {
+		w.unregisterActionEvent()
+
+		return nil, fmt.Errorf("did exchange client - connect: %w", err)
+	}
+
+	return w, nil
+}
+
+// wait blocks until the connection is completed, abandoned or the timeout is hit. The inviter does not know
+// the connection ID yet, it waits for the first connection requested with the invitation.
+func (w *connectWaiter) wait(connectionID string, timeout <-chan time.Time) (*Connection, error) {
+	var state string
+
+	for {
+		select {
+		case action := <-w.actions:
+			// the continue has no effect if the action event is owned by the application
+			action.Continue(w.opts)
+		case msg := <-w.states:
+			props, ok := msg.Properties.(Event)
+			if !ok {
+				continue
+			}
+
+			if connectionID == "" {
+				connectionID = props.ConnectionID()
+			}
+
+			if props.ConnectionID() != connectionID {
+				continue
+			}
+
+			switch msg.StateID {
+			case stateCompleted:
+				if msg.Type == service.PostState {
+					return w.connection(connectionID)
+				}
+			case stateAbandoned:
+				return nil, &ConnectError{ConnectionID: connectionID, State: state, Err: abandonedErr(props)}
+			}
+
+			state = msg.StateID
+		case <-timeout:
+			return nil, &ConnectError{ConnectionID: connectionID, State: state, Err: ErrConnectTimeout}
+		}
+	}
+}
+
+func (w *connectWaiter) connection(connectionID string) (*Connection, error) {
+	connection, err := w.client.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("did exchange client - connect: %w", err)
+	}
+
+	return connection, nil
+}
+
+// close unregisters the event channels. The events sent concurrently with the unregistration are absorbed
+// by the channel buffers.
+func (w *connectWaiter) close() {
+	w.unregisterActionEvent()
+
+	if err := w.client.UnregisterMsgEvent(w.states); err != nil {
+		logger.Warnf("connect: unregister message event: %s", err)
+	}
+}
+
+func (w *connectWaiter) unregisterActionEvent() {
+	if err := w.client.UnregisterActionEvent(w.actions); err != nil {
+		logger.Warnf("connect: unregister action event: %s", err)
+	}
+}
+
+// abandonedErr returns ErrConnectionAbandoned with the cause carried by the event properties.
+func abandonedErr(props Event) error {
+	if cause, ok := props.(error); ok && cause.Error() != "" {
+		return fmt.Errorf("%w: %s", ErrConnectionAbandoned, cause)
+	}
+
+	return ErrConnectionAbandoned
+}
@@ -0,0 +1,232 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didexchange
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	mockprotocol "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/internal/mock/kms"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/internal/mock/provider"
+	mockstore "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	mockvdri "github.com/hyperledger/aries-framework-go/pkg/internal/mock/vdri"
+)
+
+func TestClient_CreateInvitationAndConnect(t *testing.T) {
+	t.Run("test connection completed", func(t *testing.T) {
+		c, svc := newConnectClient(t)
+
+		conn, err := c.CreateInvitationAndConnect("alice", func(invitation *Invitation) error {
+			go sendExchangeRequest(t, c, svc, invitation)
+
+			return nil
+		}, 5*time.Second)
+		require.NoError(t, err)
+		require.Equal(t, stateCompleted, conn.State)
+		require.Equal(t, "bob", conn.TheirLabel)
+		require.NotEmpty(t, conn.InvitationID)
+	})
+
+	t.Run("test connection abandoned", func(t *testing.T) {
+		c, svc := newConnectClient(t)
+
+		// the public DID can't be resolved, the exchange is abandoned when the response is prepared
+		_, err := c.CreateInvitationAndConnect("alice", func(invitation *Invitation) error {
+			go sendExchangeRequest(t, c, svc, invitation)
+
+			return nil
+		}, 5*time.Second, WithPublicDID("did:example:unknown"))
+		require.True(t, errors.Is(err, ErrConnectionAbandoned))
+		require.Contains(t, err.Error(), "resolve public did[did:example:unknown]")
+
+		connectErr := &ConnectError{}
+		require.True(t, errors.As(err, &connectErr))
+		require.NotEmpty(t, connectErr.ConnectionID)
+		require.Equal(t, "responded", connectErr.State)
+	})
+
+	t.Run("test exchange request not received", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+
+		_, err := c.CreateInvitationAndConnect("alice", func(*Invitation) error { return nil }, time.Millisecond)
+		require.True(t, errors.Is(err, ErrConnectTimeout))
+
+		connectErr := &ConnectError{}
+		require.True(t, errors.As(err, &connectErr))
+		require.Empty(t, connectErr.ConnectionID)
+		require.Empty(t, connectErr.State)
+	})
+
+	t.Run("test error from deliver", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+
+		_, err := c.CreateInvitationAndConnect("alice", func(*Invitation) error {
+			return errors.New("deliver error")
+		}, 5*time.Second)
+		require.EqualError(t, err, "did exchange client - deliver invitation: deliver error")
+	})
+
+	t.Run("test error from create invitation", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+		c.kms = &mockkms.CloseableKMS{CreateKeyErr: errors.New("kms error")}
+
+		_, err := c.CreateInvitationAndConnect("alice", nil, 5*time.Second)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "kms error")
+	})
+}
+
+func TestClient_HandleInvitationAndConnect(t *testing.T) {
+	t.Run("test timeout at requested state", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+
+		// the request is sent but the response never comes
+		_, err := c.HandleInvitationAndConnect(newInvitation(), 500*time.Millisecond, WithLabel("bob"))
+		require.True(t, errors.Is(err, ErrConnectTimeout))
+
+		connectErr := &ConnectError{}
+		require.True(t, errors.As(err, &connectErr))
+		require.Equal(t, "requested", connectErr.State)
+
+		conn, err := c.GetConnection(connectErr.ConnectionID)
+		require.NoError(t, err)
+		require.Equal(t, "requested", conn.State)
+	})
+
+	t.Run("test the application owning the action events stops the exchange", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+
+		actions := make(chan service.DIDCommAction, 1)
+		require.NoError(t, c.RegisterActionEvent(actions))
+
+		go func() {
+			for action := range actions {
+				action.Stop(errors.New("invitation rejected"))
+			}
+		}()
+
+		_, err := c.HandleInvitationAndConnect(newInvitation(), 5*time.Second)
+		require.True(t, errors.Is(err, ErrConnectionAbandoned))
+		require.Contains(t, err.Error(), "invitation rejected")
+
+		connectErr := &ConnectError{}
+		require.True(t, errors.As(err, &connectErr))
+		require.Equal(t, "invited", connectErr.State)
+	})
+
+	t.Run("test error from handle invitation", func(t *testing.T) {
+		c, _ := newConnectClient(t)
+
+		_, err := c.HandleInvitationAndConnect(&Invitation{&didexchange.Invitation{ID: "invalid"}}, time.Second)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed from didexchange service handle")
+	})
+
+	t.Run("test error from register events", func(t *testing.T) {
+		for _, svc := range []*mockprotocol.MockDIDExchangeSvc{
+			{RegisterActionEventErr: errors.New("register error")},
+			{RegisterMsgEventErr: errors.New("register error")},
+		} {
+			c, err := New(&mockprovider.Provider{
+				TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+				StorageProviderValue:          mockstore.NewMockStoreProvider(),
+				ServiceValue:                  svc,
+			})
+			require.NoError(t, err)
+
+			_, err = c.HandleInvitationAndConnect(newInvitation(), time.Second)
+			require.EqualError(t, err, "did exchange client - connect: register error")
+		}
+	})
+}
+
+func newConnectClient(t *testing.T) (*Client, *didexchange.Service) {
+	transientStore := mockstore.NewMockStoreProvider()
+	store := mockstore.NewMockStoreProvider()
+
+	svc, err := didexchange.New(&mockprotocol.MockProvider{
+		TransientStoreProvider: transientStore,
+		StoreProvider:          store,
+	})
+	require.NoError(t, err)
+
+	c, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: transientStore,
+		StorageProviderValue:          store,
+		ServiceValue:                  svc,
+		KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"},
+	})
+	require.NoError(t, err)
+
+	return c, svc
+}
+
+func newInvitation() *Invitation {
+	pubKey, _ := generateKeyPair()
+
+	return &Invitation{&didexchange.Invitation{
+		Type:          InvitationMsgType,
+		ID:            "invitation-id",
+		Label:         "alice",
+		RecipientKeys: []string{pubKey},
+	}}
+}
+
+// sendExchangeRequest plays the invitee: it sends the exchange request and acknowledges the response.
+func sendExchangeRequest(t *testing.T, c *Client, svc *didexchange.Service, invitation *Invitation) {
+	responded := make(chan service.StateMsg, 10)
+	require.NoError(t, c.RegisterMsgEvent(responded, service.WithStates("responded")))
+
+	didDoc, err := (&mockvdri.MockVDRIRegistry{}).Create("test")
+	require.NoError(t, err)
+
+	request, err := json.Marshal(&didexchange.Request{
+		Type:       didexchange.RequestMsgType,
+		ID:         "thread-id",
+		Label:      "bob",
+		Thread:     &decorator.Thread{PID: invitation.ID},
+		Connection: &didexchange.Connection{DID: didDoc.ID, DIDDoc: didDoc},
+	})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(request)
+	require.NoError(t, err)
+
+	_, err = svc.HandleInbound(msg)
+	require.NoError(t, err)
+
+	for e := range responded {
+		if e.Type != service.PostState {
+			continue
+		}
+
+		ack, err := json.Marshal(&model.Ack{
+			Type:   didexchange.AckMsgType,
+			ID:     "ack-id",
+			Status: "OK",
+			Thread: &decorator.Thread{ID: "thread-id"},
+		})
+		require.NoError(t, err)
+
+		msg, err := service.NewDIDCommMsg(ack)
+		require.NoError(t, err)
+
+		_, err = svc.HandleInbound(msg)
+		require.NoError(t, err)
+
+		return
+	}
+}
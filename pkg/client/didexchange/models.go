@@ -34,6 +34,9 @@ type QueryConnectionsParams struct {
 
 	// TheirRole is other party's role
 	TheirRole string `json:"their_role,omitempty"`
+
+	// Tag of the connection
+	Tag string `json:"tag,omitempty"`
 }
 
 // Connection model
@@ -48,3 +51,19 @@ type Connection struct {
 type Invitation struct {
 	*didexchange.Invitation
 }
+
+// ConnectionMetadata model
+//
+// Alias, tags and JSON metadata attached to a connection by the application
+//
+type ConnectionMetadata struct {
+	*didexchange.ConnectionMetadata
+}
+
+// PendingAction model
+//
+// Action event which was not continued or stopped yet, pending actions survive the agent restart
+//
+type PendingAction struct {
+	*didexchange.PendingAction
+}
@@ -9,6 +9,7 @@ package introduce
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -20,6 +21,7 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/introduce"
 	introduceMocks "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/introduce/gomocks"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
 	storageMocks "github.com/hyperledger/aries-framework-go/pkg/storage/gomocks"
 )
 
@@ -88,6 +90,7 @@ func TestClient_SendProposal(t *testing.T) {
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(introduce.Introduce).Return(store, nil).Times(2)
+	expectPending(store)
 
 	introduceProvider := introduceMocks.NewMockProvider(ctrl)
 	introduceProvider.EXPECT().StorageProvider().Return(storageProvider)
@@ -129,6 +132,7 @@ func TestClient_SendProposalWithInvitation(t *testing.T) {
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(introduce.Introduce).Return(store, nil).Times(2)
+	expectPending(store)
 
 	introduceProvider := introduceMocks.NewMockProvider(ctrl)
 	introduceProvider.EXPECT().StorageProvider().Return(storageProvider)
@@ -172,6 +176,7 @@ func TestClient_HandleRequest(t *testing.T) {
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(introduce.Introduce).Return(store, nil).Times(2)
+	expectPending(store)
 
 	introduceProvider := introduceMocks.NewMockProvider(ctrl)
 	introduceProvider.EXPECT().StorageProvider().Return(storageProvider)
@@ -263,6 +268,7 @@ func TestClient_InvitationEnvelope(t *testing.T) {
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(introduce.Introduce).Return(store, nil).Times(2)
+	expectPending(store)
 
 	introduceProvider := introduceMocks.NewMockProvider(ctrl)
 	introduceProvider.EXPECT().StorageProvider().Return(storageProvider)
@@ -317,6 +323,7 @@ func TestClient_SendRequest(t *testing.T) {
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(introduce.Introduce).Return(store, nil).Times(2)
+	expectPending(store)
 
 	introduceProvider := introduceMocks.NewMockProvider(ctrl)
 	introduceProvider.EXPECT().StorageProvider().Return(storageProvider)
@@ -359,3 +366,22 @@ func toBytes(t *testing.T, v interface{}) []byte {
 
 	return res
 }
+
+// expectPending expects the pending action events to be restored, persisted and deleted.
+func expectPending(store *storageMocks.MockStore) {
+	store.EXPECT().Iterator("pending_", "pending_~").Return(mockstorage.NewMockIterator(nil))
+	store.EXPECT().Put(pendingKey{}, gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().Delete(pendingKey{}).Return(nil).AnyTimes()
+}
+
+// pendingKey matches the keys of the pending action events.
+type pendingKey struct{}
+
+func (pendingKey) Matches(x interface{}) bool {
+	key, ok := x.(string)
+	return ok && strings.HasPrefix(key, "pending_")
+}
+
+func (pendingKey) String() string {
+	return "has prefix pending_"
+}
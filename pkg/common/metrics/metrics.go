@@ -0,0 +1,116 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// The metrics reported by the framework.
+const (
+	// MessagesReceived counts the inbound messages by the protocol and the message type.
+	MessagesReceived = "aries_messages_received_total"
+	// MessagesSent counts the outbound messages delivered by the protocol and the message type.
+	MessagesSent = "aries_messages_sent_total"
+	// PackDuration is the time spent packing the outbound messages by the packer encoding type.
+	PackDuration = "aries_pack_duration_seconds"
+	// UnpackDuration is the time spent unpacking the inbound messages by the packer encoding type.
+	UnpackDuration = "aries_unpack_duration_seconds"
+	// OutboundFailures counts the failed deliveries to the service endpoints by the transport scheme.
+	OutboundFailures = "aries_outbound_failures_total"
+	// VDRIResolveDuration is the time spent resolving the DIDs by the DID method.
+	VDRIResolveDuration = "aries_vdri_resolve_duration_seconds"
+	// Connections is the number of the DID exchange connections by the state.
+	Connections = "aries_connections"
+	// WorkerPoolWorkers is the number of the workers of the protocol service worker pools by the pool.
+	WorkerPoolWorkers = "aries_worker_pool_workers"
+	// WorkerPoolQueueSize is the capacity of the queues of the protocol service worker pools by the pool.
+	WorkerPoolQueueSize = "aries_worker_pool_queue_size"
+	// WorkerPoolQueueDepth is the number of the tasks waiting for a worker by the pool.
+	WorkerPoolQueueDepth = "aries_worker_pool_queue_depth"
+	// WorkerPoolActive is the number of the tasks being run by the pool.
+	WorkerPoolActive = "aries_worker_pool_active"
+	// WorkerPoolRejected counts the tasks rejected because the queue was full by the pool.
+	WorkerPoolRejected = "aries_worker_pool_rejected_total"
+)
+
+// help describes the metrics reported by the framework.
+var help = map[string]string{ //nolint:gochecknoglobals
+	MessagesReceived:     "Number of inbound messages by protocol and message type.",
+	MessagesSent:         "Number of outbound messages delivered by protocol and message type.",
+	PackDuration:         "Time spent packing outbound messages in seconds by encoding type.",
+	UnpackDuration:       "Time spent unpacking inbound messages in seconds by encoding type.",
+	OutboundFailures:     "Number of failed deliveries to service endpoints by transport scheme.",
+	VDRIResolveDuration:  "Time spent resolving DIDs in seconds by DID method.",
+	Connections:          "Number of DID exchange connections by state.",
+	WorkerPoolWorkers:    "Number of workers of protocol service worker pools by pool.",
+	WorkerPoolQueueSize:  "Capacity of the queues of protocol service worker pools by pool.",
+	WorkerPoolQueueDepth: "Number of tasks waiting for a worker by pool.",
+	WorkerPoolActive:     "Number of tasks being run by pool.",
+	WorkerPoolRejected:   "Number of tasks rejected because the queue was full by pool.",
+}
+
+// unknown is the label value used when the value can't be determined, e.g. the message has no type.
+const unknown = "unknown"
+
+// Labels are the names and values of the metric dimensions.
+type Labels map[string]string
+
+// Sink receives the metrics reported by the framework. The framework users can plug their own sink
+// to forward the metrics to their monitoring system. The sink must be safe for concurrent use.
+type Sink interface {
+	// IncCounter increments the counter by one.
+	IncCounter(name string, labels Labels)
+	// AddGauge adds the delta to the gauge, the delta might be negative.
+	AddGauge(name string, delta float64, labels Labels)
+	// Observe records the value, e.g. the duration in seconds, in the histogram.
+	Observe(name string, value float64, labels Labels)
+}
+
+// Exporter is implemented by the sinks which expose the collected metrics in the Prometheus text format.
+type Exporter interface {
+	WritePrometheus(w io.Writer) error
+}
+
+// Nop is the sink discarding the metrics.
+var Nop Sink = nop{} //nolint:gochecknoglobals
+
+type nop struct{}
+
+func (nop) IncCounter(string, Labels) {}
+
+func (nop) AddGauge(string, float64, Labels) {}
+
+func (nop) Observe(string, float64, Labels) {}
+
+// ObserveSince records the time elapsed since the start in seconds in the histogram.
+func ObserveSince(sink Sink, name string, start time.Time, labels Labels) {
+	sink.Observe(name, time.Since(start).Seconds(), labels)
+}
+
+// MessageLabels returns the protocol and the type labels of the message type, the unknown labels if the type
+// is empty, e.g. the type of the message is not known to the agent.
+func MessageLabels(msgType string) Labels {
+	if msgType == "" {
+		return Labels{"protocol": unknown, "type": unknown}
+	}
+
+	return Labels{"protocol": Protocol(msgType), "type": msgType}
+}
+
+// Protocol returns the protocol name and version of the message type,
+// e.g. didexchange/1.0 for https://didcomm.org/didexchange/1.0/request.
+func Protocol(msgType string) string {
+	parts := strings.Split(msgType, "/")
+	if len(parts) < 3 || parts[len(parts)-3] == "" {
+		return unknown
+	}
+
+	return parts[len(parts)-3] + "/" + parts[len(parts)-2]
+}
@@ -0,0 +1,122 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	t.Run("test counters, gauges and histograms", func(t *testing.T) {
+		r := NewRegistry(WithBuckets(0.1, 1))
+
+		r.IncCounter(MessagesReceived, MessageLabels("https://didcomm.org/didexchange/1.0/request"))
+		r.IncCounter(MessagesReceived, MessageLabels("https://didcomm.org/didexchange/1.0/request"))
+		r.IncCounter(OutboundFailures, Labels{"scheme": "http"})
+		r.AddGauge(Connections, 1, Labels{"state": "requested"})
+		r.AddGauge(Connections, 1, Labels{"state": "completed"})
+		r.AddGauge(Connections, -1, Labels{"state": "requested"})
+		r.Observe(PackDuration, 0.05, Labels{"encoding": "JWE/1.0"})
+		r.Observe(PackDuration, 0.5, Labels{"encoding": "JWE/1.0"})
+		r.Observe(PackDuration, 5, Labels{"encoding": "JWE/1.0"})
+
+		// the metric reported with a different kind is ignored
+		r.Observe(OutboundFailures, 1, Labels{"scheme": "http"})
+
+		var buf bytes.Buffer
+		require.NoError(t, r.WritePrometheus(&buf))
+		require.Equal(t, `# HELP aries_connections Number of DID exchange connections by state.
+# TYPE aries_connections gauge
+aries_connections{state="completed"} 1
+aries_connections{state="requested"} 0
+# HELP aries_messages_received_total Number of inbound messages by protocol and message type.
+# TYPE aries_messages_received_total counter
+aries_messages_received_total{protocol="didexchange/1.0",type="https://didcomm.org/didexchange/1.0/request"} 2
+# HELP aries_outbound_failures_total Number of failed deliveries to service endpoints by transport scheme.
+# TYPE aries_outbound_failures_total counter
+aries_outbound_failures_total{scheme="http"} 1
+# HELP aries_pack_duration_seconds Time spent packing outbound messages in seconds by encoding type.
+# TYPE aries_pack_duration_seconds histogram
+aries_pack_duration_seconds_bucket{encoding="JWE/1.0",le="0.1"} 1
+aries_pack_duration_seconds_bucket{encoding="JWE/1.0",le="1"} 2
+aries_pack_duration_seconds_bucket{encoding="JWE/1.0",le="+Inf"} 3
+aries_pack_duration_seconds_sum{encoding="JWE/1.0"} 5.55
+aries_pack_duration_seconds_count{encoding="JWE/1.0"} 3
+`, buf.String())
+	})
+
+	t.Run("test custom metric without labels and escaped label values", func(t *testing.T) {
+		r := NewRegistry()
+
+		r.IncCounter("custom_total", nil)
+		r.IncCounter("custom_total", Labels{"value": "a\"b\\c\nd"})
+
+		var buf bytes.Buffer
+		require.NoError(t, r.WritePrometheus(&buf))
+		require.Equal(t, `# TYPE custom_total counter
+custom_total 1
+custom_total{value="a\"b\\c\nd"} 1
+`, buf.String())
+	})
+
+	t.Run("test write error", func(t *testing.T) {
+		r := NewRegistry()
+		r.IncCounter("custom_total", nil)
+
+		require.EqualError(t, r.WritePrometheus(&failingWriter{}), "write error")
+	})
+
+	t.Run("test concurrent use", func(t *testing.T) {
+		r := NewRegistry()
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				ObserveSince(r, VDRIResolveDuration, time.Now(), Labels{"method": "peer"})
+			}()
+		}
+
+		wg.Wait()
+
+		var buf bytes.Buffer
+		require.NoError(t, r.WritePrometheus(&buf))
+		require.Contains(t, buf.String(), `aries_vdri_resolve_duration_seconds_count{method="peer"} 10`)
+	})
+}
+
+func TestMessageLabels(t *testing.T) {
+	require.Equal(t, Labels{"protocol": "didexchange/1.0", "type": "https://didcomm.org/didexchange/1.0/request"},
+		MessageLabels("https://didcomm.org/didexchange/1.0/request"))
+	require.Equal(t, "introduce/1.0",
+		Protocol("did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/introduce/1.0/proposal"))
+	require.Equal(t, "unknown", Protocol("request"))
+	require.Equal(t, "unknown", Protocol("/1.0/request"))
+	require.Equal(t, Labels{"protocol": "unknown", "type": "unknown"}, MessageLabels(""))
+}
+
+func TestNop(t *testing.T) {
+	Nop.IncCounter(MessagesSent, nil)
+	Nop.AddGauge(Connections, 1, nil)
+	ObserveSince(Nop, UnpackDuration, time.Now(), nil)
+}
+
+type failingWriter struct{}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write error")
+}
@@ -0,0 +1,228 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	counterKind   = "counter"
+	gaugeKind     = "gauge"
+	histogramKind = "histogram"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10} //nolint:gochecknoglobals
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`) //nolint:gochecknoglobals
+
+// Registry is the sink keeping the metrics in memory, it exposes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+type family struct {
+	kind   string
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	// the histogram buckets are not cumulative, they are summed up on the export
+	buckets []uint64
+	count   uint64
+}
+
+// RegistryOption configures the Registry.
+type RegistryOption func(r *Registry)
+
+// WithBuckets sets the upper bounds of the histogram buckets in the ascending order.
+func WithBuckets(buckets ...float64) RegistryOption {
+	return func(r *Registry) {
+		r.buckets = buckets
+	}
+}
+
+// NewRegistry returns new Registry.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{buckets: DefaultBuckets, families: make(map[string]*family)}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// IncCounter increments the counter by one.
+func (r *Registry) IncCounter(name string, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.series(name, counterKind, labels); s != nil {
+		s.value++
+	}
+}
+
+// AddGauge adds the delta to the gauge.
+func (r *Registry) AddGauge(name string, delta float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.series(name, gaugeKind, labels); s != nil {
+		s.value += delta
+	}
+}
+
+// Observe records the value in the histogram.
+func (r *Registry) Observe(name string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.series(name, histogramKind, labels)
+	if s == nil {
+		return
+	}
+
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(r.buckets))
+	}
+
+	for i, bound := range r.buckets {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+
+	s.value += value
+	s.count++
+}
+
+// series returns the series of the metric with the given labels, nil if the metric was reported
+// with a different kind before.
+func (r *Registry) series(name, kind string, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+
+	if f.kind != kind {
+		return nil
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, formatLabel(k, v))
+	}
+
+	sort.Strings(pairs)
+
+	key := strings.Join(pairs, ",")
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: pairs}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+
+	for _, name := range names {
+		r.writeFamily(bw, name, r.families[name])
+	}
+
+	return bw.Flush()
+}
+
+func (r *Registry) writeFamily(w io.Writer, name string, f *family) {
+	if h, ok := help[name]; ok {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, h)
+	}
+
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+
+		if f.kind != histogramKind {
+			fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(s.labels), formatValue(s.value))
+			continue
+		}
+
+		var cumulative uint64
+
+		for i, bound := range r.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatValue(bound)), cumulative)
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(s.labels), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(s.labels), s.count)
+	}
+}
+
+// formatLabels formats the label pairs and the additional label, e.g. the le label of the histogram bucket.
+func formatLabels(pairs []string, extra ...string) string {
+	if len(extra) == 2 {
+		pairs = append(pairs[:len(pairs):len(pairs)], formatLabel(extra[0], extra[1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatLabel formats the label pair escaping the backslash, the double quote and the line feed of the value.
+func formatLabel(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
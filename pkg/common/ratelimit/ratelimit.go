@@ -0,0 +1,106 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// minSweepSize is the number of the buckets kept before the idle buckets are dropped.
+const minSweepSize = 1024
+
+// Limiter limits the rate of the events per key with the token buckets. Every key has its own bucket
+// holding up to burst tokens and refilled at the given rate, the event takes one token from the bucket of its key.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	sweepSize int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns the limiter allowing rate events per second per key with bursts of up to burst events.
+func New(rate float64, burst int) (*Limiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("invalid rate: %v", rate)
+	}
+
+	if burst < 1 {
+		return nil, fmt.Errorf("invalid burst: %d", burst)
+	}
+
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+		sweepSize: minSweepSize,
+	}, nil
+}
+
+// Allow takes a token from the bucket of the key. It returns true if the event may happen now, otherwise
+// false and the time after which the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		l.sweep(now)
+
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.refill(now, l.rate, l.burst)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops the buckets which are full again, they are the same as the new buckets. The buckets are swept
+// when their number doubles so that the memory used by the idle keys is bounded.
+func (l *Limiter) sweep(now time.Time) {
+	if len(l.buckets) < l.sweepSize {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if b.refill(now, l.rate, l.burst); b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.sweepSize = 2 * len(l.buckets)
+	if l.sweepSize < minSweepSize {
+		l.sweepSize = minSweepSize
+	}
+}
+
+func (b *bucket) refill(now time.Time, rate, burst float64) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*rate)
+	}
+
+	b.last = now
+}
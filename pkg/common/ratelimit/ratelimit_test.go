@@ -0,0 +1,95 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(1, 1)
+	require.NoError(t, err)
+
+	for _, rate := range []float64{0, -1, math.Inf(1), math.NaN()} {
+		_, err = New(rate, 1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid rate")
+	}
+
+	_, err = New(1, 0)
+	require.EqualError(t, err, "invalid burst: 0")
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Run("test burst and refill", func(t *testing.T) {
+		l, err := New(2, 3)
+		require.NoError(t, err)
+
+		now := time.Now()
+		l.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			ok, _ := l.Allow("key")
+			require.True(t, ok)
+		}
+
+		ok, retryAfter := l.Allow("key")
+		require.False(t, ok)
+		require.Equal(t, 500*time.Millisecond, retryAfter)
+
+		// the other keys have their own buckets
+		ok, _ = l.Allow("other")
+		require.True(t, ok)
+
+		now = now.Add(250 * time.Millisecond)
+		ok, retryAfter = l.Allow("key")
+		require.False(t, ok)
+		require.Equal(t, 250*time.Millisecond, retryAfter)
+
+		now = now.Add(250 * time.Millisecond)
+		ok, _ = l.Allow("key")
+		require.True(t, ok)
+
+		// the bucket is never filled above the burst
+		now = now.Add(time.Hour)
+
+		for i := 0; i < 3; i++ {
+			ok, _ = l.Allow("key")
+			require.True(t, ok)
+		}
+
+		ok, _ = l.Allow("key")
+		require.False(t, ok)
+	})
+
+	t.Run("test idle buckets are dropped", func(t *testing.T) {
+		l, err := New(1, 1)
+		require.NoError(t, err)
+
+		now := time.Now()
+		l.now = func() time.Time { return now }
+
+		for i := 0; i < minSweepSize; i++ {
+			ok, _ := l.Allow(fmt.Sprintf("key-%d", i))
+			require.True(t, ok)
+		}
+
+		require.Len(t, l.buckets, minSweepSize)
+
+		now = now.Add(time.Second)
+
+		ok, _ := l.Allow("new")
+		require.True(t, ok)
+		require.Len(t, l.buckets, 1)
+		require.Equal(t, minSweepSize, l.sweepSize)
+	})
+}
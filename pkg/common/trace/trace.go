@@ -0,0 +1,198 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+// The spans started by the framework.
+const (
+	// InboundSpan is the root span of the envelope received by the inbound transport.
+	InboundSpan = "didcomm.inbound"
+	// UnpackSpan is the unpacking of the inbound envelope.
+	UnpackSpan = "didcomm.unpack"
+	// HandleInboundSpan is the handling of the inbound message by the protocol service.
+	HandleInboundSpan = "didcomm.handle_inbound"
+	// StateSpan is the execution of a single state of the protocol state machine.
+	StateSpan = "didcomm.state"
+	// ResolveSpan is the resolution of the DID by the VDRI registry.
+	ResolveSpan = "vdri.resolve"
+	// SendSpan is the sending of the outbound message.
+	SendSpan = "didcomm.send"
+)
+
+// The attributes of the spans started by the framework.
+const (
+	// ThreadIDKey is the ~thread.thid of the message, the spans of a DIDComm exchange are correlated by it.
+	ThreadIDKey = "didcomm.thid"
+	// MessageTypeKey is the @type of the message.
+	MessageTypeKey = "didcomm.type"
+	// ServiceKey is the name of the protocol service.
+	ServiceKey = "didcomm.service"
+	// StateKey is the name of the protocol state.
+	StateKey = "didcomm.state"
+	// TransportKey is the scheme of the transport, e.g. http or ws.
+	TransportKey = "didcomm.transport"
+	// EndpointKey is the service endpoint the message is sent to.
+	EndpointKey = "didcomm.endpoint"
+	// DIDMethodKey is the method of the resolved DID.
+	DIDMethodKey = "did.method"
+)
+
+// Tracer starts the spans. The interface follows the OpenTelemetry tracer so that the framework users
+// can plug an OpenTelemetry tracer with a thin adapter.
+type Tracer interface {
+	// Start starts the span, the span is the child of the span in the context if any. The returned context
+	// holds the started span.
+	Start(ctx context.Context, spanName string, opts ...SpanStartOption) (context.Context, Span)
+}
+
+// Span is a single operation of the trace.
+type Span interface {
+	// End completes the span, the span is not changed once ended.
+	End()
+	// SetAttributes sets the attributes of the span.
+	SetAttributes(kv ...KeyValue)
+	// RecordError records the error the operation failed with.
+	RecordError(err error)
+	// SpanContext returns the identifiers of the span.
+	SpanContext() SpanContext
+	// IsRecording returns true if the span records the attributes and errors.
+	IsRecording() bool
+}
+
+// KeyValue is the attribute of the span.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// String returns the attribute with the given key and value.
+func String(key, value string) KeyValue {
+	return KeyValue{Key: key, Value: value}
+}
+
+// SpanConfig is the configuration of the started span.
+type SpanConfig struct {
+	Attributes []KeyValue
+}
+
+// SpanStartOption configures the started span.
+type SpanStartOption func(cfg *SpanConfig)
+
+// WithAttributes sets the attributes of the started span.
+func WithAttributes(kv ...KeyValue) SpanStartOption {
+	return func(cfg *SpanConfig) {
+		cfg.Attributes = append(cfg.Attributes, kv...)
+	}
+}
+
+// NewSpanConfig applies the options to the span configuration.
+func NewSpanConfig(opts ...SpanStartOption) *SpanConfig {
+	cfg := &SpanConfig{}
+
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return cfg
+}
+
+// TraceID identifies the trace.
+type TraceID [16]byte
+
+// String returns the hex encoded trace ID.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies the span.
+type SpanID [8]byte
+
+// String returns the hex encoded span ID.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext holds the identifiers of the span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid returns true if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+type (
+	spanKey     struct{}
+	threadIDKey struct{}
+)
+
+// ContextWithSpan returns the context holding the span, the spans started with the context are its children.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span held by the context, the span which records nothing if there is no span.
+func SpanFromContext(ctx context.Context) Span {
+	if ctx != nil {
+		if span, ok := ctx.Value(spanKey{}).(Span); ok {
+			return span
+		}
+	}
+
+	return noopSpan{}
+}
+
+// ContextWithThreadID returns the context holding the thread ID of the DIDComm exchange, the spans started
+// for the exchange without its message, e.g. the DID resolution, are correlated by it.
+func ContextWithThreadID(ctx context.Context, thID string) context.Context {
+	return context.WithValue(ctx, threadIDKey{}, thID)
+}
+
+// ThreadIDFromContext returns the thread ID held by the context, empty if there is none.
+func ThreadIDFromContext(ctx context.Context) string {
+	if ctx != nil {
+		if thID, ok := ctx.Value(threadIDKey{}).(string); ok {
+			return thID
+		}
+	}
+
+	return ""
+}
+
+// Detach returns the background context holding the span and the thread ID of the given context, it is used
+// to continue the trace by the work outliving the context, e.g. the message processed asynchronously after
+// the inbound request is done.
+func Detach(ctx context.Context) context.Context {
+	return ContextWithThreadID(ContextWithSpan(context.Background(), SpanFromContext(ctx)), ThreadIDFromContext(ctx))
+}
+
+// Noop is the tracer which records nothing.
+var Noop Tracer = noopTracer{} //nolint:gochecknoglobals
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...SpanStartOption) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End() {}
+
+func (noopSpan) SetAttributes(...KeyValue) {}
+
+func (noopSpan) RecordError(error) {}
+
+func (noopSpan) SpanContext() SpanContext { return SpanContext{} }
+
+func (noopSpan) IsRecording() bool { return false }
@@ -0,0 +1,147 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("test child spans inherit the trace", func(t *testing.T) {
+		exporter := NewInMemoryExporter()
+		tracer := NewTracer(exporter)
+
+		ctx, root := tracer.Start(context.Background(), InboundSpan, WithAttributes(String(TransportKey, "http")))
+		require.True(t, root.IsRecording())
+		require.True(t, root.SpanContext().IsValid())
+		require.Equal(t, root, SpanFromContext(ctx))
+
+		_, child := tracer.Start(ctx, UnpackSpan)
+		child.RecordError(errors.New("unpack error"))
+		child.RecordError(nil)
+		child.End()
+
+		root.SetAttributes(String(ThreadIDKey, "thid"))
+		root.End()
+		require.False(t, root.IsRecording())
+
+		// the ended span is not changed
+		root.SetAttributes(String(ThreadIDKey, "other"))
+		root.RecordError(errors.New("late error"))
+		root.End()
+
+		spans := exporter.Spans()
+		require.Len(t, spans, 2)
+
+		require.Equal(t, UnpackSpan, spans[0].Name)
+		require.Equal(t, root.SpanContext(), spans[0].Parent)
+		require.Equal(t, root.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+		require.NotEqual(t, root.SpanContext().SpanID, spans[0].SpanContext.SpanID)
+		require.Equal(t, []string{"unpack error"}, spans[0].Errors)
+
+		require.Equal(t, InboundSpan, spans[1].Name)
+		require.False(t, spans[1].Parent.IsValid())
+		require.Empty(t, spans[1].Errors)
+		require.False(t, spans[1].EndTime.Before(spans[1].StartTime))
+
+		v, ok := spans[1].Attribute(TransportKey)
+		require.True(t, ok)
+		require.Equal(t, "http", v)
+
+		v, ok = spans[1].Attribute(ThreadIDKey)
+		require.True(t, ok)
+		require.Equal(t, "thid", v)
+
+		_, ok = spans[1].Attribute(StateKey)
+		require.False(t, ok)
+
+		require.Len(t, exporter.ThreadSpans("thid"), 1)
+		require.Empty(t, exporter.ThreadSpans("other"))
+
+		exporter.Reset()
+		require.Empty(t, exporter.Spans())
+	})
+
+	t.Run("test root spans start new traces", func(t *testing.T) {
+		tracer := NewTracer(NewInMemoryExporter())
+
+		//nolint:staticcheck
+		_, first := tracer.Start(nil, InboundSpan)
+		_, second := tracer.Start(context.Background(), InboundSpan)
+
+		require.NotEqual(t, first.SpanContext().TraceID, second.SpanContext().TraceID)
+		require.Len(t, first.SpanContext().TraceID.String(), 32)
+		require.Len(t, first.SpanContext().SpanID.String(), 16)
+	})
+
+	t.Run("test concurrent spans", func(t *testing.T) {
+		exporter := NewInMemoryExporter()
+		tracer := NewTracer(exporter)
+
+		ctx, root := tracer.Start(context.Background(), InboundSpan)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, span := tracer.Start(ctx, StateSpan)
+				span.SetAttributes(String(ThreadIDKey, "thid"))
+				span.End()
+			}()
+		}
+
+		wg.Wait()
+		root.End()
+
+		require.Len(t, exporter.ThreadSpans("thid"), 10)
+	})
+}
+
+func TestNoop(t *testing.T) {
+	ctx, span := Noop.Start(context.Background(), InboundSpan, WithAttributes(String(TransportKey, "ws")))
+	require.Equal(t, context.Background(), ctx)
+	require.False(t, span.IsRecording())
+	require.False(t, span.SpanContext().IsValid())
+
+	span.SetAttributes(String(ThreadIDKey, "thid"))
+	span.RecordError(errors.New("error"))
+	span.End()
+
+	require.False(t, SpanFromContext(context.Background()).IsRecording())
+	//nolint:staticcheck
+	require.False(t, SpanFromContext(nil).IsRecording())
+}
+
+func TestDetach(t *testing.T) {
+	tracer := NewTracer(NewInMemoryExporter())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, span := tracer.Start(ContextWithThreadID(ctx, "thid"), InboundSpan)
+
+	cancel()
+
+	detached := Detach(ctx)
+	require.NoError(t, detached.Err())
+	require.Equal(t, span, SpanFromContext(detached))
+	require.Equal(t, "thid", ThreadIDFromContext(detached))
+}
+
+func TestThreadIDFromContext(t *testing.T) {
+	require.Equal(t, "thid", ThreadIDFromContext(ContextWithThreadID(context.Background(), "thid")))
+	require.Empty(t, ThreadIDFromContext(context.Background()))
+	//nolint:staticcheck
+	require.Empty(t, ThreadIDFromContext(nil))
+}
@@ -0,0 +1,176 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// SpanData is the snapshot of the ended span passed to the exporter.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	// Parent is the span context of the parent span, it is not valid for the root span.
+	Parent     SpanContext
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes []KeyValue
+	Errors     []string
+}
+
+// Attribute returns the value of the attribute with the given key, the last value if the attribute was set
+// more than once.
+func (d *SpanData) Attribute(key string) (string, bool) {
+	for i := len(d.Attributes) - 1; i >= 0; i-- {
+		if d.Attributes[i].Key == key {
+			return d.Attributes[i].Value, true
+		}
+	}
+
+	return "", false
+}
+
+// SpanExporter receives the ended spans.
+type SpanExporter interface {
+	ExportSpan(span *SpanData)
+}
+
+// NewTracer returns the tracer passing the ended spans to the exporter.
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter SpanExporter
+}
+
+// Start starts the span, the span is the child of the span in the context if any.
+func (t *tracer) Start(ctx context.Context, spanName string, opts ...SpanStartOption) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s := &span{exporter: t.exporter, data: &SpanData{
+		Name:       spanName,
+		StartTime:  time.Now(),
+		Attributes: NewSpanConfig(opts...).Attributes,
+	}}
+
+	parent := SpanFromContext(ctx).SpanContext()
+	if parent.IsValid() {
+		s.data.Parent = parent
+		s.data.SpanContext.TraceID = parent.TraceID
+	} else {
+		_, _ = rand.Read(s.data.SpanContext.TraceID[:])
+	}
+
+	_, _ = rand.Read(s.data.SpanContext.SpanID[:])
+
+	return ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	mu       sync.Mutex
+	exporter SpanExporter
+	data     *SpanData
+	ended    bool
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.data.EndTime = time.Now()
+	s.mu.Unlock()
+
+	s.exporter.ExportSpan(s.data)
+}
+
+func (s *span) SetAttributes(kv ...KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended {
+		s.data.Attributes = append(s.data.Attributes, kv...)
+	}
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended && err != nil {
+		s.data.Errors = append(s.data.Errors, err.Error())
+	}
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.ended
+}
+
+// InMemoryExporter keeps the ended spans in memory, it is typically used by the tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// NewInMemoryExporter returns new InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan keeps the ended span.
+func (e *InMemoryExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the ended spans in the order they ended.
+func (e *InMemoryExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// ThreadSpans returns the ended spans of the DIDComm exchange with the given thread ID.
+func (e *InMemoryExporter) ThreadSpans(thID string) []*SpanData {
+	var spans []*SpanData
+
+	for _, s := range e.Spans() {
+		if v, ok := s.Attribute(ThreadIDKey); ok && v == thID {
+			spans = append(spans, s)
+		}
+	}
+
+	return spans
+}
+
+// Reset drops the ended spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = nil
+}
@@ -0,0 +1,26 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+
+// ProblemReportMsgType is the message type of the problem report.
+const ProblemReportMsgType = "https://didcomm.org/report-problem/1.0/problem-report"
+
+// ProblemReport problem report struct
+type ProblemReport struct {
+	Type        string            `json:"@type,omitempty"`
+	ID          string            `json:"@id,omitempty"`
+	Thread      *decorator.Thread `json:"~thread,omitempty"`
+	Description Description       `json:"description"`
+}
+
+// Description describes the problem by the code and the explanation in English.
+type Description struct {
+	Code    string `json:"code"`
+	English string `json:"en,omitempty"`
+}
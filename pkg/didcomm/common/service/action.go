@@ -8,28 +8,63 @@ package service
 
 import (
 	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
 )
 
-// Action thread-safe action register structure
+var logger = log.New("aries-framework/service")
+
+// Action thread-safe action event bus. The action events sent by the protocol service are delivered to every
+// subscriber channel matching the event.
+//
+// Ownership of the action event: the first subscriber in the registration order which matches the event and
+// is not registered AsObserver owns the event. Only the Continue and Stop functions passed to the owner resume
+// the protocol thread, the other subscribers receive the event with no-op Continue and Stop functions.
+// The action event none of the subscribers owns is kept and re-offered once the next subscriber is registered.
+//
+// The action event is delivered to the owner before the publisher returns. The copies delivered to the other
+// subscribers are queued per subscriber, a subscriber which is slow to read them does not delay the others.
 type Action struct {
-	mu    sync.RWMutex
-	event chan<- DIDCommAction
+	mu          sync.RWMutex
+	subscribers []*actionSubscriber
+	publish     chan DIDCommAction
+	done        chan struct{}
+	closed      bool
+
+	unownedMu sync.Mutex
+	// unowned keeps the action events none of the subscribers owned until the next subscriber is registered
+	unowned []DIDCommAction
+}
+
+// observedQueueSize is the number of the action events queued for the subscriber which does not own them.
+const observedQueueSize = 100
+
+type actionSubscriber struct {
+	subscription
+	ch chan<- DIDCommAction
+	// observed queues the action events the subscriber does not own
+	observed     chan DIDCommAction
+	unregistered chan struct{}
 }
 
-// ActionEvent returns event action channel
+// ActionEvent returns the channel the protocol service sends the action events to, nil if there are no subscribers
+// or the bus was closed.
 func (a *Action) ActionEvent() chan<- DIDCommAction {
 	a.mu.RLock()
-	e := a.event
-	a.mu.RUnlock()
+	defer a.mu.RUnlock()
 
-	return e
+	if len(a.subscribers) == 0 || a.closed {
+		return nil
+	}
+
+	return a.publish
 }
 
 // RegisterActionEvent on protocol messages.
 // The consumer need to invoke the callback to resume processing.
-// Only one channel can be registered for the action events. The function will throw error if a channel is already
-// registered.
-func (a *Action) RegisterActionEvent(ch chan<- DIDCommAction) error {
+// Multiple channels can be registered for the action events, the options filter the delivered events.
+// The function will throw error if the channel is already registered.
+func (a *Action) RegisterActionEvent(ch chan<- DIDCommAction, opts ...EventOption) error {
 	if ch == nil {
 		return ErrNilChannel
 	}
@@ -37,11 +72,33 @@ func (a *Action) RegisterActionEvent(ch chan<- DIDCommAction) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.event != nil {
-		return ErrChannelRegistered
+	for _, s := range a.subscribers {
+		if s.ch == ch {
+			return ErrChannelRegistered
+		}
 	}
 
-	a.event = ch
+	s := &actionSubscriber{
+		subscription: newSubscription(opts),
+		ch:           ch,
+		observed:     make(chan DIDCommAction, observedQueueSize),
+		unregistered: make(chan struct{}),
+	}
+
+	a.subscribers = append(a.subscribers, s)
+
+	// the dispatcher is started once and serves the bus until it is closed
+	if a.publish == nil && !a.closed {
+		a.publish = make(chan DIDCommAction)
+		a.done = make(chan struct{})
+
+		go a.dispatch(a.publish, a.done)
+	}
+
+	if !a.closed {
+		go s.deliverObserved(a.done)
+		go a.reofferUnowned()
+	}
 
 	return nil
 }
@@ -55,11 +112,179 @@ func (a *Action) UnregisterActionEvent(ch chan<- DIDCommAction) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.event != ch {
-		return ErrInvalidChannel
+	for i, s := range a.subscribers {
+		if s.ch == ch {
+			a.subscribers = append(a.subscribers[:i], a.subscribers[i+1:]...)
+			close(s.unregistered)
+
+			return nil
+		}
 	}
 
-	a.event = nil
+	return ErrInvalidChannel
+}
 
-	return nil
+// Close stops the dispatcher of the bus, the action events are not delivered anymore. The protocol service
+// closes the bus once it was stopped, the subscriber channels are owned by the consumers, they are not closed.
+func (a *Action) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	a.closed = true
+
+	if a.done != nil {
+		close(a.done)
+	}
+}
+
+func (a *Action) dispatch(publish <-chan DIDCommAction, done <-chan struct{}) {
+	for {
+		select {
+		case action := <-publish:
+			a.deliver(action, done)
+		case <-done:
+			return
+		}
+	}
+}
+
+// PublishActionEvent delivers the action event to the matching subscribers. It returns false if none of
+// the subscribers owns the action event, the action event is kept and re-offered once the next subscriber
+// is registered then, e.g. the action event restored after the agent restart before any subscriber is registered.
+func (a *Action) PublishActionEvent(action DIDCommAction) bool {
+	a.mu.RLock()
+	done := a.done
+	a.mu.RUnlock()
+
+	return a.deliver(action, done)
+}
+
+// deliver publishes the action event, the action event none of the subscribers owns is kept unless
+// the bus was closed.
+func (a *Action) deliver(action DIDCommAction, done <-chan struct{}) bool {
+	if a.publishActionEvent(action, done) {
+		return true
+	}
+
+	a.mu.RLock()
+	closed := a.closed
+	a.mu.RUnlock()
+
+	if closed {
+		return false
+	}
+
+	logger.Infof("%s action event is not owned by any subscriber, it is re-offered once a subscriber is registered",
+		action.ProtocolName)
+
+	a.unownedMu.Lock()
+	a.unowned = append(a.unowned, action)
+	a.unownedMu.Unlock()
+
+	return false
+}
+
+// reofferUnowned publishes the kept action events again, the action events are kept again if none
+// of the subscribers owns them.
+func (a *Action) reofferUnowned() {
+	a.unownedMu.Lock()
+	unowned := a.unowned
+	a.unowned = nil
+	a.unownedMu.Unlock()
+
+	for _, action := range unowned {
+		a.PublishActionEvent(action)
+	}
+}
+
+// publishActionEvent delivers the action event, the delivery is abandoned once the bus is closed
+// so that the dispatcher is not blocked by the consumer which stopped reading.
+func (a *Action) publishActionEvent(action DIDCommAction, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		logger.Warnf("%s action event was not delivered: the action event bus was closed", action.ProtocolName)
+
+		return false
+	default:
+	}
+
+	a.mu.RLock()
+	subscribers := append(a.subscribers[:0:0], a.subscribers...)
+	a.mu.RUnlock()
+
+	owned := false
+
+	for _, s := range subscribers {
+		if !s.match(action.ProtocolName, action.StateID, action.Properties) {
+			continue
+		}
+
+		if owned || s.observer {
+			s.observe(observed(action))
+			continue
+		}
+
+		select {
+		case s.ch <- action:
+			owned = true
+		case <-done:
+			logger.Warnf("%s action event was not delivered: the action event bus was closed", action.ProtocolName)
+
+			return false
+		}
+	}
+
+	return owned
+}
+
+// observe queues the action event the subscriber does not own, the action event is dropped if the queue is full.
+func (s *actionSubscriber) observe(action DIDCommAction) {
+	select {
+	case s.observed <- action:
+	default:
+		logger.Warnf("%s action event was not delivered: the subscriber is not reading the action events",
+			action.ProtocolName)
+	}
+}
+
+// deliverObserved delivers the queued action events until the subscriber is unregistered or the bus is closed.
+func (s *actionSubscriber) deliverObserved(done <-chan struct{}) {
+	for {
+		select {
+		case action := <-s.observed:
+			select {
+			case s.ch <- action:
+			case <-s.unregistered:
+				return
+			case <-done:
+				return
+			}
+		case <-s.unregistered:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// observed returns the copy of the action event delivered to the subscribers which do not own the event.
+func observed(action DIDCommAction) DIDCommAction {
+	action.Continue = func(interface{}) {
+		logger.Warnf("%s action event: continue ignored, the event is owned by another subscriber",
+			action.ProtocolName)
+	}
+	action.Stop = func(error) {
+		logger.Warnf("%s action event: stop ignored, the event is owned by another subscriber",
+			action.ProtocolName)
+	}
+
+	if action.Message != nil {
+		action.Message = action.Message.Clone()
+	}
+
+	return action
 }
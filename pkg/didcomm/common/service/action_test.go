@@ -7,11 +7,19 @@ SPDX-License-Identifier: Apache-2.0
 package service
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+type connectionProps string
+
+func (p connectionProps) ConnectionID() string {
+	return string(p)
+}
+
 func TestAction_ActionEvent(t *testing.T) {
 	a := Action{}
 	require.Nil(t, a.ActionEvent())
@@ -22,14 +30,15 @@ func TestAction_RegisterActionEvent(t *testing.T) {
 	// nil error
 	require.EqualError(t, a.RegisterActionEvent(nil), ErrNilChannel.Error())
 
-	// channel should be the same
 	ch := make(chan DIDCommAction)
 	require.Nil(t, a.RegisterActionEvent(ch))
-	require.EqualValues(t, ch, a.ActionEvent())
+	require.NotNil(t, a.ActionEvent())
 
 	// register the same channel twice
-	newCh := make(chan DIDCommAction)
-	require.EqualError(t, a.RegisterActionEvent(newCh), ErrChannelRegistered.Error())
+	require.EqualError(t, a.RegisterActionEvent(ch), ErrChannelRegistered.Error())
+
+	// multiple channels
+	require.Nil(t, a.RegisterActionEvent(make(chan DIDCommAction)))
 }
 
 func TestAction_UnregisterActionEvent(t *testing.T) {
@@ -45,4 +54,219 @@ func TestAction_UnregisterActionEvent(t *testing.T) {
 	// happy path
 	require.Nil(t, a.RegisterActionEvent(ch))
 	require.Nil(t, a.UnregisterActionEvent(ch))
+	require.Nil(t, a.ActionEvent())
+}
+
+func TestAction_PublishActionEvent(t *testing.T) {
+	var (
+		continued []interface{}
+		stopped   []error
+	)
+
+	newAction := func() DIDCommAction {
+		return DIDCommAction{
+			ProtocolName: "didexchange",
+			StateID:      "requested",
+			Message:      &DIDCommMsg{Header: &Header{ID: "ID"}},
+			Continue:     func(args interface{}) { continued = append(continued, args) },
+			Stop:         func(err error) { stopped = append(stopped, err) },
+			Properties:   connectionProps("conn-1"),
+		}
+	}
+
+	t.Run("first matching subscriber owns the action event", func(t *testing.T) {
+		continued, stopped = nil, nil
+		a := Action{}
+
+		observer := make(chan DIDCommAction, 1)
+		other := make(chan DIDCommAction, 1)
+		owner := make(chan DIDCommAction, 1)
+		second := make(chan DIDCommAction, 1)
+
+		require.NoError(t, a.RegisterActionEvent(observer, AsObserver()))
+		require.NoError(t, a.RegisterActionEvent(other, WithProtocols("introduce")))
+		require.NoError(t, a.RegisterActionEvent(owner, WithProtocols("didexchange"), WithStates("requested"),
+			WithConnectionIDs("conn-1")))
+		require.NoError(t, a.RegisterActionEvent(second))
+
+		require.True(t, a.PublishActionEvent(newAction()))
+		require.Empty(t, other)
+
+		(<-observer).Continue("observer")
+		(<-second).Stop(errors.New("second"))
+		require.Empty(t, continued)
+		require.Empty(t, stopped)
+
+		(<-owner).Continue("owner")
+		require.Equal(t, []interface{}{"owner"}, continued)
+	})
+
+	t.Run("no owner", func(t *testing.T) {
+		continued, stopped = nil, nil
+		a := Action{}
+
+		observer := make(chan DIDCommAction, 1)
+		require.NoError(t, a.RegisterActionEvent(observer, AsObserver()))
+		require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction), WithConnectionIDs("conn-2")))
+		require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction), WithStates("invited")))
+
+		require.False(t, a.PublishActionEvent(newAction()))
+		(<-observer).Stop(nil)
+		require.Empty(t, stopped)
+
+		// the connection ID is not provided by the event properties
+		action := newAction()
+		action.Properties = nil
+		require.False(t, a.PublishActionEvent(action))
+		<-observer
+	})
+
+	t.Run("action events sent to the channel are published", func(t *testing.T) {
+		a := Action{}
+
+		first := make(chan DIDCommAction)
+		second := make(chan DIDCommAction)
+
+		require.NoError(t, a.RegisterActionEvent(first))
+		require.NoError(t, a.RegisterActionEvent(second))
+
+		go func() { a.ActionEvent() <- newAction() }()
+
+		for _, ch := range []chan DIDCommAction{first, second} {
+			select {
+			case action := <-ch:
+				require.Equal(t, "didexchange", action.ProtocolName)
+			case <-time.After(time.Second):
+				t.Error("timeout")
+			}
+		}
+	})
+
+	t.Run("unowned action event is re-offered to the next subscriber", func(t *testing.T) {
+		continued, stopped = nil, nil
+		a := Action{}
+
+		require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction), WithProtocols("introduce")))
+
+		// the action event sent to the channel is not owned by any subscriber
+		a.ActionEvent() <- newAction()
+
+		require.Eventually(t, func() bool {
+			a.unownedMu.Lock()
+			defer a.unownedMu.Unlock()
+
+			return len(a.unowned) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		observer := make(chan DIDCommAction, 1)
+		require.NoError(t, a.RegisterActionEvent(observer, AsObserver()))
+
+		select {
+		case <-observer:
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+
+		owner := make(chan DIDCommAction)
+		require.NoError(t, a.RegisterActionEvent(owner))
+
+		select {
+		case action := <-owner:
+			action.Continue("owner")
+			require.Equal(t, []interface{}{"owner"}, continued)
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+
+		a.Close()
+
+		// the action events are not kept once the bus was closed
+		require.False(t, a.PublishActionEvent(newAction()))
+		require.Empty(t, a.unowned)
+	})
+}
+
+func TestAction_SlowObserver(t *testing.T) {
+	a := Action{}
+	defer a.Close()
+
+	// the observer is not reading
+	require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction), AsObserver()))
+
+	owner := make(chan DIDCommAction)
+	require.NoError(t, a.RegisterActionEvent(owner, WithProtocols("didexchange")))
+
+	go func() {
+		for i := 0; i < 2*observedQueueSize; i++ {
+			<-owner
+		}
+	}()
+
+	// the owner receives the action events, the action events queued for the observer are dropped once
+	// the queue is full
+	for i := 0; i < 2*observedQueueSize; i++ {
+		require.True(t, a.PublishActionEvent(DIDCommAction{ProtocolName: "didexchange"}))
+	}
+
+	observed := make(chan DIDCommAction)
+	require.NoError(t, a.RegisterActionEvent(observed, AsObserver()))
+	require.NoError(t, a.UnregisterActionEvent(observed))
+
+	// the action events are not delivered to the unregistered subscriber
+	require.False(t, a.PublishActionEvent(DIDCommAction{ProtocolName: "introduce"}))
+
+	select {
+	case <-observed:
+		require.Fail(t, "the action event was delivered to the unregistered subscriber")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestAction_Close(t *testing.T) {
+	t.Run("the dispatcher is stopped", func(t *testing.T) {
+		a := Action{}
+
+		// the subscriber is not reading
+		require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction)))
+
+		publish := a.ActionEvent()
+		publish <- DIDCommAction{ProtocolName: "didexchange"}
+
+		a.Close()
+		a.Close()
+		require.Nil(t, a.ActionEvent())
+
+		// the dispatcher blocked by the subscriber exits, nobody receives the action events anymore
+		for i := 0; ; i++ {
+			require.True(t, i < 1000, "the dispatcher was not stopped")
+
+			select {
+			case publish <- DIDCommAction{ProtocolName: "didexchange"}:
+				continue
+			case <-time.After(time.Millisecond):
+			}
+
+			break
+		}
+	})
+
+	t.Run("the action event is not delivered after close", func(t *testing.T) {
+		a := Action{}
+
+		require.NoError(t, a.RegisterActionEvent(make(chan DIDCommAction)))
+		a.Close()
+
+		require.False(t, a.PublishActionEvent(DIDCommAction{ProtocolName: "didexchange"}))
+	})
+
+	t.Run("the action event is not delivered to the ready subscriber after close", func(t *testing.T) {
+		a := Action{}
+
+		ch := make(chan DIDCommAction, 1)
+		require.NoError(t, a.RegisterActionEvent(ch))
+		a.Close()
+
+		require.False(t, a.PublishActionEvent(DIDCommAction{ProtocolName: "didexchange"}))
+		require.Empty(t, ch)
+	})
 }
@@ -54,6 +54,9 @@ type DIDCommAction struct {
 	// DIDComm message
 	Message *DIDCommMsg
 
+	// current state of the protocol thread, empty if the protocol does not report it.
+	StateID string
+
 	// Continue function to be called by the consumer for further processing the message.
 	Continue func(args interface{})
 
@@ -76,16 +79,17 @@ type EventProperties interface{}
 type Event interface {
 	// RegisterActionEvent on protocol messages. The events are triggered for incoming message types based on
 	// the protocol service. The consumer need to invoke the callback to resume processing.
-	// Only one channel can be registered for the action events. The function will throw error if a channel is already
-	// registered.
-	RegisterActionEvent(ch chan<- DIDCommAction) error
+	// Multiple channels can be registered for the action events, the options filter the delivered events.
+	// The first matching subscriber which is not registered AsObserver owns the Continue and Stop functions,
+	// refer service.Action. The function will throw error if the channel is already registered.
+	RegisterActionEvent(ch chan<- DIDCommAction, opts ...EventOption) error
 
 	// UnregisterActionEvent on protocol messages. Refer RegisterActionEvent().
 	UnregisterActionEvent(ch chan<- DIDCommAction) error
 
 	// RegisterMsgEvent on protocol messages. The message events are triggered for incoming messages. Service
-	// will not expect any callback on these events unlike Action event.
-	RegisterMsgEvent(ch chan<- StateMsg) error
+	// will not expect any callback on these events unlike Action event. The options filter the delivered events.
+	RegisterMsgEvent(ch chan<- StateMsg, opts ...EventOption) error
 
 	// UnregisterMsgEvent on protocol messages. Refer RegisterMsgEvent().
 	UnregisterMsgEvent(ch chan<- StateMsg) error
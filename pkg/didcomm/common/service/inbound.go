@@ -0,0 +1,53 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package service
+
+import "context"
+
+// InboundContext contains the details of the inbound message which are not part of the message itself.
+type InboundContext struct {
+	// SenderVerKey is the key the sender packed the message with.
+	SenderVerKey string
+	// RecipientVerKeys are the keys the message was packed for.
+	RecipientVerKeys []string
+	// Connection is the connection record of the sender, nil if the sender key does not belong to any
+	// connection of the agent. The record is resolved by the ConnectionResolver of the framework,
+	// e.g. the didexchange service resolves it to *didexchange.ConnectionRecord.
+	Connection interface{}
+	// MessageTypePrefix is the aliased prefix the sender used for the message type before it was normalized,
+	// e.g. the legacy prefix, empty for the canonical prefix.
+	MessageTypePrefix string
+}
+
+// ConnectionResolver is implemented by the services which manage the connections of the agent. The framework
+// uses it to resolve the connection of the inbound messages.
+type ConnectionResolver interface {
+	// ResolveConnection returns the connection record of the sender key, nil if there is no such connection.
+	ResolveConnection(senderVerKey string, recipientVerKeys []string) (interface{}, error)
+}
+
+// DestinationResolver is implemented by the services which can find the destination of the sender in the message,
+// e.g. the didexchange service reads it from the DID document of the request. The framework uses it to send
+// the problem reports to the senders which have no connection with the agent.
+type DestinationResolver interface {
+	// ResolveDestination returns the destination of the sender of the message, nil if the message has none.
+	// The resolution is aborted when the context is done.
+	ResolveDestination(ctx context.Context, msg *DIDCommMsg) (*Destination, error)
+}
+
+func (c *InboundContext) clone() *InboundContext {
+	if c == nil {
+		return nil
+	}
+
+	return &InboundContext{
+		SenderVerKey:      c.SenderVerKey,
+		RecipientVerKeys:  append(c.RecipientVerKeys[:0:0], c.RecipientVerKeys...),
+		Connection:        c.Connection,
+		MessageTypePrefix: c.MessageTypePrefix,
+	}
+}
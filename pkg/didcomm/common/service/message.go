@@ -8,30 +8,53 @@ package service
 
 import "sync"
 
-// Message thread-safe message register structure
+// Message thread-safe message event bus. The message events are delivered to every subscriber channel
+// matching the event.
 type Message struct {
-	mu     sync.RWMutex
-	events []chan<- StateMsg
+	mu          sync.RWMutex
+	subscribers []*msgSubscriber
+}
+
+type msgSubscriber struct {
+	subscription
+	ch chan<- StateMsg
 }
 
 // MsgEvents returns event message channels
 func (m *Message) MsgEvents() []chan<- StateMsg {
 	m.mu.RLock()
-	events := append(m.events[:0:0], m.events...)
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
+
+	var events []chan<- StateMsg
+	for _, s := range m.subscribers {
+		events = append(events, s.ch)
+	}
 
 	return events
 }
 
+// SendMsgEvent delivers the message event to the subscribers matching the event.
+func (m *Message) SendMsgEvent(msg StateMsg) {
+	m.mu.RLock()
+	subscribers := append(m.subscribers[:0:0], m.subscribers...)
+	m.mu.RUnlock()
+
+	for _, s := range subscribers {
+		if s.match(msg.ProtocolName, msg.StateID, msg.Properties) {
+			s.ch <- msg
+		}
+	}
+}
+
 // RegisterMsgEvent on protocol messages. The message events are triggered for incoming messages. Event
-// will not expect any callback on these events unlike Action events.
-func (m *Message) RegisterMsgEvent(ch chan<- StateMsg) error {
+// will not expect any callback on these events unlike Action events. The options filter the delivered events.
+func (m *Message) RegisterMsgEvent(ch chan<- StateMsg, opts ...EventOption) error {
 	if ch == nil {
 		return ErrNilChannel
 	}
 
 	m.mu.Lock()
-	m.events = append(m.events, ch)
+	m.subscribers = append(m.subscribers, &msgSubscriber{subscription: newSubscription(opts), ch: ch})
 	m.mu.Unlock()
 
 	return nil
@@ -40,9 +63,9 @@ func (m *Message) RegisterMsgEvent(ch chan<- StateMsg) error {
 // UnregisterMsgEvent on protocol messages. Refer RegisterMsgEvent().
 func (m *Message) UnregisterMsgEvent(ch chan<- StateMsg) error {
 	m.mu.Lock()
-	for i := 0; i < len(m.events); i++ {
-		if m.events[i] == ch {
-			m.events = append(m.events[:i], m.events[i+1:]...)
+	for i := 0; i < len(m.subscribers); i++ {
+		if m.subscribers[i].ch == ch {
+			m.subscribers = append(m.subscribers[:i], m.subscribers[i+1:]...)
 			i--
 		}
 	}
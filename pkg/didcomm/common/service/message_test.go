@@ -51,3 +51,74 @@ func TestAction_UnregisterMsgEvent(t *testing.T) {
 	// no error if nothing to unregister
 	require.Nil(t, m.UnregisterMsgEvent(ch))
 }
+
+func TestMessage_SendMsgEvent(t *testing.T) {
+	m := Message{}
+
+	all := make(chan StateMsg, 1)
+	exchange := make(chan StateMsg, 1)
+	responded := make(chan StateMsg, 1)
+	connection := make(chan StateMsg, 1)
+
+	require.NoError(t, m.RegisterMsgEvent(all))
+	require.NoError(t, m.RegisterMsgEvent(exchange, WithProtocols("didexchange")))
+	require.NoError(t, m.RegisterMsgEvent(responded, WithStates("responded")))
+	require.NoError(t, m.RegisterMsgEvent(connection, WithConnectionIDs("conn-1")))
+
+	m.SendMsgEvent(StateMsg{ProtocolName: "didexchange", StateID: "requested", Properties: connectionProps("conn-1")})
+	require.Len(t, all, 1)
+	require.Len(t, exchange, 1)
+	require.Len(t, responded, 0)
+	require.Len(t, connection, 1)
+
+	<-all
+	<-exchange
+	<-connection
+
+	m.SendMsgEvent(StateMsg{ProtocolName: "introduce", StateID: "responded"})
+	require.Len(t, all, 1)
+	require.Len(t, exchange, 0)
+	require.Len(t, responded, 1)
+	require.Len(t, connection, 0)
+}
+
+func TestMessage_SendMsgEventWithInvitationIDs(t *testing.T) {
+	m := Message{}
+
+	invitation := make(chan StateMsg, 1)
+	both := make(chan StateMsg, 1)
+
+	require.NoError(t, m.RegisterMsgEvent(invitation, WithInvitationIDs("inv-1")))
+	require.NoError(t, m.RegisterMsgEvent(both, WithConnectionIDs("conn-1"), WithInvitationIDs("inv-1")))
+
+	m.SendMsgEvent(StateMsg{Properties: exchangeProps{connectionID: "conn-1", invitationID: "inv-1"}})
+	require.Len(t, invitation, 1)
+	require.Len(t, both, 1)
+
+	<-invitation
+	<-both
+
+	m.SendMsgEvent(StateMsg{Properties: exchangeProps{connectionID: "conn-2", invitationID: "inv-1"}})
+	require.Len(t, invitation, 1)
+	require.Len(t, both, 0)
+
+	<-invitation
+
+	// the events without the invitation ID are not delivered
+	m.SendMsgEvent(StateMsg{Properties: connectionProps("conn-1")})
+	require.Len(t, invitation, 0)
+	require.Len(t, both, 0)
+}
+
+type exchangeProps struct {
+	connectionID string
+	invitationID string
+}
+
+func (p exchangeProps) ConnectionID() string {
+	return p.connectionID
+}
+
+func (p exchangeProps) InvitationID() string {
+	return p.invitationID
+}
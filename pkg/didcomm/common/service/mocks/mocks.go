@@ -63,31 +63,41 @@ func (mr *MockDIDCommMockRecorder) HandleOutbound(arg0, arg1 interface{}) *gomoc
 }
 
 // RegisterActionEvent mocks base method
-func (m *MockDIDComm) RegisterActionEvent(arg0 chan<- service.DIDCommAction) error {
+func (m *MockDIDComm) RegisterActionEvent(arg0 chan<- service.DIDCommAction, arg1 ...service.EventOption) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RegisterActionEvent", arg0)
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RegisterActionEvent", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RegisterActionEvent indicates an expected call of RegisterActionEvent
-func (mr *MockDIDCommMockRecorder) RegisterActionEvent(arg0 interface{}) *gomock.Call {
+func (mr *MockDIDCommMockRecorder) RegisterActionEvent(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterActionEvent", reflect.TypeOf((*MockDIDComm)(nil).RegisterActionEvent), arg0)
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterActionEvent", reflect.TypeOf((*MockDIDComm)(nil).RegisterActionEvent), varargs...)
 }
 
 // RegisterMsgEvent mocks base method
-func (m *MockDIDComm) RegisterMsgEvent(arg0 chan<- service.StateMsg) error {
+func (m *MockDIDComm) RegisterMsgEvent(arg0 chan<- service.StateMsg, arg1 ...service.EventOption) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RegisterMsgEvent", arg0)
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "RegisterMsgEvent", varargs...)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RegisterMsgEvent indicates an expected call of RegisterMsgEvent
-func (mr *MockDIDCommMockRecorder) RegisterMsgEvent(arg0 interface{}) *gomock.Call {
+func (mr *MockDIDCommMockRecorder) RegisterMsgEvent(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterMsgEvent", reflect.TypeOf((*MockDIDComm)(nil).RegisterMsgEvent), arg0)
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterMsgEvent", reflect.TypeOf((*MockDIDComm)(nil).RegisterMsgEvent), varargs...)
 }
 
 // UnregisterActionEvent mocks base method
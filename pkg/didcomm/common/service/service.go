@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -21,6 +22,49 @@ type Handler interface {
 	HandleOutbound(msg *DIDCommMsg, dest *Destination) error
 }
 
+// InboundContextHandler is implemented by the services handling the inbound messages with the context
+// of the request. The context is cancelled when the request is done, it must not be used for the processing
+// continuing after the call returns.
+type InboundContextHandler interface {
+	// HandleInboundContext handles inbound messages.
+	HandleInboundContext(ctx context.Context, msg *DIDCommMsg) (string, error)
+}
+
+// OutboundContextHandler is implemented by the services sending the outbound messages with the context
+// of the request, the sending is aborted when the context is done.
+type OutboundContextHandler interface {
+	// HandleOutboundContext handles outbound messages.
+	HandleOutboundContext(ctx context.Context, msg *DIDCommMsg, dest *Destination) error
+}
+
+// HandleInboundContext passes the inbound message with the context to the handler. The handlers not implementing
+// InboundContextHandler cannot be cancelled, the context is only checked before the message is passed to them.
+func HandleInboundContext(ctx context.Context, h Handler, msg *DIDCommMsg) (string, error) {
+	if ch, ok := h.(InboundContextHandler); ok {
+		return ch.HandleInboundContext(ctx, msg)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return h.HandleInbound(msg)
+}
+
+// HandleOutboundContext passes the outbound message with the context to the handler. The handlers not implementing
+// OutboundContextHandler cannot be cancelled, the context is only checked before the message is passed to them.
+func HandleOutboundContext(ctx context.Context, h Handler, msg *DIDCommMsg, dest *Destination) error {
+	if ch, ok := h.(OutboundContextHandler); ok {
+		return ch.HandleOutboundContext(ctx, msg, dest)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return h.HandleOutbound(msg, dest)
+}
+
 // DIDComm defines service APIs.
 type DIDComm interface {
 	// service handler
@@ -55,6 +99,8 @@ func (h *Header) clone() *Header {
 type DIDCommMsg struct {
 	Header  *Header
 	Payload []byte
+	// Inbound is set by the framework for the received messages, nil for the messages created by the agent.
+	Inbound *InboundContext
 }
 
 // Clone creates new DIDCommMsg with the same data
@@ -68,6 +114,7 @@ func (m *DIDCommMsg) Clone() *DIDCommMsg {
 	return &DIDCommMsg{
 		Header:  m.Header.clone(),
 		Payload: append(m.Payload[:0:0], m.Payload...),
+		Inbound: m.Inbound.clone(),
 	}
 }
 
@@ -113,4 +160,12 @@ type Destination struct {
 	RecipientKeys   []string
 	ServiceEndpoint string
 	RoutingKeys     []string
+	// Fallbacks are the destinations of the other DIDComm services of the recipient ordered by priority,
+	// they are tried in turn if the message could not be sent to the ServiceEndpoint.
+	Fallbacks []*Destination
+}
+
+// Endpoints returns the destination followed by its fallbacks.
+func (d *Destination) Endpoints() []*Destination {
+	return append([]*Destination{d}, d.Fallbacks...)
 }
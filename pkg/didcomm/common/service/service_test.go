@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package service
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -124,4 +125,90 @@ func TestDIDCommMsg_Clone(t *testing.T) {
 	// modifies Header
 	didMsg.Header.ID = "newID"
 	require.NotEqual(t, didMsg, cloned)
+
+	// clone DIDCommMsg with Payload and InboundContext
+	didMsg = &DIDCommMsg{Payload: []byte{0x1}, Inbound: &InboundContext{
+		SenderVerKey:     "sender",
+		RecipientVerKeys: []string{"recipient"},
+	}}
+	cloned = didMsg.Clone()
+	require.Equal(t, didMsg, cloned)
+	// modifies InboundContext
+	didMsg.Inbound.RecipientVerKeys[0] = "other"
+	require.NotEqual(t, didMsg, cloned)
+}
+
+func TestDestination_Endpoints(t *testing.T) {
+	des := &Destination{ServiceEndpoint: "primary"}
+	require.Equal(t, []*Destination{des}, des.Endpoints())
+
+	fallback := &Destination{ServiceEndpoint: "fallback"}
+	des.Fallbacks = []*Destination{fallback}
+	require.Equal(t, []*Destination{des, fallback}, des.Endpoints())
+}
+
+func TestHandleContext(t *testing.T) {
+	type key struct{}
+
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	msg := &DIDCommMsg{Header: &Header{Type: "type"}}
+
+	t.Run("test context handler", func(t *testing.T) {
+		h := &contextHandler{}
+
+		_, err := HandleInboundContext(ctx, h, msg)
+		require.NoError(t, err)
+		require.Equal(t, "value", h.ctx.Value(key{}))
+
+		h.ctx = nil
+
+		require.NoError(t, HandleOutboundContext(ctx, h, msg, &Destination{}))
+		require.Equal(t, "value", h.ctx.Value(key{}))
+	})
+
+	t.Run("test handler", func(t *testing.T) {
+		h := &handler{}
+
+		_, err := HandleInboundContext(ctx, h, msg)
+		require.NoError(t, err)
+		require.NoError(t, HandleOutboundContext(ctx, h, msg, &Destination{}))
+		require.Equal(t, 2, h.calls)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err = HandleInboundContext(cancelled, h, msg)
+		require.Equal(t, context.Canceled, err)
+		require.Equal(t, context.Canceled, HandleOutboundContext(cancelled, h, msg, &Destination{}))
+		require.Equal(t, 2, h.calls)
+	})
+}
+
+type handler struct {
+	calls int
+}
+
+func (h *handler) HandleInbound(*DIDCommMsg) (string, error) {
+	h.calls++
+	return "", nil
+}
+
+func (h *handler) HandleOutbound(*DIDCommMsg, *Destination) error {
+	h.calls++
+	return nil
+}
+
+type contextHandler struct {
+	handler
+	ctx context.Context
+}
+
+func (h *contextHandler) HandleInboundContext(ctx context.Context, _ *DIDCommMsg) (string, error) {
+	h.ctx = ctx
+	return "", nil
+}
+
+func (h *contextHandler) HandleOutboundContext(ctx context.Context, _ *DIDCommMsg, _ *Destination) error {
+	h.ctx = ctx
+	return nil
 }
@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package service
+
+// EventOption configures the subscription of the action or message event channel.
+type EventOption func(s *subscription)
+
+// WithProtocols delivers only the events of the given protocols, e.g. didexchange.DIDExchange.
+func WithProtocols(names ...string) EventOption {
+	return func(s *subscription) {
+		s.protocols = names
+	}
+}
+
+// WithStates delivers only the events of the given states, e.g. "requested".
+func WithStates(states ...string) EventOption {
+	return func(s *subscription) {
+		s.states = states
+	}
+}
+
+// WithConnectionIDs delivers only the events of the given connections. The connection ID is read from
+// the event properties, the events without the connection ID (e.g. introduce) are not delivered.
+func WithConnectionIDs(ids ...string) EventOption {
+	return func(s *subscription) {
+		s.connectionIDs = ids
+	}
+}
+
+// WithInvitationIDs delivers only the events of the connections created from the given invitations. The invitation
+// ID is read from the event properties, the events without the invitation ID are not delivered.
+func WithInvitationIDs(ids ...string) EventOption {
+	return func(s *subscription) {
+		s.invitationIDs = ids
+	}
+}
+
+// AsObserver subscribes the action event channel without the ownership of the action events. Observers
+// receive the action events but the Continue and Stop functions passed to them have no effect.
+func AsObserver() EventOption {
+	return func(s *subscription) {
+		s.observer = true
+	}
+}
+
+// subscription is the filter of the events delivered to the subscriber channel.
+type subscription struct {
+	protocols     []string
+	states        []string
+	connectionIDs []string
+	invitationIDs []string
+	observer      bool
+}
+
+func newSubscription(opts []EventOption) subscription {
+	s := subscription{}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return s
+}
+
+func (s *subscription) match(protocol, state string, props EventProperties) bool {
+	if !contains(s.protocols, protocol) || !contains(s.states, state) {
+		return false
+	}
+
+	if len(s.connectionIDs) != 0 {
+		conn, ok := props.(interface{ ConnectionID() string })
+		if !ok || !contains(s.connectionIDs, conn.ConnectionID()) {
+			return false
+		}
+	}
+
+	if len(s.invitationIDs) != 0 {
+		inv, ok := props.(interface{ InvitationID() string })
+		if !ok || !contains(s.invitationIDs, inv.InvitationID()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contains returns true if the list is empty or contains the value.
+func contains(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package workerpool
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+)
+
+// DefaultRetryAfter is the default time the senders are asked to wait before retrying the rejected message.
+const DefaultRetryAfter = 5 * time.Second
+
+type config struct {
+	workers   int
+	queueSize int
+}
+
+// Pools holds the worker pools of the protocol services by the service name, the pool is created on the first use.
+// The nil Pools returns the nil pools.
+type Pools struct {
+	mu         sync.Mutex
+	defaults   config
+	configs    map[string]config
+	pools      map[string]*Pool
+	retryAfter time.Duration
+	metrics    metrics.Sink
+	stopped    bool
+}
+
+// Option configures the Pools.
+type Option func(p *Pools)
+
+// WithDefaultPool sets the number of workers and the queue size of the pools not configured by WithPool.
+func WithDefaultPool(workers, queueSize int) Option {
+	return func(p *Pools) {
+		p.defaults = config{workers: workers, queueSize: queueSize}
+	}
+}
+
+// WithPool sets the number of workers and the queue size of the pool of the given service.
+func WithPool(name string, workers, queueSize int) Option {
+	return func(p *Pools) {
+		p.configs[name] = config{workers: workers, queueSize: queueSize}
+	}
+}
+
+// WithRetryAfter sets the time the senders are asked to wait before retrying the message rejected
+// because the pool queue was full.
+func WithRetryAfter(retryAfter time.Duration) Option {
+	return func(p *Pools) {
+		p.retryAfter = retryAfter
+	}
+}
+
+// WithMetrics sets the sink receiving the gauges of the pools, e.g. the queue depth, labeled by the pool name.
+func WithMetrics(sink metrics.Sink) Option {
+	return func(p *Pools) {
+		if sink != nil {
+			p.metrics = sink
+		}
+	}
+}
+
+// NewPools returns new Pools.
+func NewPools(opts ...Option) *Pools {
+	p := &Pools{
+		defaults:   config{workers: DefaultWorkers, queueSize: DefaultQueueSize},
+		configs:    make(map[string]config),
+		pools:      make(map[string]*Pool),
+		retryAfter: DefaultRetryAfter,
+		metrics:    metrics.Nop,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Pool returns the pool of the given service.
+func (p *Pools) Pool(name string) *Pool {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pool, ok := p.pools[name]
+	if !ok {
+		cfg, ok := p.configs[name]
+		if !ok {
+			cfg = p.defaults
+		}
+
+		pool = newPool(name, cfg.workers, cfg.queueSize, p.metrics)
+		p.pools[name] = pool
+
+		// the pools created after the Pools were stopped reject the tasks
+		if p.stopped {
+			pool.Stop()
+		}
+	}
+
+	return pool
+}
+
+// RetryAfter returns the time the senders are asked to wait before retrying the rejected message.
+func (p *Pools) RetryAfter() time.Duration {
+	if p == nil {
+		return DefaultRetryAfter
+	}
+
+	return p.retryAfter
+}
+
+// Metrics returns the metrics of the pools ordered by the service name.
+func (p *Pools) Metrics() []Metrics {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	metrics := make([]Metrics, 0, len(p.pools))
+
+	for _, pool := range p.pools {
+		metrics = append(metrics, pool.Metrics())
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	return metrics
+}
+
+// Stop stops the pools, it waits until the queued and running tasks are done.
+func (p *Pools) Stop() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+
+	p.stopped = true
+
+	pools := make([]*Pool, 0, len(p.pools))
+	for _, pool := range p.pools {
+		pools = append(pools, pool)
+	}
+
+	p.mu.Unlock()
+
+	// the running tasks might use the Pools, e.g. to report the metrics
+	for _, pool := range pools {
+		pool.Stop()
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+)
+
+const (
+	// DefaultWorkers is the default number of workers of the pool.
+	DefaultWorkers = 10
+	// DefaultQueueSize is the default number of tasks waiting for a worker.
+	DefaultQueueSize = 100
+)
+
+var (
+	// ErrQueueFull is returned when the task is rejected because all workers are busy and the queue is full.
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrStopped is returned when the task is submitted to the stopped pool.
+	ErrStopped = errors.New("worker pool is stopped")
+)
+
+// Metrics is the snapshot of the worker pool state.
+type Metrics struct {
+	Name string `json:"name"`
+	// Workers is the number of workers of the pool.
+	Workers int `json:"workers"`
+	// QueueSize is the capacity of the queue.
+	QueueSize int `json:"queue_size"`
+	// QueueDepth is the number of tasks waiting for a worker.
+	QueueDepth int `json:"queue_depth"`
+	// Active is the number of tasks being run.
+	Active int `json:"active"`
+	// Processed is the number of tasks run since the pool was started.
+	Processed uint64 `json:"processed"`
+	// Rejected is the number of tasks rejected because the queue was full.
+	Rejected uint64 `json:"rejected"`
+}
+
+// Pool runs the tasks with a fixed number of workers, the tasks wait for a free worker in the bounded queue.
+// The nil pool runs every task in a new goroutine.
+type Pool struct {
+	// the counters are accessed atomically, they are kept first for the 64-bit alignment
+	processed uint64
+	rejected  uint64
+	active    int64
+	name      string
+	workers   int
+	queue     chan func()
+	mu        sync.RWMutex
+	stopped   bool
+	wg        sync.WaitGroup
+	// metrics receives the gauges of the queue and the workers labeled by the pool name
+	metrics metrics.Sink
+	labels  metrics.Labels
+}
+
+// New returns a new pool and starts the workers. The queue of size 0 accepts the task only if a worker is idle.
+func New(name string, workers, queueSize int) *Pool {
+	return newPool(name, workers, queueSize, metrics.Nop)
+}
+
+// newPool returns a new pool reporting its gauges to the metrics sink.
+func newPool(name string, workers, queueSize int, sink metrics.Sink) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &Pool{
+		name:    name,
+		workers: workers,
+		queue:   make(chan func(), queueSize),
+		metrics: sink,
+		labels:  metrics.Labels{"pool": name},
+	}
+
+	p.metrics.AddGauge(metrics.WorkerPoolWorkers, float64(workers), p.labels)
+	p.metrics.AddGauge(metrics.WorkerPoolQueueSize, float64(queueSize), p.labels)
+
+	p.wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Submit queues the task without blocking. ErrQueueFull is returned when all workers are busy
+// and the queue is full, the caller should apply the backpressure, e.g. ask the sender to retry later.
+func (p *Pool) Submit(task func()) error {
+	if p == nil {
+		go task()
+
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return ErrStopped
+	}
+
+	// the task is counted before it is queued, the worker might take it before the send returns
+	p.metrics.AddGauge(metrics.WorkerPoolQueueDepth, 1, p.labels)
+
+	select {
+	case p.queue <- task:
+		return nil
+	default:
+		atomic.AddUint64(&p.rejected, 1)
+		p.metrics.AddGauge(metrics.WorkerPoolQueueDepth, -1, p.labels)
+		p.metrics.IncCounter(metrics.WorkerPoolRejected, p.labels)
+
+		return ErrQueueFull
+	}
+}
+
+// SubmitWait queues the task, it blocks until the task is queued or the context is done.
+func (p *Pool) SubmitWait(ctx context.Context, task func()) error {
+	if p == nil {
+		go task()
+
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return ErrStopped
+	}
+
+	p.metrics.AddGauge(metrics.WorkerPoolQueueDepth, 1, p.labels)
+
+	select {
+	case p.queue <- task:
+		return nil
+	case <-ctx.Done():
+		p.metrics.AddGauge(metrics.WorkerPoolQueueDepth, -1, p.labels)
+
+		return ctx.Err()
+	}
+}
+
+// Metrics returns the snapshot of the pool state.
+func (p *Pool) Metrics() Metrics {
+	if p == nil {
+		return Metrics{}
+	}
+
+	return Metrics{
+		Name:       p.name,
+		Workers:    p.workers,
+		QueueSize:  cap(p.queue),
+		QueueDepth: len(p.queue),
+		Active:     int(atomic.LoadInt64(&p.active)),
+		Processed:  atomic.LoadUint64(&p.processed),
+		Rejected:   atomic.LoadUint64(&p.rejected),
+	}
+}
+
+// Stop stops accepting the tasks and waits until the queued and running tasks are done.
+func (p *Pool) Stop() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+
+	stopping := !p.stopped
+
+	if stopping {
+		p.stopped = true
+		close(p.queue)
+	}
+
+	p.mu.Unlock()
+
+	p.wg.Wait()
+
+	// the stopped pool has no capacity, the pool replacing it reports its own
+	if stopping {
+		p.metrics.AddGauge(metrics.WorkerPoolWorkers, -float64(p.workers), p.labels)
+		p.metrics.AddGauge(metrics.WorkerPoolQueueSize, -float64(cap(p.queue)), p.labels)
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for task := range p.queue {
+		p.metrics.AddGauge(metrics.WorkerPoolQueueDepth, -1, p.labels)
+		p.run(task)
+	}
+}
+
+func (p *Pool) run(task func()) {
+	atomic.AddInt64(&p.active, 1)
+	p.metrics.AddGauge(metrics.WorkerPoolActive, 1, p.labels)
+
+	defer func() {
+		atomic.AddInt64(&p.active, -1)
+		atomic.AddUint64(&p.processed, 1)
+		p.metrics.AddGauge(metrics.WorkerPoolActive, -1, p.labels)
+	}()
+
+	task()
+}
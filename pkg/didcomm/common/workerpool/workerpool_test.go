@@ -0,0 +1,199 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package workerpool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+)
+
+func TestPool(t *testing.T) {
+	t.Run("test tasks are run by the workers", func(t *testing.T) {
+		p := New("test", 2, 10)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			require.NoError(t, p.Submit(wg.Done))
+		}
+
+		wg.Wait()
+		p.Stop()
+
+		metrics := p.Metrics()
+		require.Equal(t, "test", metrics.Name)
+		require.Equal(t, 2, metrics.Workers)
+		require.Equal(t, 10, metrics.QueueSize)
+		require.Equal(t, uint64(10), metrics.Processed)
+		require.Zero(t, metrics.Rejected)
+	})
+
+	t.Run("test queue full", func(t *testing.T) {
+		p := New("test", 1, 1)
+
+		started, release := make(chan struct{}), make(chan struct{})
+
+		require.NoError(t, p.Submit(func() {
+			close(started)
+			<-release
+		}))
+
+		<-started
+
+		// the worker is busy, the task waits in the queue
+		require.NoError(t, p.Submit(func() {}))
+
+		err := p.Submit(func() {})
+		require.True(t, errors.Is(err, ErrQueueFull))
+
+		metrics := p.Metrics()
+		require.Equal(t, 1, metrics.Active)
+		require.Equal(t, 1, metrics.QueueDepth)
+		require.Equal(t, uint64(1), metrics.Rejected)
+
+		// the task waiting for the free worker is not queued before the context is done
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		require.Equal(t, context.DeadlineExceeded, p.SubmitWait(ctx, func() {}))
+
+		close(release)
+		p.Stop()
+
+		require.Equal(t, uint64(2), p.Metrics().Processed)
+	})
+
+	t.Run("test submit wait", func(t *testing.T) {
+		p := New("test", 1, 0)
+
+		done := make(chan struct{})
+		require.NoError(t, p.SubmitWait(context.Background(), func() { close(done) }))
+
+		<-done
+		p.Stop()
+	})
+
+	t.Run("test stopped", func(t *testing.T) {
+		p := New("test", 0, -1)
+		p.Stop()
+		p.Stop()
+
+		require.Equal(t, ErrStopped, p.Submit(func() {}))
+		require.Equal(t, ErrStopped, p.SubmitWait(context.Background(), func() {}))
+		require.Equal(t, 1, p.Metrics().Workers)
+		require.Zero(t, p.Metrics().QueueSize)
+	})
+
+	t.Run("test nil pool", func(t *testing.T) {
+		var p *Pool
+
+		var wg sync.WaitGroup
+
+		wg.Add(2)
+		require.NoError(t, p.Submit(wg.Done))
+		require.NoError(t, p.SubmitWait(context.Background(), wg.Done))
+		wg.Wait()
+
+		require.Equal(t, Metrics{}, p.Metrics())
+		p.Stop()
+	})
+}
+
+func TestPools(t *testing.T) {
+	t.Run("test pools are configured by the service name", func(t *testing.T) {
+		pools := NewPools(WithDefaultPool(2, 3), WithPool("second", 4, 5), WithRetryAfter(time.Minute))
+		defer pools.Stop()
+
+		second, first := pools.Pool("second"), pools.Pool("first")
+		require.True(t, first == pools.Pool("first"))
+
+		require.Equal(t, []Metrics{
+			{Name: "first", Workers: 2, QueueSize: 3},
+			{Name: "second", Workers: 4, QueueSize: 5},
+		}, pools.Metrics())
+		require.Equal(t, time.Minute, pools.RetryAfter())
+
+		pools.Stop()
+		require.Equal(t, ErrStopped, first.Submit(func() {}))
+		require.Equal(t, ErrStopped, second.Submit(func() {}))
+		require.Equal(t, ErrStopped, pools.Pool("third").Submit(func() {}))
+	})
+
+	t.Run("test defaults", func(t *testing.T) {
+		pools := NewPools()
+		defer pools.Stop()
+
+		metrics := pools.Pool("test").Metrics()
+		require.Equal(t, DefaultWorkers, metrics.Workers)
+		require.Equal(t, DefaultQueueSize, metrics.QueueSize)
+		require.Equal(t, DefaultRetryAfter, pools.RetryAfter())
+	})
+
+	t.Run("test nil pools", func(t *testing.T) {
+		var pools *Pools
+
+		require.Nil(t, pools.Pool("test"))
+		require.Nil(t, pools.Metrics())
+		require.Equal(t, DefaultRetryAfter, pools.RetryAfter())
+		pools.Stop()
+	})
+}
+
+func TestPools_Gauges(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	pools := NewPools(WithMetrics(registry), WithPool("test", 1, 1))
+	defer pools.Stop()
+
+	p := pools.Pool("test")
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	require.NoError(t, p.Submit(func() {
+		close(started)
+		<-release
+	}))
+
+	<-started
+
+	require.NoError(t, p.Submit(func() {}))
+	require.True(t, errors.Is(p.Submit(func() {}), ErrQueueFull))
+
+	export := func() string {
+		var buf bytes.Buffer
+		require.NoError(t, registry.WritePrometheus(&buf))
+
+		return buf.String()
+	}
+
+	// the gauges of the pool are exported with the other metrics
+	exported := export()
+	require.Contains(t, exported, `aries_worker_pool_workers{pool="test"} 1`)
+	require.Contains(t, exported, `aries_worker_pool_queue_size{pool="test"} 1`)
+	require.Contains(t, exported, `aries_worker_pool_queue_depth{pool="test"} 1`)
+	require.Contains(t, exported, `aries_worker_pool_active{pool="test"} 1`)
+	require.Contains(t, exported, `aries_worker_pool_rejected_total{pool="test"} 1`)
+
+	close(release)
+	pools.Stop()
+
+	// the stopped pool has no capacity and no tasks
+	exported = export()
+	require.Contains(t, exported, `aries_worker_pool_workers{pool="test"} 0`)
+	require.Contains(t, exported, `aries_worker_pool_queue_size{pool="test"} 0`)
+	require.Contains(t, exported, `aries_worker_pool_queue_depth{pool="test"} 0`)
+	require.Contains(t, exported, `aries_worker_pool_active{pool="test"} 0`)
+}
@@ -7,6 +7,8 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	"context"
+
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 )
 
@@ -17,7 +19,50 @@ type Service interface {
 	Name() string
 }
 
+// Starter is implemented by the services which must be started before the messages are dispatched to them.
+// The service is started when it is registered.
+type Starter interface {
+	Start() error
+}
+
+// VersionedService is implemented by the services declaring the protocol versions they support. The inbound
+// message of another minor version of the protocol is dispatched to the service supporting the best matching
+// version as the message of that version, the message of an unsupported major version is reported to the sender.
+type VersionedService interface {
+	// Protocols returns the protocol identifier URIs of the supported versions,
+	// e.g. https://didcomm.org/didexchange/1.0.
+	Protocols() []string
+}
+
+// Stopper is implemented by the services running in the background, e.g. processing the action event callbacks.
+// The service is stopped when it is unregistered or the framework is closed.
+type Stopper interface {
+	Stop() error
+}
+
 // Outbound interface
 type Outbound interface {
 	Send(interface{}, string, *service.Destination) error
 }
+
+// ContextOutbound is implemented by the outbound dispatchers which can be cancelled, the sending is aborted
+// when the context is done.
+type ContextOutbound interface {
+	Outbound
+	SendContext(context.Context, interface{}, string, *service.Destination) error
+}
+
+// SendContext sends the message using the outbound dispatcher. The dispatchers not implementing ContextOutbound
+// cannot be cancelled, the context is only checked before sending.
+func SendContext(ctx context.Context, o Outbound, msg interface{}, senderVerKey string,
+	des *service.Destination) error {
+	if co, ok := o.(ContextOutbound); ok {
+		return co.SendContext(ctx, msg, senderVerKey, des)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return o.Send(msg, senderVerKey, des)
+}
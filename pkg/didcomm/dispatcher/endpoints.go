@@ -0,0 +1,85 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultWorkingEndpoints is the default number of the recipients the working endpoint is remembered for.
+const DefaultWorkingEndpoints = 1000
+
+// endpointCache maps the recipient endpoints to the endpoint the last message was delivered to. The cache is
+// bounded, the least recently used recipient is evicted once the cache is full.
+type endpointCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type endpointEntry struct {
+	key      string
+	endpoint string
+}
+
+func newEndpointCache(size int) *endpointCache {
+	return &endpointCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the working endpoint of the recipient endpoints.
+func (c *endpointCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	c.order.MoveToFront(e)
+
+	return e.Value.(*endpointEntry).endpoint, true
+}
+
+// put records the working endpoint of the recipient endpoints, nothing is recorded if the size is not positive.
+func (c *endpointCache) put(key, endpoint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*endpointEntry).endpoint = endpoint
+		c.order.MoveToFront(e)
+
+		return
+	}
+
+	if c.size < 1 {
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*endpointEntry).key)
+	}
+
+	c.entries[key] = c.order.PushFront(&endpointEntry{key: key, endpoint: endpoint})
+}
+
+// len returns the number of the recipients the working endpoint is remembered for.
+func (c *endpointCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
@@ -0,0 +1,59 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointCache(t *testing.T) {
+	t.Run("test least recently used recipient evicted", func(t *testing.T) {
+		c := newEndpointCache(2)
+
+		c.put("a", "https://a")
+		c.put("b", "https://b")
+
+		// a is used, b is the least recently used one
+		endpoint, ok := c.get("a")
+		require.True(t, ok)
+		require.Equal(t, "https://a", endpoint)
+
+		c.put("c", "https://c")
+		require.Equal(t, 2, c.len())
+
+		_, ok = c.get("b")
+		require.False(t, ok)
+
+		endpoint, ok = c.get("c")
+		require.True(t, ok)
+		require.Equal(t, "https://c", endpoint)
+	})
+
+	t.Run("test endpoint updated", func(t *testing.T) {
+		c := newEndpointCache(1)
+
+		c.put("a", "https://a")
+		c.put("a", "https://fallback")
+		require.Equal(t, 1, c.len())
+
+		endpoint, ok := c.get("a")
+		require.True(t, ok)
+		require.Equal(t, "https://fallback", endpoint)
+	})
+
+	t.Run("test nothing remembered if the size is not positive", func(t *testing.T) {
+		c := newEndpointCache(0)
+
+		c.put("a", "https://a")
+		require.Equal(t, 0, c.len())
+
+		_, ok := c.get("a")
+		require.False(t, ok)
+	})
+}
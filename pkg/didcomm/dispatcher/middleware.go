@@ -0,0 +1,50 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"context"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+// InboundHandler handles the unpacked inbound message received from the sender key for the recipient keys.
+// The context is the context of the inbound request.
+type InboundHandler func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string,
+	recipientVerKeys []string) error
+
+// InboundMiddleware wraps the inbound handler. The middleware can inspect, modify or log the message before
+// passing it to the next handler, or reject the message by returning an error without calling the next handler.
+type InboundMiddleware func(next InboundHandler) InboundHandler
+
+// OutboundHandler sends the message from the sender key to the destination, it has the signature
+// of ContextOutbound.SendContext.
+type OutboundHandler func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error
+
+// OutboundMiddleware wraps the outbound handler. The middleware can inspect, modify or log the message before
+// passing it to the next handler, or reject the message by returning an error without calling the next handler.
+type OutboundMiddleware func(next OutboundHandler) OutboundHandler
+
+// ChainInbound wraps the handler with the middleware, the first middleware is the outermost one and sees
+// the message first.
+func ChainInbound(h InboundHandler, middleware ...InboundMiddleware) InboundHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// ChainOutbound wraps the handler with the middleware, the first middleware is the outermost one and sees
+// the message first.
+func ChainOutbound(h OutboundHandler, middleware ...OutboundMiddleware) OutboundHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
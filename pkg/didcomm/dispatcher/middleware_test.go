@@ -0,0 +1,81 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+func TestChainInbound(t *testing.T) {
+	var calls []string
+
+	mw := func(name string) InboundMiddleware {
+		return func(next InboundHandler) InboundHandler {
+			return func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string, recipientVerKeys []string) error {
+				calls = append(calls, name)
+
+				if senderVerKey == "rejected" {
+					return errors.New("rejected by " + name)
+				}
+
+				msg.Header.Type += "/" + name
+
+				return next(ctx, msg, senderVerKey, recipientVerKeys)
+			}
+		}
+	}
+
+	h := ChainInbound(func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string, recipientVerKeys []string) error {
+		calls = append(calls, msg.Header.Type)
+		return nil
+	}, mw("first"), mw("second"))
+
+	require.NoError(t, h(context.Background(), &service.DIDCommMsg{Header: &service.Header{Type: "type"}}, "sender", nil))
+	require.Equal(t, []string{"first", "second", "type/first/second"}, calls)
+
+	calls = nil
+
+	require.EqualError(t, h(context.Background(), &service.DIDCommMsg{Header: &service.Header{Type: "type"}}, "rejected", nil),
+		"rejected by first")
+	require.Equal(t, []string{"first"}, calls)
+}
+
+func TestChainOutbound(t *testing.T) {
+	var calls []string
+
+	mw := func(name string) OutboundMiddleware {
+		return func(next OutboundHandler) OutboundHandler {
+			return func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+				calls = append(calls, name)
+				return next(ctx, msg.(string)+"/"+name, senderVerKey, des)
+			}
+		}
+	}
+
+	h := ChainOutbound(func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+		calls = append(calls, msg.(string))
+		return nil
+	}, mw("first"), mw("second"))
+
+	require.NoError(t, h(context.Background(), "msg", "sender", &service.Destination{}))
+	require.Equal(t, []string{"first", "second", "msg/first/second"}, calls)
+
+	// no middleware
+	calls = nil
+
+	require.NoError(t, ChainOutbound(func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+		calls = append(calls, msg.(string))
+		return nil
+	})(context.Background(), "msg", "sender", &service.Destination{}))
+	require.Equal(t, []string{"msg"}, calls)
+}
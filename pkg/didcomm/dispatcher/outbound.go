@@ -7,9 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
@@ -25,38 +30,245 @@ type provider interface {
 type OutboundDispatcher struct {
 	outboundTransports []transport.OutboundTransport
 	packager           commontransport.Packager
+	middleware         []OutboundMiddleware
+	send               OutboundHandler
+	metrics            metrics.Sink
+	tracer             trace.Tracer
+	// workingEndpoints maps the recipient endpoints to the endpoint the last message was delivered to
+	workingEndpoints *endpointCache
+}
+
+// OutboundOpt configures the outbound dispatcher.
+type OutboundOpt func(o *OutboundDispatcher)
+
+// WithOutboundMiddleware wraps the Send function of the outbound dispatcher with the middleware,
+// the middleware is invoked in the given order before the message is packed.
+func WithOutboundMiddleware(middleware ...OutboundMiddleware) OutboundOpt {
+	return func(o *OutboundDispatcher) {
+		o.middleware = append(o.middleware, middleware...)
+	}
+}
+
+// WithOutboundMetrics sets the sink receiving the number of the messages sent and the failed deliveries.
+func WithOutboundMetrics(sink metrics.Sink) OutboundOpt {
+	return func(o *OutboundDispatcher) {
+		o.metrics = sink
+	}
+}
+
+// WithOutboundTracer traces the sending of the messages, the spans are correlated by the thread ID of the message.
+func WithOutboundTracer(tracer trace.Tracer) OutboundOpt {
+	return func(o *OutboundDispatcher) {
+		if tracer != nil {
+			o.tracer = tracer
+		}
+	}
+}
+
+// WithWorkingEndpointsLimit sets the number of the recipients the endpoint the last message was delivered to is
+// remembered for, the least recently used recipient is forgotten once the limit is reached. Defaults to
+// DefaultWorkingEndpoints, the endpoints are not remembered if the limit is not positive.
+func WithWorkingEndpointsLimit(limit int) OutboundOpt {
+	return func(o *OutboundDispatcher) {
+		o.workingEndpoints = newEndpointCache(limit)
+	}
 }
 
 // NewOutbound return new dispatcher outbound instance
-func NewOutbound(prov provider) *OutboundDispatcher {
-	return &OutboundDispatcher{outboundTransports: prov.OutboundTransports(), packager: prov.Packager()}
+func NewOutbound(prov provider, opts ...OutboundOpt) *OutboundDispatcher {
+	o := &OutboundDispatcher{
+		outboundTransports: prov.OutboundTransports(),
+		packager:           prov.Packager(),
+		workingEndpoints:   newEndpointCache(DefaultWorkingEndpoints),
+		metrics:            metrics.Nop,
+		tracer:             trace.Noop,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	o.send = ChainOutbound(o.dispatch, o.middleware...)
+
+	return o
 }
 
 // Send msg
 func (o *OutboundDispatcher) Send(msg interface{}, senderVerKey string, des *service.Destination) error {
+	return o.send(context.Background(), msg, senderVerKey, des)
+}
+
+// SendContext sends the msg, the sending is aborted when the context is done.
+func (o *OutboundDispatcher) SendContext(ctx context.Context, msg interface{}, senderVerKey string,
+	des *service.Destination) error {
+	return o.send(ctx, msg, senderVerKey, des)
+}
+
+func (o *OutboundDispatcher) dispatch(ctx context.Context, msg interface{}, senderVerKey string,
+	des *service.Destination) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed marshal to bytes: %w", err)
+	}
+
+	msgType, thID := messageHeader(bytes)
+
+	ctx, span := o.tracer.Start(ctx, trace.SendSpan, trace.WithAttributes(
+		trace.String(trace.ThreadIDKey, thID), trace.String(trace.MessageTypeKey, msgType)))
+	defer span.End()
+
+	err = o.dispatchBytes(ctx, bytes, msgType, senderVerKey, des)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return err
+}
+
+// dispatchBytes sends the marshaled message to the destination or its fallbacks.
+func (o *OutboundDispatcher) dispatchBytes(ctx context.Context, bytes []byte, msgType, senderVerKey string,
+	des *service.Destination) error {
+	var err error
+
+	destinations := o.preferred(des)
+
+	var errs []string
+
+	for _, d := range destinations {
+		err = o.sendTo(ctx, bytes, senderVerKey, d)
+		if err == nil {
+			o.remember(des, d.ServiceEndpoint)
+			o.metrics.IncCounter(metrics.MessagesSent, metrics.MessageLabels(msgType))
+			trace.SpanFromContext(ctx).SetAttributes(trace.String(trace.EndpointKey, d.ServiceEndpoint))
+
+			return nil
+		}
+
+		o.metrics.IncCounter(metrics.OutboundFailures, metrics.Labels{"scheme": scheme(d.ServiceEndpoint)})
+
+		errs = append(errs, fmt.Sprintf("%s: %s", d.ServiceEndpoint, err))
+
+		// the remaining endpoints are not tried once the context is done
+		if ctx.Err() != nil {
+			return fmt.Errorf("send msg: %w", ctx.Err())
+		}
+	}
+
+	if len(destinations) == 1 {
+		return err
+	}
+
+	return fmt.Errorf("failed to send msg to any service endpoint: %s", strings.Join(errs, "; "))
+}
+
+// sendTo sends the message to the destination trying every outbound transport accepting its endpoint.
+func (o *OutboundDispatcher) sendTo(ctx context.Context, bytes []byte, senderVerKey string,
+	des *service.Destination) error {
+	var (
+		packedMsg []byte
+		sendErr   error
+	)
+
 	for _, v := range o.outboundTransports {
 		if !v.Accept(des.ServiceEndpoint) {
 			continue
 		}
 
-		bytes, err := json.Marshal(msg)
-		if err != nil {
-			return fmt.Errorf("failed marshal to bytes: %w", err)
-		}
+		if packedMsg == nil {
+			var err error
 
-		packedMsg, err := o.packager.PackMessage(
-			&commontransport.Envelope{Message: bytes, FromVerKey: senderVerKey, ToVerKeys: des.RecipientKeys})
-		if err != nil {
-			return fmt.Errorf("failed to pack msg: %w", err)
+			packedMsg, err = o.packager.PackMessage(
+				&commontransport.Envelope{Message: bytes, FromVerKey: senderVerKey, ToVerKeys: des.RecipientKeys})
+			if err != nil {
+				return fmt.Errorf("failed to pack msg: %w", err)
+			}
 		}
 
-		_, err = v.Send(packedMsg, des.ServiceEndpoint)
-		if err != nil {
-			return fmt.Errorf("failed to send msg using http outbound transport: %w", err)
+		_, err := transport.SendContext(ctx, v, packedMsg, des.ServiceEndpoint)
+		if err == nil {
+			return nil
 		}
 
-		return nil
+		sendErr = fmt.Errorf("failed to send msg using %s outbound transport to %s: %w",
+			scheme(des.ServiceEndpoint), des.ServiceEndpoint, err)
+	}
+
+	if sendErr != nil {
+		return sendErr
 	}
 
 	return fmt.Errorf("no outbound transport found for serviceEndpoint: %s", des.ServiceEndpoint)
 }
+
+// preferred returns the destination and its fallbacks with the endpoint which worked last time moved first.
+func (o *OutboundDispatcher) preferred(des *service.Destination) []*service.Destination {
+	destinations := des.Endpoints()
+	if len(destinations) == 1 {
+		return destinations
+	}
+
+	endpoint, ok := o.workingEndpoints.get(endpointsKey(destinations))
+	if !ok {
+		return destinations
+	}
+
+	for i, d := range destinations {
+		if d.ServiceEndpoint == endpoint {
+			return append(append([]*service.Destination{d}, destinations[:i]...), destinations[i+1:]...)
+		}
+	}
+
+	return destinations
+}
+
+// remember records the endpoint the message was delivered to, the endpoint is tried first next time.
+func (o *OutboundDispatcher) remember(des *service.Destination, endpoint string) {
+	destinations := des.Endpoints()
+	if len(destinations) == 1 {
+		return
+	}
+
+	o.workingEndpoints.put(endpointsKey(destinations), endpoint)
+}
+
+// messageHeader returns the type and the thread ID of the marshaled message, the thread ID is the ~thread.thid
+// or the @id of the message starting the thread. The values are empty if the message has no such header.
+func messageHeader(bytes []byte) (string, string) {
+	header := &struct {
+		ID     string `json:"@id"`
+		Type   string `json:"@type"`
+		Thread struct {
+			ID string `json:"thid"`
+		} `json:"~thread"`
+	}{}
+
+	if err := json.Unmarshal(bytes, header); err != nil {
+		return "", ""
+	}
+
+	if header.Thread.ID != "" {
+		return header.Type, header.Thread.ID
+	}
+
+	return header.Type, header.ID
+}
+
+// scheme returns the transport scheme of the service endpoint, e.g. http or ws.
+func scheme(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" {
+		return "unknown"
+	}
+
+	return strings.ToLower(u.Scheme)
+}
+
+func endpointsKey(destinations []*service.Destination) string {
+	key := strings.Join(destinations[0].RecipientKeys, ",")
+
+	for _, d := range destinations {
+		key += "|" + d.ServiceEndpoint
+	}
+
+	return key
+}
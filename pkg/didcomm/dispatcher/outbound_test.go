@@ -7,13 +7,20 @@ SPDX-License-Identifier: Apache-2.0
 package dispatcher
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	mockdidcomm "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm"
 	mockpackager "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/packager"
@@ -50,6 +57,288 @@ func TestOutboundDispatcher_Send(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "send error")
 	})
+
+	t.Run("test outbound middleware", func(t *testing.T) {
+		var sent []interface{}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{&mockdidcomm.MockOutboundTransport{AcceptValue: true}}},
+			WithOutboundMiddleware(func(next OutboundHandler) OutboundHandler {
+				return func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+					if des.RecipientKeys[0] == "blocked" {
+						return fmt.Errorf("recipient %s not allowed", des.RecipientKeys[0])
+					}
+
+					sent = append(sent, msg)
+
+					return next(ctx, msg, senderVerKey, des)
+				}
+			}))
+
+		require.NoError(t, o.Send("data", "key", &service.Destination{ServiceEndpoint: "url",
+			RecipientKeys: []string{"recipient"}}))
+		require.Equal(t, []interface{}{"data"}, sent)
+
+		err := o.Send("data", "key", &service.Destination{ServiceEndpoint: "url", RecipientKeys: []string{"blocked"}})
+		require.EqualError(t, err, "recipient blocked not allowed")
+		require.Len(t, sent, 1)
+	})
+}
+
+func TestOutboundDispatcher_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+		outboundTransportsValue: []transport.OutboundTransport{
+			&endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}}},
+		WithOutboundMetrics(registry))
+
+	msg := &service.Header{ID: "id", Type: "https://didcomm.org/didexchange/1.0/request"}
+
+	require.NoError(t, o.Send(msg, "", &service.Destination{ServiceEndpoint: "https://primary",
+		Fallbacks: []*service.Destination{{ServiceEndpoint: "ws://secondary"}, {ServiceEndpoint: "https://tertiary"}}}))
+	require.Error(t, o.Send("data", "", &service.Destination{ServiceEndpoint: "url"}))
+
+	var buf bytes.Buffer
+	require.NoError(t, registry.WritePrometheus(&buf))
+	require.Contains(t, buf.String(), `aries_messages_sent_total{protocol="didexchange/1.0",`+
+		`type="https://didcomm.org/didexchange/1.0/request"} 1`)
+	require.Contains(t, buf.String(), `aries_outbound_failures_total{scheme="https"} 1`)
+	require.Contains(t, buf.String(), `aries_outbound_failures_total{scheme="ws"} 1`)
+	require.Contains(t, buf.String(), `aries_outbound_failures_total{scheme="unknown"} 1`)
+}
+
+func TestOutboundDispatcher_Tracer(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+
+	o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+		outboundTransportsValue: []transport.OutboundTransport{
+			&endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}}},
+		WithOutboundTracer(tracer))
+
+	ctx, parent := tracer.Start(context.Background(), trace.StateSpan)
+
+	msg := &service.Header{ID: "id", Type: "https://didcomm.org/didexchange/1.0/request"}
+	require.NoError(t, o.SendContext(ctx, msg, "", &service.Destination{ServiceEndpoint: "https://primary",
+		Fallbacks: []*service.Destination{{ServiceEndpoint: "https://secondary"}}}))
+
+	msg = &service.Header{ID: "other-id", Type: "https://didcomm.org/didexchange/1.0/response",
+		Thread: decorator.Thread{ID: "id"}}
+	require.Error(t, o.Send(msg, "", &service.Destination{ServiceEndpoint: "https://primary"}))
+
+	parent.End()
+
+	spans := exporter.ThreadSpans("id")
+	require.Len(t, spans, 2)
+
+	require.Equal(t, trace.SendSpan, spans[0].Name)
+	require.Equal(t, parent.SpanContext(), spans[0].Parent)
+	require.Empty(t, spans[0].Errors)
+
+	endpoint, ok := spans[0].Attribute(trace.EndpointKey)
+	require.True(t, ok)
+	require.Equal(t, "https://secondary", endpoint)
+
+	require.False(t, spans[1].Parent.IsValid())
+	require.Len(t, spans[1].Errors, 1)
+
+	msgType, ok := spans[1].Attribute(trace.MessageTypeKey)
+	require.True(t, ok)
+	require.Equal(t, "https://didcomm.org/didexchange/1.0/response", msgType)
+
+	_, ok = spans[1].Attribute(trace.EndpointKey)
+	require.False(t, ok)
+}
+
+func TestSendContext(t *testing.T) {
+	outbound := &mockOutbound{}
+
+	require.NoError(t, SendContext(context.Background(), outbound, "data", "", &service.Destination{}))
+	require.Equal(t, 1, outbound.sent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := SendContext(ctx, outbound, "data", "", &service.Destination{})
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 1, outbound.sent)
+}
+
+type mockOutbound struct {
+	sent int
+}
+
+func (m *mockOutbound) Send(interface{}, string, *service.Destination) error {
+	m.sent++
+	return nil
+}
+
+func TestOutboundDispatcher_Failover(t *testing.T) {
+	des := &service.Destination{ServiceEndpoint: "https://primary", RecipientKeys: []string{"key"},
+		Fallbacks: []*service.Destination{
+			{ServiceEndpoint: "ws://secondary", RecipientKeys: []string{"key"}},
+			{ServiceEndpoint: "https://tertiary", RecipientKeys: []string{"key"}},
+		}}
+
+	t.Run("test fallback endpoint remembered", func(t *testing.T) {
+		httpTransport := &endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}
+		wsTransport := &endpointTransport{scheme: "ws", failing: map[string]bool{"ws://secondary": true}}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{httpTransport, wsTransport}})
+
+		require.NoError(t, o.Send("data", "", des))
+		require.Equal(t, []string{"https://primary", "https://tertiary"}, httpTransport.attempts)
+		require.Equal(t, []string{"ws://secondary"}, wsTransport.attempts)
+
+		// the endpoint which worked is tried first
+		require.NoError(t, o.Send("data", "", des))
+		require.Equal(t, []string{"https://primary", "https://tertiary", "https://tertiary"}, httpTransport.attempts)
+		require.Len(t, wsTransport.attempts, 1)
+	})
+
+	t.Run("test every transport accepting the endpoint is tried", func(t *testing.T) {
+		failing := &endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}
+		working := &endpointTransport{scheme: "https"}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{failing, working}})
+
+		require.NoError(t, o.Send("data", "", &service.Destination{ServiceEndpoint: "https://primary"}))
+		require.Equal(t, []string{"https://primary"}, failing.attempts)
+		require.Equal(t, []string{"https://primary"}, working.attempts)
+	})
+
+	t.Run("test all endpoints failed", func(t *testing.T) {
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{
+				&endpointTransport{scheme: "https", failing: map[string]bool{
+					"https://primary": true, "https://tertiary": true}}}})
+
+		err := o.Send("data", "", des)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to send msg to any service endpoint")
+		require.Contains(t, err.Error(),
+			"https://primary: failed to send msg using https outbound transport to https://primary")
+		require.Contains(t, err.Error(), "ws://secondary: no outbound transport found")
+		require.Contains(t, err.Error(),
+			"https://tertiary: failed to send msg using https outbound transport to https://tertiary")
+	})
+
+	t.Run("test send error names the transport scheme and endpoint", func(t *testing.T) {
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{
+				&endpointTransport{scheme: "ws", failing: map[string]bool{"ws://secondary": true}}}})
+
+		err := o.Send("data", "", &service.Destination{ServiceEndpoint: "ws://secondary"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to send msg using ws outbound transport to ws://secondary")
+	})
+
+	t.Run("test working endpoints limited", func(t *testing.T) {
+		httpTransport := &endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{httpTransport}}, WithWorkingEndpointsLimit(1))
+
+		other := &service.Destination{ServiceEndpoint: "https://primary", RecipientKeys: []string{"other"},
+			Fallbacks: []*service.Destination{{ServiceEndpoint: "https://other", RecipientKeys: []string{"other"}}}}
+
+		require.NoError(t, o.Send("data", "", des))
+		require.NoError(t, o.Send("data", "", other))
+		require.Equal(t, 1, o.workingEndpoints.len())
+
+		// the working endpoint of the first recipient was forgotten, the primary endpoint is tried again
+		httpTransport.attempts = nil
+		require.NoError(t, o.Send("data", "", des))
+		require.Equal(t, []string{"https://primary", "https://tertiary"}, httpTransport.attempts)
+	})
+
+	t.Run("test context done", func(t *testing.T) {
+		httpTransport := &endpointTransport{scheme: "https", failing: map[string]bool{"https://primary": true}}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{httpTransport}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		httpTransport.onSend = cancel
+
+		// the fallbacks are not tried once the context is cancelled
+		err := o.SendContext(ctx, "data", "", des)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Equal(t, []string{"https://primary"}, httpTransport.attempts)
+
+		// the transport not accepting the context is not called with the cancelled context
+		err = o.SendContext(ctx, "data", "", &service.Destination{ServiceEndpoint: "https://primary"})
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Len(t, httpTransport.attempts, 1)
+	})
+
+	t.Run("test context passed to transport", func(t *testing.T) {
+		ctxTransport := &contextTransport{}
+
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{},
+			outboundTransportsValue: []transport.OutboundTransport{ctxTransport}})
+
+		type key struct{}
+
+		ctx := context.WithValue(context.Background(), key{}, "value")
+
+		require.NoError(t, o.SendContext(ctx, "data", "", &service.Destination{ServiceEndpoint: "https://primary"}))
+		require.Equal(t, "value", ctxTransport.ctx.Value(key{}))
+
+		require.NoError(t, SendContext(ctx, o, "data", "", &service.Destination{ServiceEndpoint: "https://primary"}))
+	})
+
+	t.Run("test marshal error", func(t *testing.T) {
+		o := NewOutbound(&mockProvider{packagerValue: &mockpackager.Packager{}})
+		err := o.Send(make(chan int), "", des)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed marshal to bytes")
+	})
+}
+
+// endpointTransport accepts the endpoints with the given scheme and fails to send to the failing endpoints.
+type endpointTransport struct {
+	scheme   string
+	failing  map[string]bool
+	attempts []string
+	onSend   func()
+}
+
+func (e *endpointTransport) Send(_ []byte, destination string) (string, error) {
+	e.attempts = append(e.attempts, destination)
+
+	if e.onSend != nil {
+		e.onSend()
+	}
+
+	if e.failing[destination] {
+		return "", fmt.Errorf("%s unavailable", destination)
+	}
+
+	return "", nil
+}
+
+func (e *endpointTransport) Accept(url string) bool {
+	return strings.HasPrefix(url, e.scheme+"://")
+}
+
+// contextTransport records the context it was called with.
+type contextTransport struct {
+	endpointTransport
+	ctx context.Context
+}
+
+func (c *contextTransport) SendContext(ctx context.Context, data []byte, destination string) (string, error) {
+	c.ctx = ctx
+	return c.Send(data, destination)
+}
+
+func (c *contextTransport) Accept(string) bool {
+	return true
 }
 
 type mockProvider struct {
@@ -0,0 +1,200 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+)
+
+var logger = log.New("aries-framework/dispatcher")
+
+var (
+	// ErrServiceRegistered is returned when the service with the same name is already registered.
+	ErrServiceRegistered = errors.New("service already registered")
+	// ErrServiceNotRegistered is returned when there is no service registered with the given name.
+	ErrServiceNotRegistered = errors.New("service not registered")
+)
+
+// ServiceRegistry holds the protocol services by name, the services can be registered, replaced and
+// unregistered while the agent is running. The registry is safe for concurrent use.
+//
+// The registry manages the lifecycle of the services implementing Starter and Stopper: the service is started
+// before it is registered and stopped once it is unregistered, replaced or the registry is stopped.
+type ServiceRegistry struct {
+	mu       sync.RWMutex
+	services []Service
+}
+
+// NewServiceRegistry returns new registry holding the given services.
+func NewServiceRegistry(services ...Service) *ServiceRegistry {
+	return &ServiceRegistry{services: append([]Service(nil), services...)}
+}
+
+// Register adds the service, the service is consulted after the services registered before it.
+func (r *ServiceRegistry) Register(svc Service) error {
+	if err := startService(svc); err != nil {
+		return fmt.Errorf("register %s: %w", svc.Name(), err)
+	}
+
+	r.mu.Lock()
+
+	if r.index(svc.Name()) >= 0 {
+		r.mu.Unlock()
+		stopUnregistered(svc)
+
+		return fmt.Errorf("register %s: %w", svc.Name(), ErrServiceRegistered)
+	}
+
+	r.services = append(r.services, svc)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Replace replaces the service registered with the same name, the position of the service is kept.
+// The replaced service is stopped.
+func (r *ServiceRegistry) Replace(svc Service) error {
+	if err := startService(svc); err != nil {
+		return fmt.Errorf("replace %s: %w", svc.Name(), err)
+	}
+
+	r.mu.Lock()
+
+	i := r.index(svc.Name())
+	if i < 0 {
+		r.mu.Unlock()
+		stopUnregistered(svc)
+
+		return fmt.Errorf("replace %s: %w", svc.Name(), ErrServiceNotRegistered)
+	}
+
+	// copy on write, the snapshots returned by Services are not modified
+	services := append([]Service(nil), r.services...)
+	replaced := services[i]
+	services[i] = svc
+	r.services = services
+	r.mu.Unlock()
+
+	if err := stopService(replaced); err != nil {
+		return fmt.Errorf("replace %s: %w", svc.Name(), err)
+	}
+
+	return nil
+}
+
+// Unregister removes the service with the given name, the service is stopped.
+func (r *ServiceRegistry) Unregister(name string) error {
+	r.mu.Lock()
+
+	i := r.index(name)
+	if i < 0 {
+		r.mu.Unlock()
+
+		return fmt.Errorf("unregister %s: %w", name, ErrServiceNotRegistered)
+	}
+
+	unregistered := r.services[i]
+
+	services := make([]Service, 0, len(r.services)-1)
+	services = append(services, r.services[:i]...)
+	r.services = append(services, r.services[i+1:]...)
+	r.mu.Unlock()
+
+	if err := stopService(unregistered); err != nil {
+		return fmt.Errorf("unregister %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Stop stops the registered services in the reverse order of registration, the services stay registered.
+// Every service is stopped even if stopping the previous one failed.
+func (r *ServiceRegistry) Stop() error {
+	services := r.Services()
+
+	var errs []string
+
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := stopService(services[i]); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", services[i].Name(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("stop services: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Service returns the service with the given name. The nil registry holds no services.
+func (r *ServiceRegistry) Service(name string) (Service, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.index(name)
+	if i < 0 {
+		return nil, false
+	}
+
+	return r.services[i], true
+}
+
+// Services returns the snapshot of the registered services in the order of registration. The nil registry
+// holds no services.
+func (r *ServiceRegistry) Services() []Service {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.services
+}
+
+func (r *ServiceRegistry) index(name string) int {
+	for i, svc := range r.services {
+		if svc.Name() == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func startService(svc Service) error {
+	if starter, ok := svc.(Starter); ok {
+		return starter.Start()
+	}
+
+	return nil
+}
+
+func stopService(svc Service) error {
+	if stopper, ok := svc.(Stopper); ok {
+		return stopper.Stop()
+	}
+
+	return nil
+}
+
+// stopUnregistered stops the service which was started but not registered.
+func stopUnregistered(svc Service) {
+	if err := stopService(svc); err != nil {
+		logger.Warnf("stop %s: %s", svc.Name(), err)
+	}
+}
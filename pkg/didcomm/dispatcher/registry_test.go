@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+func TestServiceRegistry(t *testing.T) {
+	t.Run("test register, replace and unregister", func(t *testing.T) {
+		first, second := &mockService{name: "first"}, &mockService{name: "second"}
+
+		r := NewServiceRegistry(first)
+		require.NoError(t, r.Register(second))
+		require.Equal(t, []Service{first, second}, r.Services())
+
+		err := r.Register(&mockService{name: "first"})
+		require.True(t, errors.Is(err, ErrServiceRegistered))
+
+		// the snapshot is not changed by the replace
+		snapshot := r.Services()
+		replaced := &mockService{name: "first"}
+		require.NoError(t, r.Replace(replaced))
+		require.Equal(t, []Service{replaced, second}, r.Services())
+		require.Equal(t, []Service{first, second}, snapshot)
+
+		svc, ok := r.Service("first")
+		require.True(t, ok)
+		require.True(t, svc == replaced)
+
+		require.NoError(t, r.Unregister("first"))
+		require.Equal(t, []Service{second}, r.Services())
+
+		_, ok = r.Service("first")
+		require.False(t, ok)
+
+		err = r.Unregister("first")
+		require.True(t, errors.Is(err, ErrServiceNotRegistered))
+
+		err = r.Replace(&mockService{name: "first"})
+		require.True(t, errors.Is(err, ErrServiceNotRegistered))
+	})
+
+	t.Run("test nil registry", func(t *testing.T) {
+		var r *ServiceRegistry
+
+		_, ok := r.Service("first")
+		require.False(t, ok)
+		require.Empty(t, r.Services())
+	})
+
+	t.Run("test concurrent use", func(t *testing.T) {
+		r := NewServiceRegistry()
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func(name string) {
+				defer wg.Done()
+
+				require.NoError(t, r.Register(&mockService{name: name}))
+
+				for _, svc := range r.Services() {
+					svc.Accept("type")
+				}
+
+				require.NoError(t, r.Replace(&mockService{name: name}))
+				require.NoError(t, r.Unregister(name))
+			}(fmt.Sprintf("svc-%d", i))
+		}
+
+		wg.Wait()
+		require.Empty(t, r.Services())
+	})
+}
+
+func TestServiceRegistry_Lifecycle(t *testing.T) {
+	t.Run("test services are started and stopped", func(t *testing.T) {
+		first, second := &lifecycleService{mockService: mockService{name: "first"}},
+			&lifecycleService{mockService: mockService{name: "second"}}
+
+		r := NewServiceRegistry()
+		require.NoError(t, r.Register(first))
+		require.NoError(t, r.Register(second))
+		require.Equal(t, 1, first.started)
+
+		// the duplicate is stopped
+		duplicate := &lifecycleService{mockService: mockService{name: "first"}}
+		require.True(t, errors.Is(r.Register(duplicate), ErrServiceRegistered))
+		require.Equal(t, 1, duplicate.started)
+		require.Equal(t, 1, duplicate.stopped)
+
+		// the replaced service is stopped
+		replaced := &lifecycleService{mockService: mockService{name: "first"}}
+		require.NoError(t, r.Replace(replaced))
+		require.Equal(t, 1, replaced.started)
+		require.Equal(t, 1, first.stopped)
+
+		// the services are stopped in the reverse order
+		var stopped []string
+
+		replaced.onStop = func() { stopped = append(stopped, "first") }
+		second.onStop = func() { stopped = append(stopped, "second") }
+
+		require.NoError(t, r.Stop())
+		require.Equal(t, []string{"second", "first"}, stopped)
+
+		require.NoError(t, r.Unregister("second"))
+		require.Equal(t, 2, second.stopped)
+	})
+
+	t.Run("test errors", func(t *testing.T) {
+		r := NewServiceRegistry()
+
+		svc := &lifecycleService{mockService: mockService{name: "svc"}, startErr: errors.New("start error")}
+		require.EqualError(t, r.Register(svc), "register svc: start error")
+		require.Empty(t, r.Services())
+
+		svc.startErr = nil
+		require.NoError(t, r.Register(svc))
+		require.NoError(t, r.Register(&lifecycleService{mockService: mockService{name: "other"},
+			stopErr: errors.New("other error")}))
+
+		svc.stopErr = errors.New("stop error")
+		require.EqualError(t, r.Stop(), "stop services: other: other error; svc: stop error")
+
+		require.EqualError(t, r.Replace(&lifecycleService{mockService: mockService{name: "svc"}}),
+			"replace svc: stop error")
+		require.EqualError(t, r.Replace(&lifecycleService{mockService: mockService{name: "svc"},
+			startErr: errors.New("start error")}), "replace svc: start error")
+		require.EqualError(t, r.Unregister("other"), "unregister other: other error")
+		require.Len(t, r.Services(), 1)
+	})
+}
+
+type lifecycleService struct {
+	mockService
+	started, stopped  int
+	startErr, stopErr error
+	onStop            func()
+}
+
+func (s *lifecycleService) Start() error {
+	s.started++
+	return s.startErr
+}
+
+func (s *lifecycleService) Stop() error {
+	s.stopped++
+
+	if s.onStop != nil {
+		s.onStop()
+	}
+
+	return s.stopErr
+}
+
+type mockService struct {
+	name string
+}
+
+func (m *mockService) HandleInbound(*service.DIDCommMsg) (string, error) {
+	return "", nil
+}
+
+func (m *mockService) HandleOutbound(*service.DIDCommMsg, *service.Destination) error {
+	return nil
+}
+
+func (m *mockService) Accept(string) bool {
+	return false
+}
+
+func (m *mockService) Name() string {
+	return m.name
+}
@@ -0,0 +1,427 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+var logger = log.New("aries-framework/history")
+
+const (
+	// StoreName is the name of the store of the archived messages and state transitions.
+	StoreName = "messagehistory"
+
+	defaultRetention = 30 * 24 * time.Hour
+	// maxSweepInterval is how often the expired entries are deleted at most when the retention is longer
+	maxSweepInterval = time.Hour
+
+	connectionKeyPrefix = "history_conn_"
+	threadKeyPrefix     = "history_thread_"
+	timeKeyPrefix       = "history_time_"
+	// limitPattern with `~` at the end for lte of given prefix (less than or equal)
+	limitPattern = "%s~"
+)
+
+const (
+	// Inbound the message was received by the agent.
+	Inbound = "inbound"
+	// Outbound the message was sent by the agent.
+	Outbound = "outbound"
+	// Transition the protocol thread moved to the state.
+	Transition = "transition"
+)
+
+// Entry is the archived message or state transition.
+type Entry struct {
+	ID           string          `json:"id"`
+	ConnectionID string          `json:"connection_id,omitempty"`
+	ThreadID     string          `json:"thread_id,omitempty"`
+	Direction    string          `json:"direction"`
+	MessageType  string          `json:"message_type,omitempty"`
+	Message      json.RawMessage `json:"message,omitempty"`
+	// Protocol and State are set for the state transitions.
+	Protocol string `json:"protocol,omitempty"`
+	State    string `json:"state,omitempty"`
+	// Error is the error the message was rejected or failed to be sent with.
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ConnectionLookup finds the connection the message belongs to.
+type ConnectionLookup interface {
+	// ConnectionID returns the ID of the connection with the party owning the key or the connection created
+	// by the thread, empty if there is no such connection.
+	ConnectionID(theirKey, thID string) string
+}
+
+// provider contains dependencies for the message history and is typically created by using aries.Context()
+type provider interface {
+	StorageProvider() storage.Provider
+}
+
+// Archive records the inbound and outbound messages and the protocol state transitions with the connection
+// they belong to. The messages are recorded by the inbound and outbound middleware of the archive,
+// the state transitions are recorded by the protocol state machines.
+//
+// The entries are keyed by their connection, or by their thread until the connection is known, and by their time,
+// so that a query reads the entries of the connection and of its threads only. Every entry is indexed by its time
+// too, the entries older than the retention are deleted at most once per hour.
+type Archive struct {
+	store     storage.Store
+	lookup    ConnectionLookup
+	retention time.Duration
+	now       func() time.Time
+	nextSweep time.Time
+	// mu serializes the sweeps of the expired entries
+	mu sync.Mutex
+}
+
+// Option configures the archive.
+type Option func(a *Archive)
+
+// WithConnectionLookup sets the lookup of the connections the messages without the inbound connection belong to,
+// e.g. the outbound messages or the messages of the DID exchange.
+func WithConnectionLookup(lookup ConnectionLookup) Option {
+	return func(a *Archive) {
+		a.lookup = lookup
+	}
+}
+
+// WithRetention sets how long the entries are kept, defaults to 30 days.
+func WithRetention(retention time.Duration) Option {
+	return func(a *Archive) {
+		a.retention = retention
+	}
+}
+
+// New returns new archive instance.
+func New(prov provider, opts ...Option) (*Archive, error) {
+	store, err := prov.StorageProvider().OpenStore(StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open message history store: %w", err)
+	}
+
+	a := &Archive{store: store, retention: defaultRetention, now: time.Now}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if a.retention <= 0 {
+		return nil, fmt.Errorf("invalid retention: %s", a.retention)
+	}
+
+	a.nextSweep = a.now().Add(a.sweepInterval())
+
+	return a, nil
+}
+
+// Record archives the entry, the ID and the time are set if empty. The entry which belongs neither to
+// a connection nor to a thread can't be queried and is not archived.
+func (a *Archive) Record(e *Entry) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+
+	if e.Time.IsZero() {
+		e.Time = a.now()
+	}
+
+	key := entryKey(e)
+	if key == "" {
+		return nil
+	}
+
+	src, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("record message history: %w", err)
+	}
+
+	if err := a.store.Put(key, src); err != nil {
+		return fmt.Errorf("record message history: %w", err)
+	}
+
+	if err := a.store.Put(timeKeyPrefix+timeKey(e.Time, e.ID), []byte(key)); err != nil {
+		return fmt.Errorf("record message history: %w", err)
+	}
+
+	a.sweepExpired()
+
+	return nil
+}
+
+// Messages returns the messages and state transitions of the connection ordered by time. The entries of the given
+// threads recorded before the connection was known are returned too, e.g. the DID exchange messages received
+// before the connection was created.
+func (a *Archive) Messages(connectionID string, threadIDs ...string) ([]*Entry, error) {
+	if connectionID == "" {
+		return nil, errors.New("connection ID is mandatory")
+	}
+
+	entries, err := a.query(connectionKeyPrefix+connectionID+"_", func(e *Entry) bool {
+		return e.ConnectionID == connectionID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make(map[string]struct{}, len(threadIDs))
+
+	for _, thID := range threadIDs {
+		if _, ok := threads[thID]; ok || thID == "" {
+			continue
+		}
+
+		threads[thID] = struct{}{}
+
+		thEntries, err := a.query(threadKeyPrefix+thID+"_", func(e *Entry) bool {
+			return e.ConnectionID == "" && e.ThreadID == thID
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, thEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// query returns the entries with the key prefix which match, the prefix of one connection or thread
+// may be the prefix of another one too.
+func (a *Archive) query(prefix string, match func(e *Entry) bool) ([]*Entry, error) {
+	itr := a.store.Iterator(prefix, fmt.Sprintf(limitPattern, prefix))
+	defer itr.Release()
+
+	var entries []*Entry
+
+	for itr.Next() {
+		e := &Entry{}
+		if err := json.Unmarshal(itr.Value(), e); err != nil {
+			return nil, fmt.Errorf("query message history: %w", err)
+		}
+
+		if match(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	if err := itr.Error(); err != nil {
+		return nil, fmt.Errorf("query message history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// sweepExpired deletes the entries older than the retention once the sweep interval elapsed.
+func (a *Archive) sweepExpired() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if now.Before(a.nextSweep) {
+		return
+	}
+
+	a.nextSweep = now.Add(a.sweepInterval())
+	a.sweep(now.Add(-a.retention))
+}
+
+// sweep deletes the entries recorded before the cutoff through the time index, only the expired part of the index
+// is read. The failures are logged only, the entries are deleted by the next sweep.
+func (a *Archive) sweep(cutoff time.Time) {
+	itr := a.store.Iterator(timeKeyPrefix, timeKeyPrefix+timeKey(cutoff, ""))
+	defer itr.Release()
+
+	expired := make(map[string]string)
+
+	for itr.Next() {
+		key := string(itr.Key())
+
+		// the stores which don't honour the limit of the range return the whole index
+		nanos, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(key, timeKeyPrefix), "_", 2)[0], 10, 64)
+		if err == nil && nanos >= cutoff.UnixNano() {
+			continue
+		}
+
+		expired[key] = string(itr.Value())
+	}
+
+	if err := itr.Error(); err != nil {
+		logger.Warnf("failed to sweep message history: %s", err)
+	}
+
+	for key, entry := range expired {
+		if err := a.store.Delete(entry); err != nil {
+			logger.Warnf("failed to delete message history entry: %s", err)
+			continue
+		}
+
+		if err := a.store.Delete(key); err != nil {
+			logger.Warnf("failed to delete message history entry: %s", err)
+		}
+	}
+}
+
+func (a *Archive) sweepInterval() time.Duration {
+	if a.retention < maxSweepInterval {
+		return a.retention
+	}
+
+	return maxSweepInterval
+}
+
+// InboundMiddleware returns the middleware recording the inbound messages, the message is recorded
+// with the error it was rejected with if any.
+func (a *Archive) InboundMiddleware() dispatcher.InboundMiddleware {
+	return func(next dispatcher.InboundHandler) dispatcher.InboundHandler {
+		return func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string, recipientVerKeys []string) error {
+			err := next(ctx, msg, senderVerKey, recipientVerKeys)
+
+			thID, _ := msg.ThreadID()
+
+			e := &Entry{
+				ConnectionID: a.connectionID(senderVerKey, thID),
+				ThreadID:     thID,
+				Direction:    Inbound,
+				MessageType:  msg.Header.Type,
+				Message:      msg.Payload,
+			}
+
+			a.record(e, err)
+
+			return err
+		}
+	}
+}
+
+// OutboundMiddleware returns the middleware recording the outbound messages, the message is recorded
+// with the error it failed to be sent with if any.
+func (a *Archive) OutboundMiddleware() dispatcher.OutboundMiddleware {
+	return func(next dispatcher.OutboundHandler) dispatcher.OutboundHandler {
+		return func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+			err := next(ctx, msg, senderVerKey, des)
+
+			e := &Entry{Direction: Outbound}
+
+			payload, mErr := json.Marshal(msg)
+			if mErr != nil {
+				logger.Warnf("outbound message not recorded: %s", mErr)
+				return err
+			}
+
+			e.Message = payload
+			e.MessageType, e.ThreadID = messageHeader(payload)
+
+			var theirKey string
+			if des != nil && len(des.RecipientKeys) > 0 {
+				theirKey = des.RecipientKeys[0]
+			}
+
+			e.ConnectionID = a.connectionID(theirKey, e.ThreadID)
+
+			a.record(e, err)
+
+			return err
+		}
+	}
+}
+
+// RecordTransition records the state the protocol thread moved to. The entry belongs to the connection
+// of the event properties if they have one, e.g. the properties of the DID exchange events.
+func (a *Archive) RecordTransition(protocol, state string, msg *service.DIDCommMsg, props service.EventProperties) {
+	e := &Entry{Direction: Transition, Protocol: protocol, State: state}
+
+	if msg != nil && msg.Header != nil {
+		e.ThreadID, _ = msg.ThreadID()
+		e.MessageType = msg.Header.Type
+	}
+
+	if p, ok := props.(interface{ ConnectionID() string }); ok {
+		e.ConnectionID = p.ConnectionID()
+	}
+
+	if e.ConnectionID == "" {
+		e.ConnectionID = a.connectionID("", e.ThreadID)
+	}
+
+	a.record(e, nil)
+}
+
+func (a *Archive) connectionID(theirKey, thID string) string {
+	if a.lookup == nil {
+		return ""
+	}
+
+	return a.lookup.ConnectionID(theirKey, thID)
+}
+
+// record archives the entry, the message is processed even if it could not be archived.
+func (a *Archive) record(e *Entry, err error) {
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if e.ConnectionID == "" {
+		logger.Debugf("%s message %s is not linked to any connection", e.Direction, e.MessageType)
+	}
+
+	if err := a.Record(e); err != nil {
+		logger.Errorf("failed to record %s message: %s", e.Direction, err)
+	}
+}
+
+// entryKey returns the key of the entry ordered by time under its connection, or under its thread if the connection
+// is not known, empty if the entry has neither.
+func entryKey(e *Entry) string {
+	switch {
+	case e.ConnectionID != "":
+		return connectionKeyPrefix + e.ConnectionID + "_" + timeKey(e.Time, e.ID)
+	case e.ThreadID != "":
+		return threadKeyPrefix + e.ThreadID + "_" + timeKey(e.Time, e.ID)
+	default:
+		return ""
+	}
+}
+
+// timeKey returns the key part ordering the entries by time, the nanoseconds are padded to sort lexicographically.
+func timeKey(t time.Time, id string) string {
+	return fmt.Sprintf("%020d_%s", t.UnixNano(), id)
+}
+
+// messageHeader returns the type and the thread ID of the marshaled message, the thread ID is the ~thread.thid
+// or the @id of the message starting the thread.
+func messageHeader(payload []byte) (string, string) {
+	msg, err := service.NewDIDCommMsg(payload)
+	if err != nil {
+		return "", ""
+	}
+
+	thID, _ := msg.ThreadID()
+
+	return msg.Header.Type, thID
+}
@@ -0,0 +1,281 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("test success", func(t *testing.T) {
+		a, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+		require.NotNil(t, a)
+	})
+
+	t.Run("test error from open store", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: &mockstorage.MockStoreProvider{
+			ErrOpenStoreHandle: errors.New("open store error")}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open store error")
+	})
+
+	t.Run("test invalid retention", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: mem.NewProvider()}, WithRetention(0))
+		require.EqualError(t, err, "invalid retention: 0s")
+	})
+}
+
+func TestArchive_Messages(t *testing.T) {
+	t.Run("test entries of the connection and its threads ordered by time", func(t *testing.T) {
+		a, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		now := time.Now()
+
+		require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Outbound, Time: now.Add(2 * time.Second)}))
+		require.NoError(t, a.Record(&Entry{ThreadID: "thid", Direction: Inbound, Time: now}))
+		require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Transition, Time: now.Add(time.Second)}))
+		require.NoError(t, a.Record(&Entry{ConnectionID: "conn-2", Direction: Inbound}))
+		require.NoError(t, a.Record(&Entry{Direction: Inbound}))
+
+		entries, err := a.Messages("conn", "thid", "")
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		require.Equal(t, Inbound, entries[0].Direction)
+		require.Equal(t, Transition, entries[1].Direction)
+		require.Equal(t, Outbound, entries[2].Direction)
+
+		for _, e := range entries {
+			require.NotEmpty(t, e.ID)
+		}
+
+		entries, err = a.Messages("conn-2")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.False(t, entries[0].Time.IsZero())
+
+		entries, err = a.Messages("unknown")
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("test entries of the connections and threads sharing the key prefix", func(t *testing.T) {
+		a, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Outbound}))
+		require.NoError(t, a.Record(&Entry{ConnectionID: "conn_2", Direction: Inbound}))
+		require.NoError(t, a.Record(&Entry{ThreadID: "thid", Direction: Outbound}))
+		require.NoError(t, a.Record(&Entry{ThreadID: "thid_2", Direction: Inbound}))
+
+		entries, err := a.Messages("conn", "thid", "thid")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, Outbound, entries[0].Direction)
+		require.Equal(t, Outbound, entries[1].Direction)
+	})
+
+	t.Run("test connection ID is mandatory", func(t *testing.T) {
+		a, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		_, err = a.Messages("")
+		require.EqualError(t, err, "connection ID is mandatory")
+	})
+
+	t.Run("test invalid entry", func(t *testing.T) {
+		store := mockstorage.NewMockStoreProvider()
+		store.Store.Store[connectionKeyPrefix+"conn_id"] = []byte("{")
+
+		a, err := New(&mockProvider{storage: store})
+		require.NoError(t, err)
+
+		_, err = a.Messages("conn")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "query message history")
+	})
+}
+
+func TestArchive_Retention(t *testing.T) {
+	store := mem.NewProvider()
+
+	a, err := New(&mockProvider{storage: store}, WithRetention(2*time.Hour))
+	require.NoError(t, err)
+
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Inbound, Time: now.Add(-3 * time.Hour)}))
+	require.NoError(t, a.Record(&Entry{ThreadID: "thid", Direction: Inbound, Time: now.Add(-90 * time.Minute)}))
+	require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Outbound}))
+
+	// the expired entries are kept until the sweep interval elapses
+	entries, err := a.Messages("conn", "thid")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	now = now.Add(time.Hour)
+
+	require.NoError(t, a.Record(&Entry{ConnectionID: "conn", Direction: Transition}))
+
+	entries, err = a.Messages("conn", "thid")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, Outbound, entries[0].Direction)
+	require.Equal(t, Transition, entries[1].Direction)
+
+	// the time index of the deleted entries is deleted too
+	s, err := store.OpenStore(StoreName)
+	require.NoError(t, err)
+
+	itr := s.Iterator(timeKeyPrefix, fmt.Sprintf(limitPattern, timeKeyPrefix))
+	defer itr.Release()
+
+	var indexed int
+	for itr.Next() {
+		indexed++
+	}
+
+	require.Equal(t, 2, indexed)
+}
+
+func TestArchive_InboundMiddleware(t *testing.T) {
+	a, err := New(&mockProvider{storage: mem.NewProvider()},
+		WithConnectionLookup(&mockLookup{keys: map[string]string{"their-key": "conn"}}))
+	require.NoError(t, err)
+
+	handleErr := errors.New("handle error")
+
+	handler := dispatcher.ChainInbound(func(context.Context, *service.DIDCommMsg, string, []string) error {
+		return handleErr
+	}, a.InboundMiddleware())
+
+	msg, err := service.NewDIDCommMsg([]byte(`{"@id": "2", "@type": "https://didcomm.org/test/1.0/response",` +
+		`"~thread": {"thid": "1"}}`))
+	require.NoError(t, err)
+
+	require.Equal(t, handleErr, handler(context.Background(), msg, "their-key", []string{"my-key"}))
+
+	entries, err := a.Messages("conn")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, Inbound, entries[0].Direction)
+	require.Equal(t, "1", entries[0].ThreadID)
+	require.Equal(t, "https://didcomm.org/test/1.0/response", entries[0].MessageType)
+	require.Equal(t, "handle error", entries[0].Error)
+	require.JSONEq(t, string(msg.Payload), string(entries[0].Message))
+}
+
+func TestArchive_OutboundMiddleware(t *testing.T) {
+	a, err := New(&mockProvider{storage: mem.NewProvider()},
+		WithConnectionLookup(&mockLookup{threads: map[string]string{"1": "conn"}}))
+	require.NoError(t, err)
+
+	var sendErr error
+
+	handler := dispatcher.ChainOutbound(func(context.Context, interface{}, string, *service.Destination) error {
+		return sendErr
+	}, a.OutboundMiddleware())
+
+	des := &service.Destination{ServiceEndpoint: "url", RecipientKeys: []string{"their-key"}}
+
+	msg := &service.Header{ID: "1", Type: "https://didcomm.org/test/1.0/request"}
+	require.NoError(t, handler(context.Background(), msg, "my-key", des))
+
+	sendErr = errors.New("send error")
+	require.Equal(t, sendErr, handler(context.Background(), msg, "my-key", nil))
+
+	// the messages which can't be marshaled are not recorded
+	require.Error(t, handler(context.Background(), make(chan int), "my-key", des))
+
+	entries, err := a.Messages("conn")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, Outbound, entries[0].Direction)
+	require.Equal(t, "1", entries[0].ThreadID)
+	require.Equal(t, "https://didcomm.org/test/1.0/request", entries[0].MessageType)
+	require.Empty(t, entries[0].Error)
+
+	payload, err := json.Marshal(msg)
+	require.NoError(t, err)
+	require.JSONEq(t, string(payload), string(entries[0].Message))
+
+	require.Equal(t, "send error", entries[1].Error)
+}
+
+func TestArchive_RecordTransition(t *testing.T) {
+	store := mockstorage.NewMockStoreProvider()
+
+	a, err := New(&mockProvider{storage: store}, WithConnectionLookup(&mockLookup{threads: map[string]string{"2": "conn"}}))
+	require.NoError(t, err)
+
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "1", Type: "https://didcomm.org/test/1.0/request"}}
+
+	a.RecordTransition("test", "requested", msg, &connectionProps{connectionID: "conn"})
+	a.RecordTransition("test", "completed", &service.DIDCommMsg{Header: &service.Header{ID: "2"}}, nil)
+	a.RecordTransition("test", "abandoned", nil, nil)
+
+	entries, err := a.Messages("conn")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, Transition, entries[0].Direction)
+	require.Equal(t, "test", entries[0].Protocol)
+	require.Equal(t, "requested", entries[0].State)
+	require.Equal(t, "1", entries[0].ThreadID)
+	require.Equal(t, "https://didcomm.org/test/1.0/request", entries[0].MessageType)
+	require.Equal(t, "completed", entries[1].State)
+
+	// the failure to archive the entry is only logged
+	store.Store.ErrPut = errors.New("put error")
+
+	a.RecordTransition("test", "abandoned", msg, &connectionProps{connectionID: "conn"})
+}
+
+type mockProvider struct {
+	storage storage.Provider
+}
+
+func (p *mockProvider) StorageProvider() storage.Provider {
+	return p.storage
+}
+
+type mockLookup struct {
+	keys    map[string]string
+	threads map[string]string
+}
+
+func (l *mockLookup) ConnectionID(theirKey, thID string) string {
+	if id, ok := l.keys[theirKey]; ok {
+		return id
+	}
+
+	return l.threads[thID]
+}
+
+type connectionProps struct {
+	connectionID string
+}
+
+func (p *connectionProps) ConnectionID() string {
+	return p.connectionID
+}
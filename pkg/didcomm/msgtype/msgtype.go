@@ -0,0 +1,245 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgtype
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+)
+
+const (
+	// DIDCommPrefix is the canonical prefix of the message types of the Aries protocols.
+	DIDCommPrefix = "https://didcomm.org/"
+	// LegacyPrefix is the prefix of the message types sent by the agents implementing the older Aries RFCs.
+	LegacyPrefix = "did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/"
+
+	typeField = "@type"
+)
+
+var logger = log.New("aries-framework/msgtype")
+
+// defaultNormalizer aliases the legacy prefix only, it is used by the services to match the message types.
+var defaultNormalizer = NewNormalizer() //nolint:gochecknoglobals
+
+// Normalize returns the canonical form of the message type using the default alias of the legacy prefix.
+func Normalize(msgType string) string {
+	return defaultNormalizer.Normalize(msgType)
+}
+
+// NormalizeMsg rewrites the header type of the message using the default alias of the legacy prefix.
+func NormalizeMsg(msg *service.DIDCommMsg) {
+	defaultNormalizer.NormalizeMsg(msg)
+}
+
+type alias struct {
+	prefix    string
+	canonical string
+}
+
+// Normalizer rewrites the message types starting with the aliased prefixes to their canonical form,
+// e.g. did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/didexchange/1.0/request to https://didcomm.org/didexchange/1.0/request.
+type Normalizer struct {
+	// aliases are sorted by the prefix length, the longest prefix matching the type wins
+	aliases []alias
+}
+
+// Option configures the normalizer.
+type Option func(n *Normalizer)
+
+// WithAlias adds the alias of the canonical prefix, e.g. the prefix of the protocol renamed since it was
+// deployed: did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/connections/1.0/ to https://didcomm.org/didexchange/1.0/.
+func WithAlias(prefix, canonical string) Option {
+	return func(n *Normalizer) {
+		n.aliases = append(n.aliases, alias{prefix: prefix, canonical: canonical})
+	}
+}
+
+// NewNormalizer returns new normalizer, the legacy prefix is always aliased to the canonical one.
+func NewNormalizer(opts ...Option) *Normalizer {
+	n := &Normalizer{aliases: []alias{{prefix: LegacyPrefix, canonical: DIDCommPrefix}}}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	sort.SliceStable(n.aliases, func(i, j int) bool {
+		return len(n.aliases[i].prefix) > len(n.aliases[j].prefix)
+	})
+
+	return n
+}
+
+// Normalize returns the canonical form of the message type, the type is returned as is if no alias matches it.
+func (n *Normalizer) Normalize(msgType string) string {
+	for _, a := range n.aliases {
+		if a.prefix != "" && strings.HasPrefix(msgType, a.prefix) {
+			return a.canonical + strings.TrimPrefix(msgType, a.prefix)
+		}
+	}
+
+	return msgType
+}
+
+// Prefix returns the aliased prefix the message type starts with if the prefix is the alias of the canonical prefix,
+// e.g. the legacy prefix, so that the replies can be sent with the prefix of the sender. It returns empty
+// for the canonical types and for the aliases of the other prefixes, e.g. the renamed protocols.
+func (n *Normalizer) Prefix(msgType string) string {
+	for _, a := range n.aliases {
+		if a.prefix != "" && strings.HasPrefix(msgType, a.prefix) {
+			if a.canonical != DIDCommPrefix {
+				return ""
+			}
+
+			return a.prefix
+		}
+	}
+
+	return ""
+}
+
+// NormalizeMsg rewrites the header type of the message to its canonical form, the payload is left as received.
+func (n *Normalizer) NormalizeMsg(msg *service.DIDCommMsg) {
+	if msg == nil || msg.Header == nil {
+		return
+	}
+
+	msg.Header.Type = n.Normalize(msg.Header.Type)
+}
+
+// WithPrefix returns the message type with the canonical prefix replaced by the given one, the type is returned
+// as is if it doesn't have the canonical prefix or the prefix is empty.
+func WithPrefix(msgType, prefix string) string {
+	if prefix == "" || !strings.HasPrefix(msgType, DIDCommPrefix) {
+		return msgType
+	}
+
+	return prefix + strings.TrimPrefix(msgType, DIDCommPrefix)
+}
+
+// PrefixLookup finds the message type prefix chosen for the connection.
+type PrefixLookup interface {
+	// MessageTypePrefix returns the prefix of the message types sent to the party owning the key or
+	// to the party of the thread, empty if the canonical prefix is used.
+	MessageTypePrefix(theirKey, thID string) string
+}
+
+// PrefixRecorder records the message type prefix the other party uses on the thread.
+type PrefixRecorder interface {
+	// SaveMessageTypePrefix saves the prefix of the message types received on the thread.
+	SaveMessageTypePrefix(thID, prefix string) error
+}
+
+// InboundMiddleware returns the middleware recording the aliased prefix of the inbound message type per thread,
+// so that the replies on the thread mirror it, e.g. the response to the DID exchange request of the agent
+// implementing the older RFCs is sent with the legacy prefix before the connection exists.
+func InboundMiddleware(recorder PrefixRecorder) dispatcher.InboundMiddleware {
+	return func(next dispatcher.InboundHandler) dispatcher.InboundHandler {
+		return func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string, recipientVerKeys []string) error {
+			if msg.Inbound != nil && msg.Inbound.MessageTypePrefix != "" {
+				if thID, err := msg.ThreadID(); err == nil && thID != "" {
+					if err := recorder.SaveMessageTypePrefix(thID, msg.Inbound.MessageTypePrefix); err != nil {
+						// the replies are sent with the canonical type rather than the message is rejected
+						logger.Warnf("inbound message type prefix not recorded: %s", err)
+					}
+				}
+			}
+
+			return next(ctx, msg, senderVerKey, recipientVerKeys)
+		}
+	}
+}
+
+// OutboundMiddleware returns the middleware rewriting the type of the outbound message to the prefix
+// chosen for the connection or mirrored on the thread, so that the agents implementing the older RFCs understand
+// the message. The message is marshaled once and passed on marshaled, the type is rewritten only if the prefix
+// is not the canonical one.
+func OutboundMiddleware(lookup PrefixLookup) dispatcher.OutboundMiddleware {
+	return func(next dispatcher.OutboundHandler) dispatcher.OutboundHandler {
+		return func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+			rewritten, err := rewrite(lookup, msg, des)
+			if err != nil {
+				// the message is sent with the canonical type rather than not sent at all
+				logger.Warnf("outbound message type not rewritten: %s", err)
+
+				return next(ctx, msg, senderVerKey, des)
+			}
+
+			return next(ctx, rewritten, senderVerKey, des)
+		}
+	}
+}
+
+// header is the part of the message the prefix is looked up by.
+type header struct {
+	ID     string `json:"@id"`
+	Type   string `json:"@type"`
+	Thread struct {
+		ID string `json:"thid"`
+	} `json:"~thread"`
+}
+
+func rewrite(lookup PrefixLookup, msg interface{}, des *service.Destination) (interface{}, error) {
+	payload, ok := msg.(json.RawMessage)
+	if !ok {
+		var err error
+
+		payload, err = json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h := &header{}
+	if err := json.Unmarshal(payload, h); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(h.Type, DIDCommPrefix) {
+		return payload, nil
+	}
+
+	var theirKey string
+	if des != nil && len(des.RecipientKeys) > 0 {
+		theirKey = des.RecipientKeys[0]
+	}
+
+	// the thread ID is the ID of the message starting the thread
+	thID := h.Thread.ID
+	if thID == "" {
+		thID = h.ID
+	}
+
+	prefix := lookup.MessageTypePrefix(theirKey, thID)
+	if prefix == "" || prefix == DIDCommPrefix {
+		return payload, nil
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+
+	msgType, err := json.Marshal(WithPrefix(h.Type, prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	fields[typeField] = msgType
+
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(rewritten), nil
+}
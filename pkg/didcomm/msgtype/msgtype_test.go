@@ -0,0 +1,203 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgtype
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+const (
+	requestType       = "https://didcomm.org/didexchange/1.0/request"
+	legacyRequestType = "did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/didexchange/1.0/request"
+)
+
+func TestNormalize(t *testing.T) {
+	require.Equal(t, requestType, Normalize(legacyRequestType))
+	require.Equal(t, requestType, Normalize(requestType))
+	require.Equal(t, "https://example.com/test/1.0/message", Normalize("https://example.com/test/1.0/message"))
+
+	msg := &service.DIDCommMsg{Header: &service.Header{Type: legacyRequestType}}
+	NormalizeMsg(msg)
+	require.Equal(t, requestType, msg.Header.Type)
+
+	// messages without header are left as is
+	NormalizeMsg(&service.DIDCommMsg{})
+	NormalizeMsg(nil)
+}
+
+func TestNormalizer_Normalize(t *testing.T) {
+	n := NewNormalizer(
+		WithAlias(LegacyPrefix+"connections/1.0/", DIDCommPrefix+"didexchange/1.0/"),
+		WithAlias("https://example.com/", DIDCommPrefix),
+		WithAlias("", "https://ignored.com/"))
+
+	// the longest prefix wins
+	require.Equal(t, requestType, n.Normalize(LegacyPrefix+"connections/1.0/request"))
+	require.Equal(t, requestType, n.Normalize(legacyRequestType))
+	require.Equal(t, requestType, n.Normalize("https://example.com/didexchange/1.0/request"))
+	require.Equal(t, "message", n.Normalize("message"))
+}
+
+func TestNormalizer_Prefix(t *testing.T) {
+	n := NewNormalizer(
+		WithAlias(LegacyPrefix+"connections/1.0/", DIDCommPrefix+"didexchange/1.0/"),
+		WithAlias("https://example.com/", DIDCommPrefix))
+
+	require.Equal(t, LegacyPrefix, n.Prefix(legacyRequestType))
+	require.Equal(t, "https://example.com/", n.Prefix("https://example.com/didexchange/1.0/request"))
+	require.Empty(t, n.Prefix(requestType))
+	// the alias of the renamed protocol can't be mirrored by the prefix
+	require.Empty(t, n.Prefix(LegacyPrefix+"connections/1.0/request"))
+}
+
+func TestWithPrefix(t *testing.T) {
+	require.Equal(t, legacyRequestType, WithPrefix(requestType, LegacyPrefix))
+	require.Equal(t, requestType, WithPrefix(requestType, ""))
+	require.Equal(t, legacyRequestType, WithPrefix(legacyRequestType, "https://example.com/"))
+}
+
+func TestOutboundMiddleware(t *testing.T) {
+	lookup := &mockLookup{prefixes: map[string]string{"legacy-key": LegacyPrefix}}
+
+	var sent interface{}
+
+	handler := OutboundMiddleware(lookup)(
+		func(_ context.Context, msg interface{}, _ string, _ *service.Destination) error {
+			sent = msg
+			return nil
+		})
+
+	t.Run("test type rewritten for connection", func(t *testing.T) {
+		msg := map[string]interface{}{"@id": "1", "@type": requestType, "label": "alice"}
+
+		require.NoError(t, handler(context.Background(), msg, "", &service.Destination{
+			RecipientKeys: []string{"legacy-key"},
+		}))
+
+		fields := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(sent.(json.RawMessage), &fields))
+		require.Equal(t, legacyRequestType, fields["@type"])
+		require.Equal(t, "alice", fields["label"])
+		require.Equal(t, "legacy-key", lookup.theirKey)
+		require.Equal(t, "1", lookup.thID)
+	})
+
+	t.Run("test type rewritten for thread", func(t *testing.T) {
+		lookup.prefixes["2"] = LegacyPrefix
+		defer delete(lookup.prefixes, "2")
+
+		// the marshaled message is not marshaled again
+		msg := json.RawMessage(`{"@id":"3","@type":"` + requestType + `","~thread":{"thid":"2"}}`)
+
+		require.NoError(t, handler(context.Background(), msg, "", nil))
+
+		fields := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(sent.(json.RawMessage), &fields))
+		require.Equal(t, legacyRequestType, fields["@type"])
+		require.Equal(t, "2", lookup.thID)
+	})
+
+	t.Run("test type kept without prefix", func(t *testing.T) {
+		msg := map[string]interface{}{"@id": "1", "@type": requestType}
+
+		require.NoError(t, handler(context.Background(), msg, "", &service.Destination{
+			RecipientKeys: []string{"other-key"},
+		}))
+		require.JSONEq(t, `{"@id": "1", "@type": "`+requestType+`"}`, string(sent.(json.RawMessage)))
+
+		require.NoError(t, handler(context.Background(), msg, "", nil))
+		require.JSONEq(t, `{"@id": "1", "@type": "`+requestType+`"}`, string(sent.(json.RawMessage)))
+	})
+
+	t.Run("test non canonical type kept", func(t *testing.T) {
+		msg := map[string]interface{}{"@id": "1", "@type": "https://example.com/test/1.0/message"}
+
+		require.NoError(t, handler(context.Background(), msg, "", &service.Destination{
+			RecipientKeys: []string{"legacy-key"},
+		}))
+		require.JSONEq(t, `{"@id": "1", "@type": "https://example.com/test/1.0/message"}`,
+			string(sent.(json.RawMessage)))
+	})
+
+	t.Run("test message sent as is if not rewritten", func(t *testing.T) {
+		msg := make(chan int)
+
+		require.NoError(t, handler(context.Background(), msg, "", nil))
+		require.Equal(t, msg, sent)
+
+		require.NoError(t, handler(context.Background(), "not a message", "", nil))
+		require.Equal(t, "not a message", sent)
+	})
+}
+
+func TestInboundMiddleware(t *testing.T) {
+	recorder := &mockRecorder{prefixes: make(map[string]string)}
+
+	var handled int
+
+	handler := InboundMiddleware(recorder)(
+		func(context.Context, *service.DIDCommMsg, string, []string) error {
+			handled++
+			return nil
+		})
+
+	msg, err := service.NewDIDCommMsg([]byte(`{"@id": "2", "@type": "` + requestType + `", "~thread": {"thid": "1"}}`))
+	require.NoError(t, err)
+
+	// the canonical prefix is not recorded
+	msg.Inbound = &service.InboundContext{}
+	require.NoError(t, handler(context.Background(), msg, "", nil))
+	require.Empty(t, recorder.prefixes)
+
+	msg.Inbound.MessageTypePrefix = LegacyPrefix
+	require.NoError(t, handler(context.Background(), msg, "", nil))
+	require.Equal(t, LegacyPrefix, recorder.prefixes["1"])
+
+	// the message is handled even if the prefix is not recorded
+	recorder.err = errors.New("save error")
+	require.NoError(t, handler(context.Background(), msg, "", nil))
+	require.Equal(t, 3, handled)
+}
+
+type mockRecorder struct {
+	prefixes map[string]string
+	err      error
+}
+
+func (m *mockRecorder) SaveMessageTypePrefix(thID, prefix string) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.prefixes[thID] = prefix
+
+	return nil
+}
+
+type mockLookup struct {
+	prefixes map[string]string
+	theirKey string
+	thID     string
+}
+
+func (m *mockLookup) MessageTypePrefix(theirKey, thID string) string {
+	m.theirKey = theirKey
+	m.thID = thID
+
+	if prefix, ok := m.prefixes[thID]; ok {
+		return prefix
+	}
+
+	return m.prefixes[theirKey]
+}
@@ -0,0 +1,200 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgtype
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+// VersionProblemCode is the code of the problem report sent for the message of the unsupported major version.
+const VersionProblemCode = "version-not-supported"
+
+const (
+	// <doc-uri><protocol>/<major>.<minor>/<name>
+	typeSegments    = 3
+	versionSegments = 2
+)
+
+// ErrProtocolNotSupported is returned by Negotiate if none of the versions of the message protocol is supported.
+var ErrProtocolNotSupported = errors.New("protocol not supported")
+
+// MessageType is the message type URI split according to the Aries message type rules,
+// e.g. https://didcomm.org/didexchange/1.0/request.
+type MessageType struct {
+	DocURI   string
+	Protocol string
+	Major    int
+	Minor    int
+	Name     string
+}
+
+// Parse splits the message type URI <doc-uri><protocol>/<major>.<minor>/<name>, the protocol identifier URI
+// <doc-uri><protocol>/<major>.<minor> without the message name is parsed as well.
+func Parse(msgType string) (*MessageType, error) {
+	segments := strings.Split(msgType, "/")
+	if len(segments) < typeSegments {
+		return nil, fmt.Errorf("invalid message type: %s", msgType)
+	}
+
+	if t, err := parseSegments(segments, true); err == nil {
+		return t, nil
+	}
+
+	t, err := parseSegments(segments, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message type %s: %w", msgType, err)
+	}
+
+	return t, nil
+}
+
+func parseSegments(segments []string, named bool) (*MessageType, error) {
+	t := &MessageType{}
+
+	if named {
+		t.Name = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+
+		if t.Name == "" {
+			return nil, errors.New("empty message name")
+		}
+	}
+
+	version := strings.Split(segments[len(segments)-1], ".")
+	if len(version) != versionSegments {
+		return nil, fmt.Errorf("invalid version: %s", segments[len(segments)-1])
+	}
+
+	var err error
+
+	if t.Major, err = strconv.Atoi(version[0]); err != nil {
+		return nil, fmt.Errorf("invalid major version: %w", err)
+	}
+
+	if t.Minor, err = strconv.Atoi(version[1]); err != nil {
+		return nil, fmt.Errorf("invalid minor version: %w", err)
+	}
+
+	t.Protocol = segments[len(segments)-2]
+	t.DocURI = strings.Join(segments[:len(segments)-2], "/") + "/"
+
+	if t.Protocol == "" || t.Major < 0 || t.Minor < 0 {
+		return nil, errors.New("invalid protocol")
+	}
+
+	return t, nil
+}
+
+// PIURI returns the protocol identifier URI of the message type, e.g. https://didcomm.org/didexchange/1.0.
+func (t *MessageType) PIURI() string {
+	return fmt.Sprintf("%s%s/%d.%d", t.DocURI, t.Protocol, t.Major, t.Minor)
+}
+
+func (t *MessageType) String() string {
+	return t.PIURI() + "/" + t.Name
+}
+
+// sameProtocol returns true if the types belong to the same protocol regardless of the version.
+func (t *MessageType) sameProtocol(other *MessageType) bool {
+	return t.DocURI == other.DocURI && t.Protocol == other.Protocol
+}
+
+// VersionError is returned for the message of the protocol supported in the other major versions only.
+// It holds the details needed to report the problem to the sender.
+type VersionError struct {
+	// MsgID is the @id of the message, the problem report is threaded by it.
+	MsgID   string
+	MsgType string
+	// Supported are the protocol identifier URIs of the supported versions, e.g. https://didcomm.org/didexchange/1.0.
+	Supported []string
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("unsupported version of message %s of type %s, supported versions: %s",
+		e.MsgID, e.MsgType, strings.Join(e.Supported, ", "))
+}
+
+// Negotiate returns the message type of the supported protocol version which matches the message type best
+// according to the Aries semver rules: the version of the same major version and the nearest lower minor version
+// is preferred, the nearest higher minor version is chosen otherwise. The protocols are the protocol identifier
+// URIs of the supported versions. VersionError is returned if the protocol is supported in the other major
+// versions only, ErrProtocolNotSupported if it is not supported at all.
+func Negotiate(msgType string, protocols []string) (*MessageType, error) {
+	received, err := Parse(msgType)
+	if err != nil || received.Name == "" {
+		return nil, ErrProtocolNotSupported
+	}
+
+	var (
+		best  *MessageType
+		known []string
+	)
+
+	for _, protocol := range protocols {
+		supported, err := Parse(protocol)
+		if err != nil || !supported.sameProtocol(received) {
+			continue
+		}
+
+		known = append(known, supported.PIURI())
+
+		if supported.Major == received.Major && closer(supported.Minor, best, received.Minor) {
+			best = supported
+		}
+	}
+
+	if best != nil {
+		return &MessageType{
+			DocURI:   best.DocURI,
+			Protocol: best.Protocol,
+			Major:    best.Major,
+			Minor:    best.Minor,
+			Name:     received.Name,
+		}, nil
+	}
+
+	if len(known) > 0 {
+		return nil, &VersionError{MsgType: msgType, Supported: known}
+	}
+
+	return nil, ErrProtocolNotSupported
+}
+
+// NegotiateMsg rewrites the header type of the message to the type of the best matching supported protocol
+// version, the type is left as is if no version matches it.
+func NegotiateMsg(msg *service.DIDCommMsg, protocols []string) {
+	if msg == nil || msg.Header == nil {
+		return
+	}
+
+	if t, err := Negotiate(msg.Header.Type, protocols); err == nil {
+		msg.Header.Type = t.String()
+	}
+}
+
+// closer returns true if the minor version matches the received one better than the best so far.
+func closer(minor int, best *MessageType, received int) bool {
+	if best == nil {
+		return true
+	}
+
+	// the lower minor versions are preferred as the sender is expected to downgrade to them
+	if (minor <= received) != (best.Minor <= received) {
+		return minor <= received
+	}
+
+	if minor <= received {
+		return minor > best.Minor
+	}
+
+	return minor < best.Minor
+}
@@ -0,0 +1,127 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package msgtype
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("test message type", func(t *testing.T) {
+		msgType, err := Parse(requestType)
+		require.NoError(t, err)
+		require.Equal(t, &MessageType{
+			DocURI:   DIDCommPrefix,
+			Protocol: "didexchange",
+			Major:    1,
+			Minor:    0,
+			Name:     "request",
+		}, msgType)
+		require.Equal(t, "https://didcomm.org/didexchange/1.0", msgType.PIURI())
+		require.Equal(t, requestType, msgType.String())
+
+		msgType, err = Parse(legacyRequestType)
+		require.NoError(t, err)
+		require.Equal(t, LegacyPrefix, msgType.DocURI)
+		require.Equal(t, legacyRequestType, msgType.String())
+	})
+
+	t.Run("test protocol identifier", func(t *testing.T) {
+		msgType, err := Parse("https://didcomm.org/didexchange/1.12")
+		require.NoError(t, err)
+		require.Equal(t, "didexchange", msgType.Protocol)
+		require.Equal(t, 12, msgType.Minor)
+		require.Empty(t, msgType.Name)
+	})
+
+	t.Run("test invalid message type", func(t *testing.T) {
+		for _, msgType := range []string{
+			"",
+			"request",
+			"didexchange/1.0",
+			"https://didcomm.org/didexchange/1/request",
+			"https://didcomm.org/didexchange/1.0.1/request",
+			"https://didcomm.org/didexchange/a.0/request",
+			"https://didcomm.org/didexchange/1.b/request",
+			"https://didcomm.org/didexchange/1.-1/request",
+			"https://didcomm.org//1.0/request",
+			"https://didcomm.org/didexchange/1.0/",
+		} {
+			_, err := Parse(msgType)
+			require.Error(t, err, msgType)
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	protocols := []string{
+		"https://didcomm.org/didexchange/1.0",
+		"https://didcomm.org/didexchange/1.2",
+		"https://didcomm.org/didexchange/1.4",
+		"https://didcomm.org/introduce/1.0",
+		"invalid",
+	}
+
+	for received, expected := range map[string]string{
+		"https://didcomm.org/didexchange/1.0/request": "https://didcomm.org/didexchange/1.0/request",
+		"https://didcomm.org/didexchange/1.1/request": "https://didcomm.org/didexchange/1.0/request",
+		"https://didcomm.org/didexchange/1.3/request": "https://didcomm.org/didexchange/1.2/request",
+		"https://didcomm.org/didexchange/1.9/request": "https://didcomm.org/didexchange/1.4/request",
+		"https://didcomm.org/introduce/1.1/proposal":  "https://didcomm.org/introduce/1.0/proposal",
+	} {
+		msgType, err := Negotiate(received, protocols)
+		require.NoError(t, err)
+		require.Equal(t, expected, msgType.String())
+	}
+
+	// the nearest higher minor version is chosen if there is no lower one
+	msgType, err := Negotiate("https://didcomm.org/didexchange/1.0/request", protocols[1:])
+	require.NoError(t, err)
+	require.Equal(t, "https://didcomm.org/didexchange/1.2/request", msgType.String())
+
+	_, err = Negotiate("https://didcomm.org/didexchange/2.0/request", protocols)
+	require.Error(t, err)
+
+	var versionErr *VersionError
+	require.True(t, errors.As(err, &versionErr))
+	require.Equal(t, "https://didcomm.org/didexchange/2.0/request", versionErr.MsgType)
+	require.Equal(t, protocols[:3], versionErr.Supported)
+
+	versionErr.MsgID = "1"
+	require.Contains(t, versionErr.Error(), "unsupported version of message 1 of type "+
+		"https://didcomm.org/didexchange/2.0/request, supported versions: https://didcomm.org/didexchange/1.0, ")
+
+	for _, msgType := range []string{
+		"https://didcomm.org/other/1.0/request",
+		legacyRequestType,
+		"https://didcomm.org/didexchange/1.0",
+		"invalid",
+	} {
+		_, err = Negotiate(msgType, protocols)
+		require.True(t, errors.Is(err, ErrProtocolNotSupported), msgType)
+	}
+}
+
+func TestNegotiateMsg(t *testing.T) {
+	protocols := []string{"https://didcomm.org/didexchange/1.0"}
+
+	msg := &service.DIDCommMsg{Header: &service.Header{Type: "https://didcomm.org/didexchange/1.1/request"}}
+	NegotiateMsg(msg, protocols)
+	require.Equal(t, requestType, msg.Header.Type)
+
+	msg = &service.DIDCommMsg{Header: &service.Header{Type: "https://didcomm.org/didexchange/2.0/request"}}
+	NegotiateMsg(msg, protocols)
+	require.Equal(t, "https://didcomm.org/didexchange/2.0/request", msg.Header.Type)
+
+	NegotiateMsg(&service.DIDCommMsg{}, protocols)
+	NegotiateMsg(nil, protocols)
+}
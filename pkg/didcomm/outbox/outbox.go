@@ -0,0 +1,679 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+var logger = log.New("aries-framework/outbox")
+
+const (
+	// StoreName is the name of the store of the queued messages.
+	StoreName = "outbox"
+	// DeadLetterStoreName is the name of the store of the messages which could not be delivered.
+	DeadLetterStoreName = "outbox-dead-letter"
+
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	// defaultDeadLetterRetention is the time the dead letters are kept for the manual retry
+	defaultDeadLetterRetention = 30 * 24 * time.Hour
+	// sweepInterval is the minimal interval between the sweeps of the expired dead letters
+	sweepInterval = time.Hour
+)
+
+const (
+	// EventSent the message was delivered.
+	EventSent = "sent"
+	// EventRetry the delivery attempt failed, the message is queued for the next attempt.
+	EventRetry = "retry"
+	// EventDeadLetter the last delivery attempt failed, the message was moved to the dead-letter store.
+	EventDeadLetter = "dead-letter"
+)
+
+// ErrNotFound is returned if there is no queued or dead-lettered message with the given ID.
+var ErrNotFound = errors.New("outbox message not found")
+
+// DeliveryError is returned by Send if the first delivery attempt failed and no attempts are left,
+// the message was moved to the dead-letter store.
+type DeliveryError struct {
+	// ID is the ID of the outbox record of the message.
+	ID  string
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("message %s moved to dead-letter store: %s", e.ID, e.Err)
+}
+
+// Unwrap returns the error of the failed delivery attempt.
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Event reports the result of the delivery attempt.
+type Event struct {
+	Type   string
+	Record *Record
+	// Err is the error of the failed delivery attempt.
+	Err error
+}
+
+// provider contains dependencies for the outbox and is typically created by using aries.Context()
+type provider interface {
+	StorageProvider() storage.Provider
+}
+
+// Outbox persists the outbound messages before sending them and retries the failed deliveries with exponential
+// backoff and jitter. The messages which could not be delivered after the maximum number of attempts are moved
+// to the dead-letter store, the dead letters are deleted once the retention expires. The delivered messages are
+// deleted. Outbox implements dispatcher.Outbound and wraps the dispatcher sending the messages.
+type Outbox struct {
+	outbound       dispatcher.Outbound
+	queue          *recordStore
+	deadLetters    *recordStore
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	retention      time.Duration
+	now            func() time.Time
+
+	mu       sync.Mutex
+	inFlight map[string]struct{}
+	events   []chan<- Event
+	// retries is the index of the scheduled attempts, the worker retries the records once they are due
+	retries retryHeap
+	// lastSweep is the time of the last sweep of the expired dead letters, it is used by the worker only
+	lastSweep time.Time
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	// retryCtx is cancelled when the outbox is closed to abort the retries in flight
+	retryCtx    context.Context
+	cancelRetry context.CancelFunc
+}
+
+// Option configures the outbox.
+type Option func(o *Outbox)
+
+// WithMaxAttempts sets the number of delivery attempts before the message is moved to the dead-letter store.
+func WithMaxAttempts(n int) Option {
+	return func(o *Outbox) {
+		o.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the maximum delay between the retries. The delay
+// is doubled after every failed attempt.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(o *Outbox) {
+		o.initialBackoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// WithDeadLetterRetention sets the time the dead letters are kept for the manual retry before they are deleted.
+func WithDeadLetterRetention(d time.Duration) Option {
+	return func(o *Outbox) {
+		o.retention = d
+	}
+}
+
+// New returns new outbox instance sending the messages through the given outbound dispatcher. The messages
+// queued before the agent restart are resumed.
+func New(prov provider, outbound dispatcher.Outbound, opts ...Option) (*Outbox, error) {
+	queue, err := prov.StorageProvider().OpenStore(StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open outbox store: %w", err)
+	}
+
+	deadLetters, err := prov.StorageProvider().OpenStore(DeadLetterStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open outbox dead-letter store: %w", err)
+	}
+
+	o := &Outbox{
+		outbound:       outbound,
+		queue:          &recordStore{store: queue},
+		deadLetters:    &recordStore{store: deadLetters},
+		maxAttempts:    defaultMaxAttempts,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		retention:      defaultDeadLetterRetention,
+		now:            time.Now,
+		inFlight:       make(map[string]struct{}),
+		wake:           make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.maxAttempts < 1 {
+		return nil, fmt.Errorf("invalid max attempts: %d", o.maxAttempts)
+	}
+
+	if o.retention <= 0 {
+		return nil, fmt.Errorf("invalid dead-letter retention: %s", o.retention)
+	}
+
+	if err := o.resume(); err != nil {
+		return nil, err
+	}
+
+	o.retryCtx, o.cancelRetry = context.WithCancel(context.Background())
+
+	go o.run()
+
+	return o, nil
+}
+
+// Send persists the message and makes the first delivery attempt. If the attempt fails the message is queued
+// for the retries and nil is returned, the message is delivered later: the failed attempt and the result of
+// the retries are reported through the events. The *DeliveryError is returned only if no attempts are left.
+func (o *Outbox) Send(msg interface{}, senderVerKey string, des *service.Destination) error {
+	return o.SendContext(context.Background(), msg, senderVerKey, des)
+}
+
+// SendContext is Send with the first delivery attempt aborted when the context is done, the message is
+// queued for the retries in that case.
+func (o *Outbox) SendContext(ctx context.Context, msg interface{}, senderVerKey string,
+	des *service.Destination) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("outbox send: failed marshal to bytes: %w", err)
+	}
+
+	now := o.now()
+
+	r := &Record{
+		ID:           uuid.New().String(),
+		Message:      bytes,
+		SenderVerKey: senderVerKey,
+		Destination:  des,
+		Status:       StatusQueued,
+		NextAttempt:  now,
+		CreatedAt:    now,
+	}
+
+	o.lock(r.ID)
+	defer o.unlock(r.ID)
+
+	if err := o.queue.save(r); err != nil {
+		return fmt.Errorf("outbox send: %w", err)
+	}
+
+	if err := o.attempt(ctx, r); err != nil && r.Status == StatusDeadLetter {
+		return fmt.Errorf("outbox send: %w", &DeliveryError{ID: r.ID, Err: err})
+	}
+
+	return nil
+}
+
+// Queued returns the messages waiting for the delivery.
+func (o *Outbox) Queued() ([]*Record, error) {
+	return o.queue.list(StatusQueued)
+}
+
+// DeadLetters returns the messages which could not be delivered.
+func (o *Outbox) DeadLetters() ([]*Record, error) {
+	return o.deadLetters.list(StatusDeadLetter)
+}
+
+// Retry schedules the immediate delivery of the queued message, the dead-lettered message is moved back
+// to the queue with the attempts counter reset.
+func (o *Outbox) Retry(id string) error {
+	if !o.lock(id) {
+		return fmt.Errorf("retry %s: delivery in progress", id)
+	}
+	defer o.unlock(id)
+
+	r, store, err := o.find(id)
+	if err != nil {
+		return fmt.Errorf("retry %s: %w", id, err)
+	}
+
+	if store == o.deadLetters {
+		r.Attempts = 0
+		r.DeadLetteredAt = time.Time{}
+	}
+
+	r.Status = StatusQueued
+	r.NextAttempt = o.now()
+
+	if err := o.queue.save(r); err != nil {
+		return fmt.Errorf("retry %s: %w", id, err)
+	}
+
+	o.schedule(r.ID, r.NextAttempt)
+
+	if store == o.deadLetters {
+		if err := o.deadLetters.delete(id); err != nil {
+			return fmt.Errorf("retry %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Purge removes the message from the queue or the dead-letter store.
+func (o *Outbox) Purge(id string) error {
+	if !o.lock(id) {
+		return fmt.Errorf("purge %s: delivery in progress", id)
+	}
+	defer o.unlock(id)
+
+	_, store, err := o.find(id)
+	if err != nil {
+		return fmt.Errorf("purge %s: %w", id, err)
+	}
+
+	if err := store.delete(id); err != nil {
+		return fmt.Errorf("purge %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// RegisterEvent registers the channel the delivery events are sent to.
+func (o *Outbox) RegisterEvent(ch chan<- Event) error {
+	if ch == nil {
+		return service.ErrNilChannel
+	}
+
+	o.mu.Lock()
+	o.events = append(o.events, ch)
+	o.mu.Unlock()
+
+	return nil
+}
+
+// UnregisterEvent unregisters the channel. Refer RegisterEvent().
+func (o *Outbox) UnregisterEvent(ch chan<- Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := 0; i < len(o.events); i++ {
+		if o.events[i] == ch {
+			o.events = append(o.events[:i], o.events[i+1:]...)
+			i--
+		}
+	}
+
+	return nil
+}
+
+// Close stops the retries and aborts the retries in flight, the queued messages are resumed by the next
+// outbox instance.
+func (o *Outbox) Close() error {
+	o.closeOnce.Do(func() {
+		o.cancelRetry()
+		close(o.stop)
+		<-o.done
+	})
+
+	return nil
+}
+
+// find returns the queued or dead-lettered record with the store it belongs to.
+func (o *Outbox) find(id string) (*Record, *recordStore, error) {
+	for _, store := range []*recordStore{o.queue, o.deadLetters} {
+		r, err := store.get(id)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if r.Status == StatusQueued || r.Status == StatusDeadLetter {
+			return r, store, nil
+		}
+	}
+
+	return nil, nil, ErrNotFound
+}
+
+// resume schedules the records queued before the restart. The records of the other statuses left by
+// the earlier versions of the outbox are deleted.
+func (o *Outbox) resume() error {
+	for store, status := range map[*recordStore]string{o.queue: StatusQueued, o.deadLetters: StatusDeadLetter} {
+		records, err := store.all()
+		if err != nil {
+			return fmt.Errorf("resume outbox: %w", err)
+		}
+
+		for _, r := range records {
+			if r.Status != status {
+				if err := store.delete(r.ID); err != nil {
+					return fmt.Errorf("resume outbox: %w", err)
+				}
+
+				continue
+			}
+
+			if status == StatusQueued {
+				heap.Push(&o.retries, &retry{id: r.ID, at: r.NextAttempt})
+			}
+		}
+	}
+
+	return nil
+}
+
+// attempt sends the record and updates it with the result, it returns the error of the failed attempt.
+// The caller must hold the lock of the record.
+func (o *Outbox) attempt(ctx context.Context, r *Record) error {
+	err := dispatcher.SendContext(ctx, o.outbound, r.Message, r.SenderVerKey, r.Destination)
+	if err != nil && ctx.Err() != nil {
+		// the aborted attempt is not counted, the message is retried by the worker
+		r.LastError = err.Error()
+		r.NextAttempt = o.now().Add(o.backoff(r.Attempts + 1))
+
+		o.requeue(r, err)
+
+		return err
+	}
+
+	r.Attempts++
+
+	switch {
+	case err == nil:
+		o.delivered(r)
+	case r.Attempts >= o.maxAttempts:
+		r.LastError = err.Error()
+
+		o.deadLetter(r, err)
+	default:
+		r.LastError = err.Error()
+		r.NextAttempt = o.now().Add(o.backoff(r.Attempts))
+
+		o.requeue(r, err)
+	}
+
+	return err
+}
+
+// delivered deletes the delivered record from the queue.
+func (o *Outbox) delivered(r *Record) {
+	if err := o.queue.delete(r.ID); err != nil {
+		logger.Errorf("outbox: failed to delete delivered message %s: %s", r.ID, err)
+	}
+
+	r.Status = statusSent
+	r.LastError = ""
+
+	o.notify(EventSent, r, nil)
+}
+
+// deadLetter moves the record to the dead-letter store.
+func (o *Outbox) deadLetter(r *Record, err error) {
+	moved := *r
+	moved.Status = StatusDeadLetter
+	moved.DeadLetteredAt = o.now()
+
+	if e := o.deadLetters.save(&moved); e != nil {
+		logger.Errorf("outbox: failed to move message %s to dead-letter store: %s", r.ID, e)
+		// the record is still queued with the previous attempt, it is retried later
+		o.schedule(r.ID, o.now().Add(o.backoff(r.Attempts)))
+
+		return
+	}
+
+	if e := o.queue.delete(r.ID); e != nil {
+		logger.Errorf("outbox: failed to delete dead-lettered message %s from queue: %s", r.ID, e)
+	}
+
+	*r = moved
+
+	o.notify(EventDeadLetter, r, err)
+}
+
+// requeue saves the record for the next attempt and schedules it.
+func (o *Outbox) requeue(r *Record, err error) {
+	if e := o.queue.save(r); e != nil {
+		logger.Errorf("outbox: failed to save message %s: %s", r.ID, e)
+	}
+
+	o.schedule(r.ID, r.NextAttempt)
+	o.notify(EventRetry, r, err)
+}
+
+// notify sends the event to the registered channels, the event is dropped for the channel which is full.
+func (o *Outbox) notify(eventType string, r *Record, err error) {
+	o.mu.Lock()
+	events := append(o.events[:0:0], o.events...)
+	o.mu.Unlock()
+
+	for _, ch := range events {
+		record := *r
+
+		select {
+		case ch <- Event{Type: eventType, Record: &record, Err: err}:
+		default:
+			logger.Warnf("outbox: event %s of message %s dropped, channel is full", eventType, r.ID)
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: the initial backoff doubled after every failed attempt,
+// limited by the max backoff, with a random jitter of up to half of the delay.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.initialBackoff
+
+	for i := 1; i < attempts && delay < o.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > o.maxBackoff {
+		delay = o.maxBackoff
+	}
+
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1)) //nolint:gosec
+	}
+
+	return delay
+}
+
+// lock marks the record in flight, it returns false if the record is already in flight.
+func (o *Outbox) lock(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.inFlight[id]; ok {
+		return false
+	}
+
+	o.inFlight[id] = struct{}{}
+
+	return true
+}
+
+func (o *Outbox) unlock(id string) {
+	o.mu.Lock()
+	delete(o.inFlight, id)
+	o.mu.Unlock()
+}
+
+// schedule adds the attempt of the record to the retry index and wakes up the worker.
+func (o *Outbox) schedule(id string, at time.Time) {
+	o.mu.Lock()
+	heap.Push(&o.retries, &retry{id: id, at: at})
+	o.mu.Unlock()
+
+	o.notifyWorker()
+}
+
+func (o *Outbox) notifyWorker() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run retries the queued messages when they are due.
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	for {
+		timer := time.NewTimer(o.retryDue())
+
+		select {
+		case <-o.stop:
+			timer.Stop()
+			return
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDue retries the due messages, sweeps the expired dead letters and returns the delay until the next
+// message is due or the next sweep.
+func (o *Outbox) retryDue() time.Duration {
+	o.sweepDeadLetters()
+
+	for {
+		select {
+		case <-o.stop:
+			return o.maxBackoff
+		default:
+		}
+
+		id, wait := o.nextDue()
+		if id == "" {
+			if untilSweep := o.lastSweep.Add(sweepInterval).Sub(o.now()); untilSweep < wait {
+				wait = untilSweep
+			}
+
+			return wait
+		}
+
+		o.retry(id)
+	}
+}
+
+// nextDue pops the due attempt from the retry index. If no attempt is due it returns the delay until the next one,
+// limited by the max backoff.
+func (o *Outbox) nextDue() (string, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.retries) == 0 {
+		return "", o.maxBackoff
+	}
+
+	if wait := o.retries[0].at.Sub(o.now()); wait > 0 {
+		if wait > o.maxBackoff {
+			wait = o.maxBackoff
+		}
+
+		return "", wait
+	}
+
+	return heap.Pop(&o.retries).(*retry).id, 0
+}
+
+// retry makes the scheduled attempt of the queued record.
+func (o *Outbox) retry(id string) {
+	if !o.lock(id) {
+		// the record is changed by the caller, it is checked again later
+		o.schedule(id, o.now().Add(o.initialBackoff))
+		return
+	}
+
+	defer o.unlock(id)
+
+	r, err := o.queue.get(id)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		// the record was delivered, moved or purged in the meantime
+		return
+	}
+
+	if err != nil {
+		logger.Errorf("outbox: failed to get queued message %s: %s", id, err)
+		o.schedule(id, o.now().Add(o.initialBackoff))
+
+		return
+	}
+
+	// the record rescheduled in the meantime is retried by its later attempt in the index
+	if r.Status != StatusQueued || r.NextAttempt.After(o.now()) {
+		return
+	}
+
+	// the result of the retry is reported through the events
+	o.attempt(o.retryCtx, r) //nolint:errcheck
+}
+
+// sweepDeadLetters deletes the dead letters older than the retention, at most once per the sweep interval.
+func (o *Outbox) sweepDeadLetters() {
+	now := o.now()
+	if now.Sub(o.lastSweep) < sweepInterval {
+		return
+	}
+
+	o.lastSweep = now
+
+	records, err := o.deadLetters.all()
+	if err != nil {
+		logger.Errorf("outbox: failed to list dead letters: %s", err)
+		return
+	}
+
+	for _, r := range records {
+		if o.expired(r, now) && o.lock(r.ID) {
+			o.deleteExpired(r.ID, now)
+			o.unlock(r.ID)
+		}
+	}
+}
+
+// deleteExpired deletes the expired dead letter. The caller must hold the lock of the record.
+func (o *Outbox) deleteExpired(id string, now time.Time) {
+	// the record might have been retried and dead-lettered again while it was not locked
+	r, err := o.deadLetters.get(id)
+	if err != nil || !o.expired(r, now) {
+		return
+	}
+
+	if err := o.deadLetters.delete(id); err != nil {
+		logger.Errorf("outbox: failed to delete expired dead letter %s: %s", id, err)
+	}
+}
+
+func (o *Outbox) expired(r *Record, now time.Time) bool {
+	at := r.DeadLetteredAt
+	if at.IsZero() {
+		// the dead letter of the earlier version of the outbox
+		at = r.CreatedAt
+	}
+
+	return now.Sub(at) >= o.retention
+}
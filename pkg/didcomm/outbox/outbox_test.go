@@ -0,0 +1,469 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("test success", func(t *testing.T) {
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{})
+		require.NoError(t, err)
+		require.NoError(t, o.Close())
+		// close is idempotent
+		require.NoError(t, o.Close())
+	})
+
+	t.Run("test error from open store", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: &mockstorage.MockStoreProvider{
+			ErrOpenStoreHandle: errors.New("open store error")}}, &mockOutbound{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open store error")
+	})
+
+	t.Run("test invalid max attempts", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{}, WithMaxAttempts(0))
+		require.EqualError(t, err, "invalid max attempts: 0")
+	})
+
+	t.Run("test invalid dead-letter retention", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{}, WithDeadLetterRetention(0))
+		require.EqualError(t, err, "invalid dead-letter retention: 0s")
+	})
+
+	t.Run("test error from resume", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: &mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store: map[string][]byte{recordKeyPrefix + "invalid": []byte("invalid")}}}}, &mockOutbound{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "resume outbox")
+	})
+}
+
+func TestOutbox_Send(t *testing.T) {
+	t.Run("test delivered on the first attempt", func(t *testing.T) {
+		outbound := &mockOutbound{}
+
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, outbound)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		events := make(chan Event, 1)
+		require.NoError(t, o.RegisterEvent(events))
+
+		require.NoError(t, o.Send(map[string]string{"@id": "1"}, "sender", &service.Destination{ServiceEndpoint: "url"}))
+		require.Equal(t, []string{`{"@id":"1"}`}, outbound.sent())
+
+		e := <-events
+		require.Equal(t, EventSent, e.Type)
+		require.Equal(t, 1, e.Record.Attempts)
+		require.Equal(t, "sender", e.Record.SenderVerKey)
+
+		queued, err := o.Queued()
+		require.NoError(t, err)
+		require.Empty(t, queued)
+
+		// the delivered message is deleted
+		_, err = o.queue.get(e.Record.ID)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("test retried and dead-lettered", func(t *testing.T) {
+		outbound := &mockOutbound{err: errors.New("endpoint unavailable")}
+
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, outbound,
+			WithMaxAttempts(3), WithBackoff(time.Millisecond, 4*time.Millisecond))
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		events := make(chan Event, 3)
+		require.NoError(t, o.RegisterEvent(events))
+
+		// the message is queued for the retries
+		require.NoError(t, o.Send("msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+
+		for i := 1; i < 3; i++ {
+			e := receive(t, events)
+			require.Equal(t, EventRetry, e.Type)
+			require.Equal(t, i, e.Record.Attempts)
+			require.EqualError(t, e.Err, "endpoint unavailable")
+		}
+
+		e := receive(t, events)
+		require.Equal(t, EventDeadLetter, e.Type)
+		require.Equal(t, 3, e.Record.Attempts)
+		require.Equal(t, "endpoint unavailable", e.Record.LastError)
+		require.Len(t, outbound.sent(), 3)
+
+		queued, err := o.Queued()
+		require.NoError(t, err)
+		require.Empty(t, queued)
+
+		deadLetters, err := o.DeadLetters()
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, e.Record.ID, deadLetters[0].ID)
+		require.False(t, deadLetters[0].DeadLetteredAt.IsZero())
+
+		// the dead-lettered message is deleted from the queue
+		_, err = o.queue.get(e.Record.ID)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("test aborted attempt is not counted", func(t *testing.T) {
+		outbound := &mockOutbound{err: errors.New("endpoint unavailable")}
+
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, outbound, WithMaxAttempts(1),
+			WithBackoff(time.Hour, time.Hour))
+		require.NoError(t, err)
+
+		events := make(chan Event, 1)
+		require.NoError(t, o.RegisterEvent(events))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.NoError(t, o.SendContext(ctx, "msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+		require.NoError(t, o.Close())
+
+		e := receive(t, events)
+		require.Equal(t, EventRetry, e.Type)
+		require.Equal(t, 0, e.Record.Attempts)
+		require.True(t, errors.Is(e.Err, context.Canceled))
+		require.Empty(t, outbound.sent())
+
+		queued, err := o.Queued()
+		require.NoError(t, err)
+		require.Len(t, queued, 1)
+	})
+
+	t.Run("test marshal error", func(t *testing.T) {
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{})
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		err = o.Send(make(chan int), "sender", &service.Destination{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed marshal to bytes")
+	})
+
+	t.Run("test store error", func(t *testing.T) {
+		o, err := New(&mockProvider{storage: &mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store: make(map[string][]byte), ErrPut: errors.New("put error")}}}, &mockOutbound{})
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		err = o.Send("msg", "sender", &service.Destination{})
+		require.EqualError(t, err, "outbox send: put error")
+	})
+
+	t.Run("test event dropped for full channel", func(t *testing.T) {
+		o, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{})
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		full := make(chan Event)
+		events := make(chan Event, 1)
+		require.NoError(t, o.RegisterEvent(full))
+		require.NoError(t, o.RegisterEvent(events))
+
+		require.NoError(t, o.Send("msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+		require.Equal(t, EventSent, receive(t, events).Type)
+	})
+}
+
+func TestOutbox_Resume(t *testing.T) {
+	prov := &mockProvider{storage: mem.NewProvider()}
+	outbound := &mockOutbound{err: errors.New("endpoint unavailable")}
+
+	o, err := New(prov, outbound, WithBackoff(time.Hour, time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, o.Send("msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+	require.NoError(t, o.Close())
+
+	// the records left by the earlier versions of the outbox are deleted
+	require.NoError(t, o.queue.save(&Record{ID: "sent", Status: "sent"}))
+	require.NoError(t, o.deadLetters.save(&Record{ID: "moved", Status: "moved"}))
+
+	queued, err := o.Queued()
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+
+	// the restarted outbox delivers the message once it is due
+	outbound.setErr(nil)
+
+	o, err = New(prov, outbound, WithBackoff(time.Hour, time.Hour))
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, o.Close()) }()
+
+	events := make(chan Event, 1)
+	require.NoError(t, o.RegisterEvent(events))
+
+	require.NoError(t, o.Retry(queued[0].ID))
+
+	e := receive(t, events)
+	require.Equal(t, EventSent, e.Type)
+	require.Equal(t, queued[0].ID, e.Record.ID)
+	require.Equal(t, 2, e.Record.Attempts)
+
+	_, err = o.queue.get("sent")
+	require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	_, err = o.deadLetters.get("moved")
+	require.True(t, errors.Is(err, storage.ErrDataNotFound))
+}
+
+func TestOutbox_RetryAndPurge(t *testing.T) {
+	outbound := &mockOutbound{err: errors.New("endpoint unavailable")}
+
+	o, err := New(&mockProvider{storage: mem.NewProvider()}, outbound, WithMaxAttempts(1))
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, o.Close()) }()
+
+	err = o.Send("msg1", "sender", &service.Destination{ServiceEndpoint: "url"})
+	require.Error(t, err)
+
+	deliveryErr := &DeliveryError{}
+	require.True(t, errors.As(err, &deliveryErr))
+	require.EqualError(t, deliveryErr.Err, "endpoint unavailable")
+	require.EqualError(t, err, fmt.Sprintf("outbox send: message %s moved to dead-letter store: endpoint unavailable",
+		deliveryErr.ID))
+
+	require.Error(t, o.Send("msg2", "sender", &service.Destination{ServiceEndpoint: "url"}))
+
+	deadLetters, err := o.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+
+	events := make(chan Event, 1)
+	require.NoError(t, o.RegisterEvent(events))
+
+	// retry moves the dead letter back to the queue
+	outbound.setErr(nil)
+	require.NoError(t, o.Retry(deadLetters[0].ID))
+
+	e := receive(t, events)
+	require.Equal(t, EventSent, e.Type)
+	require.Equal(t, deadLetters[0].ID, e.Record.ID)
+	require.Equal(t, 1, e.Record.Attempts)
+
+	_, err = o.deadLetters.get(deadLetters[0].ID)
+	require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+	require.NoError(t, o.UnregisterEvent(events))
+
+	// purge
+	require.NoError(t, o.Purge(deadLetters[1].ID))
+
+	deadLetters, err = o.DeadLetters()
+	require.NoError(t, err)
+	require.Empty(t, deadLetters)
+
+	err = o.Purge("unknown")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	err = o.Retry("unknown")
+	require.True(t, errors.Is(err, ErrNotFound))
+
+	// in flight
+	require.True(t, o.lock("id"))
+	require.Contains(t, o.Retry("id").Error(), "delivery in progress")
+	require.Contains(t, o.Purge("id").Error(), "delivery in progress")
+	o.unlock("id")
+
+	require.Equal(t, service.ErrNilChannel, o.RegisterEvent(nil))
+}
+
+func TestOutbox_DeadLetterRetention(t *testing.T) {
+	o, err := New(&mockProvider{storage: mem.NewProvider()}, &mockOutbound{err: errors.New("endpoint unavailable")},
+		WithMaxAttempts(1), WithDeadLetterRetention(time.Hour))
+	require.NoError(t, err)
+
+	stopWorker(t, o)
+
+	require.Error(t, o.Send("msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+	require.NoError(t, o.deadLetters.save(&Record{ID: "old", Status: StatusDeadLetter,
+		CreatedAt: time.Now().Add(-2 * time.Hour)}))
+
+	// the sweep runs at most once per the sweep interval
+	o.lastSweep = time.Now()
+	o.retryDue()
+
+	deadLetters, err := o.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+
+	o.lastSweep = time.Time{}
+	require.True(t, o.retryDue() <= sweepInterval)
+
+	deadLetters, err = o.DeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, "msg", mustUnquote(t, deadLetters[0].Message))
+
+	o.now = func() time.Time { return time.Now().Add(time.Hour) }
+	o.lastSweep = time.Time{}
+	o.retryDue()
+
+	deadLetters, err = o.DeadLetters()
+	require.NoError(t, err)
+	require.Empty(t, deadLetters)
+}
+
+func TestOutbox_RetryIndex(t *testing.T) {
+	outbound := &mockOutbound{}
+
+	o, err := New(&mockProvider{storage: mem.NewProvider()}, outbound, WithBackoff(time.Hour, time.Hour))
+	require.NoError(t, err)
+
+	stopWorker(t, o)
+
+	now := time.Now()
+	o.lastSweep = now
+
+	// the attempts of the records which were delivered, purged or rescheduled in the meantime are skipped
+	require.NoError(t, o.queue.save(&Record{ID: "due", Message: []byte(`"due"`), Status: StatusQueued,
+		NextAttempt: now}))
+	require.NoError(t, o.queue.save(&Record{ID: "rescheduled", Message: []byte(`"rescheduled"`),
+		Status: StatusQueued, NextAttempt: now.Add(time.Minute)}))
+	o.schedule("due", now)
+	o.schedule("rescheduled", now)
+	o.schedule("purged", now)
+	o.schedule("rescheduled", now.Add(time.Minute))
+
+	wait := o.retryDue()
+	require.True(t, wait > 0 && wait <= time.Minute, wait.String())
+	require.Equal(t, []string{`"due"`}, outbound.sent())
+	require.Len(t, o.retries, 1)
+
+	// the locked record is checked again later
+	require.True(t, o.lock("locked"))
+	o.schedule("locked", now)
+	o.retryDue()
+	o.unlock("locked")
+	require.Len(t, o.retries, 2)
+	require.Equal(t, []string{`"due"`}, outbound.sent())
+}
+
+func TestOutbox_Backoff(t *testing.T) {
+	o := &Outbox{initialBackoff: 10 * time.Second, maxBackoff: time.Minute}
+
+	for attempts, max := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		4:  time.Minute,
+		10: time.Minute,
+	} {
+		delay := o.backoff(attempts)
+		require.True(t, delay >= max/2 && delay <= max, fmt.Sprintf("attempts %d: %s", attempts, delay))
+	}
+}
+
+func TestRecordStore(t *testing.T) {
+	store := &recordStore{store: &mockstorage.MockStore{Store: map[string][]byte{
+		recordKeyPrefix + "invalid": []byte("invalid"),
+	}}}
+
+	_, err := store.get("invalid")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "get record")
+
+	_, err = store.list(StatusQueued)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "list records")
+
+	_, err = store.get("unknown")
+	require.True(t, errors.Is(err, storage.ErrDataNotFound))
+}
+
+// stopWorker stops the worker of the outbox, the retries are run by the test.
+func stopWorker(t *testing.T, o *Outbox) {
+	require.NoError(t, o.Close())
+
+	o.stop = make(chan struct{})
+	o.retryCtx = context.Background()
+}
+
+func mustUnquote(t *testing.T, msg json.RawMessage) string {
+	var s string
+	require.NoError(t, json.Unmarshal(msg, &s))
+
+	return s
+}
+
+func receive(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		require.Fail(t, "tried 1 second, event was not received")
+	}
+
+	return Event{}
+}
+
+type mockProvider struct {
+	storage storage.Provider
+}
+
+func (p *mockProvider) StorageProvider() storage.Provider {
+	return p.storage
+}
+
+type mockOutbound struct {
+	mu       sync.Mutex
+	err      error
+	messages []string
+}
+
+func (m *mockOutbound) Send(msg interface{}, _ string, _ *service.Destination) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	m.messages = append(m.messages, string(bytes))
+
+	return m.err
+}
+
+func (m *mockOutbound) setErr(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+func (m *mockOutbound) sent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(m.messages[:0:0], m.messages...)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+const (
+	// StatusQueued the message waits for the next delivery attempt.
+	StatusQueued = "queued"
+	// StatusDeadLetter the delivery failed after the maximum number of attempts.
+	StatusDeadLetter = "dead-letter"
+	// statusSent the message was delivered, the status is reported by the event only.
+	statusSent = "sent"
+
+	recordKeyPrefix = "outbox_"
+	// limitPattern with `~` at the end for lte of given prefix (less than or equal)
+	limitPattern = "%s~"
+)
+
+// Record is the outbound message persisted by the outbox.
+type Record struct {
+	ID           string               `json:"id"`
+	Message      json.RawMessage      `json:"message"`
+	SenderVerKey string               `json:"sender_ver_key"`
+	Destination  *service.Destination `json:"destination"`
+	Status       string               `json:"status"`
+	Attempts     int                  `json:"attempts"`
+	LastError    string               `json:"last_error,omitempty"`
+	NextAttempt  time.Time            `json:"next_attempt"`
+	CreatedAt    time.Time            `json:"created_at"`
+	// DeadLetteredAt is the time the message was moved to the dead-letter store, the retention of the dead letters
+	// starts then.
+	DeadLetteredAt time.Time `json:"dead_lettered_at,omitempty"`
+}
+
+// recordStore persists the records. The store keeps only the queued or dead-lettered records, the record is
+// deleted once it is delivered, moved to the other store or purged.
+type recordStore struct {
+	store storage.Store
+}
+
+func (s *recordStore) save(r *Record) error {
+	src, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("save record: %w", err)
+	}
+
+	return s.store.Put(recordKeyPrefix+r.ID, src)
+}
+
+func (s *recordStore) delete(id string) error {
+	if err := s.store.Delete(recordKeyPrefix + id); err != nil {
+		return fmt.Errorf("delete record: %w", err)
+	}
+
+	return nil
+}
+
+func (s *recordStore) get(id string) (*Record, error) {
+	src, err := s.store.Get(recordKeyPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(src, r); err != nil {
+		return nil, fmt.Errorf("get record: %w", err)
+	}
+
+	return r, nil
+}
+
+// list returns the records with the given status ordered by the creation time.
+func (s *recordStore) list(status string) ([]*Record, error) {
+	records, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Record
+
+	for _, r := range records {
+		if r.Status == status {
+			result = append(result, r)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (s *recordStore) all() ([]*Record, error) {
+	itr := s.store.Iterator(recordKeyPrefix, fmt.Sprintf(limitPattern, recordKeyPrefix))
+	defer itr.Release()
+
+	var records []*Record
+
+	for itr.Next() {
+		r := &Record{}
+		if err := json.Unmarshal(itr.Value(), r); err != nil {
+			return nil, fmt.Errorf("list records: %w", err)
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import "time"
+
+// retry is the scheduled delivery attempt of the queued record.
+type retry struct {
+	id string
+	at time.Time
+}
+
+// retryHeap is the index of the scheduled attempts ordered by their time, it implements heap.Interface.
+// The attempt of the record which was delivered, purged or rescheduled in the meantime is skipped once it is due.
+type retryHeap []*retry
+
+func (h retryHeap) Len() int {
+	return len(h)
+}
+
+func (h retryHeap) Less(i, j int) bool {
+	return h[i].at.Before(h[j].at)
+}
+
+func (h retryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *retryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*retry))
+}
+
+func (h *retryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	r := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return r
+}
@@ -7,12 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package packager_test
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	. "github.com/hyperledger/aries-framework-go/pkg/didcomm/packager"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
@@ -222,7 +224,8 @@ func TestBaseKMSInPackager_UnpackMessage(t *testing.T) {
 		mockedProviders.packers = []packer.Packer{testPacker, legacyPacker}
 
 		// now create a new packager with the above provider context
-		packager, err := New(mockedProviders)
+		registry := metrics.NewRegistry()
+		packager, err := New(mockedProviders, WithMetrics(registry))
 		require.NoError(t, err)
 
 		_, base58FromVerKey, err := w.CreateKeySet()
@@ -241,12 +244,13 @@ func TestBaseKMSInPackager_UnpackMessage(t *testing.T) {
 		unpackedMsg, err := packager.UnpackMessage(packMsg)
 		require.NoError(t, err)
 		require.Equal(t, unpackedMsg.Message, []byte("msg1"))
+		require.Len(t, unpackedMsg.ToVerKeys, 1)
 
 		// pack with legacy, unpack using a packager that has JWE as default but supports legacy
 
 		mockedProviders.primaryPacker = legacyPacker
 
-		packager2, err := New(mockedProviders)
+		packager2, err := New(mockedProviders, WithMetrics(registry))
 		require.NoError(t, err)
 
 		packMsg, err = packager2.PackMessage(&transport.Envelope{Message: []byte("msg2"),
@@ -258,6 +262,19 @@ func TestBaseKMSInPackager_UnpackMessage(t *testing.T) {
 		unpackedMsg, err = packager.UnpackMessage(packMsg)
 		require.NoError(t, err)
 		require.Equal(t, unpackedMsg.Message, []byte("msg2"))
+		require.Equal(t, base58FromVerKey, unpackedMsg.FromVerKey)
+		require.Equal(t, []string{base58ToVerKey}, unpackedMsg.ToVerKeys)
+
+		// the latency is reported by the encoding type
+		var buf bytes.Buffer
+		require.NoError(t, registry.WritePrometheus(&buf))
+
+		for _, encoding := range []string{testPacker.EncodingType(), legacyPacker.EncodingType()} {
+			require.Contains(t, buf.String(),
+				fmt.Sprintf(`%s_count{encoding="%s"} 1`, metrics.PackDuration, encoding))
+			require.Contains(t, buf.String(),
+				fmt.Sprintf(`%s_count{encoding="%s"} 1`, metrics.UnpackDuration, encoding))
+		}
 	})
 }
 
@@ -11,9 +11,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/btcsuite/btcutil/base58"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
 )
@@ -31,6 +33,17 @@ type Creator func(prov Provider) (transport.Packager, error)
 type Packager struct {
 	primaryPacker packer.Packer
 	packers       map[string]packer.Packer
+	metrics       metrics.Sink
+}
+
+// Option configures the Packager.
+type Option func(p *Packager)
+
+// WithMetrics sets the sink receiving the pack and unpack latency by the packer encoding type.
+func WithMetrics(sink metrics.Sink) Option {
+	return func(p *Packager) {
+		p.metrics = sink
+	}
 }
 
 // PackerCreator holds a creator function for a Packer and the name of the Packer's encoding method.
@@ -40,10 +53,15 @@ type PackerCreator struct {
 }
 
 // New return new instance of KMS implementation
-func New(ctx Provider) (*Packager, error) {
+func New(ctx Provider, opts ...Option) (*Packager, error) {
 	basePackager := Packager{
 		primaryPacker: nil,
 		packers:       map[string]packer.Packer{},
+		metrics:       metrics.Nop,
+	}
+
+	for _, opt := range opts {
+		opt(&basePackager)
 	}
 
 	for _, packerType := range ctx.Packers() {
@@ -86,28 +104,44 @@ func (bp *Packager) PackMessage(messageEnvelope *transport.Envelope) ([]byte, er
 		recipients = append(recipients, verKeyBytes)
 	}
 	// pack message
+	start := time.Now()
 	bytes, err := bp.primaryPacker.Pack(messageEnvelope.Message, base58.Decode(messageEnvelope.FromVerKey), recipients)
 	if err != nil {
 		return nil, fmt.Errorf("pack: %w", err)
 	}
 
+	metrics.ObserveSince(bp.metrics, metrics.PackDuration, start,
+		metrics.Labels{"encoding": bp.primaryPacker.EncodingType()})
+
 	return bytes, nil
 }
 
 type envelopeStub struct {
-	Protected string `json:"protected,omitempty"`
+	Protected  string          `json:"protected,omitempty"`
+	Recipients []recipientStub `json:"recipients,omitempty"`
 }
 
 type headerStub struct {
-	Type string `json:"typ,omitempty"`
+	Type       string          `json:"typ,omitempty"`
+	Recipients []recipientStub `json:"recipients,omitempty"`
 }
 
-func getEncodingType(encMessage []byte) (string, error) {
+// recipientStub is the envelope recipient, the JWE envelope lists the recipients in the envelope while
+// the legacy envelope lists them in the protected header.
+type recipientStub struct {
+	Header struct {
+		KID string `json:"kid,omitempty"`
+	} `json:"header,omitempty"`
+}
+
+// parseEnvelope returns the encoding type and the recipient keys of the envelope. The recipient keys are
+// the key IDs as listed by the envelope, their type depends on the packer.
+func parseEnvelope(encMessage []byte) (string, []string, error) {
 	env := &envelopeStub{}
 
 	err := json.Unmarshal(encMessage, env)
 	if err != nil {
-		return "", fmt.Errorf("parse envelope: %w", err)
+		return "", nil, fmt.Errorf("parse envelope: %w", err)
 	}
 
 	var protBytes []byte
@@ -121,24 +155,32 @@ func getEncodingType(encMessage []byte) (string, error) {
 	case err2 == nil:
 		protBytes = protBytes2
 	default:
-		return "", fmt.Errorf("decode header: %w", err1)
+		return "", nil, fmt.Errorf("decode header: %w", err1)
 	}
 
 	prot := &headerStub{}
 
 	err = json.Unmarshal(protBytes, prot)
 	if err != nil {
-		return "", fmt.Errorf("parse header: %w", err)
+		return "", nil, fmt.Errorf("parse header: %w", err)
 	}
 
-	return prot.Type, nil
+	var recipientKeys []string
+
+	for _, r := range append(env.Recipients, prot.Recipients...) {
+		if r.Header.KID != "" {
+			recipientKeys = append(recipientKeys, r.Header.KID)
+		}
+	}
+
+	return prot.Type, recipientKeys, nil
 }
 
 // UnpackMessage Unpack a message.
 func (bp *Packager) UnpackMessage(encMessage []byte) (*transport.Envelope, error) {
-	encType, err := getEncodingType(encMessage)
+	encType, recipientKeys, err := parseEnvelope(encMessage)
 	if err != nil {
-		return nil, fmt.Errorf("getEncodingType: %w", err)
+		return nil, fmt.Errorf("parseEnvelope: %w", err)
 	}
 
 	p, ok := bp.packers[encType]
@@ -146,10 +188,14 @@ func (bp *Packager) UnpackMessage(encMessage []byte) (*transport.Envelope, error
 		return nil, fmt.Errorf("message Type not recognized")
 	}
 
+	start := time.Now()
+
 	data, senderVerKey, err := p.Unpack(encMessage)
 	if err != nil {
 		return nil, fmt.Errorf("unpack: %w", err)
 	}
 
-	return &transport.Envelope{Message: data, FromVerKey: base58.Encode(senderVerKey)}, nil
+	metrics.ObserveSince(bp.metrics, metrics.UnpackDuration, start, metrics.Labels{"encoding": encType})
+
+	return &transport.Envelope{Message: data, FromVerKey: base58.Encode(senderVerKey), ToVerKeys: recipientKeys}, nil
 }
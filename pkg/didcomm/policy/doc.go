@@ -0,0 +1,22 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+/*
+Package policy provides the auto-accept policy for the protocol action events. The policy rules match the action
+events by protocol name, message type, sender DID or key, invitation ID and label pattern, and continue or stop
+them automatically. The action events which do not match any rule are passed to the manual channel of the consumer.
+
+Usage:
+	p, err := policy.LoadFile("policy.json")
+	engine, err := policy.NewEngine(p)
+
+	actionCh := make(chan service.DIDCommAction)
+	err = didexchangeClient.RegisterActionEvent(actionCh)
+
+	manualCh := make(chan service.DIDCommAction)
+	go engine.Handle(actionCh, manualCh)
+*/
+package policy
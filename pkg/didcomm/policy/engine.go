@@ -0,0 +1,226 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+var logger = log.New("aries-framework/policy")
+
+// ErrRejected is passed to the Stop function of the action events rejected by the policy.
+var ErrRejected = errors.New("rejected by policy")
+
+// Decision is the result of the policy evaluation.
+type Decision struct {
+	// Action is accept, reject or manual.
+	Action string
+	// Rule is the name of the matched rule, empty if the default decision was applied.
+	Rule string
+}
+
+// Engine evaluates the action events against the policy. The policy can be updated at runtime.
+type Engine struct {
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// NewEngine returns new policy engine instance.
+func NewEngine(p *Policy) (*Engine, error) {
+	e := &Engine{}
+	if err := e.Update(p); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Policy returns the policy in use.
+func (e *Engine) Policy() *Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.policy
+}
+
+// Update replaces the policy in use.
+func (e *Engine) Update(p *Policy) error {
+	if p == nil {
+		return errors.New("update policy: nil policy")
+	}
+
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("update policy: %w", err)
+	}
+
+	e.mu.Lock()
+	e.policy = p
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Evaluate returns the decision for the action event.
+func (e *Engine) Evaluate(action service.DIDCommAction) Decision {
+	attrs := newAttributes(action)
+	p := e.Policy()
+
+	for _, rule := range p.Rules {
+		if rule.match(attrs) {
+			return Decision{Action: rule.Action, Rule: rule.Name}
+		}
+	}
+
+	if p.Default == "" {
+		return Decision{Action: Manual}
+	}
+
+	return Decision{Action: p.Default}
+}
+
+// Handle applies the policy to the action events received from the channel. The action events which require
+// the manual decision are passed to the manual channel, the consumer of the manual channel continues or stops
+// them. Handle returns service.ErrNilChannel if the manual channel is nil, the manual action events would be
+// left hanging otherwise. This is a blocking function and use this function with a goroutine.
+//
+// Usage:
+//	engine, err := policy.NewEngine(p)
+//	actionCh := make(chan service.DIDCommAction)
+//	err = didexchangeClient.RegisterActionEvent(actionCh)
+//	go engine.Handle(actionCh, manualCh)
+func (e *Engine) Handle(ch <-chan service.DIDCommAction, manual chan<- service.DIDCommAction) error {
+	if manual == nil {
+		return service.ErrNilChannel
+	}
+
+	for action := range ch {
+		decision := e.Evaluate(action)
+
+		switch decision.Action {
+		case Accept:
+			logger.Debugf("policy rule %q accepted %s action event", decision.Rule, action.ProtocolName)
+			action.Continue(&service.Empty{})
+		case Reject:
+			logger.Debugf("policy rule %q rejected %s action event", decision.Rule, action.ProtocolName)
+			action.Stop(fmt.Errorf("%w: rule %q", ErrRejected, decision.Rule))
+		default:
+			manual <- action
+		}
+	}
+
+	return nil
+}
+
+// attributes of the action event matched by the rules. The sender key is the key the inbound message was
+// packed with, the sender DID is set only if its DID doc contains the sender key: the other fields of
+// the message are claimed by the sender.
+type attributes struct {
+	protocol     string
+	msgType      string
+	senderDID    string
+	senderKey    string
+	invitationID string
+	label        string
+}
+
+// payload contains the fields of the invitation and request messages used by the rules.
+type payload struct {
+	ID            string   `json:"@id"`
+	Label         string   `json:"label"`
+	RecipientKeys []string `json:"recipientKeys"`
+	Connection    *struct {
+		DID    string  `json:"did"`
+		DIDDoc *didDoc `json:"did_doc"`
+	} `json:"connection"`
+	Thread *struct {
+		PID string `json:"pthid"`
+	} `json:"~thread"`
+}
+
+// didDoc contains the fields of the DID doc of the request the sender key is looked up in.
+type didDoc struct {
+	ID        string `json:"id"`
+	PublicKey []struct {
+		Value string `json:"publicKeyBase58"`
+	} `json:"publicKey"`
+	Service []struct {
+		RecipientKeys []string `json:"recipientKeys"`
+	} `json:"service"`
+}
+
+// hasKey returns true if the DID doc of the given DID contains the key.
+func (d *didDoc) hasKey(did, key string) bool {
+	if d == nil || key == "" || (d.ID != "" && d.ID != did) {
+		return false
+	}
+
+	for _, pk := range d.PublicKey {
+		if pk.Value == key {
+			return true
+		}
+	}
+
+	for _, svc := range d.Service {
+		for _, k := range svc.RecipientKeys {
+			if k == key {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func newAttributes(action service.DIDCommAction) *attributes {
+	attrs := &attributes{protocol: action.ProtocolName}
+
+	if props, ok := action.Properties.(interface{ InvitationID() string }); ok {
+		attrs.invitationID = props.InvitationID()
+	}
+
+	if action.Message == nil {
+		return attrs
+	}
+
+	if action.Message.Header != nil {
+		attrs.msgType = action.Message.Header.Type
+	}
+
+	if action.Message.Inbound != nil {
+		attrs.senderKey = action.Message.Inbound.SenderVerKey
+	}
+
+	p := &payload{}
+	if err := json.Unmarshal(action.Message.Payload, p); err != nil {
+		logger.Warnf("policy: unable to read the action event message: %s", err)
+		return attrs
+	}
+
+	attrs.label = p.Label
+
+	// the request is sent by the invitee, the claimed DID is trusted if its DID doc contains the sender key
+	if p.Connection != nil && p.Connection.DIDDoc.hasKey(p.Connection.DID, attrs.senderKey) {
+		attrs.senderDID = p.Connection.DID
+	}
+
+	if attrs.invitationID == "" {
+		if p.Thread != nil && p.Thread.PID != "" {
+			attrs.invitationID = p.Thread.PID
+		} else if p.RecipientKeys != nil {
+			// the invitation message
+			attrs.invitationID = p.ID
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,180 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+const (
+	invitationMsgType = "https://didcomm.org/didexchange/1.0/invitation"
+	requestMsgType    = "https://didcomm.org/didexchange/1.0/request"
+)
+
+type invitationProps string
+
+func (p invitationProps) InvitationID() string {
+	return string(p)
+}
+
+func invitation() service.DIDCommAction {
+	return service.DIDCommAction{
+		ProtocolName: "didexchange",
+		Message: &service.DIDCommMsg{
+			Header: &service.Header{Type: invitationMsgType},
+			Payload: []byte(`{"@id": "inv-1", "@type": "` + invitationMsgType + `", "label": "acme-agent",
+				"recipientKeys": ["key-1"]}`),
+		},
+	}
+}
+
+func request() service.DIDCommAction {
+	return requestFrom("key-2", "did:example:bob")
+}
+
+// requestFrom returns the request packed with the sender key claiming the DID with the DID doc of key-2.
+func requestFrom(senderKey, did string) service.DIDCommAction {
+	return service.DIDCommAction{
+		ProtocolName: "didexchange",
+		Message: &service.DIDCommMsg{
+			Header: &service.Header{Type: requestMsgType},
+			Payload: []byte(`{"@id": "req-1", "@type": "` + requestMsgType + `", "label": "bob",
+				"~thread": {"pthid": "inv-2"},
+				"connection": {"did": "` + did + `", "did_doc": {"id": "did:example:bob",
+					"publicKey": [{"publicKeyBase58": "key-3"}], "service": [{"recipientKeys": ["key-2"]}]}}}`),
+			Inbound: &service.InboundContext{SenderVerKey: senderKey},
+		},
+		Properties: invitationProps("inv-2"),
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		action   service.DIDCommAction
+		expected string
+	}{
+		{"protocol", Rule{Protocols: []string{"didexchange"}}, request(), Accept},
+		{"other protocol", Rule{Protocols: []string{"introduce"}}, request(), Manual},
+		{"message type", Rule{MessageTypes: []string{invitationMsgType}}, invitation(), Accept},
+		{"other message type", Rule{MessageTypes: []string{invitationMsgType}}, request(), Manual},
+		{"sender DID", Rule{SenderDIDs: []string{"did:example:bob"}}, request(), Accept},
+		{"other sender DID", Rule{SenderDIDs: []string{"did:example:carol"}}, request(), Manual},
+		{"sender DID with public key", Rule{SenderDIDs: []string{"did:example:bob"}},
+			requestFrom("key-3", "did:example:bob"), Accept},
+		{"spoofed sender DID", Rule{SenderDIDs: []string{"did:example:bob"}},
+			requestFrom("key-mallory", "did:example:bob"), Manual},
+		{"sender DID of other DID doc", Rule{SenderDIDs: []string{"did:example:carol"}},
+			requestFrom("key-2", "did:example:carol"), Manual},
+		{"unauthenticated sender DID", Rule{SenderDIDs: []string{"did:example:bob"}}, requestFrom("", "did:example:bob"),
+			Manual},
+		{"unauthenticated invitation key", Rule{SenderKeys: []string{"key-1"}}, invitation(), Manual},
+		{"request key", Rule{SenderKeys: []string{"key-1", "key-2"}}, request(), Accept},
+		{"other key", Rule{SenderKeys: []string{"key-3"}}, request(), Manual},
+		{"claimed key", Rule{SenderKeys: []string{"key-2"}}, requestFrom("key-mallory", "did:example:bob"), Manual},
+		{"invitation ID", Rule{InvitationIDs: []string{"inv-1"}}, invitation(), Accept},
+		{"request invitation ID", Rule{InvitationIDs: []string{"inv-2"}}, request(), Accept},
+		{"label", Rule{Labels: []string{"acme-*"}}, invitation(), Accept},
+		{"other label", Rule{Labels: []string{"acme-*"}}, request(), Manual},
+		{"all criteria", Rule{Protocols: []string{"didexchange"}, Labels: []string{"b?b"},
+			SenderDIDs: []string{"did:example:bob"}}, request(), Accept},
+		{"some criteria", Rule{Protocols: []string{"didexchange"}, Labels: []string{"acme-*"}}, request(), Manual},
+		{"no message", Rule{Protocols: []string{"didexchange"}}, service.DIDCommAction{ProtocolName: "didexchange"},
+			Accept},
+		{"invalid message", Rule{Labels: []string{"*"}}, service.DIDCommAction{
+			Message: &service.DIDCommMsg{Header: &service.Header{}, Payload: []byte("[]")}}, Accept},
+	}
+
+	for _, test := range tests {
+		tc := test
+		t.Run(tc.name, func(t *testing.T) {
+			tc.rule.Action = Accept
+			tc.rule.Name = "rule"
+
+			e, err := NewEngine(&Policy{Rules: []Rule{tc.rule}})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, e.Evaluate(tc.action).Action)
+		})
+	}
+
+	t.Run("first matching rule decides", func(t *testing.T) {
+		e, err := NewEngine(&Policy{Default: Accept, Rules: []Rule{
+			{Name: "deny", Action: Reject, SenderDIDs: []string{"did:example:bob"}},
+			{Name: "allow", Action: Accept, Protocols: []string{"didexchange"}},
+		}})
+		require.NoError(t, err)
+
+		require.Equal(t, Decision{Action: Reject, Rule: "deny"}, e.Evaluate(request()))
+		require.Equal(t, Decision{Action: Accept, Rule: "allow"}, e.Evaluate(invitation()))
+		require.Equal(t, Decision{Action: Accept}, e.Evaluate(service.DIDCommAction{ProtocolName: "introduce"}))
+	})
+}
+
+func TestEngine_Update(t *testing.T) {
+	e, err := NewEngine(&Policy{})
+	require.NoError(t, err)
+	require.Equal(t, Manual, e.Evaluate(request()).Action)
+
+	require.NoError(t, e.Update(&Policy{Default: Reject}))
+	require.Equal(t, Reject, e.Policy().Default)
+	require.Equal(t, Reject, e.Evaluate(request()).Action)
+
+	require.EqualError(t, e.Update(nil), "update policy: nil policy")
+	require.EqualError(t, e.Update(&Policy{Default: "maybe"}), "update policy: invalid default decision: maybe")
+	require.Equal(t, Reject, e.Policy().Default)
+
+	_, err = NewEngine(&Policy{Default: "maybe"})
+	require.Error(t, err)
+}
+
+func TestEngine_Handle(t *testing.T) {
+	e, err := NewEngine(&Policy{Rules: []Rule{
+		{Name: "deny", Action: Reject, SenderDIDs: []string{"did:example:bob"}},
+		{Name: "allow", Action: Accept, InvitationIDs: []string{"inv-1"}},
+	}})
+	require.NoError(t, err)
+
+	var (
+		continued bool
+		stopped   error
+	)
+
+	accepted := invitation()
+	accepted.Continue = func(args interface{}) {
+		require.Equal(t, &service.Empty{}, args)
+
+		continued = true
+	}
+
+	rejected := request()
+	rejected.Stop = func(err error) { stopped = err }
+
+	manual := service.DIDCommAction{ProtocolName: "introduce"}
+
+	ch := make(chan service.DIDCommAction, 3)
+	ch <- accepted
+	ch <- rejected
+	ch <- manual
+	close(ch)
+
+	manualCh := make(chan service.DIDCommAction, 1)
+	require.NoError(t, e.Handle(ch, manualCh))
+
+	require.True(t, continued)
+	require.True(t, errors.Is(stopped, ErrRejected))
+	require.EqualError(t, stopped, `rejected by policy: rule "deny"`)
+	require.Equal(t, "introduce", (<-manualCh).ProtocolName)
+
+	// manual action events would be left hanging without the manual channel
+	require.Equal(t, service.ErrNilChannel, e.Handle(ch, nil))
+}
@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+)
+
+const (
+	// Accept continues the action event.
+	Accept = "accept"
+	// Reject stops the action event.
+	Reject = "reject"
+	// Manual leaves the action event to the consumer.
+	Manual = "manual"
+)
+
+// Policy is an ordered list of rules. The first rule matching the action event decides,
+// the Default decision is used when none of the rules match.
+//
+// Allow and deny lists are expressed as rules with the accept and reject actions, e.g. a deny list of DIDs
+// followed by an allow list of partner DIDs:
+//  {
+//    "default": "manual",
+//    "rules": [
+//      {"name": "blocked", "action": "reject", "sender_dids": ["did:example:mallory"]},
+//      {"name": "partners", "action": "accept", "protocols": ["didexchange"], "labels": ["acme-*"]}
+//    ]
+//  }
+type Policy struct {
+	// Default decision when none of the rules match (accept, reject or manual). Defaults to manual.
+	Default string `json:"default,omitempty"`
+	Rules   []Rule `json:"rules,omitempty"`
+}
+
+// Rule matches the action events by the given criteria. Every non-empty criteria must match the action event,
+// any of the values of a criteria matches.
+type Rule struct {
+	// Name of the rule, it is reported when the rule rejects an action event.
+	Name string `json:"name,omitempty"`
+	// Action is either accept or reject.
+	Action string `json:"action"`
+	// Protocols the protocol names, e.g. didexchange.
+	Protocols []string `json:"protocols,omitempty"`
+	// MessageTypes the message types which triggered the action event.
+	MessageTypes []string `json:"message_types,omitempty"`
+	// SenderDIDs the DIDs of the sender, the DID matches only if its DID doc contains the sender key.
+	SenderDIDs []string `json:"sender_dids,omitempty"`
+	// SenderKeys the base58 encoded keys of the sender, matched against the key the inbound message was packed with.
+	SenderKeys []string `json:"sender_keys,omitempty"`
+	// InvitationIDs the IDs of the invitations the action events relates to.
+	InvitationIDs []string `json:"invitation_ids,omitempty"`
+	// Labels the patterns of the sender label, see path.Match for the pattern syntax.
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Validate checks the policy rules.
+func (p *Policy) Validate() error {
+	switch p.Default {
+	case "", Accept, Reject, Manual:
+	default:
+		return fmt.Errorf("invalid default decision: %s", p.Default)
+	}
+
+	for i, rule := range p.Rules {
+		if rule.Action != Accept && rule.Action != Reject {
+			return fmt.Errorf("rule %d: invalid action: %s", i, rule.Action)
+		}
+
+		for _, pattern := range rule.Labels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid label pattern %s: %w", i, pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load reads the JSON encoded policy.
+func Load(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, fmt.Errorf("load policy: %w", err)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("load policy: %w", err)
+	}
+
+	return p, nil
+}
+
+// LoadFile reads the JSON encoded policy from the given file.
+func LoadFile(name string) (*Policy, error) {
+	f, err := os.Open(name) // nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("load policy: %w", err)
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Warnf("failed to close policy file: %s", err)
+		}
+	}()
+
+	return Load(f)
+}
+
+func (r *Rule) match(attrs *attributes) bool {
+	return matchAny(r.Protocols, attrs.protocol) &&
+		matchAny(r.MessageTypes, attrs.msgType) &&
+		matchAny(r.SenderDIDs, attrs.senderDID) &&
+		matchAny(r.InvitationIDs, attrs.invitationID) &&
+		matchAny(r.SenderKeys, attrs.senderKey) &&
+		matchPattern(r.Labels, attrs.label)
+}
+
+// matchAny returns true if the list is empty or any of the values is in the list.
+func matchAny(list []string, values ...string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, item := range list {
+		for _, v := range values {
+			if v != "" && item == v {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchPattern returns true if the patterns are empty or the value matches any of the patterns.
+func matchPattern(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	require.NoError(t, (&Policy{}).Validate())
+	require.NoError(t, (&Policy{Default: Accept, Rules: []Rule{{Action: Reject, Labels: []string{"a*"}}}}).Validate())
+
+	require.EqualError(t, (&Policy{Default: "maybe"}).Validate(), "invalid default decision: maybe")
+	require.EqualError(t, (&Policy{Rules: []Rule{{Action: Manual}}}).Validate(), "rule 0: invalid action: manual")
+	require.EqualError(t, (&Policy{Rules: []Rule{{Action: Accept, Labels: []string{"["}}}}).Validate(),
+		"rule 0: invalid label pattern [: syntax error in pattern")
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p, err := Load(strings.NewReader(`{
+			"default": "reject",
+			"rules": [{"name": "partners", "action": "accept", "sender_dids": ["did:example:alice"]}]
+		}`))
+		require.NoError(t, err)
+		require.Equal(t, Reject, p.Default)
+		require.Len(t, p.Rules, 1)
+		require.Equal(t, "partners", p.Rules[0].Name)
+		require.Equal(t, []string{"did:example:alice"}, p.Rules[0].SenderDIDs)
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, err := Load(strings.NewReader(`{`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "load policy")
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		_, err := Load(strings.NewReader(`{"rules": [{"action": "skip"}]}`))
+		require.EqualError(t, err, "load policy: rule 0: invalid action: skip")
+	})
+}
+
+func TestLoadFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "policy")
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, os.Remove(f.Name())) }()
+
+	_, err = f.WriteString(`{"default": "accept"}`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p, err := LoadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, Accept, p.Default)
+
+	_, err = LoadFile(f.Name() + "-missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "load policy")
+}
@@ -23,6 +23,10 @@ type Invitation struct {
 	// the Service endpoint of the connection invitation
 	ServiceEndpoint string `json:"serviceEndpoint,omitempty"`
 
+	// the lower priority Service endpoints of the connection invitation, the invitee falls back to them
+	// if the Service endpoint is not reachable
+	FallbackServiceEndpoints []string `json:"fallbackServiceEndpoints,omitempty"`
+
 	// the RecipientKeys for the connection invitation
 	RecipientKeys []string `json:"recipientKeys,omitempty"`
 
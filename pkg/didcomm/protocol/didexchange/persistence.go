@@ -11,16 +11,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 )
 
 const (
-	keyPattern         = "%s_%s"
-	invKeyPrefix       = "inv"
-	connIDKeyPrefix    = "conn"
-	connStateKeyPrefix = "connstate"
-	myNSPrefix         = "my"
+	keyPattern          = "%s_%s"
+	invKeyPrefix        = "inv"
+	connIDKeyPrefix     = "conn"
+	connStateKeyPrefix  = "connstate"
+	connMetaKeyPrefix   = "connmeta"
+	theirKeyPrefix      = "theirkey"
+	connCountsKey       = "conncounts"
+	typePrefixKeyPrefix = "msgtypeprefix"
+	myNSPrefix          = "my"
 	// TODO: https://github.com/hyperledger/aries-framework-go/issues/556 It will not be constant, this namespace
 	//  will need to be figured with verification key
 	theirNSPrefix = "their"
@@ -42,6 +50,46 @@ type ConnectionRecord struct {
 	InvitationDID   string
 	Implicit        bool
 	Namespace       string
+	// Alias, Tags, Metadata and MessageTypePrefix are copied from the ConnectionMetadata of the connection
+	// when the record is read, they are not stored with the record.
+	Alias    string          `json:",omitempty"`
+	Tags     []string        `json:",omitempty"`
+	Metadata json.RawMessage `json:",omitempty"`
+	// MessageTypePrefix is the prefix of the message types sent to the other party, the canonical prefix
+	// is used if empty.
+	MessageTypePrefix string `json:",omitempty"`
+}
+
+// Destination returns the destination of the other party recorded by the DID exchange, nil if the record
+// has no service endpoint.
+func (r *ConnectionRecord) Destination() *service.Destination {
+	if r.ServiceEndPoint == "" {
+		return nil
+	}
+
+	return &service.Destination{RecipientKeys: r.RecipientKeys, ServiceEndpoint: r.ServiceEndPoint}
+}
+
+// ConnectionMetadata contains application specific data attached to a connection record.
+// It is persisted separately from the protocol state so that the state machine never overwrites it.
+type ConnectionMetadata struct {
+	Alias    string          `json:"alias,omitempty"`
+	Tags     []string        `json:"tags,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+	// MessageTypePrefix is the prefix of the message types sent to the other party, e.g.
+	// did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/ for the agents implementing the older RFCs.
+	MessageTypePrefix string `json:"message_type_prefix,omitempty"`
+}
+
+// HasTag returns true if the connection record is tagged with the given tag.
+func (r *ConnectionRecord) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (r *ConnectionRecord) isValid() error {
@@ -55,15 +103,25 @@ func (r *ConnectionRecord) isValid() error {
 
 // NewConnectionRecorder returns new connection record instance
 func NewConnectionRecorder(transientStore, store storage.Store) *ConnectionRecorder {
-	return &ConnectionRecorder{transientStore: transientStore, store: store}
+	return &ConnectionRecorder{transientStore: transientStore, store: store, metrics: metrics.Nop}
 }
 
 // ConnectionRecorder takes care of connection related persistence features
 type ConnectionRecorder struct {
 	transientStore storage.Store
 	store          storage.Store
+	// metrics receives the number of the connections by the state
+	metrics metrics.Sink
+	// counted are the numbers of the connections by the state the recorder added to the metrics
+	counted  connectionCounts
+	countsMu sync.Mutex
 }
 
+// connectionCounts are the numbers of the connections by the state. Each store keeps the counts of the connection
+// records it holds: the store counts the completed connections and the transient store the connections in progress,
+// the connections are counted without reading the records.
+type connectionCounts map[string]float64
+
 // SaveInvitation saves connection invitation to underlying store
 //
 // Args:
@@ -123,16 +181,129 @@ func (c *ConnectionRecorder) GetInvitation(id string) (*Invitation, error) {
 func (c *ConnectionRecorder) GetConnectionRecord(connectionID string) (*ConnectionRecord, error) {
 	rec, err := getAndUnmarshal(connectionKeyPrefix(connectionID), c.store)
 	if err != nil {
-		if errors.Is(err, storage.ErrDataNotFound) {
-			return getAndUnmarshal(connectionKeyPrefix(connectionID), c.transientStore)
+		if !errors.Is(err, storage.ErrDataNotFound) {
+			return nil, err
+		}
+
+		rec, err = getAndUnmarshal(connectionKeyPrefix(connectionID), c.transientStore)
+		if err != nil {
+			return nil, err
 		}
+	}
 
+	if err := c.applyConnectionMetadata(rec); err != nil {
 		return nil, err
 	}
 
 	return rec, nil
 }
 
+// SaveConnectionMetadata saves alias, tags and metadata for the given connection. The connection record
+// must exist in the store.
+func (c *ConnectionRecorder) SaveConnectionMetadata(connectionID string, meta *ConnectionMetadata) error {
+	if meta == nil {
+		return errors.New("connection metadata can't be nil")
+	}
+
+	if len(meta.Metadata) > 0 && !json.Valid(meta.Metadata) {
+		return errors.New("connection metadata must be valid JSON")
+	}
+
+	if _, err := c.GetConnectionRecord(connectionID); err != nil {
+		return fmt.Errorf("save connection metadata: %w", err)
+	}
+
+	return c.putConnectionMetadata(connectionID, meta)
+}
+
+func (c *ConnectionRecorder) putConnectionMetadata(connectionID string, meta *ConnectionMetadata) error {
+	bytes, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("save connection metadata: %w", err)
+	}
+
+	return c.store.Put(connectionMetadataKey(connectionID), bytes)
+}
+
+// GetConnectionMetadata returns alias, tags and metadata saved for the given connection.
+// An empty ConnectionMetadata is returned if nothing was saved yet.
+func (c *ConnectionRecorder) GetConnectionMetadata(connectionID string) (*ConnectionMetadata, error) {
+	if _, err := c.GetConnectionRecord(connectionID); err != nil {
+		return nil, fmt.Errorf("get connection metadata: %w", err)
+	}
+
+	return c.getConnectionMetadata(connectionID)
+}
+
+func (c *ConnectionRecorder) getConnectionMetadata(connectionID string) (*ConnectionMetadata, error) {
+	meta := &ConnectionMetadata{}
+
+	bytes, err := c.store.Get(connectionMetadataKey(connectionID))
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return meta, nil
+		}
+
+		return nil, fmt.Errorf("get connection metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(bytes, meta); err != nil {
+		return nil, fmt.Errorf("get connection metadata: %w", err)
+	}
+
+	return meta, nil
+}
+
+// applyConnectionMetadata copies the saved metadata into the connection record.
+func (c *ConnectionRecorder) applyConnectionMetadata(record *ConnectionRecord) error {
+	meta, err := c.getConnectionMetadata(record.ConnectionID)
+	if err != nil {
+		return err
+	}
+
+	record.setMetadata(meta)
+
+	return nil
+}
+
+// connectionMetadata returns the saved metadata of all connections by the connection ID, the metadata
+// is read by a single iteration of the store.
+func (c *ConnectionRecorder) connectionMetadata() (map[string]*ConnectionMetadata, error) {
+	searchKey := connectionMetadataKey("")
+
+	itr := c.store.Iterator(searchKey, fmt.Sprintf(limitPattern, searchKey))
+	defer itr.Release()
+
+	metas := make(map[string]*ConnectionMetadata)
+
+	for itr.Next() {
+		meta := &ConnectionMetadata{}
+		if err := json.Unmarshal(itr.Value(), meta); err != nil {
+			return nil, fmt.Errorf("get connection metadata: %w", err)
+		}
+
+		metas[strings.TrimPrefix(string(itr.Key()), searchKey)] = meta
+	}
+
+	if err := itr.Error(); err != nil {
+		return nil, fmt.Errorf("get connection metadata: %w", err)
+	}
+
+	return metas, nil
+}
+
+// setMetadata copies the metadata into the record, the fields are cleared if meta is nil.
+func (r *ConnectionRecord) setMetadata(meta *ConnectionMetadata) {
+	if meta == nil {
+		meta = &ConnectionMetadata{}
+	}
+
+	r.Alias = meta.Alias
+	r.Tags = meta.Tags
+	r.Metadata = meta.Metadata
+	r.MessageTypePrefix = meta.MessageTypePrefix
+}
+
 // QueryConnectionRecords returns connection records found in underlying store
 // for given query criteria
 func (c *ConnectionRecorder) QueryConnectionRecords() ([]*ConnectionRecord, error) {
@@ -176,9 +347,179 @@ func (c *ConnectionRecorder) QueryConnectionRecords() ([]*ConnectionRecord, erro
 		}
 	}
 
+	metas, err := c.connectionMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("query connection records : %w", err)
+	}
+
+	for _, record := range records {
+		record.setMetadata(metas[record.ConnectionID])
+	}
+
 	return records, nil
 }
 
+// GetConnectionRecordByTheirKey returns the connection record, completed or in progress, which has the given key
+// among the recipient keys of the other party, storage.ErrDataNotFound if there is no such connection.
+func (c *ConnectionRecorder) GetConnectionRecordByTheirKey(verKey string) (*ConnectionRecord, error) {
+	k, err := createNSKey(theirKeyPrefix, verKey)
+	if err != nil {
+		return nil, storage.ErrDataNotFound
+	}
+
+	// the connections in progress are indexed in the transient store, the completed ones in both stores
+	for _, store := range []storage.Store{c.transientStore, c.store} {
+		connectionID, err := store.Get(k)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("get connection record by their key: %w", err)
+		}
+
+		record, err := c.GetConnectionRecord(string(connectionID))
+		if errors.Is(err, storage.ErrDataNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("get connection record by their key: %w", err)
+		}
+
+		// the index is stale if the other party changed its keys, e.g. the invitation key was replaced
+		// by the key of its DID
+		if record.hasTheirKey(verKey) {
+			return record, nil
+		}
+	}
+
+	return nil, storage.ErrDataNotFound
+}
+
+// hasTheirKey returns true if the key is among the recipient keys of the other party.
+func (r *ConnectionRecord) hasTheirKey(verKey string) bool {
+	for _, k := range r.RecipientKeys {
+		if k == verKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConnectionID returns the ID of the connection with the other party owning the key or the connection created
+// by the DID exchange thread, empty if there is no such connection. It implements history.ConnectionLookup.
+func (c *ConnectionRecorder) ConnectionID(theirKey, thID string) string {
+	if theirKey != "" {
+		if record, err := c.GetConnectionRecordByTheirKey(theirKey); err == nil {
+			return record.ConnectionID
+		}
+	}
+
+	if thID == "" {
+		return ""
+	}
+
+	for _, namespace := range []string{myNSPrefix, theirNSPrefix} {
+		nsThID, err := createNSKey(namespace, thID)
+		if err != nil {
+			continue
+		}
+
+		if record, err := c.GetConnectionRecordByNSThreadID(nsThID); err == nil {
+			return record.ConnectionID
+		}
+	}
+
+	return ""
+}
+
+// MessageTypePrefix returns the message type prefix the other party uses on the thread, otherwise the prefix saved
+// in the metadata of the connection with the other party owning the key or the connection created by the thread,
+// empty if there is no such connection. It implements msgtype.PrefixLookup.
+func (c *ConnectionRecorder) MessageTypePrefix(theirKey, thID string) string {
+	if prefix := c.threadMessageTypePrefix(thID); prefix != "" {
+		return prefix
+	}
+
+	connectionID := c.ConnectionID(theirKey, thID)
+	if connectionID == "" {
+		return ""
+	}
+
+	meta, err := c.getConnectionMetadata(connectionID)
+	if err != nil {
+		logger.Warnf("get message type prefix of connection %s: %s", connectionID, err)
+		return ""
+	}
+
+	return meta.MessageTypePrefix
+}
+
+// SaveMessageTypePrefix saves the message type prefix the other party uses on the thread, the replies on the thread
+// are sent with the same prefix. The prefix used on the DID exchange thread is saved in the metadata
+// of the connection once it is completed. It implements msgtype.PrefixRecorder.
+func (c *ConnectionRecorder) SaveMessageTypePrefix(thID, prefix string) error {
+	k, err := createNSKey(typePrefixKeyPrefix, thID)
+	if err != nil {
+		return fmt.Errorf("save message type prefix: %w", err)
+	}
+
+	// every message of the thread has the prefix, it is saved once
+	if saved, err := c.transientStore.Get(k); err == nil && string(saved) == prefix {
+		return nil
+	}
+
+	if err := c.transientStore.Put(k, []byte(prefix)); err != nil {
+		return fmt.Errorf("save message type prefix: %w", err)
+	}
+
+	return nil
+}
+
+// threadMessageTypePrefix returns the message type prefix the other party uses on the thread, empty if none
+// was saved.
+func (c *ConnectionRecorder) threadMessageTypePrefix(thID string) string {
+	if thID == "" {
+		return ""
+	}
+
+	k, err := createNSKey(typePrefixKeyPrefix, thID)
+	if err != nil {
+		return ""
+	}
+
+	prefix, err := c.transientStore.Get(k)
+	if err != nil {
+		return ""
+	}
+
+	return string(prefix)
+}
+
+// keepMessageTypePrefix saves the prefix the other party used on the DID exchange thread in the metadata
+// of the completed connection, the prefix chosen for the connection is kept.
+func (c *ConnectionRecorder) keepMessageTypePrefix(record *ConnectionRecord) error {
+	prefix := c.threadMessageTypePrefix(record.ThreadID)
+	if prefix == "" {
+		return nil
+	}
+
+	meta, err := c.getConnectionMetadata(record.ConnectionID)
+	if err != nil {
+		return err
+	}
+
+	if meta.MessageTypePrefix != "" {
+		return nil
+	}
+
+	meta.MessageTypePrefix = prefix
+
+	return c.putConnectionMetadata(record.ConnectionID, meta)
+}
+
 // GetConnectionRecordAtState return connection record based on the connection ID and state.
 func (c *ConnectionRecorder) GetConnectionRecordAtState(connectionID, stateID string) (*ConnectionRecord, error) {
 	if stateID == "" {
@@ -216,6 +557,8 @@ func (c *ConnectionRecorder) GetConnectionRecordByNSThreadID(nsThreadID string)
 
 // saveConnectionRecord saves the connection record against the connection id  in the store
 func (c *ConnectionRecorder) saveConnectionRecord(record *ConnectionRecord) error {
+	previous := c.previousState(record.ConnectionID)
+
 	if err := marshalAndSave(connectionKeyPrefix(record.ConnectionID), record, c.transientStore); err != nil {
 		return fmt.Errorf("save connection record in transient store: %w", err)
 	}
@@ -227,17 +570,194 @@ func (c *ConnectionRecorder) saveConnectionRecord(record *ConnectionRecord) erro
 		}
 	}
 
+	if err := saveTheirKeys(record, c.transientStore); err != nil {
+		return fmt.Errorf("save their keys in transient store: %w", err)
+	}
+
 	if record.State == stateNameCompleted {
 		if err := marshalAndSave(connectionKeyPrefix(record.ConnectionID), record, c.store); err != nil {
 			return fmt.Errorf("save connection record in permanent store: %w", err)
 		}
+
+		if err := saveTheirKeys(record, c.store); err != nil {
+			return fmt.Errorf("save their keys in permanent store: %w", err)
+		}
+
+		if err := c.keepMessageTypePrefix(record); err != nil {
+			return fmt.Errorf("save message type prefix in permanent store: %w", err)
+		}
+	}
+
+	if previous != record.State {
+		c.countConnection(previous, -1)
+		c.countConnection(record.State, 1)
 	}
 
 	return nil
 }
 
+// previousState returns the state of the connection record before it is saved, the completed connection
+// is not kept by the transient store after the restart.
+func (c *ConnectionRecorder) previousState(connectionID string) string {
+	for _, store := range []storage.Store{c.transientStore, c.store} {
+		if store == nil {
+			continue
+		}
+
+		record, err := getAndUnmarshal(connectionKeyPrefix(connectionID), store)
+		if err == nil {
+			return record.State
+		}
+	}
+
+	return ""
+}
+
+// countConnection adds the delta to the number of the connections in the state kept by the store
+// and to the metrics.
+func (c *ConnectionRecorder) countConnection(state string, delta float64) {
+	if state == "" {
+		return
+	}
+
+	c.countsMu.Lock()
+	defer c.countsMu.Unlock()
+
+	store := c.countsStore(state)
+	if store == nil {
+		return
+	}
+
+	counts, err := getConnectionCounts(store)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		logger.Warnf("count connections: %s", err)
+		return
+	}
+
+	// the store without the counts yet is counted by the recorder starting to count
+	if counts != nil {
+		counts[state] += delta
+
+		if err := putConnectionCounts(store, counts); err != nil {
+			logger.Warnf("count connections: %s", err)
+		}
+	}
+
+	if c.counted != nil {
+		c.counted[state] += delta
+		c.metrics.AddGauge(metrics.Connections, delta, metrics.Labels{"state": state})
+	}
+}
+
+// startCounting adds the connections kept by the stores to the metrics. The connection records of the store
+// are counted once if the store keeps no counts yet, e.g. it was written by a previous version.
+func (c *ConnectionRecorder) startCounting() {
+	c.countsMu.Lock()
+	defer c.countsMu.Unlock()
+
+	c.counted = connectionCounts{}
+
+	for _, store := range []storage.Store{c.store, c.transientStore} {
+		if store == nil {
+			continue
+		}
+
+		counts, err := getConnectionCounts(store)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			counts, err = c.countRecords(store)
+		}
+
+		if err != nil {
+			logger.Warnf("count connections: %s", err)
+			continue
+		}
+
+		for state, n := range counts {
+			c.counted[state] += n
+			c.metrics.AddGauge(metrics.Connections, n, metrics.Labels{"state": state})
+		}
+	}
+}
+
+// stopCounting removes the connections counted by the recorder from the metrics.
+func (c *ConnectionRecorder) stopCounting() {
+	c.countsMu.Lock()
+	defer c.countsMu.Unlock()
+
+	for state, n := range c.counted {
+		c.metrics.AddGauge(metrics.Connections, -n, metrics.Labels{"state": state})
+	}
+
+	c.counted = nil
+}
+
+// countRecords counts the connection records held by the store and saves the counts.
+func (c *ConnectionRecorder) countRecords(store storage.Store) (connectionCounts, error) {
+	searchKey := connectionKeyPrefix("")
+
+	itr := store.Iterator(searchKey, fmt.Sprintf(limitPattern, searchKey))
+	defer itr.Release()
+
+	counts := connectionCounts{}
+
+	for itr.Next() {
+		var record struct{ State string }
+
+		if err := json.Unmarshal(itr.Value(), &record); err != nil {
+			return nil, fmt.Errorf("count connection records: %w", err)
+		}
+
+		if record.State != "" && c.countsStore(record.State) == store {
+			counts[record.State]++
+		}
+	}
+
+	if err := itr.Error(); err != nil {
+		return nil, fmt.Errorf("count connection records: %w", err)
+	}
+
+	return counts, putConnectionCounts(store, counts)
+}
+
+// countsStore returns the store counting the connections in the state.
+func (c *ConnectionRecorder) countsStore(state string) storage.Store {
+	if state == stateNameCompleted {
+		return c.store
+	}
+
+	return c.transientStore
+}
+
+func getConnectionCounts(store storage.Store) (connectionCounts, error) {
+	src, err := store.Get(connCountsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := connectionCounts{}
+	if err := json.Unmarshal(src, &counts); err != nil {
+		return nil, fmt.Errorf("unmarshal connection counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+func putConnectionCounts(store storage.Store, counts connectionCounts) error {
+	src, err := json.Marshal(counts)
+	if err != nil {
+		return fmt.Errorf("marshal connection counts: %w", err)
+	}
+
+	return store.Put(connCountsKey, src)
+}
+
+// marshalAndSave saves the connection record without its metadata, the metadata is kept by the connection
+// metadata key only.
 func marshalAndSave(k string, v *ConnectionRecord, store storage.Store) error {
-	bytes, err := json.Marshal(v)
+	record := *v
+	record.setMetadata(nil)
+
+	bytes, err := json.Marshal(&record)
 
 	if err != nil {
 		return fmt.Errorf("save connection record: %w", err)
@@ -262,6 +782,27 @@ func (c *ConnectionRecorder) saveNewConnectionRecord(record *ConnectionRecord) e
 	return c.saveNSThreadID(record.ThreadID, record.Namespace, record.ConnectionID)
 }
 
+// saveTheirKeys indexes the connection by the recipient keys of the other party.
+func saveTheirKeys(record *ConnectionRecord, store storage.Store) error {
+	for _, verKey := range record.RecipientKeys {
+		// an empty key identifies no sender, e.g. the invitation was created without recipient keys
+		if verKey == "" {
+			continue
+		}
+
+		k, err := createNSKey(theirKeyPrefix, verKey)
+		if err != nil {
+			return err
+		}
+
+		if err := store.Put(k, []byte(record.ConnectionID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *ConnectionRecorder) saveNSThreadID(thid, namespace, connectionID string) error {
 	if namespace != myNSPrefix && namespace != theirNSPrefix {
 		return fmt.Errorf("namespace not supported")
@@ -318,6 +859,11 @@ func connectionKeyPrefix(connectionID string) string {
 	return fmt.Sprintf(keyPattern, connIDKeyPrefix, connectionID)
 }
 
+// connectionMetadataKey computes key for connection metadata object
+func connectionMetadataKey(connectionID string) string {
+	return fmt.Sprintf(keyPattern, connMetaKeyPrefix, connectionID)
+}
+
 // connectionStateKeyPrefix computes key for connection record data associated with state.
 func connectionStateKeyPrefix(connectionID, stateID string) string {
 	return fmt.Sprintf(keyPattern, connStateKeyPrefix, connectionID+stateID)
@@ -8,11 +8,13 @@ package didexchange
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
@@ -417,3 +419,274 @@ func TestConnectionRecorder_QueryConnectionRecord(t *testing.T) {
 		require.Empty(t, result)
 	})
 }
+
+func TestConnectionRecorder_GetConnectionRecordByTheirKey(t *testing.T) {
+	t.Run("test get connection record by their key", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		recorder := NewConnectionRecorder(transientStore, store)
+
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn1",
+			State: stateNameCompleted, RecipientKeys: []string{"key1", "key2"}}))
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn2",
+			State: stateNameCompleted, RecipientKeys: []string{"key3"}}))
+		// the connections in progress are resolved too
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn3",
+			State: stateNameRequested, RecipientKeys: []string{"key4"}}))
+		// the empty keys are not indexed
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn4",
+			State: stateNameInvited, RecipientKeys: []string{""}}))
+		require.NoError(t, recorder.SaveConnectionMetadata("conn1", &ConnectionMetadata{Alias: "alias"}))
+
+		record, err := recorder.GetConnectionRecordByTheirKey("key2")
+		require.NoError(t, err)
+		require.Equal(t, "conn1", record.ConnectionID)
+		require.Equal(t, "alias", record.Alias)
+
+		record, err = recorder.GetConnectionRecordByTheirKey("key3")
+		require.NoError(t, err)
+		require.Equal(t, "conn2", record.ConnectionID)
+
+		record, err = recorder.GetConnectionRecordByTheirKey("key4")
+		require.NoError(t, err)
+		require.Equal(t, "conn3", record.ConnectionID)
+
+		// the key replaced by the other party is not resolved anymore
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn3",
+			State: stateNameCompleted, RecipientKeys: []string{"key5"}}))
+
+		_, err = recorder.GetConnectionRecordByTheirKey("key4")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		record, err = recorder.GetConnectionRecordByTheirKey("key5")
+		require.NoError(t, err)
+		require.Equal(t, "conn3", record.ConnectionID)
+
+		_, err = recorder.GetConnectionRecordByTheirKey("key6")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		_, err = recorder.GetConnectionRecordByTheirKey("")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("test get connection record by their key failure", func(t *testing.T) {
+		k, err := createNSKey(theirKeyPrefix, "key")
+		require.NoError(t, err)
+
+		// error from the index
+		store := &mockstorage.MockStore{Store: map[string][]byte{k: []byte("conn1")}, ErrGet: errors.New("get error")}
+
+		recorder := NewConnectionRecorder(store, store)
+		_, err = recorder.GetConnectionRecordByTheirKey("key")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get connection record by their key: get error")
+
+		// invalid record
+		store = &mockstorage.MockStore{Store: map[string][]byte{k: []byte("conn1"),
+			connectionKeyPrefix("conn1"): []byte("-----")}}
+
+		recorder = NewConnectionRecorder(store, store)
+		_, err = recorder.GetConnectionRecordByTheirKey("key")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get connection record by their key")
+
+		// the record of the index was not found
+		store = &mockstorage.MockStore{Store: map[string][]byte{k: []byte("conn1")}}
+
+		recorder = NewConnectionRecorder(store, store)
+		_, err = recorder.GetConnectionRecordByTheirKey("key")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+}
+
+func TestConnectionRecorder_ConnectionID(t *testing.T) {
+	store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+	transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+	recorder := NewConnectionRecorder(transientStore, store)
+
+	require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn1",
+		State: stateNameCompleted, RecipientKeys: []string{"key1"}}))
+	require.NoError(t, recorder.saveNewConnectionRecord(&ConnectionRecord{ConnectionID: "conn2",
+		ThreadID: "thid2", State: stateNameInvited, Namespace: myNSPrefix}))
+	require.NoError(t, recorder.saveNewConnectionRecord(&ConnectionRecord{ConnectionID: "conn3",
+		ThreadID: "thid3", State: stateNameRequested, Namespace: theirNSPrefix}))
+
+	require.Equal(t, "conn1", recorder.ConnectionID("key1", "thid2"))
+	require.Equal(t, "conn2", recorder.ConnectionID("unknown", "thid2"))
+	require.Equal(t, "conn3", recorder.ConnectionID("", "thid3"))
+	require.Empty(t, recorder.ConnectionID("unknown", "unknown"))
+	require.Empty(t, recorder.ConnectionID("", ""))
+}
+
+func TestConnectionRecord_Destination(t *testing.T) {
+	require.Nil(t, (&ConnectionRecord{RecipientKeys: []string{"key1"}}).Destination())
+
+	des := (&ConnectionRecord{RecipientKeys: []string{"key1"}, ServiceEndPoint: "http://example.com"}).Destination()
+	require.Equal(t, &service.Destination{RecipientKeys: []string{"key1"}, ServiceEndpoint: "http://example.com"}, des)
+}
+
+func TestConnectionRecorder_MessageTypePrefix(t *testing.T) {
+	store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+	transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+	recorder := NewConnectionRecorder(transientStore, store)
+
+	require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn1",
+		State: stateNameCompleted, RecipientKeys: []string{"key1"}}))
+	require.NoError(t, recorder.saveNewConnectionRecord(&ConnectionRecord{ConnectionID: "conn2",
+		ThreadID: "thid2", State: stateNameInvited, Namespace: myNSPrefix}))
+
+	require.Empty(t, recorder.MessageTypePrefix("key1", ""))
+
+	legacyPrefix := "did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/"
+	require.NoError(t, recorder.SaveConnectionMetadata("conn1", &ConnectionMetadata{MessageTypePrefix: legacyPrefix}))
+
+	require.Equal(t, legacyPrefix, recorder.MessageTypePrefix("key1", ""))
+	require.Empty(t, recorder.MessageTypePrefix("", "thid2"))
+	require.Empty(t, recorder.MessageTypePrefix("unknown", "unknown"))
+
+	record, err := recorder.GetConnectionRecord("conn1")
+	require.NoError(t, err)
+	require.Equal(t, legacyPrefix, record.MessageTypePrefix)
+
+	t.Run("test prefix of the thread mirrored", func(t *testing.T) {
+		require.NoError(t, recorder.SaveMessageTypePrefix("thid2", legacyPrefix))
+		require.NoError(t, recorder.SaveMessageTypePrefix("thid2", legacyPrefix))
+
+		// the prefix of the thread is used before the connection is completed
+		require.Equal(t, legacyPrefix, recorder.MessageTypePrefix("", "thid2"))
+		require.Equal(t, legacyPrefix, recorder.MessageTypePrefix("key2", "thid2"))
+		require.Empty(t, recorder.MessageTypePrefix("key2", "thid3"))
+
+		// the prefix of the DID exchange thread is kept for the completed connection
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn2",
+			ThreadID: "thid2", State: stateNameCompleted, Namespace: myNSPrefix, RecipientKeys: []string{"key2"}}))
+		require.Equal(t, legacyPrefix, recorder.MessageTypePrefix("key2", "thid3"))
+
+		record, err := recorder.GetConnectionRecord("conn2")
+		require.NoError(t, err)
+		require.Equal(t, legacyPrefix, record.MessageTypePrefix)
+	})
+
+	t.Run("test prefix chosen for the connection kept", func(t *testing.T) {
+		require.NoError(t, recorder.saveNewConnectionRecord(&ConnectionRecord{ConnectionID: "conn3",
+			ThreadID: "thid4", State: stateNameInvited, Namespace: myNSPrefix}))
+		require.NoError(t, recorder.SaveConnectionMetadata("conn3",
+			&ConnectionMetadata{MessageTypePrefix: "https://example.com/"}))
+		require.NoError(t, recorder.SaveMessageTypePrefix("thid4", legacyPrefix))
+
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn3",
+			ThreadID: "thid4", State: stateNameCompleted, Namespace: myNSPrefix, RecipientKeys: []string{"key3"}}))
+		require.Equal(t, "https://example.com/", recorder.MessageTypePrefix("key3", ""))
+	})
+
+	t.Run("test error from store", func(t *testing.T) {
+		transientStore.ErrPut = errors.New("put error")
+		defer func() { transientStore.ErrPut = nil }()
+
+		err := recorder.SaveMessageTypePrefix("thid5", legacyPrefix)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "save message type prefix")
+	})
+}
+
+func TestConnectionRecorder_ConnectionMetadata(t *testing.T) {
+	t.Run("save and get connection metadata", func(t *testing.T) {
+		transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		recorder := NewConnectionRecorder(transientStore, store)
+
+		connRec := &ConnectionRecord{ConnectionID: connIDValue, ThreadID: threadIDValue,
+			Namespace: myNSPrefix, State: stateNameInvited}
+		require.NoError(t, recorder.saveConnectionRecord(connRec))
+
+		meta, err := recorder.GetConnectionMetadata(connIDValue)
+		require.NoError(t, err)
+		require.Equal(t, &ConnectionMetadata{}, meta)
+
+		expected := &ConnectionMetadata{
+			Alias:    "alice",
+			Tags:     []string{"partner", "customer"},
+			Metadata: json.RawMessage(`{"customerID":"123"}`),
+		}
+		require.NoError(t, recorder.SaveConnectionMetadata(connIDValue, expected))
+
+		meta, err = recorder.GetConnectionMetadata(connIDValue)
+		require.NoError(t, err)
+		require.Equal(t, expected, meta)
+
+		// metadata is kept when the state machine updates the record
+		connRec.State = stateNameRequested
+		require.NoError(t, recorder.saveConnectionRecord(connRec))
+
+		stored, err := recorder.GetConnectionRecord(connIDValue)
+		require.NoError(t, err)
+		require.Equal(t, stateNameRequested, stored.State)
+		require.Equal(t, expected.Alias, stored.Alias)
+		require.Equal(t, expected.Tags, stored.Tags)
+		require.JSONEq(t, string(expected.Metadata), string(stored.Metadata))
+		require.True(t, stored.HasTag("partner"))
+		require.False(t, stored.HasTag("unknown"))
+
+		// the metadata is kept only by the connection metadata key
+		connRec.State = stateNameCompleted
+		connRec.Alias = "stale"
+		require.NoError(t, recorder.saveConnectionRecord(connRec))
+
+		for _, s := range []*mockstorage.MockStore{store, transientStore} {
+			raw := &ConnectionRecord{}
+			require.NoError(t, json.Unmarshal(s.Store[connectionKeyPrefix(connIDValue)], raw))
+			require.Empty(t, raw.Alias)
+			require.Empty(t, raw.Tags)
+			require.Empty(t, raw.Metadata)
+		}
+
+		// the records and their metadata are read by the iterators
+		store.ErrGet = errors.New("get error")
+		transientStore.ErrGet = errors.New("get error")
+
+		records, err := recorder.QueryConnectionRecords()
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, expected.Alias, records[0].Alias)
+		require.Equal(t, expected.Tags, records[0].Tags)
+		require.JSONEq(t, string(expected.Metadata), string(records[0].Metadata))
+	})
+
+	t.Run("save connection metadata errors", func(t *testing.T) {
+		transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		recorder := NewConnectionRecorder(transientStore, store)
+
+		err := recorder.SaveConnectionMetadata(connIDValue, nil)
+		require.EqualError(t, err, "connection metadata can't be nil")
+
+		err = recorder.SaveConnectionMetadata(connIDValue, &ConnectionMetadata{Metadata: []byte("{-")})
+		require.EqualError(t, err, "connection metadata must be valid JSON")
+
+		err = recorder.SaveConnectionMetadata(connIDValue, &ConnectionMetadata{Alias: "alice"})
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		_, err = recorder.GetConnectionMetadata(connIDValue)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("get connection metadata with invalid data", func(t *testing.T) {
+		transientStore := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		recorder := NewConnectionRecorder(transientStore, store)
+
+		require.NoError(t, recorder.saveConnectionRecord(&ConnectionRecord{ConnectionID: connIDValue,
+			ThreadID: threadIDValue, Namespace: myNSPrefix}))
+		require.NoError(t, store.Put(connectionMetadataKey(connIDValue), []byte("-----")))
+
+		_, err := recorder.GetConnectionMetadata(connIDValue)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get connection metadata")
+
+		_, err = recorder.GetConnectionRecord(connIDValue)
+		require.Error(t, err)
+
+		_, err = recorder.QueryConnectionRecords()
+		require.Error(t, err)
+	})
+}
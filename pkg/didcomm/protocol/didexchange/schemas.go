@@ -0,0 +1,104 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didexchange
+
+const (
+	invitationSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "label": {"type": "string"},
+    "did": {"type": "string", "minLength": 1},
+    "recipientKeys": {"type": "array", "minItems": 1, "items": {"type": "string"}},
+    "routingKeys": {"type": "array", "items": {"type": "string"}},
+    "serviceEndpoint": {"type": "string", "minLength": 1},
+    "imageUrl": {"type": "string"}
+  },
+  "anyOf": [
+    {"required": ["did"]},
+    {"required": ["recipientKeys", "serviceEndpoint"]}
+  ]
+}`
+
+	requestSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "connection"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "label": {"type": "string"},
+    "connection": {
+      "type": "object",
+      "required": ["did"],
+      "properties": {
+        "did": {"type": "string", "minLength": 1},
+        "did_doc": {"type": "object"}
+      }
+    },
+    "~thread": {"type": "object"}
+  }
+}`
+
+	responseSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "~thread", "connection~sig"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "~thread": {
+      "type": "object",
+      "required": ["thid"],
+      "properties": {
+        "thid": {"type": "string", "minLength": 1}
+      }
+    },
+    "connection~sig": {
+      "type": "object",
+      "required": ["signature", "sig_data", "signers"],
+      "properties": {
+        "signature": {"type": "string", "minLength": 1},
+        "sig_data": {"type": "string", "minLength": 1},
+        "signers": {"type": "string", "minLength": 1}
+      }
+    }
+  }
+}`
+
+	ackSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "~thread"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "status": {"type": "string"},
+    "~thread": {
+      "type": "object",
+      "required": ["thid"],
+      "properties": {
+        "thid": {"type": "string", "minLength": 1}
+      }
+    }
+  }
+}`
+)
+
+// Schemas returns the JSON Schemas of the DID exchange messages by message type, the inbound messages
+// are validated against them before they are dispatched to the service.
+func Schemas() map[string]string {
+	return map[string]string{
+		InvitationMsgType: invitationSchema,
+		RequestMsgType:    requestSchema,
+		ResponseMsgType:   responseSchema,
+		AckMsgType:        ackSchema,
+	}
+}
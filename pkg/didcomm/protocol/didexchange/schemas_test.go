@@ -0,0 +1,84 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didexchange
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
+)
+
+func TestSchemas(t *testing.T) {
+	registry := schema.NewRegistry()
+	require.NoError(t, registry.RegisterAll(Schemas()))
+
+	validate := func(msg interface{}) error {
+		payload, err := json.Marshal(msg)
+		require.NoError(t, err)
+
+		didCommMsg, err := service.NewDIDCommMsg(payload)
+		require.NoError(t, err)
+
+		return registry.Validate(didCommMsg)
+	}
+
+	requireInvalid := func(err error, detail string) {
+		var validationErr *schema.ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Contains(t, err.Error(), detail)
+	}
+
+	t.Run("test invitation", func(t *testing.T) {
+		require.NoError(t, validate(&Invitation{Type: InvitationMsgType, ID: "1", Label: "alice",
+			RecipientKeys: []string{"key"}, ServiceEndpoint: "http://alice.example.com"}))
+		require.NoError(t, validate(&Invitation{Type: InvitationMsgType, ID: "1", DID: "did:example:alice"}))
+
+		requireInvalid(validate(&Invitation{Type: InvitationMsgType, ID: "1", RecipientKeys: []string{"key"}}),
+			"serviceEndpoint is required")
+	})
+
+	t.Run("test request", func(t *testing.T) {
+		doc := createDIDDoc()
+
+		require.NoError(t, validate(&Request{Type: RequestMsgType, ID: "1", Label: "bob",
+			Connection: &Connection{DID: doc.ID, DIDDoc: doc}, Thread: &decorator.Thread{PID: "pid"}}))
+
+		// the DID document of the public DID is resolved by the receiver
+		require.NoError(t, validate(&Request{Type: RequestMsgType, ID: "1", Connection: &Connection{DID: doc.ID}}))
+
+		requireInvalid(validate(&Request{Type: RequestMsgType, ID: "1"}), "connection is required")
+		requireInvalid(validate(&Request{Type: RequestMsgType, ID: "1", Connection: &Connection{DIDDoc: doc}}),
+			"did is required")
+	})
+
+	t.Run("test response", func(t *testing.T) {
+		sig := &ConnectionSignature{Signature: "sig", SignedData: "data", SignVerKey: "key"}
+
+		require.NoError(t, validate(&Response{Type: ResponseMsgType, ID: "2", ConnectionSignature: sig,
+			Thread: &decorator.Thread{ID: "1"}}))
+
+		requireInvalid(validate(&Response{Type: ResponseMsgType, ID: "2", ConnectionSignature: sig}),
+			"~thread is required")
+		requireInvalid(validate(&Response{Type: ResponseMsgType, ID: "2", Thread: &decorator.Thread{ID: "1"},
+			ConnectionSignature: &ConnectionSignature{Signature: "sig"}}), "sig_data is required")
+	})
+
+	t.Run("test ack", func(t *testing.T) {
+		require.NoError(t, validate(&model.Ack{Type: AckMsgType, ID: "3", Status: ackStatusOK,
+			Thread: &decorator.Thread{ID: "1"}}))
+
+		requireInvalid(validate(&model.Ack{Type: AckMsgType, ID: "3", Thread: &decorator.Thread{PID: "1"}}),
+			"thid is required")
+	})
+}
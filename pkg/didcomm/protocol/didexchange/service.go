@@ -7,16 +7,26 @@ SPDX-License-Identifier: Apache-2.0
 package didexchange
 
 import (
+	gocontext "context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/statemachine"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
@@ -24,6 +34,9 @@ import (
 
 var logger = log.New("aries-framework/did-exchange/service")
 
+// ErrSenderMismatch is returned if the inbound message was not sent by the connection it belongs to.
+var ErrSenderMismatch = errors.New("message sender does not match the connection")
+
 const (
 	// DIDExchange did exchange protocol
 	DIDExchange = "didexchange"
@@ -37,6 +50,8 @@ const (
 	ResponseMsgType = DIDExchangeSpec + "response"
 	// AckMsgType defines the did-exchange ack message type.
 	AckMsgType = DIDExchangeSpec + "ack"
+	// CallbackPool is the name of the worker pool resuming the threads continued by the action events.
+	CallbackPool = DIDExchange + "-callbacks"
 )
 
 // message type to store data for eventing. This is retrieved during callback.
@@ -46,10 +61,15 @@ type message struct {
 	Options       *options
 	NextStateName string
 	ConnRecord    *ConnectionRecord
-	// err is used to determine whether callback was stopped
-	// e.g the user received an action event and executes Stop(err) function
-	// in that case `err` is equal to `err` which was passing to Stop function
-	err error
+}
+
+// PendingAction is an action event which waits for the consumer to continue or stop it.
+// Pending actions survive the agent restart, they are re-emitted once the action event channel is registered.
+type PendingAction struct {
+	ConnectionID string `json:"connection_id"`
+	ThreadID     string `json:"thread_id"`
+	MessageType  string `json:"message_type"`
+	State        string `json:"state"`
 }
 
 // provider contains dependencies for the DID exchange protocol and is typically created by using aries.Context()
@@ -59,6 +79,10 @@ type provider interface {
 	TransientStorageProvider() storage.Provider
 	Signer() kms.Signer
 	VDRIRegistry() vdriapi.Registry
+	WorkerPool(name string) *workerpool.Pool
+	Metrics() metrics.Sink
+	Tracer() trace.Tracer
+	MessageHistory() *history.Archive
 }
 
 // stateMachineMsg is an internal struct used to pass data to state machine.
@@ -67,6 +91,19 @@ type stateMachineMsg struct {
 	payload    []byte
 	connRecord *ConnectionRecord
 	options    *options
+	// inbound is nil for the messages which were not received by the framework
+	inbound *service.InboundContext
+	// goCtx aborts the DID resolution and the sending of the state actions when done
+	goCtx gocontext.Context
+}
+
+// requestContext returns the context the state is executed with.
+func (m *stateMachineMsg) requestContext() gocontext.Context {
+	if m.goCtx == nil {
+		return gocontext.Background()
+	}
+
+	return m.goCtx
 }
 
 // Service for DID exchange protocol
@@ -74,8 +111,13 @@ type Service struct {
 	service.Action
 	service.Message
 	ctx             *context
-	callbackChannel chan *message
+	machine         *statemachine.Machine
 	connectionStore *ConnectionRecorder
+	// pool processes the inbound messages, the callbacks are processed by the separate pool
+	// so that the consumer continuing the action events is not blocked by the inbound messages
+	pool *workerpool.Pool
+	// retryAfter is the time the callers are asked to wait if the pool rejects the implicit invitation
+	retryAfter time.Duration
 }
 
 type context struct {
@@ -107,6 +149,7 @@ func New(prov provider) (*Service, error) {
 	}
 
 	connRecorder := NewConnectionRecorder(transientStore, store)
+	connRecorder.metrics = prov.Metrics()
 	svc := &Service{
 		ctx: &context{
 			outboundDispatcher: prov.OutboundDispatcher(),
@@ -114,50 +157,204 @@ func New(prov provider) (*Service, error) {
 			vdriRegistry:       prov.VDRIRegistry(),
 			connectionStore:    connRecorder,
 		},
-		// TODO channel size - https://github.com/hyperledger/aries-framework-go/issues/246
-		callbackChannel: make(chan *message, 10),
 		connectionStore: connRecorder,
+		pool:            prov.WorkerPool(DIDExchange),
+		retryAfter:      workerpool.DefaultRetryAfter,
+	}
+
+	if rp, ok := prov.(interface{ WorkerPoolRetryAfter() time.Duration }); ok {
+		svc.retryAfter = rp.WorkerPoolRetryAfter()
+	}
+
+	machineOpts := []statemachine.Option{
+		statemachine.WithWorkerPool(prov.WorkerPool(CallbackPool)), statemachine.WithPendingStore(store),
+		statemachine.WithTracer(prov.Tracer()),
+	}
+
+	if h := prov.MessageHistory(); h != nil {
+		machineOpts = append(machineOpts, statemachine.WithTransitionRecorder(h))
 	}
 
-	// start the listener
-	go svc.startInternalListener()
+	svc.machine = statemachine.New(DIDExchange, &svc.Message, svc.resume, svc.abandon, machineOpts...)
+
+	if err = svc.restore(); err != nil {
+		return nil, fmt.Errorf("restore pending actions: %w", err)
+	}
+
+	connRecorder.startCounting()
 
 	return svc, nil
 }
 
 // HandleInbound handles inbound didexchange messages.
 func (s *Service) HandleInbound(msg *service.DIDCommMsg) (string, error) {
+	return s.HandleInboundContext(gocontext.Background(), msg)
+}
+
+// HandleInboundContext handles inbound didexchange messages. The message is processed after the call returns,
+// the processing only continues the trace of the context.
+func (s *Service) HandleInboundContext(ctx gocontext.Context, msg *service.DIDCommMsg) (string, error) {
 	logger.Debugf("receive inbound message : %s", msg.Payload)
 
+	// the state machine matches the canonical types of the supported version only
+	msgtype.NormalizeMsg(msg)
+	msgtype.NegotiateMsg(msg, s.Protocols())
+
 	// fetch the thread id
 	thID, err := threadID(msg)
 	if err != nil {
 		return "", err
 	}
 
+	// serialize the transitions of the thread, the lock is released once the message is processed
+	unlock, err := s.lockThread(msg.Header.Type, thID)
+	if err != nil {
+		return "", err
+	}
+
 	// valid state transition and get the next state
 	next, err := s.nextState(msg.Header.Type, thID)
 	if err != nil {
+		unlock()
 		return "", fmt.Errorf("handle inbound - next state : %w", err)
 	}
 
 	// connection record
-	connRecord, err := s.connectionRecord(msg)
+	connRecord, err := s.connectionRecord(ctx, msg)
 	if err != nil {
+		unlock()
 		return "", err
 	}
 
 	internalMsg := &message{Msg: msg, ThreadID: thID, NextStateName: next.Name(), ConnRecord: connRecord}
 
-	go func(msg *message, aEvent chan<- service.DIDCommAction) {
-		if err = s.handle(msg, aEvent); err != nil {
+	aEvent := s.ActionEvent()
+	traceCtx := trace.Detach(ctx)
+
+	// the message is rejected if the pool is full, the sender is asked to retry later
+	err = s.pool.Submit(func() {
+		defer unlock()
+
+		if err := s.handle(traceCtx, internalMsg, aEvent); err != nil {
 			logger.Errorf("didexchange processing error : %s", err)
+
+			// the thread is abandoned if the message was not sent by the other party of the connection
+			if errors.Is(err, ErrSenderMismatch) {
+				s.abandonThread(thID, msg, err)
+			}
 		}
-	}(internalMsg, s.ActionEvent())
+	})
+	if err != nil {
+		unlock()
+		return "", fmt.Errorf("handle inbound: %w", err)
+	}
 
 	return connRecord.ConnectionID, nil
 }
 
+// Stop stops the service: the queued callbacks are processed, then the action event bus is closed.
+func (s *Service) Stop() error {
+	if err := s.machine.Stop(); err != nil {
+		return err
+	}
+
+	s.Action.Close()
+
+	// the connections are counted again by the service replacing this one
+	s.connectionStore.stopCounting()
+
+	return nil
+}
+
+// ResolveConnection returns the connection record, completed or in progress, which the sender key belongs to,
+// nil if the sender has no connection with the agent. It implements service.ConnectionResolver.
+func (s *Service) ResolveConnection(senderVerKey string, _ []string) (interface{}, error) {
+	record, err := s.connectionStore.GetConnectionRecordByTheirKey(senderVerKey)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("resolve connection: %w", err)
+	}
+
+	return record, nil
+}
+
+// ResolveDestination returns the destination of the sender of the DID exchange request, the destination is read
+// from the DID document of the request or of the public DID. It implements service.DestinationResolver.
+func (s *Service) ResolveDestination(ctx gocontext.Context, msg *service.DIDCommMsg) (*service.Destination, error) {
+	// the message might be invalid, the connection is read if it can be
+	request := &Request{}
+	if err := json.Unmarshal(msg.Payload, request); err != nil || request.Connection == nil {
+		return nil, nil
+	}
+
+	if request.Connection.DIDDoc == nil && request.Connection.DID == "" {
+		return nil, nil
+	}
+
+	didDoc, err := s.ctx.resolveDidDocFromConnection(ctx, request.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("resolve destination: %w", err)
+	}
+
+	des, err := prepareDestination(didDoc)
+	if err != nil {
+		return nil, fmt.Errorf("resolve destination: %w", err)
+	}
+
+	return des, nil
+}
+
+// InboundConnection returns the connection record the inbound message was received from, false if the sender
+// of the message has no connection with the agent.
+func InboundConnection(msg *service.DIDCommMsg) (*ConnectionRecord, bool) {
+	if msg == nil || msg.Inbound == nil {
+		return nil, false
+	}
+
+	record, ok := msg.Inbound.Connection.(*ConnectionRecord)
+
+	return record, ok && record != nil
+}
+
+// VerifySender returns ErrSenderMismatch if the inbound message was not sent by the given connection,
+// services use it to check the message really belongs to the connection of the thread.
+func VerifySender(msg *service.DIDCommMsg, connectionID string) error {
+	record, ok := InboundConnection(msg)
+	if !ok || record.ConnectionID != connectionID {
+		return fmt.Errorf("%w: connection %s", ErrSenderMismatch, connectionID)
+	}
+
+	return nil
+}
+
+// verifyInboundSender verifies the message received by the framework was sent by the connection of the thread,
+// the messages passed to the service by the agent itself have no inbound context and they are not verified.
+func verifyInboundSender(msg *stateMachineMsg) error {
+	if msg.inbound == nil {
+		return nil
+	}
+
+	return VerifySender(&service.DIDCommMsg{Header: msg.header, Inbound: msg.inbound}, msg.connRecord.ConnectionID)
+}
+
+// verifyInboundSenderKey verifies the message received by the framework was sent with one of the keys.
+func verifyInboundSenderKey(msg *stateMachineMsg, keys []string, connectionID string) error {
+	if msg.inbound == nil {
+		return nil
+	}
+
+	for _, k := range keys {
+		if k == msg.inbound.SenderVerKey {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: connection %s", ErrSenderMismatch, connectionID)
+}
+
 // Name return service name
 func (s *Service) Name() string {
 	return DIDExchange
@@ -174,12 +371,19 @@ func findNameSpace(msgType string) string {
 
 // Accept msg checks the msg type
 func (s *Service) Accept(msgType string) bool {
+	msgType = msgtype.Normalize(msgType)
+
 	return msgType == InvitationMsgType ||
 		msgType == RequestMsgType ||
 		msgType == ResponseMsgType ||
 		msgType == AckMsgType
 }
 
+// Protocols returns the supported versions of the DID exchange protocol.
+func (s *Service) Protocols() []string {
+	return []string{strings.TrimSuffix(DIDExchangeSpec, "/")}
+}
+
 // HandleOutbound handles outbound didexchange messages.
 func (s *Service) HandleOutbound(msg *service.DIDCommMsg, destination *service.Destination) error {
 	return errors.New("not implemented")
@@ -205,97 +409,98 @@ func (s *Service) nextState(msgType, thID string) (state, error) {
 
 	logger.Debugf("check if current state [%s] can transition to [%s]", current.Name(), next.Name())
 
-	if !current.CanTransitionTo(next) {
-		return nil, fmt.Errorf("invalid state transition: %s -> %s", current.Name(), next.Name())
+	if err := statemachine.ValidateTransition(current, next); err != nil {
+		return nil, err
 	}
 
 	return next, nil
 }
 
-func (s *Service) handle(msg *message, aEvent chan<- service.DIDCommAction) error { //nolint funlen
+func (s *Service) handle(ctx gocontext.Context, msg *message, aEvent chan<- service.DIDCommAction) error {
 	next, err := stateFromName(msg.NextStateName)
 	if err != nil {
 		return fmt.Errorf("invalid state name: %w", err)
 	}
 
-	for !isNoOp(next) {
-		s.sendMsgEvents(&service.StateMsg{
-			ProtocolName: DIDExchange,
-			Type:         service.PreState,
-			Msg:          msg.Msg.Clone(),
-			StateID:      next.Name(),
-			Properties:   createEventProperties(msg.ConnRecord.ConnectionID, msg.ConnRecord.InvitationID),
+	props := createEventProperties(msg.ConnRecord.ConnectionID, msg.ConnRecord.InvitationID)
+
+	return s.machine.RunContext(ctx, msg.Msg, next, props,
+		func(stateCtx gocontext.Context, current statemachine.State) (*statemachine.Transition, error) {
+			return s.execute(stateCtx, current.(state), msg, aEvent)
 		})
-		logger.Debugf("sent pre event for state %s", next.Name())
-
-		var (
-			action           stateAction
-			followup         state
-			connectionRecord *ConnectionRecord
-		)
-
-		connectionRecord, followup, action, err = next.ExecuteInbound(
-			&stateMachineMsg{
-				header:     msg.Msg.Header,
-				payload:    msg.Msg.Payload,
-				connRecord: msg.ConnRecord,
-				options:    msg.Options,
-			},
-			msg.ThreadID,
-			s.ctx)
+}
 
-		if err != nil {
-			return fmt.Errorf("failed to execute state %s %w", next.Name(), err)
-		}
+// execute executes the state, persists the connection record and runs the state action.
+func (s *Service) execute(ctx gocontext.Context, next state, msg *message,
+	aEvent chan<- service.DIDCommAction) (*statemachine.Transition, error) {
+	connectionRecord, followup, action, err := next.ExecuteInbound(
+		&stateMachineMsg{
+			header:     msg.Msg.Header,
+			payload:    msg.Msg.Payload,
+			connRecord: msg.ConnRecord,
+			options:    msg.Options,
+			inbound:    msg.Msg.Inbound,
+			goCtx:      ctx,
+		},
+		msg.ThreadID,
+		s.ctx)
 
-		connectionRecord.State = next.Name()
-		logger.Debugf("finished execute state: %s", next.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute state %s %w", next.Name(), err)
+	}
 
-		if err = s.update(msg.Msg.Header.Type, connectionRecord); err != nil {
-			return fmt.Errorf("failed to persist state %s %w", next.Name(), err)
-		}
+	connectionRecord.State = next.Name()
+	logger.Debugf("finished execute state: %s", next.Name())
 
-		logger.Debugf("persisted the connection record using connection id %s", connectionRecord.ConnectionID)
+	if err = s.update(msg.Msg.Header.Type, connectionRecord); err != nil {
+		return nil, fmt.Errorf("failed to persist state %s %w", next.Name(), err)
+	}
 
-		if err = action(); err != nil {
-			return fmt.Errorf("failed to execute state action %s %w", next.Name(), err)
-		}
+	logger.Debugf("persisted the connection record using connection id %s", connectionRecord.ConnectionID)
 
-		logger.Debugf("finish execute state action: %s", next.Name())
+	if err = action(); err != nil {
+		return nil, fmt.Errorf("failed to execute state action %s %w", next.Name(), err)
+	}
 
-		prev := next
-		next = followup
-		haltExecution := false
+	logger.Debugf("finish execute state action: %s", next.Name())
 
-		// trigger action event based on message type for inbound messages
-		if canTriggerActionEvents(connectionRecord.State, connectionRecord.Namespace) {
-			msg.NextStateName = next.Name()
-			if err = s.sendActionEvent(msg, aEvent); err != nil {
-				return fmt.Errorf("handle inbound : %w", err)
-			}
+	transition := &statemachine.Transition{
+		Followup:   followup,
+		Properties: createEventProperties(connectionRecord.ConnectionID, connectionRecord.InvitationID),
+	}
 
-			haltExecution = true
+	// trigger action event based on message type for inbound messages
+	if canTriggerActionEvents(connectionRecord.State, connectionRecord.Namespace) {
+		msg.NextStateName = followup.Name()
+		if err = s.sendActionEvent(msg, aEvent); err != nil {
+			return nil, fmt.Errorf("handle inbound : %w", err)
 		}
 
-		s.sendMsgEvents(&service.StateMsg{
-			ProtocolName: DIDExchange,
-			Type:         service.PostState,
-			Msg:          msg.Msg.Clone(),
-			StateID:      prev.Name(),
-			Properties:   createEventProperties(connectionRecord.ConnectionID, connectionRecord.InvitationID),
-		})
-		logger.Debugf("sent post event for state %s", prev.Name())
+		transition.Halt = true
+	}
 
-		if haltExecution {
-			break
-		}
+	return transition, nil
+}
+
+func (s *Service) handleWithoutAction(ctx gocontext.Context, msg *message) error {
+	unlock, err := s.lockThread(msg.Msg.Header.Type, msg.ThreadID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	defer unlock()
+
+	return s.handle(ctx, msg, nil)
 }
 
-func (s *Service) handleWithoutAction(msg *message) error {
-	return s.handle(msg, nil)
+// lockThread locks the namespaced thread, both parties of the exchange might be handled by the same agent.
+func (s *Service) lockThread(msgType, thID string) (func(), error) {
+	nsThID, err := createNSKey(findNameSpace(msgType), thID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.machine.LockThread(nsThID), nil
 }
 
 func createEventProperties(connectionID, invitationID string) *didExchangeEvent {
@@ -322,71 +527,157 @@ func (s *Service) sendActionEvent(internalMsg *message, aEvent chan<- service.DI
 	}
 
 	if aEvent != nil {
-		// trigger action event
-		aEvent <- service.DIDCommAction{
-			ProtocolName: DIDExchange,
-			Message:      internalMsg.Msg.Clone(),
-			Continue: func(args interface{}) {
-				switch v := args.(type) {
-				case opts:
-					internalMsg.Options = &options{publicDID: v.PublicDID(), label: v.Label()}
-				default:
-					// nothing to do
-				}
-
-				s.processCallback(internalMsg)
-			},
-			Stop: func(err error) {
-				// sets an error to the message
-				internalMsg.err = err
-				s.processCallback(internalMsg)
-			},
-			Properties: createEventProperties(internalMsg.ConnRecord.ConnectionID, internalMsg.ConnRecord.InvitationID),
+		// the action event is persisted, it is re-emitted if the agent restarts before the consumer continues it
+		cb := newCallback(internalMsg)
+		cb.ID = internalMsg.ConnRecord.ConnectionID
+
+		action, err := s.newAction(cb, internalMsg)
+		if err != nil {
+			return fmt.Errorf("send action event : %w", err)
 		}
+
+		// trigger action event, the delivery is abandoned once the service is stopped. The action event none of
+		// the subscribers owns is continued by the AcceptExchangeRequest APIs or re-emitted to the next owner.
+		s.PublishActionEvent(action)
 	}
 
 	return nil
 }
 
-// sendEvent triggers the message events.
-func (s *Service) sendMsgEvents(msg *service.StateMsg) {
-	// trigger the message events
-	for _, handler := range s.MsgEvents() {
-		handler <- *msg
+func (s *Service) newAction(cb *statemachine.Callback, internalMsg *message) (service.DIDCommAction, error) {
+	action, err := s.machine.NewAction(cb,
+		createEventProperties(internalMsg.ConnRecord.ConnectionID, internalMsg.ConnRecord.InvitationID),
+		func(args interface{}) error {
+			switch v := args.(type) {
+			case opts:
+				internalMsg.Options = &options{publicDID: v.PublicDID(), label: v.Label()}
+			default:
+				// nothing to do
+			}
+
+			return nil
+		})
+	if err != nil {
+		return service.DIDCommAction{}, err
+	}
+
+	action.StateID = internalMsg.ConnRecord.State
+
+	return action, nil
+}
+
+// PendingActions returns the action events which were not continued or stopped yet.
+func (s *Service) PendingActions() ([]*PendingAction, error) {
+	pending, err := s.machine.Pending(statemachine.PendingAction)
+	if err != nil {
+		return nil, fmt.Errorf("pending actions : %w", err)
+	}
+
+	result := make([]*PendingAction, len(pending))
+
+	for i, p := range pending {
+		msg := &message{}
+		if err := json.Unmarshal(p.Data, msg); err != nil {
+			return nil, fmt.Errorf("pending actions : %w", err)
+		}
+
+		result[i] = &PendingAction{
+			ConnectionID: msg.ConnRecord.ConnectionID,
+			ThreadID:     msg.ThreadID,
+			MessageType:  msg.Msg.Header.Type,
+			State:        msg.ConnRecord.State,
+		}
 	}
+
+	return result, nil
 }
 
-// startInternalListener listens to messages in gochannel for callback messages from clients.
-func (s *Service) startInternalListener() {
-	for msg := range s.callbackChannel {
-		// TODO https://github.com/hyperledger/aries-framework-go/issues/242 - retry logic
-		// if no error - do handle
-		if msg.err == nil {
-			msg.err = s.handleWithoutAction(msg)
+// restore restores the threads which were waiting for the consumer or had a queued callback
+// when the agent stopped.
+func (s *Service) restore() error {
+	restored, err := s.machine.Restore(func(p *statemachine.Pending) (interface{}, error) {
+		msg := &message{}
+		if err := json.Unmarshal(p.Data, msg); err != nil {
+			return nil, err
 		}
 
-		// no error - continue
-		if msg.err == nil {
-			continue
+		// the connection record and the event data are kept in the transient store, they do not survive the restart
+		if err := s.restoreConnectionRecord(msg.ConnRecord); err != nil {
+			return nil, err
 		}
 
-		if err := s.abandon(msg.ThreadID, msg.Msg, msg.err); err != nil {
-			logger.Errorf("process callback : %s", err)
+		if p.Status == statemachine.PendingAction {
+			if err := s.storeEventTransientData(msg); err != nil {
+				return nil, err
+			}
 		}
+
+		return msg, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the restored action events are kept by the action event bus until a subscriber owning them is registered
+	for _, cb := range restored {
+		action, err := s.newAction(cb, cb.Data.(*message))
+		if err != nil {
+			return err
+		}
+
+		s.PublishActionEvent(action)
 	}
+
+	return nil
+}
+
+func (s *Service) restoreConnectionRecord(record *ConnectionRecord) error {
+	_, err := s.connectionStore.GetConnectionRecord(record.ConnectionID)
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return err
+	}
+
+	return s.connectionStore.saveNewConnectionRecord(record)
+}
+
+// resume continues the processing of the message once the consumer continued the action event.
+func (s *Service) resume(cb *statemachine.Callback) error {
+	// TODO https://github.com/hyperledger/aries-framework-go/issues/242 - retry logic
+	msg, ok := cb.Data.(*message)
+	if !ok {
+		return errors.New("invalid callback data")
+	}
+
+	return s.handleWithoutAction(gocontext.Background(), msg)
+}
+
+func newCallback(msg *message) *statemachine.Callback {
+	return &statemachine.Callback{ThreadID: msg.ThreadID, Msg: msg.Msg, Data: msg}
 }
 
 // AcceptInvitation accepts/approves connection invitation.
 func (s *Service) AcceptInvitation(connectionID, publicDID, label string) error {
-	return s.accept(connectionID, publicDID, label, stateNameInvited, "accept exchange invitation")
+	return s.AcceptInvitationContext(gocontext.Background(), connectionID, publicDID, label)
+}
+
+// AcceptInvitationContext accepts/approves connection invitation, the exchange request is sent with the context:
+// the DID resolution and the sending are aborted when the context is done.
+func (s *Service) AcceptInvitationContext(ctx gocontext.Context, connectionID, publicDID, label string) error {
+	return s.accept(ctx, connectionID, publicDID, label, stateNameInvited, "accept exchange invitation")
 }
 
 // AcceptExchangeRequest accepts/approves connection request.
 func (s *Service) AcceptExchangeRequest(connectionID, publicDID, label string) error {
-	return s.accept(connectionID, publicDID, label, stateNameRequested, "accept exchange request")
+	return s.AcceptExchangeRequestContext(gocontext.Background(), connectionID, publicDID, label)
 }
 
-func (s *Service) accept(connectionID, publicDID, label, stateID, errMsg string) error {
+// AcceptExchangeRequestContext accepts/approves connection request, the exchange response is sent with the context:
+// the DID resolution and the sending are aborted when the context is done.
+func (s *Service) AcceptExchangeRequestContext(ctx gocontext.Context, connectionID, publicDID, label string) error {
+	return s.accept(ctx, connectionID, publicDID, label, stateNameRequested, "accept exchange request")
+}
+
+func (s *Service) accept(ctx gocontext.Context, connectionID, publicDID, label, stateID, errMsg string) error {
 	msg, err := s.getEventTransientData(connectionID)
 	if err != nil {
 		return fmt.Errorf("%s : %w", errMsg, err)
@@ -404,7 +695,12 @@ func (s *Service) accept(connectionID, publicDID, label, stateID, errMsg string)
 
 	msg.Options = &options{publicDID: publicDID, label: label}
 
-	return s.handleWithoutAction(msg)
+	// the action event is not expected to be continued anymore
+	if err := s.machine.DiscardPending(connectionID); err != nil {
+		return fmt.Errorf("%s : %w", errMsg, err)
+	}
+
+	return s.handleWithoutAction(ctx, msg)
 }
 
 func (s *Service) storeEventTransientData(msg *message) error {
@@ -444,6 +740,25 @@ func (s *Service) abandon(thID string, msg *service.DIDCommMsg, processErr error
 		return err
 	}
 
+	unlock := s.machine.LockThread(nsThID)
+	defer unlock()
+
+	return s.abandonLocked(nsThID, msg, processErr)
+}
+
+// abandonThread abandons the thread whose lock is held by the caller.
+func (s *Service) abandonThread(thID string, msg *service.DIDCommMsg, processErr error) {
+	nsThID, err := createNSKey(findNameSpace(msg.Header.Type), thID)
+	if err == nil {
+		err = s.abandonLocked(nsThID, msg, processErr)
+	}
+
+	if err != nil {
+		logger.Errorf("abandon thread %s : %s", thID, err)
+	}
+}
+
+func (s *Service) abandonLocked(nsThID string, msg *service.DIDCommMsg, processErr error) error {
 	connRec, err := s.connectionStore.GetConnectionRecordByNSThreadID(nsThID)
 	if err != nil {
 		return fmt.Errorf("unable to update the state to abandoned: %w", err)
@@ -457,12 +772,12 @@ func (s *Service) abandon(thID string, msg *service.DIDCommMsg, processErr error
 	}
 
 	// send the message event
-	s.sendMsgEvents(&service.StateMsg{
+	s.machine.SendMsgEvents(&service.StateMsg{
 		ProtocolName: DIDExchange,
 		Type:         service.PostState,
 		Msg:          msg.Clone(),
 		StateID:      stateNameAbandoned,
-		Properties:   createErrorEventProperties(thID, "", processErr),
+		Properties:   createErrorEventProperties(connRec.ConnectionID, connRec.InvitationID, processErr),
 	})
 
 	return nil
@@ -471,12 +786,7 @@ func (s *Service) abandon(thID string, msg *service.DIDCommMsg, processErr error
 func (s *Service) processCallback(msg *message) {
 	// pass the callback data to internal channel. This is created to unblock consumer go routine and wrap the callback
 	// channel internally.
-	s.callbackChannel <- msg
-}
-
-func isNoOp(s state) bool {
-	_, ok := s.(*noOp)
-	return ok
+	s.machine.ProcessCallback(newCallback(msg))
 }
 
 func threadID(didCommMsg *service.DIDCommMsg) (string, error) {
@@ -509,10 +819,10 @@ func (s *Service) update(msgType string, connectionRecord *ConnectionRecord) err
 	return s.connectionStore.saveConnectionRecord(connectionRecord)
 }
 
-func (s *Service) connectionRecord(msg *service.DIDCommMsg) (*ConnectionRecord, error) {
+func (s *Service) connectionRecord(ctx gocontext.Context, msg *service.DIDCommMsg) (*ConnectionRecord, error) {
 	switch msg.Header.Type {
 	case InvitationMsgType:
-		return s.invitationMsgRecord(msg)
+		return s.invitationMsgRecord(ctx, msg)
 	case RequestMsgType:
 		return s.requestMsgRecord(msg)
 	case ResponseMsgType:
@@ -524,7 +834,7 @@ func (s *Service) connectionRecord(msg *service.DIDCommMsg) (*ConnectionRecord,
 	return nil, errors.New("invalid message type")
 }
 
-func (s *Service) invitationMsgRecord(msg *service.DIDCommMsg) (*ConnectionRecord, error) {
+func (s *Service) invitationMsgRecord(ctx gocontext.Context, msg *service.DIDCommMsg) (*ConnectionRecord, error) {
 	thID, msgErr := msg.ThreadID()
 	if msgErr != nil {
 		return nil, msgErr
@@ -537,7 +847,7 @@ func (s *Service) invitationMsgRecord(msg *service.DIDCommMsg) (*ConnectionRecor
 		return nil, err
 	}
 
-	recKey, err := s.ctx.getInvitationRecipientKey(invitation)
+	recKey, err := s.ctx.getInvitationRecipientKey(ctx, invitation)
 	if err != nil {
 		return nil, err
 	}
@@ -577,6 +887,11 @@ func (s *Service) requestMsgRecord(msg *service.DIDCommMsg) (*ConnectionRecord,
 		Namespace:    theirNSPrefix,
 	}
 
+	// the parent thread of the request is the invitation, it links the connection to the invitation
+	if request.Thread != nil {
+		connRecord.InvitationID = request.Thread.PID
+	}
+
 	if err := s.connectionStore.saveConnectionRecord(connRecord); err != nil {
 		return nil, err
 	}
@@ -626,17 +941,52 @@ type options struct {
 	label     string
 }
 
+// optionsJSON is used to persist the options with the pending action events.
+type optionsJSON struct {
+	PublicDID string `json:"publicDID,omitempty"`
+	Label     string `json:"label,omitempty"`
+}
+
+// MarshalJSON marshals the options.
+func (o *options) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&optionsJSON{PublicDID: o.publicDID, Label: o.label})
+}
+
+// UnmarshalJSON unmarshals the options.
+func (o *options) UnmarshalJSON(data []byte) error {
+	raw := &optionsJSON{}
+	if err := json.Unmarshal(data, raw); err != nil {
+		return err
+	}
+
+	o.publicDID = raw.PublicDID
+	o.label = raw.Label
+
+	return nil
+}
+
 // CreateImplicitInvitation creates and sends an exchange request to create connection
 // to specified public DID.
 func (s *Service) CreateImplicitInvitation(label, toDID string) (string, error) {
+	return s.CreateImplicitInvitationContext(gocontext.Background(), label, toDID)
+}
+
+// CreateImplicitInvitationContext creates and sends an exchange request to create connection to specified
+// public DID. The public DID is resolved with the context, the request is sent after the call returns and only
+// continues the trace of the context. transport.BusyError is returned if the worker pool is full.
+func (s *Service) CreateImplicitInvitationContext(ctx gocontext.Context, label, toDID string) (string, error) {
 	logger.Debugf("implicit invitation requested for: %s", toDID)
 
-	didDoc, err := s.ctx.vdriRegistry.Resolve(toDID)
+	didDoc, err := s.ctx.vdriRegistry.Resolve(toDID, vdriapi.WithContext(ctx))
 	if err != nil {
 		return "", fmt.Errorf("resolve public did[%s]: %w", toDID, err)
 	}
 
 	dest, err := prepareDestination(didDoc)
+	if err != nil {
+		return "", fmt.Errorf("prepare destination of public did[%s]: %w", toDID, err)
+	}
+
 	thID := generateRandomID()
 	connRecord := &ConnectionRecord{
 		ConnectionID:    generateRandomID(),
@@ -668,11 +1018,32 @@ func (s *Service) CreateImplicitInvitation(label, toDID string) (string, error)
 	next := &requested{}
 	internalMsg := &message{Msg: msg, ThreadID: thID, NextStateName: next.Name(), ConnRecord: connRecord}
 
-	go func(msg *message, aEvent chan<- service.DIDCommAction) {
-		if err = s.handle(msg, aEvent); err != nil {
+	// serialize the transitions of the thread like the inbound messages, the lock is released once processed
+	unlock, err := s.lockThread(InvitationMsgType, thID)
+	if err != nil {
+		return "", err
+	}
+
+	aEvent := s.ActionEvent()
+	traceCtx := trace.Detach(ctx)
+
+	err = s.pool.Submit(func() {
+		defer unlock()
+
+		if err := s.handle(traceCtx, internalMsg, aEvent); err != nil {
 			logger.Errorf("error from handle for implicit invitation: %s", err)
 		}
-	}(internalMsg, s.ActionEvent())
+	})
+	if err != nil {
+		unlock()
+
+		if errors.Is(err, workerpool.ErrQueueFull) {
+			// the caller is asked to retry later like the senders of the inbound messages
+			err = &transport.BusyError{RetryAfter: s.retryAfter, Err: err}
+		}
+
+		return "", fmt.Errorf("implicit invitation: %w", err)
+	}
 
 	return connRecord.ConnectionID, nil
 }
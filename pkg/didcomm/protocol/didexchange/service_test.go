@@ -7,10 +7,13 @@ SPDX-License-Identifier: Apache-2.0
 package didexchange
 
 import (
+	"bytes"
+	gocontext "context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,14 +21,21 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
 	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/internal/mock/provider"
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
 	mockvdri "github.com/hyperledger/aries-framework-go/pkg/internal/mock/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
 )
 
 const testMethod = "peer"
@@ -64,6 +74,142 @@ func TestServiceNew(t *testing.T) {
 	})
 }
 
+func TestService_Stop(t *testing.T) {
+	svc, err := New(&protocol.MockProvider{})
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RegisterActionEvent(make(chan service.DIDCommAction)))
+	require.NotNil(t, svc.ActionEvent())
+
+	require.NoError(t, svc.Stop())
+	require.Nil(t, svc.ActionEvent())
+	require.EqualError(t, svc.Stop(), "server was already stopped")
+}
+
+func TestService_ConnectionMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	prov := &protocol.MockProvider{StoreProvider: mockstorage.NewMockStoreProvider(),
+		TransientStoreProvider: mockstorage.NewMockStoreProvider(), MetricsSink: registry}
+
+	connections := func() string {
+		var buf bytes.Buffer
+		require.NoError(t, registry.WritePrometheus(&buf))
+
+		var lines []string
+
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, metrics.Connections+"{") {
+				lines = append(lines, line)
+			}
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	svc, err := New(prov)
+	require.NoError(t, err)
+
+	record := &ConnectionRecord{ConnectionID: "id", ThreadID: "thid", Namespace: myNSPrefix, State: stateNameInvited}
+	require.NoError(t, svc.connectionStore.saveConnectionRecord(record))
+
+	record.State = stateNameRequested
+	require.NoError(t, svc.connectionStore.saveConnectionRecord(record))
+	require.NoError(t, svc.connectionStore.saveConnectionRecord(record))
+	require.Equal(t, `aries_connections{state="invited"} 0
+aries_connections{state="requested"} 1`, connections())
+
+	// the connections are not counted by the stopped service
+	require.NoError(t, svc.Stop())
+	require.Equal(t, `aries_connections{state="invited"} 0
+aries_connections{state="requested"} 0`, connections())
+
+	// the stored connections are counted by the new service
+	svc, err = New(prov)
+	require.NoError(t, err)
+	require.Equal(t, `aries_connections{state="invited"} 0
+aries_connections{state="requested"} 1`, connections())
+
+	record.State = stateNameCompleted
+	require.NoError(t, svc.connectionStore.saveConnectionRecord(record))
+	require.NoError(t, svc.Stop())
+
+	// the completed connections are counted by the store, the transient store is lost with the restart
+	prov.TransientStoreProvider = mockstorage.NewMockStoreProvider()
+
+	svc, err = New(prov)
+	require.NoError(t, err)
+	require.Equal(t, `aries_connections{state="completed"} 1
+aries_connections{state="invited"} 0
+aries_connections{state="requested"} 0`, connections())
+	require.NoError(t, svc.Stop())
+
+	// the records of the stores without the counts are counted once
+	delete(prov.StoreProvider.Store.Store, connCountsKey)
+
+	for i := 0; i < 2; i++ {
+		svc, err = New(prov)
+		require.NoError(t, err)
+		require.Contains(t, connections(), `aries_connections{state="completed"} 1`)
+		require.NoError(t, svc.Stop())
+	}
+
+	require.Contains(t, prov.StoreProvider.Store.Store, connCountsKey)
+}
+
+func TestService_HandleInboundContext_Tracer(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+
+	svc, err := New(&protocol.MockProvider{StoreProvider: mockstorage.NewMockStoreProvider(),
+		TransientStoreProvider: mockstorage.NewMockStoreProvider(), CustomTracer: tracer})
+	require.NoError(t, err)
+
+	actionCh := make(chan service.DIDCommAction, 1)
+	require.NoError(t, svc.RegisterActionEvent(actionCh))
+
+	invitation, err := json.Marshal(&Invitation{Type: InvitationMsgType, ID: "invitation-id",
+		RecipientKeys: []string{"key"}, ServiceEndpoint: "http://alice.agent.example.com:8081"})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(invitation)
+	require.NoError(t, err)
+
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	ctx, parent := tracer.Start(ctx, trace.HandleInboundSpan)
+
+	_, err = svc.HandleInboundContext(ctx, msg)
+	require.NoError(t, err)
+
+	// the message is processed after the request is done
+	cancel()
+	parent.End()
+
+	select {
+	case <-actionCh:
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "didn't receive action event")
+	}
+
+	var spans []*trace.SpanData
+
+	for i := 0; i < 100 && len(spans) == 0; i++ {
+		spans = exporter.ThreadSpans("invitation-id")
+		if len(spans) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	require.Len(t, spans, 1)
+	require.Equal(t, trace.StateSpan, spans[0].Name)
+	require.Equal(t, parent.SpanContext(), spans[0].Parent)
+
+	state, ok := spans[0].Attribute(trace.StateKey)
+	require.True(t, ok)
+	require.Equal(t, stateNameInvited, state)
+
+	require.NoError(t, svc.Stop())
+}
+
 // did-exchange flow with role Inviter
 func TestService_Handle_Inviter(t *testing.T) {
 	prov := protocol.MockProvider{}
@@ -162,6 +308,137 @@ func TestService_Handle_Inviter(t *testing.T) {
 	validateState(t, s, thid, findNameSpace(AckMsgType), (&completed{}).Name())
 }
 
+// did-exchange flow with role Inviter, the first attempt to send the response fails and the outbox retries it
+func TestService_Handle_InviterResponseRetried(t *testing.T) {
+	store := mockstorage.NewMockStoreProvider()
+	pubKey, _ := generateKeyPair()
+	connectionStore := NewConnectionRecorder(nil, store.Store)
+
+	outbound := &flakyOutbound{failures: 1}
+
+	ob, err := outbox.New(&mockprovider.Provider{StorageProviderValue: mem.NewProvider()}, outbound,
+		outbox.WithBackoff(time.Millisecond, time.Millisecond))
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, ob.Close()) }()
+
+	events := make(chan outbox.Event, 2)
+	require.NoError(t, ob.RegisterEvent(events))
+
+	s, err := New(&protocol.MockProvider{StoreProvider: store, CustomOutbound: ob})
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, s.Stop()) }()
+
+	actionCh := make(chan service.DIDCommAction, 10)
+	require.NoError(t, s.RegisterActionEvent(actionCh))
+
+	statusCh := make(chan service.StateMsg, 10)
+	require.NoError(t, s.RegisterMsgEvent(statusCh))
+
+	completedFlag := make(chan struct{})
+	respondedFlag := make(chan struct{})
+
+	go msgEventListener(t, statusCh, respondedFlag, completedFlag)
+
+	go func() { require.NoError(t, service.AutoExecuteActionEvent(actionCh)) }()
+
+	invitation := &Invitation{
+		Type:            InvitationMsgType,
+		ID:              randomString(),
+		Label:           "Bob",
+		RecipientKeys:   []string{pubKey},
+		ServiceEndpoint: "http://alice.agent.example.com:8081",
+	}
+	require.NoError(t, connectionStore.SaveInvitation(invitation))
+
+	newDidDoc := createDIDDocWithKey(pubKey)
+	thid := randomString()
+
+	request, err := json.Marshal(&Request{
+		Type:       RequestMsgType,
+		ID:         thid,
+		Label:      "Bob",
+		Thread:     &decorator.Thread{PID: invitation.ID},
+		Connection: &Connection{DID: newDidDoc.ID, DIDDoc: newDidDoc},
+	})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(request)
+	require.NoError(t, err)
+
+	_, err = s.HandleInbound(msg)
+	require.NoError(t, err)
+
+	// the failed first attempt does not abandon the thread
+	select {
+	case <-respondedFlag:
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "didn't receive post event responded")
+	}
+
+	for _, eventType := range []string{outbox.EventRetry, outbox.EventSent} {
+		select {
+		case e := <-events:
+			require.Equal(t, eventType, e.Type)
+		case <-time.After(2 * time.Second):
+			require.Fail(t, "didn't receive outbox event "+eventType)
+		}
+	}
+
+	require.Equal(t, 2, outbound.attempts())
+
+	// the ack of the retried response completes the connection
+	ack, err := json.Marshal(&model.Ack{
+		Type:   AckMsgType,
+		ID:     randomString(),
+		Status: "OK",
+		Thread: &decorator.Thread{ID: thid},
+	})
+	require.NoError(t, err)
+
+	msg, err = service.NewDIDCommMsg(ack)
+	require.NoError(t, err)
+
+	_, err = s.HandleInbound(msg)
+	require.NoError(t, err)
+
+	select {
+	case <-completedFlag:
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "didn't receive post event complete")
+	}
+
+	validateState(t, s, thid, findNameSpace(AckMsgType), (&completed{}).Name())
+}
+
+// flakyOutbound fails the given number of the first attempts.
+type flakyOutbound struct {
+	mu       sync.Mutex
+	failures int
+	sent     int
+}
+
+func (o *flakyOutbound) Send(interface{}, string, *service.Destination) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sent++
+
+	if o.sent <= o.failures {
+		return errors.New("endpoint unavailable")
+	}
+
+	return nil
+}
+
+func (o *flakyOutbound) attempts() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.sent
+}
+
 func msgEventListener(t *testing.T, statusCh chan service.StateMsg, respondedFlag, completedFlag chan struct{}) {
 	for e := range statusCh {
 		require.Equal(t, DIDExchange, e.ProtocolName)
@@ -274,7 +551,7 @@ func TestService_Handle_Invitee(t *testing.T) {
 		DIDDoc: newDidDoc,
 	}
 
-	connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+	connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 	require.NoError(t, err)
 
 	// Bob replies with a Response
@@ -422,6 +699,47 @@ func TestService_Handle_EdgeCases(t *testing.T) {
 		_, err = svc.HandleInbound(didMsg)
 		require.NoError(t, err)
 	})
+
+	t.Run("handleInbound - worker pool queue full", func(t *testing.T) {
+		pools := workerpool.NewPools(workerpool.WithPool(DIDExchange, 1, 1))
+		defer pools.Stop()
+
+		svc, err := New(&protocol.MockProvider{WorkerPools: pools})
+		require.NoError(t, err)
+
+		actionCh := make(chan service.DIDCommAction)
+		err = svc.RegisterActionEvent(actionCh)
+		require.NoError(t, err)
+
+		pool := pools.Pool(DIDExchange)
+
+		// the action event blocks the only worker
+		_, err = svc.HandleInbound(generateRequestMsgPayload(t, &protocol.MockProvider{}, randomString(), ""))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			metrics := pool.Metrics()
+			return metrics.Active == 1 && metrics.QueueDepth == 0
+		}, time.Second, time.Millisecond)
+
+		// the message waits in the queue
+		_, err = svc.HandleInbound(generateRequestMsgPayload(t, &protocol.MockProvider{}, randomString(), ""))
+		require.NoError(t, err)
+
+		_, err = svc.HandleInbound(generateRequestMsgPayload(t, &protocol.MockProvider{}, randomString(), ""))
+		require.True(t, errors.Is(err, workerpool.ErrQueueFull))
+		require.Equal(t, 1, pool.Metrics().QueueDepth)
+		require.Equal(t, uint64(1), pool.Metrics().Rejected)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case action := <-actionCh:
+				action.Stop(nil)
+			case <-time.After(time.Second):
+				t.Error("timeout")
+			}
+		}
+	})
 }
 
 func TestService_Accept(t *testing.T) {
@@ -432,6 +750,8 @@ func TestService_Accept(t *testing.T) {
 	require.Equal(t, true, s.Accept("https://didcomm.org/didexchange/1.0/response"))
 	require.Equal(t, true, s.Accept("https://didcomm.org/didexchange/1.0/ack"))
 	require.Equal(t, false, s.Accept("unsupported msg type"))
+	require.Equal(t, true, s.Accept("did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/didexchange/1.0/request"))
+	require.Equal(t, []string{"https://didcomm.org/didexchange/1.0"}, s.Protocols())
 }
 
 func TestService_threadID(t *testing.T) {
@@ -537,6 +857,11 @@ func (m *mockStore) Get(k string) ([]byte, error) {
 	return m.get(k)
 }
 
+// Delete deletes the record based on key
+func (m *mockStore) Delete(k string) error {
+	return nil
+}
+
 // Search returns storage iterator
 func (m *mockStore) Iterator(start, limit string) storage.StoreIterator {
 	return nil
@@ -700,7 +1025,7 @@ func TestEventsUserError(t *testing.T) {
 	err = svc.RegisterMsgEvent(statusCh)
 	require.NoError(t, err)
 
-	done := make(chan struct{})
+	done := make(chan string)
 
 	go func() {
 		for {
@@ -709,7 +1034,7 @@ func TestEventsUserError(t *testing.T) {
 				e.Stop(errors.New("invalid id"))
 			case e := <-statusCh:
 				if e.Type == service.PostState && e.StateID == stateNameAbandoned {
-					done <- struct{}{}
+					done <- e.Properties.(event).ConnectionID()
 				}
 			}
 		}
@@ -725,11 +1050,161 @@ func TestEventsUserError(t *testing.T) {
 	_, err = svc.HandleInbound(generateRequestMsgPayload(t, &protocol.MockProvider{}, id, ""))
 	require.NoError(t, err)
 
+	var connectionID string
 	select {
-	case <-done:
+	case connectionID = <-done:
 	case <-time.After(5 * time.Second):
 		require.Fail(t, "tests are not validated")
 	}
+
+	// the abandoned event carries the ID of the abandoned connection
+	nsThID, err := createNSKey(theirNSPrefix, id)
+	require.NoError(t, err)
+
+	abandoned, err := svc.connectionStore.GetConnectionRecordByNSThreadID(nsThID)
+	require.NoError(t, err)
+	require.Equal(t, abandoned.ConnectionID, connectionID)
+}
+
+func TestService_ConcurrentInbound(t *testing.T) {
+	const (
+		threads = 5
+		retries = 10
+	)
+
+	// the slow stores widen the window between reading the current state and persisting the next one
+	svc, err := New(&slowStoreProvider{MockProvider: &protocol.MockProvider{}})
+	require.NoError(t, err)
+
+	pubKey, _ := generateKeyPair()
+	invitation := &Invitation{
+		Type:            InvitationMsgType,
+		ID:              randomString(),
+		Label:           "Bob",
+		RecipientKeys:   []string{pubKey},
+		ServiceEndpoint: "http://alice.agent.example.com:8081",
+	}
+	require.NoError(t, svc.connectionStore.SaveInvitation(invitation))
+
+	actionCh := make(chan service.DIDCommAction, threads*retries)
+	require.NoError(t, svc.RegisterActionEvent(actionCh))
+
+	go func() { require.NoError(t, service.AutoExecuteActionEvent(actionCh)) }()
+
+	statusCh := make(chan service.StateMsg, threads*retries)
+	require.NoError(t, svc.RegisterMsgEvent(statusCh))
+
+	responded := make(chan string, threads*retries)
+
+	go func() {
+		for e := range statusCh {
+			if e.Type == service.PostState && e.StateID == stateNameResponded {
+				responded <- e.Msg.Header.ID
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		accepted = make(map[string]int)
+		start    = make(chan struct{})
+	)
+
+	// peers retry quickly, the same request is received several times on every thread
+	for i := 0; i < threads; i++ {
+		id := randomString()
+		msg := generateRequestMsgPayload(t, &protocol.MockProvider{}, id, invitation.ID)
+
+		for j := 0; j < retries; j++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				<-start
+
+				if _, err := svc.HandleInbound(msg.Clone()); err != nil {
+					require.Contains(t, err.Error(), "invalid state transition")
+					return
+				}
+
+				mutex.Lock()
+				accepted[id]++
+				mutex.Unlock()
+			}()
+		}
+	}
+
+	close(start)
+	wg.Wait()
+
+	require.Len(t, accepted, threads)
+
+	for id, count := range accepted {
+		require.Equal(t, 1, count, "thread %s", id)
+	}
+
+	respondedThreads := make(map[string]int)
+
+	for i := 0; i < threads; i++ {
+		select {
+		case id := <-responded:
+			respondedThreads[id]++
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "tests are not validated")
+		}
+	}
+
+	// no duplicate responses are sent
+	select {
+	case id := <-responded:
+		require.Fail(t, "duplicate response", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.Len(t, respondedThreads, threads)
+}
+
+type slowStoreProvider struct {
+	*protocol.MockProvider
+}
+
+func (p *slowStoreProvider) StorageProvider() storage.Provider {
+	return &slowStorage{MockStoreProvider: mockstorage.NewMockStoreProvider()}
+}
+
+func (p *slowStoreProvider) TransientStorageProvider() storage.Provider {
+	return &slowStorage{MockStoreProvider: mockstorage.NewMockStoreProvider()}
+}
+
+type slowStorage struct {
+	*mockstorage.MockStoreProvider
+}
+
+func (s *slowStorage) OpenStore(name string) (storage.Store, error) {
+	store, err := s.MockStoreProvider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slowStore{Store: store}, nil
+}
+
+type slowStore struct {
+	storage.Store
+}
+
+func (s *slowStore) Put(k string, v []byte) error {
+	time.Sleep(time.Millisecond)
+
+	return s.Store.Put(k, v)
+}
+
+func (s *slowStore) Get(k string) ([]byte, error) {
+	time.Sleep(time.Millisecond)
+
+	return s.Store.Get(k)
 }
 
 func TestEventStoreError(t *testing.T) {
@@ -762,7 +1237,7 @@ func TestEventProcessCallback(t *testing.T) {
 		Msg:      &service.DIDCommMsg{Header: &service.Header{Type: AckMsgType}},
 	}
 
-	err = svc.handleWithoutAction(msg)
+	err = svc.handleWithoutAction(gocontext.Background(), msg)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "invalid state name: invalid state name ")
 
@@ -822,14 +1297,14 @@ func TestServiceErrors(t *testing.T) {
 	// test handle - invalid state name
 	msg.Header.Type = ResponseMsgType
 	message := &message{Msg: msg, ThreadID: randomString()}
-	err = svc.handleWithoutAction(message)
+	err = svc.handleWithoutAction(gocontext.Background(), message)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "invalid state name:")
 
 	// invalid state name
 	message.NextStateName = stateNameInvited
 	message.ConnRecord = &ConnectionRecord{ConnectionID: "abc"}
-	err = svc.handleWithoutAction(message)
+	err = svc.handleWithoutAction(gocontext.Background(), message)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "failed to execute state invited")
 }
@@ -847,7 +1322,7 @@ func TestConnectionRecord(t *testing.T) {
 	svc, err := New(&protocol.MockProvider{})
 	require.NoError(t, err)
 
-	conn, err := svc.connectionRecord(generateRequestMsgPayload(t, &protocol.MockProvider{},
+	conn, err := svc.connectionRecord(gocontext.Background(), generateRequestMsgPayload(t, &protocol.MockProvider{},
 		randomString(), ""))
 	require.NoError(t, err)
 	require.NotNil(t, conn)
@@ -860,11 +1335,120 @@ func TestConnectionRecord(t *testing.T) {
 	msg, err := service.NewDIDCommMsg(requestBytes)
 	require.NoError(t, err)
 
-	_, err = svc.connectionRecord(msg)
+	_, err = svc.connectionRecord(gocontext.Background(), msg)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "invalid message type")
 }
 
+func TestService_ResolveConnection(t *testing.T) {
+	svc, err := New(&protocol.MockProvider{})
+	require.NoError(t, err)
+
+	require.NoError(t, svc.connectionStore.saveConnectionRecord(&ConnectionRecord{ConnectionID: "conn1",
+		State: stateNameCompleted, RecipientKeys: []string{"key1"}}))
+
+	conn, err := svc.ResolveConnection("key1", nil)
+	require.NoError(t, err)
+	require.Equal(t, "conn1", conn.(*ConnectionRecord).ConnectionID)
+
+	// unknown sender
+	conn, err = svc.ResolveConnection("key2", nil)
+	require.NoError(t, err)
+	require.Nil(t, conn)
+
+	// store error
+	store := &mockstorage.MockStore{Store: map[string][]byte{
+		connectionKeyPrefix("conn1"): []byte("-----"),
+	}}
+	require.NoError(t, saveTheirKeys(&ConnectionRecord{ConnectionID: "conn1", RecipientKeys: []string{"key1"}}, store))
+	svc.connectionStore = NewConnectionRecorder(store, store)
+
+	_, err = svc.ResolveConnection("key1", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "resolve connection")
+}
+
+func TestService_ResolveDestination(t *testing.T) {
+	svc, err := New(&protocol.MockProvider{})
+	require.NoError(t, err)
+
+	requestMsg := func(conn *Connection) *service.DIDCommMsg {
+		payload, e := json.Marshal(&Request{Type: RequestMsgType, ID: randomString(), Connection: conn})
+		require.NoError(t, e)
+
+		return &service.DIDCommMsg{Header: &service.Header{Type: RequestMsgType}, Payload: payload}
+	}
+
+	didDoc := createDIDDoc()
+	expected, err := prepareDestination(didDoc)
+	require.NoError(t, err)
+
+	// the DID document of the request
+	des, err := svc.ResolveDestination(gocontext.Background(), requestMsg(&Connection{DID: didDoc.ID, DIDDoc: didDoc}))
+	require.NoError(t, err)
+	require.Equal(t, expected, des)
+
+	// the public DID of the request
+	svc.ctx.vdriRegistry = &mockvdri.MockVDRIRegistry{ResolveValue: didDoc}
+
+	des, err = svc.ResolveDestination(gocontext.Background(), requestMsg(&Connection{DID: didDoc.ID}))
+	require.NoError(t, err)
+	require.Equal(t, expected, des)
+
+	svc.ctx.vdriRegistry = &mockvdri.MockVDRIRegistry{ResolveErr: errors.New("resolve error")}
+
+	_, err = svc.ResolveDestination(gocontext.Background(), requestMsg(&Connection{DID: didDoc.ID}))
+	require.EqualError(t, err, "resolve destination: resolve error")
+
+	// the DID document without the DIDComm service
+	_, err = svc.ResolveDestination(gocontext.Background(),
+		requestMsg(&Connection{DID: didDoc.ID, DIDDoc: &did.Doc{ID: didDoc.ID}}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "resolve destination")
+
+	// the message without the connection
+	des, err = svc.ResolveDestination(gocontext.Background(), requestMsg(&Connection{}))
+	require.NoError(t, err)
+	require.Nil(t, des)
+
+	des, err = svc.ResolveDestination(gocontext.Background(), requestMsg(nil))
+	require.NoError(t, err)
+	require.Nil(t, des)
+
+	des, err = svc.ResolveDestination(gocontext.Background(),
+		&service.DIDCommMsg{Header: &service.Header{Type: RequestMsgType}, Payload: []byte("invalid")})
+	require.NoError(t, err)
+	require.Nil(t, des)
+}
+
+func TestInboundConnection(t *testing.T) {
+	record := &ConnectionRecord{ConnectionID: "conn1"}
+
+	msg := &service.DIDCommMsg{Inbound: &service.InboundContext{SenderVerKey: "key1", Connection: record}}
+
+	conn, ok := InboundConnection(msg)
+	require.True(t, ok)
+	require.Equal(t, record, conn)
+	require.NoError(t, VerifySender(msg, "conn1"))
+
+	err := VerifySender(msg, "conn2")
+	require.True(t, errors.Is(err, ErrSenderMismatch))
+
+	// sender without connection
+	msg = &service.DIDCommMsg{Inbound: &service.InboundContext{SenderVerKey: "key1"}}
+
+	_, ok = InboundConnection(msg)
+	require.False(t, ok)
+	require.True(t, errors.Is(VerifySender(msg, "conn1"), ErrSenderMismatch))
+
+	// message created by the agent
+	_, ok = InboundConnection(&service.DIDCommMsg{})
+	require.False(t, ok)
+
+	_, ok = InboundConnection(nil)
+	require.False(t, ok)
+}
+
 func TestInvitationRecord(t *testing.T) {
 	svc, err := New(&protocol.MockProvider{})
 	require.NoError(t, err)
@@ -880,7 +1464,7 @@ func TestInvitationRecord(t *testing.T) {
 	msg, err := service.NewDIDCommMsg(invitationBytes)
 	require.NoError(t, err)
 
-	conn, err := svc.invitationMsgRecord(msg)
+	conn, err := svc.invitationMsgRecord(gocontext.Background(), msg)
 	require.NoError(t, err)
 	require.NotNil(t, conn)
 
@@ -892,7 +1476,7 @@ func TestInvitationRecord(t *testing.T) {
 	msg, err = service.NewDIDCommMsg(invitationBytes)
 	require.NoError(t, err)
 
-	_, err = svc.invitationMsgRecord(msg)
+	_, err = svc.invitationMsgRecord(gocontext.Background(), msg)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "threadID not found")
 
@@ -910,7 +1494,7 @@ func TestInvitationRecord(t *testing.T) {
 	msg, err = service.NewDIDCommMsg(invitationBytes)
 	require.NoError(t, err)
 
-	_, err = svc.invitationMsgRecord(msg)
+	_, err = svc.invitationMsgRecord(gocontext.Background(), msg)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "save connection record")
 }
@@ -920,9 +1504,10 @@ func TestRequestRecord(t *testing.T) {
 	require.NoError(t, err)
 
 	conn, err := svc.requestMsgRecord(generateRequestMsgPayload(t, &protocol.MockProvider{},
-		randomString(), ""))
+		randomString(), "invitation-id"))
 	require.NoError(t, err)
 	require.NotNil(t, conn)
+	require.Equal(t, "invitation-id", conn.InvitationID)
 
 	// db error
 	svc.connectionStore = NewConnectionRecorder(
@@ -987,6 +1572,61 @@ func TestAcceptExchangeRequest(t *testing.T) {
 	}
 }
 
+func TestService_UnownedActionEvent(t *testing.T) {
+	svc, err := New(&protocol.MockProvider{StoreProvider: mockstorage.NewMockStoreProvider()})
+	require.NoError(t, err)
+
+	observer := make(chan service.DIDCommAction, 1)
+	require.NoError(t, svc.RegisterActionEvent(observer, service.AsObserver()))
+
+	statusCh := make(chan service.StateMsg, 10)
+	require.NoError(t, svc.RegisterMsgEvent(statusCh))
+
+	pubKey, _ := generateKeyPair()
+	invitation := &Invitation{
+		Type:            InvitationMsgType,
+		ID:              randomString(),
+		Label:           "Bob",
+		RecipientKeys:   []string{pubKey},
+		ServiceEndpoint: "http://alice.agent.example.com:8081",
+	}
+	require.NoError(t, svc.connectionStore.SaveInvitation(invitation))
+
+	connectionID, err := svc.HandleInbound(generateRequestMsgPayload(t,
+		&protocol.MockProvider{StoreProvider: mockstorage.NewMockStoreProvider()}, randomString(), invitation.ID))
+	require.NoError(t, err)
+
+	select {
+	case <-observer:
+	case <-time.After(time.Second):
+		require.Fail(t, "the observer did not receive the action event")
+	}
+
+	// the action event none of the subscribers owned is re-emitted to the owner
+	owner := make(chan service.DIDCommAction, 1)
+	require.NoError(t, svc.RegisterActionEvent(owner))
+
+	select {
+	case action := <-owner:
+		require.Equal(t, connectionID, action.Properties.(event).ConnectionID())
+		action.Continue(nil)
+	case <-time.After(time.Second):
+		require.Fail(t, "the owner did not receive the action event")
+	}
+
+	for {
+		select {
+		case e := <-statusCh:
+			if e.Type == service.PostState && e.StateID == stateNameResponded {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the action event was not continued")
+			return
+		}
+	}
+}
+
 func TestAcceptExchangeRequestWithPublicDID(t *testing.T) {
 	svc, err := New(&protocol.MockProvider{StoreProvider: mockstorage.NewMockStoreProvider()})
 	require.NoError(t, err)
@@ -1154,6 +1794,37 @@ func TestAcceptInvitation(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "accept exchange invitation : data not found")
 	})
+
+	t.Run("accept invitation - context done", func(t *testing.T) {
+		svc, err := New(&protocol.MockProvider{})
+		require.NoError(t, err)
+
+		id := generateRandomID()
+		connRecord := &ConnectionRecord{
+			ConnectionID: id,
+			ThreadID:     id,
+			State:        stateNameInvited,
+			Namespace:    findNameSpace(InvitationMsgType),
+		}
+		err = svc.connectionStore.saveConnectionRecord(connRecord)
+		require.NoError(t, err)
+
+		pubKey, _ := generateKeyPair()
+		msg, err := createDIDCommMsg(&Invitation{Type: InvitationMsgType, ID: id, RecipientKeys: []string{pubKey}})
+		require.NoError(t, err)
+
+		err = svc.storeEventTransientData(&message{Msg: msg, ThreadID: id, NextStateName: stateNameRequested,
+			ConnRecord: connRecord})
+		require.NoError(t, err)
+
+		ctx, cancel := gocontext.WithCancel(gocontext.Background())
+		cancel()
+
+		// the exchange request is not sent once the context of the caller is done
+		err = svc.AcceptInvitationContext(ctx, id, "", "")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, gocontext.Canceled))
+	})
 }
 
 func TestAcceptInvitationWithPublicDID(t *testing.T) {
@@ -1446,6 +2117,20 @@ func TestService_CreateImplicitInvitation(t *testing.T) {
 		require.Empty(t, connID)
 	})
 
+	t.Run("error when the public did has no didcomm service", func(t *testing.T) {
+		pubKey, _ := generateKeyPair()
+		newDIDDoc := createDIDDocWithKey(pubKey)
+		newDIDDoc.Service = nil
+
+		s, err := New(&protocol.MockProvider{CustomVDRI: &mockvdri.MockVDRIRegistry{ResolveValue: newDIDDoc}})
+		require.NoError(t, err)
+
+		connID, err := s.CreateImplicitInvitation("label", newDIDDoc.ID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "prepare destination of public did["+newDIDDoc.ID+"]")
+		require.Empty(t, connID)
+	})
+
 	t.Run("error during saving connection", func(t *testing.T) {
 		prov := protocol.MockProvider{}
 		transientStore := mockstorage.NewMockStoreProvider()
@@ -1468,4 +2153,86 @@ func TestService_CreateImplicitInvitation(t *testing.T) {
 		require.Contains(t, err.Error(), "store put error")
 		require.Empty(t, connID)
 	})
+
+	t.Run("worker pool queue full", func(t *testing.T) {
+		pools := workerpool.NewPools(workerpool.WithPool(DIDExchange, 1, 1))
+		defer pools.Stop()
+
+		pubKey, _ := generateKeyPair()
+		newDIDDoc := createDIDDocWithKey(pubKey)
+
+		s, err := New(&protocol.MockProvider{WorkerPools: pools,
+			CustomVDRI: &mockvdri.MockVDRIRegistry{ResolveValue: newDIDDoc}})
+		require.NoError(t, err)
+
+		pool := pools.Pool(DIDExchange)
+		block := make(chan struct{})
+
+		// the only worker is busy and the queue is full
+		require.NoError(t, pool.Submit(func() { <-block }))
+		require.Eventually(t, func() bool {
+			return pool.Metrics().Active == 1
+		}, time.Second, time.Millisecond)
+		require.NoError(t, pool.Submit(func() {}))
+
+		connID, err := s.CreateImplicitInvitation("label", newDIDDoc.ID)
+		require.True(t, errors.Is(err, workerpool.ErrQueueFull))
+		require.Empty(t, connID)
+
+		var busy *transport.BusyError
+		require.True(t, errors.As(err, &busy))
+		require.Equal(t, workerpool.DefaultRetryAfter, busy.RetryAfter)
+
+		close(block)
+	})
+}
+
+func TestService_SenderMismatch(t *testing.T) {
+	svc, err := New(&protocol.MockProvider{})
+	require.NoError(t, err)
+
+	statusCh := make(chan service.StateMsg, 10)
+	require.NoError(t, svc.RegisterMsgEvent(statusCh))
+
+	thID := randomString()
+	connRec := &ConnectionRecord{ConnectionID: randomString(), ThreadID: thID,
+		Namespace: theirNSPrefix, State: (&responded{}).Name(), RecipientKeys: []string{"key1"}}
+	require.NoError(t, svc.connectionStore.saveNewConnectionRecord(connRec))
+
+	ack, err := json.Marshal(&model.Ack{
+		Type:   AckMsgType,
+		ID:     randomString(),
+		Status: ackStatusOK,
+		Thread: &decorator.Thread{ID: thID},
+	})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(ack)
+	require.NoError(t, err)
+
+	// the ack is sent by a stranger
+	msg.Inbound = &service.InboundContext{SenderVerKey: "other"}
+
+	_, err = svc.HandleInbound(msg)
+	require.NoError(t, err)
+
+	for {
+		select {
+		case e := <-statusCh:
+			if e.Type != service.PostState || e.StateID != stateNameAbandoned {
+				continue
+			}
+
+			require.Equal(t, connRec.ConnectionID, e.Properties.(event).ConnectionID())
+			require.Contains(t, e.Properties.(error).Error(), ErrSenderMismatch.Error())
+
+			record, err := svc.connectionStore.GetConnectionRecord(connRec.ConnectionID)
+			require.NoError(t, err)
+			require.Equal(t, stateNameAbandoned, record.State)
+
+			return
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the thread was not abandoned")
+		}
+	}
 }
@@ -8,10 +8,12 @@ package didexchange
 
 import (
 	"bytes"
+	gocontext "context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,13 +23,16 @@ import (
 
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/statemachine"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/ed25519signature2018"
+	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 )
 
 const (
-	stateNameNoop          = "noop"
+	stateNameNoop          = statemachine.StateNameNoop
 	stateNameNull          = "null"
 	stateNameInvited       = "invited"
 	stateNameRequested     = "requested"
@@ -46,11 +51,7 @@ type stateAction func() error
 
 // The did-exchange protocol's state.
 type state interface {
-	// Name of this state.
-	Name() string
-
-	// Whether this state allows transitioning into the next state.
-	CanTransitionTo(next state) bool
+	statemachine.State
 
 	// ExecuteInbound this state, returning a followup state to be immediately executed as well.
 	// The 'noOp' state should be returned if the state has no followup.
@@ -74,37 +75,23 @@ func stateFromMsgType(msgType string) (state, error) {
 	}
 }
 
+// nolint:gochecknoglobals
+var states = statemachine.NewStates(
+	&noOp{}, &null{}, &invited{}, &requested{}, &responded{}, &completed{}, &abandoned{},
+)
+
 // Returns the state representing the name.
 func stateFromName(name string) (state, error) {
-	switch name {
-	case stateNameNoop:
-		return &noOp{}, nil
-	case stateNameNull:
-		return &null{}, nil
-	case stateNameInvited:
-		return &invited{}, nil
-	case stateNameRequested:
-		return &requested{}, nil
-	case stateNameResponded:
-		return &responded{}, nil
-	case stateNameCompleted:
-		return &completed{}, nil
-	case stateNameAbandoned:
-		return &abandoned{}, nil
-	default:
-		return nil, fmt.Errorf("invalid state name %s", name)
+	st, err := states.FromName(name)
+	if err != nil {
+		return nil, err
 	}
-}
-
-type noOp struct {
-}
 
-func (s *noOp) Name() string {
-	return stateNameNoop
+	return st.(state), nil
 }
 
-func (s *noOp) CanTransitionTo(_ state) bool {
-	return false
+type noOp struct {
+	statemachine.NoOp
 }
 
 func (s *noOp) ExecuteInbound(_ *stateMachineMsg, thid string, ctx *context) (*ConnectionRecord,
@@ -120,7 +107,7 @@ func (s *null) Name() string {
 	return stateNameNull
 }
 
-func (s *null) CanTransitionTo(next state) bool {
+func (s *null) CanTransitionTo(next statemachine.State) bool {
 	return stateNameInvited == next.Name() || stateNameRequested == next.Name()
 }
 
@@ -137,7 +124,7 @@ func (s *invited) Name() string {
 	return stateNameInvited
 }
 
-func (s *invited) CanTransitionTo(next state) bool {
+func (s *invited) CanTransitionTo(next statemachine.State) bool {
 	return stateNameRequested == next.Name()
 }
 
@@ -160,7 +147,7 @@ func (s *requested) Name() string {
 	return stateNameRequested
 }
 
-func (s *requested) CanTransitionTo(next state) bool {
+func (s *requested) CanTransitionTo(next statemachine.State) bool {
 	return stateNameResponded == next.Name()
 }
 
@@ -175,7 +162,8 @@ func (s *requested) ExecuteInbound(msg *stateMachineMsg, thid string, ctx *conte
 			return nil, nil, nil, fmt.Errorf("JSON unmarshalling of invitation: %w", err)
 		}
 
-		action, connRecord, err := ctx.handleInboundInvitation(invitation, thid, msg.options, msg.connRecord)
+		action, connRecord, err := ctx.handleInboundInvitation(msg.requestContext(), invitation, thid, msg.options,
+			msg.connRecord)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("handle inbound invitation: %w", err)
 		}
@@ -196,7 +184,7 @@ func (s *responded) Name() string {
 	return stateNameResponded
 }
 
-func (s *responded) CanTransitionTo(next state) bool {
+func (s *responded) CanTransitionTo(next statemachine.State) bool {
 	return stateNameCompleted == next.Name()
 }
 
@@ -211,7 +199,7 @@ func (s *responded) ExecuteInbound(msg *stateMachineMsg, thid string, ctx *conte
 			return nil, nil, nil, fmt.Errorf("JSON unmarshalling of request: %w", err)
 		}
 
-		action, connRecord, err := ctx.handleInboundRequest(request, msg.options, msg.connRecord)
+		action, connRecord, err := ctx.handleInboundRequest(msg.requestContext(), request, msg.options, msg.connRecord)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("handle inbound request: %w", err)
 		}
@@ -232,7 +220,7 @@ func (s *completed) Name() string {
 	return stateNameCompleted
 }
 
-func (s *completed) CanTransitionTo(next state) bool {
+func (s *completed) CanTransitionTo(next statemachine.State) bool {
 	return false
 }
 
@@ -247,13 +235,18 @@ func (s *completed) ExecuteInbound(msg *stateMachineMsg, thid string, ctx *conte
 			return nil, nil, nil, fmt.Errorf("JSON unmarshalling of response: %w", err)
 		}
 
-		action, connRecord, err := ctx.handleInboundResponse(response)
+		action, connRecord, err := ctx.handleInboundResponse(response, msg)
 		if err != nil {
 			return nil, nil, nil, fmt.Errorf("handle inbound response: %w", err)
 		}
 
 		return connRecord, &noOp{}, action, nil
 	case AckMsgType:
+		// the ack must be sent by the invitee which requested the connection
+		if err := verifyInboundSender(msg); err != nil {
+			return nil, nil, nil, fmt.Errorf("handle inbound ack: %w", err)
+		}
+
 		action := func() error { return nil }
 		return msg.connRecord, &noOp{}, action, nil
 	default:
@@ -269,7 +262,7 @@ func (s *abandoned) Name() string {
 	return stateNameAbandoned
 }
 
-func (s *abandoned) CanTransitionTo(next state) bool {
+func (s *abandoned) CanTransitionTo(next statemachine.State) bool {
 	return false
 }
 
@@ -278,16 +271,16 @@ func (s *abandoned) ExecuteInbound(msg *stateMachineMsg, thid string, ctx *conte
 	return nil, nil, nil, errors.New("not implemented")
 }
 
-func (ctx *context) handleInboundInvitation(invitation *Invitation,
+func (ctx *context) handleInboundInvitation(goCtx gocontext.Context, invitation *Invitation,
 	thid string, options *options, connRec *ConnectionRecord) (stateAction, *ConnectionRecord, error) {
 	// create a destination from invitation
-	destination, err := ctx.getDestination(invitation)
+	destination, err := ctx.getDestination(goCtx, invitation)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// get did document that will be used in exchange request
-	didDoc, conn, err := ctx.getDIDDocAndConnection(getPublicDID(options))
+	didDoc, conn, err := ctx.getDIDDocAndConnection(goCtx, getPublicDID(options))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -314,25 +307,25 @@ func (ctx *context) handleInboundInvitation(invitation *Invitation,
 	}
 
 	return func() error {
-		return ctx.outboundDispatcher.Send(request, senderVerKeys[0], destination)
+		return dispatcher.SendContext(goCtx, ctx.outboundDispatcher, request, senderVerKeys[0], destination)
 	}, connRec, nil
 }
 
-func (ctx *context) handleInboundRequest(request *Request, options *options, connRec *ConnectionRecord) (stateAction,
-	*ConnectionRecord, error) {
-	requestDidDoc, err := ctx.resolveDidDocFromConnection(request.Connection)
+func (ctx *context) handleInboundRequest(goCtx gocontext.Context, request *Request, options *options,
+	connRec *ConnectionRecord) (stateAction, *ConnectionRecord, error) {
+	requestDidDoc, err := ctx.resolveDidDocFromConnection(goCtx, request.Connection)
 	if err != nil {
 		return nil, nil, fmt.Errorf("resolve did doc from exchange request connection: %w", err)
 	}
 
 	// get did document that will be used in exchange response
-	responseDidDoc, connection, err := ctx.getDIDDocAndConnection(getPublicDID(options))
+	responseDidDoc, connection, err := ctx.getDIDDocAndConnection(goCtx, getPublicDID(options))
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// prepare connection signature
-	encodedConnectionSignature, err := ctx.prepareConnectionSignature(connection, request.Thread.PID)
+	encodedConnectionSignature, err := ctx.prepareConnectionSignature(goCtx, connection, request.Thread.PID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -356,6 +349,10 @@ func (ctx *context) handleInboundRequest(request *Request, options *options, con
 		return nil, nil, err
 	}
 
+	// the ack is expected from the keys of the invitee
+	connRec.RecipientKeys = destination.RecipientKeys
+	connRec.ServiceEndPoint = destination.ServiceEndpoint
+
 	senderVerKeys, err := getRecipientKeys(responseDidDoc)
 	if err != nil {
 		return nil, nil, err
@@ -363,7 +360,7 @@ func (ctx *context) handleInboundRequest(request *Request, options *options, con
 
 	// send exchange response
 	return func() error {
-		return ctx.outboundDispatcher.Send(response, senderVerKeys[0], destination)
+		return dispatcher.SendContext(goCtx, ctx.outboundDispatcher, response, senderVerKeys[0], destination)
 	}, connRec, nil
 }
 
@@ -383,23 +380,33 @@ func getLabel(options *options) string {
 	return options.label
 }
 
-func (ctx *context) getDestination(invitation *Invitation) (*service.Destination, error) {
+func (ctx *context) getDestination(goCtx gocontext.Context, invitation *Invitation) (*service.Destination, error) {
 	if invitation.DID != "" {
-		return ctx.getDestinationFromDID(invitation.DID)
+		return ctx.getDestinationFromDID(goCtx, invitation.DID)
 	}
 
-	return &service.Destination{
+	destination := &service.Destination{
 		RecipientKeys:   invitation.RecipientKeys,
 		ServiceEndpoint: invitation.ServiceEndpoint,
 		RoutingKeys:     invitation.RoutingKeys,
-	}, nil
+	}
+
+	for _, endpoint := range invitation.FallbackServiceEndpoints {
+		destination.Fallbacks = append(destination.Fallbacks, &service.Destination{
+			RecipientKeys:   invitation.RecipientKeys,
+			ServiceEndpoint: endpoint,
+			RoutingKeys:     invitation.RoutingKeys,
+		})
+	}
+
+	return destination, nil
 }
 
-func (ctx *context) getDIDDocAndConnection(pubDID string) (*did.Doc, *Connection, error) {
+func (ctx *context) getDIDDocAndConnection(goCtx gocontext.Context, pubDID string) (*did.Doc, *Connection, error) {
 	if pubDID != "" {
 		logger.Debugf("using public did[%s] for connection", pubDID)
 
-		didDoc, err := ctx.vdriRegistry.Resolve(pubDID)
+		didDoc, err := ctx.vdriRegistry.Resolve(pubDID, vdriapi.WithContext(goCtx))
 		if err != nil {
 			return nil, nil, fmt.Errorf("resolve public did[%s]: %w", pubDID, err)
 		}
@@ -423,17 +430,17 @@ func (ctx *context) getDIDDocAndConnection(pubDID string) (*did.Doc, *Connection
 	return newDidDoc, connection, nil
 }
 
-func (ctx *context) resolveDidDocFromConnection(conn *Connection) (*did.Doc, error) {
+func (ctx *context) resolveDidDocFromConnection(goCtx gocontext.Context, conn *Connection) (*did.Doc, error) {
 	didDoc := conn.DIDDoc
 	if didDoc == nil {
-		return ctx.vdriRegistry.Resolve(conn.DID)
+		return ctx.vdriRegistry.Resolve(conn.DID, vdriapi.WithContext(goCtx))
 	}
 
 	return didDoc, nil
 }
 
-func (ctx *context) getDestinationFromDID(id string) (*service.Destination, error) {
-	didDoc, err := ctx.vdriRegistry.Resolve(id)
+func (ctx *context) getDestinationFromDID(goCtx gocontext.Context, id string) (*service.Destination, error) {
+	didDoc, err := ctx.vdriRegistry.Resolve(id, vdriapi.WithContext(goCtx))
 	if err != nil {
 		return nil, err
 	}
@@ -447,6 +454,10 @@ func getRecipientKeys(didDoc *did.Doc) ([]string, error) {
 		return nil, err
 	}
 
+	return getServiceRecipientKeys(didDoc, didCommService)
+}
+
+func getServiceRecipientKeys(didDoc *did.Doc, didCommService *did.Service) ([]string, error) {
 	if len(didCommService.RecipientKeys) == 0 {
 		return nil, fmt.Errorf("missing recipient keys in did-communication service")
 	}
@@ -486,44 +497,75 @@ func isSupportedKeyType(keyType string) bool {
 }
 
 func getDidCommService(didDoc *did.Doc) (*did.Service, error) {
-	const notFound = -1
-	index := notFound
-
-	for i, s := range didDoc.Service {
-		if s.Type == didCommServiceType {
-			if index == notFound || didDoc.Service[index].Priority > s.Priority {
-				index = i
-			}
+	services, err := getDidCommServices(didDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	return services[0], nil
+}
+
+// getDidCommServices returns the did-communication services ordered by priority.
+func getDidCommServices(didDoc *did.Doc) ([]*did.Service, error) {
+	var services []*did.Service
+
+	for i := range didDoc.Service {
+		if didDoc.Service[i].Type == didCommServiceType {
+			services = append(services, &didDoc.Service[i])
 		}
 	}
 
-	if index == notFound {
+	if len(services) == 0 {
 		return nil, fmt.Errorf("service not found in DID document: %s", didCommServiceType)
 	}
 
-	return &didDoc.Service[index], nil
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Priority < services[j].Priority
+	})
+
+	return services, nil
 }
 
+// prepareDestination returns the destination of the did-communication service with the highest priority,
+// the other did-communication services are added as the fallbacks.
 func prepareDestination(didDoc *did.Doc) (*service.Destination, error) {
-	didCommService, err := getDidCommService(didDoc)
+	services, err := getDidCommServices(didDoc)
 	if err != nil {
 		return nil, err
 	}
 
-	recipientKeys, err := getRecipientKeys(didDoc)
-	if err != nil {
-		return nil, err
+	var destination *service.Destination
+
+	for _, didCommService := range services {
+		recipientKeys, keysErr := getServiceRecipientKeys(didDoc, didCommService)
+		if keysErr != nil && destination == nil {
+			return nil, keysErr
+		}
+
+		if keysErr != nil {
+			logger.Debugf("skipping fallback service endpoint %s: %s", didCommService.ServiceEndpoint, keysErr)
+			continue
+		}
+
+		des := &service.Destination{
+			RecipientKeys:   recipientKeys,
+			ServiceEndpoint: didCommService.ServiceEndpoint,
+		}
+
+		if destination == nil {
+			destination = des
+			continue
+		}
+
+		destination.Fallbacks = append(destination.Fallbacks, des)
 	}
 
-	return &service.Destination{
-		RecipientKeys:   recipientKeys,
-		ServiceEndpoint: didCommService.ServiceEndpoint,
-	}, nil
+	return destination, nil
 }
 
 // Encode the connection and convert to Connection Signature as per the spec:
 // https://github.com/hyperledger/aries-rfcs/tree/master/features/0023-did-exchange
-func (ctx *context) prepareConnectionSignature(connection *Connection,
+func (ctx *context) prepareConnectionSignature(goCtx gocontext.Context, connection *Connection,
 	invitationID string) (*ConnectionSignature, error) {
 	connAttributeBytes, err := json.Marshal(connection)
 	if err != nil {
@@ -545,7 +587,7 @@ func (ctx *context) prepareConnectionSignature(connection *Connection,
 		}
 	}
 
-	pubKey, err := ctx.getInvitationRecipientKey(invitation)
+	pubKey, err := ctx.getInvitationRecipientKey(goCtx, invitation)
 	if err != nil {
 		return nil, fmt.Errorf("get invitation recipient key: %w", err)
 	}
@@ -564,7 +606,8 @@ func (ctx *context) prepareConnectionSignature(connection *Connection,
 	}, nil
 }
 
-func (ctx *context) handleInboundResponse(response *Response) (stateAction, *ConnectionRecord, error) {
+func (ctx *context) handleInboundResponse(response *Response, msg *stateMachineMsg) (stateAction,
+	*ConnectionRecord, error) {
 	ack := &model.Ack{
 		Type:   AckMsgType,
 		ID:     uuid.New().String(),
@@ -592,7 +635,7 @@ func (ctx *context) handleInboundResponse(response *Response) (stateAction, *Con
 
 	connRecord.TheirDID = conn.DID
 
-	responseDidDoc, err := ctx.resolveDidDocFromConnection(conn)
+	responseDidDoc, err := ctx.resolveDidDocFromConnection(msg.requestContext(), conn)
 	if err != nil {
 		return nil, nil, fmt.Errorf("resolve did doc from exchange response connection: %w", err)
 	}
@@ -602,7 +645,16 @@ func (ctx *context) handleInboundResponse(response *Response) (stateAction, *Con
 		return nil, nil, fmt.Errorf("prepare destination from response did doc: %w", err)
 	}
 
-	myDidDoc, err := ctx.vdriRegistry.Resolve(connRecord.MyDID)
+	// the response must be sent with the keys of the DID document signed by the invitation key,
+	// they replace the invitation key as the keys of the inviter
+	if err := verifyInboundSenderKey(msg, destination.RecipientKeys, connRecord.ConnectionID); err != nil {
+		return nil, nil, err
+	}
+
+	connRecord.RecipientKeys = destination.RecipientKeys
+	connRecord.ServiceEndPoint = destination.ServiceEndpoint
+
+	myDidDoc, err := ctx.vdriRegistry.Resolve(connRecord.MyDID, vdriapi.WithContext(msg.requestContext()))
 	if err != nil {
 		return nil, nil, fmt.Errorf("fetching did document: %w", err)
 	}
@@ -613,7 +665,7 @@ func (ctx *context) handleInboundResponse(response *Response) (stateAction, *Con
 	}
 
 	return func() error {
-		return ctx.outboundDispatcher.Send(ack, senderVerKeys[0], destination)
+		return dispatcher.SendContext(msg.requestContext(), ctx.outboundDispatcher, ack, senderVerKeys[0], destination)
 	}, connRecord, nil
 }
 
@@ -665,9 +717,9 @@ func getEpochTime() int64 {
 	return time.Now().Unix()
 }
 
-func (ctx *context) getInvitationRecipientKey(invitation *Invitation) (string, error) {
+func (ctx *context) getInvitationRecipientKey(goCtx gocontext.Context, invitation *Invitation) (string, error) {
 	if invitation.DID != "" {
-		didDoc, err := ctx.vdriRegistry.Resolve(invitation.DID)
+		didDoc, err := ctx.vdriRegistry.Resolve(invitation.DID, vdriapi.WithContext(goCtx))
 		if err != nil {
 			return "", fmt.Errorf("get invitation recipient key: %w", err)
 		}
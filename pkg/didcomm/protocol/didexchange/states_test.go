@@ -8,6 +8,7 @@ package didexchange
 
 import (
 	"bytes"
+	gocontext "context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
@@ -415,7 +416,7 @@ func TestCompletedState_Execute(t *testing.T) {
 	}
 	invitation, err := createMockInvitation(pubKey, ctx)
 	require.NoError(t, err)
-	connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+	connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 	require.NoError(t, err)
 
 	response := &Response{
@@ -451,6 +452,24 @@ func TestCompletedState_Execute(t *testing.T) {
 		require.NoError(t, e)
 		require.IsType(t, &noOp{}, followup)
 	})
+	t.Run("verifies the sender of inbound responses", func(t *testing.T) {
+		_, followup, _, e := (&completed{}).ExecuteInbound(&stateMachineMsg{
+			header:  &service.Header{Type: ResponseMsgType},
+			payload: responsePayloadBytes,
+			inbound: &service.InboundContext{SenderVerKey: "other"},
+		}, "", ctx)
+		require.True(t, errors.Is(e, ErrSenderMismatch))
+		require.Nil(t, followup)
+
+		connRec, followup, _, e := (&completed{}).ExecuteInbound(&stateMachineMsg{
+			header:  &service.Header{Type: ResponseMsgType},
+			payload: responsePayloadBytes,
+			inbound: &service.InboundContext{SenderVerKey: pubKey},
+		}, "", ctx)
+		require.NoError(t, e)
+		require.IsType(t, &noOp{}, followup)
+		require.Equal(t, []string{pubKey}, connRec.RecipientKeys)
+	})
 	t.Run("no followup for inbound acks", func(t *testing.T) {
 		connRec := &ConnectionRecord{
 			State:         (&responded{}).Name(),
@@ -478,6 +497,40 @@ func TestCompletedState_Execute(t *testing.T) {
 		require.NoError(t, e)
 		require.IsType(t, &noOp{}, followup)
 	})
+	t.Run("verifies the sender of inbound acks", func(t *testing.T) {
+		connRec := &ConnectionRecord{ConnectionID: "123", RecipientKeys: []string{pubKey}}
+		ack, e := json.Marshal(&model.Ack{
+			Type:   AckMsgType,
+			ID:     randomString(),
+			Status: ackStatusOK,
+			Thread: &decorator.Thread{ID: response.Thread.ID},
+		})
+		require.NoError(t, e)
+
+		for _, inbound := range []*service.InboundContext{
+			{SenderVerKey: "other"},
+			{SenderVerKey: "other", Connection: &ConnectionRecord{ConnectionID: "456"}},
+		} {
+			_, followup, _, e := (&completed{}).ExecuteInbound(&stateMachineMsg{
+				header:     &service.Header{Type: AckMsgType},
+				payload:    ack,
+				connRecord: connRec,
+				inbound:    inbound,
+			}, "", ctx)
+			require.True(t, errors.Is(e, ErrSenderMismatch))
+			require.Contains(t, e.Error(), "handle inbound ack")
+			require.Nil(t, followup)
+		}
+
+		_, followup, _, e := (&completed{}).ExecuteInbound(&stateMachineMsg{
+			header:     &service.Header{Type: AckMsgType},
+			payload:    ack,
+			connRecord: connRec,
+			inbound:    &service.InboundContext{SenderVerKey: pubKey, Connection: connRec},
+		}, "", ctx)
+		require.NoError(t, e)
+		require.IsType(t, &noOp{}, followup)
+	})
 	t.Run("rejects messages other than responses and acks", func(t *testing.T) {
 		others := []string{InvitationMsgType, RequestMsgType}
 		for _, o := range others {
@@ -522,7 +575,7 @@ func TestVerifySignature(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("signature verified", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 		con, err := verifySignature(connectionSignature, invitation.RecipientKeys[0])
 		require.NoError(t, err)
@@ -536,7 +589,7 @@ func TestVerifySignature(t *testing.T) {
 		require.Nil(t, con)
 	})
 	t.Run("decode signature data error", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 
 		connectionSignature.SignedData = "invalid-signed-data"
@@ -546,7 +599,7 @@ func TestVerifySignature(t *testing.T) {
 		require.Nil(t, con)
 	})
 	t.Run("decode signature error", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 
 		connectionSignature.Signature = "invalid-signature"
@@ -556,7 +609,7 @@ func TestVerifySignature(t *testing.T) {
 		require.Nil(t, con)
 	})
 	t.Run("decode verification key error ", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 
 		con, err := verifySignature(connectionSignature, "invalid-key")
@@ -565,7 +618,7 @@ func TestVerifySignature(t *testing.T) {
 		require.Nil(t, con)
 	})
 	t.Run("verify signature error", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 
 		// generate different key and assign it to signature verification key
@@ -635,7 +688,7 @@ func TestPrepareConnectionSignature(t *testing.T) {
 	}
 
 	t.Run("prepare connection signature", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.NoError(t, err)
 		require.NotNil(t, connectionSignature)
 		sigData, err := base64.URLEncoding.DecodeString(connectionSignature.SignedData)
@@ -652,7 +705,7 @@ func TestPrepareConnectionSignature(t *testing.T) {
 			signer:          &mockSigner{privateKey: privKey},
 			connectionStore: NewConnectionRecorder(store, store),
 		}
-		connectionSignature, err := ctx2.prepareConnectionSignature(connection, newDidDoc.ID)
+		connectionSignature, err := ctx2.prepareConnectionSignature(gocontext.Background(), connection, newDidDoc.ID)
 		require.NoError(t, err)
 		require.NotNil(t, connectionSignature)
 		sigData, err := base64.URLEncoding.DecodeString(connectionSignature.SignedData)
@@ -670,13 +723,13 @@ func TestPrepareConnectionSignature(t *testing.T) {
 			signer:          &mockSigner{privateKey: privKey},
 			connectionStore: NewConnectionRecorder(store, store),
 		}
-		connectionSignature, err := ctx2.prepareConnectionSignature(connection, newDidDoc.ID)
+		connectionSignature, err := ctx2.prepareConnectionSignature(gocontext.Background(), connection, newDidDoc.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "key not found in DID document")
 		require.Nil(t, connectionSignature)
 	})
 	t.Run("prepare connection signature get invitation", func(t *testing.T) {
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, "test")
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, "test")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "get invitation for signature: data not found")
 		require.Nil(t, connectionSignature)
@@ -689,7 +742,7 @@ func TestPrepareConnectionSignature(t *testing.T) {
 		}
 		err := ctx.connectionStore.SaveInvitation(invitation)
 		require.NoError(t, err)
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, inv.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, inv.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "get invitation for signature: data not found")
 		require.Nil(t, connectionSignature)
@@ -700,7 +753,7 @@ func TestPrepareConnectionSignature(t *testing.T) {
 		connection := &Connection{
 			DIDDoc: getMockDID(),
 		}
-		connectionSignature, err := ctx.prepareConnectionSignature(connection, invitation.ID)
+		connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, invitation.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "sign error")
 		require.Nil(t, connectionSignature)
@@ -715,6 +768,27 @@ func TestPrepareDestination(t *testing.T) {
 		require.Equal(t, dest.ServiceEndpoint, "https://localhost:8090")
 	})
 
+	t.Run("fallback destinations ordered by priority", func(t *testing.T) {
+		didDoc := getMockDID()
+		didDoc.Service[0].Priority = 2
+		didDoc.Service[1].ServiceEndpoint = "ws://localhost:8091"
+		didDoc.Service[1].RecipientKeys = didDoc.Service[0].RecipientKeys
+		didDoc.Service = append(didDoc.Service, diddoc.Service{
+			ServiceEndpoint: "https://localhost:8092",
+			Type:            "did-communication",
+			Priority:        3,
+			RecipientKeys:   []string{"invalid"},
+		})
+
+		dest, err := prepareDestination(didDoc)
+		require.NoError(t, err)
+		require.Equal(t, "ws://localhost:8091", dest.ServiceEndpoint)
+		// the service with invalid recipient keys is skipped
+		require.Len(t, dest.Fallbacks, 1)
+		require.Equal(t, "https://localhost:8090", dest.Fallbacks[0].ServiceEndpoint)
+		require.Equal(t, dest.RecipientKeys, dest.Fallbacks[0].RecipientKeys)
+	})
+
 	t.Run("error while getting service", func(t *testing.T) {
 		didDoc := getMockDID()
 		didDoc.Service = nil
@@ -756,7 +830,8 @@ func TestNewRequestFromInvitation(t *testing.T) {
 			Payload: invitationBytes,
 		})
 		require.NoError(t, err)
-		_, connRec, err := ctx.handleInboundInvitation(invitation, thid, &options{}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundInvitation(gocontext.Background(), invitation, thid, &options{},
+			&ConnectionRecord{})
 		require.NoError(t, err)
 		require.NotNil(t, connRec.MyDID)
 	})
@@ -771,7 +846,8 @@ func TestNewRequestFromInvitation(t *testing.T) {
 			Payload: invitationBytes,
 		})
 		require.NoError(t, err)
-		_, connRec, err := ctx.handleInboundInvitation(invitation, thid, &options{publicDID: doc.ID}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundInvitation(gocontext.Background(), invitation, thid, &options{publicDID: doc.ID},
+			&ConnectionRecord{})
 		require.NoError(t, err)
 		require.NotNil(t, connRec.MyDID)
 		require.Equal(t, connRec.MyDID, doc.ID)
@@ -787,7 +863,8 @@ func TestNewRequestFromInvitation(t *testing.T) {
 			Payload: invitationBytes,
 		})
 		require.NoError(t, err)
-		_, connRec, err := ctx.handleInboundInvitation(invitation, thid, &options{}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundInvitation(gocontext.Background(), invitation, thid, &options{},
+			&ConnectionRecord{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "create DID error")
 		require.Nil(t, connRec)
@@ -801,7 +878,7 @@ func TestNewResponseFromRequest(t *testing.T) {
 		ctx := getContext(prov, store)
 		request, err := createRequest(ctx)
 		require.NoError(t, err)
-		_, connRec, err := ctx.handleInboundRequest(request, &options{}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundRequest(gocontext.Background(), request, &options{}, &ConnectionRecord{})
 		require.NoError(t, err)
 		require.NotNil(t, connRec.MyDID)
 		require.NotNil(t, connRec.TheirDID)
@@ -811,7 +888,7 @@ func TestNewResponseFromRequest(t *testing.T) {
 		ctx := &context{
 			vdriRegistry: &mockvdri.MockVDRIRegistry{CreateErr: fmt.Errorf("create DID error"), ResolveValue: getMockDID()}}
 		request := &Request{Connection: &Connection{DID: didDoc.ID, DIDDoc: didDoc}}
-		_, connRec, err := ctx.handleInboundRequest(request, &options{}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundRequest(gocontext.Background(), request, &options{}, &ConnectionRecord{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "create DID error")
 		require.Nil(t, connRec)
@@ -822,7 +899,7 @@ func TestNewResponseFromRequest(t *testing.T) {
 			connectionStore: NewConnectionRecorder(nil, store)}
 		request, err := createRequest(ctx)
 		require.NoError(t, err)
-		_, connRec, err := ctx.handleInboundRequest(request, &options{}, &ConnectionRecord{})
+		_, connRec, err := ctx.handleInboundRequest(gocontext.Background(), request, &options{}, &ConnectionRecord{})
 
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "sign error")
@@ -831,7 +908,7 @@ func TestNewResponseFromRequest(t *testing.T) {
 	t.Run("unsuccessful new response from request due to resolve public did from request error", func(t *testing.T) {
 		ctx := &context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveErr: errors.New("resolver error")}}
 		request := &Request{Connection: &Connection{DID: "did:sidetree:abc"}}
-		_, _, err := ctx.handleInboundRequest(request, &options{}, &ConnectionRecord{})
+		_, _, err := ctx.handleInboundRequest(gocontext.Background(), request, &options{}, &ConnectionRecord{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "resolver error")
 	})
@@ -848,14 +925,14 @@ func TestHandleInboundResponse(t *testing.T) {
 
 	t.Run("handle inbound responses get connection record error", func(t *testing.T) {
 		response := &Response{Thread: &decorator.Thread{ID: "test"}}
-		_, connRec, err := ctx.handleInboundResponse(response)
+		_, connRec, err := ctx.handleInboundResponse(response, &stateMachineMsg{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "get connection record")
 		require.Nil(t, connRec)
 	})
 	t.Run("handle inbound responses get connection record error", func(t *testing.T) {
 		response := &Response{Thread: &decorator.Thread{ID: ""}}
-		_, connRec, err := ctx.handleInboundResponse(response)
+		_, connRec, err := ctx.handleInboundResponse(response, &stateMachineMsg{})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "empty bytes")
 		require.Nil(t, connRec)
@@ -864,7 +941,7 @@ func TestHandleInboundResponse(t *testing.T) {
 		resp, err := saveMockConnectionRecord(request, ctx)
 		require.NoError(t, err)
 		resp.ConnectionSignature = &ConnectionSignature{}
-		_, connRec, e := ctx.handleInboundResponse(resp)
+		_, connRec, e := ctx.handleInboundResponse(resp, &stateMachineMsg{})
 		require.Error(t, e)
 		require.Contains(t, e.Error(), "missing or invalid signature data")
 		require.Nil(t, connRec)
@@ -882,7 +959,7 @@ func TestGetInvitationRecipientKey(t *testing.T) {
 			RecipientKeys:   []string{"test"},
 			ServiceEndpoint: "http://alice.agent.example.com:8081",
 		}
-		recKey, err := ctx.getInvitationRecipientKey(invitation)
+		recKey, err := ctx.getInvitationRecipientKey(gocontext.Background(), invitation)
 		require.NoError(t, err)
 		require.Equal(t, invitation.RecipientKeys[0], recKey)
 	})
@@ -894,7 +971,7 @@ func TestGetInvitationRecipientKey(t *testing.T) {
 			ID:   randomString(),
 			DID:  doc.ID,
 		}
-		recKey, err := ctx.getInvitationRecipientKey(invitation)
+		recKey, err := ctx.getInvitationRecipientKey(gocontext.Background(), invitation)
 		require.NoError(t, err)
 		require.Equal(t, string(doc.PublicKey[0].Value), recKey)
 	})
@@ -904,7 +981,7 @@ func TestGetInvitationRecipientKey(t *testing.T) {
 			ID:   randomString(),
 			DID:  "test",
 		}
-		_, err := ctx.getInvitationRecipientKey(invitation)
+		_, err := ctx.getInvitationRecipientKey(gocontext.Background(), invitation)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "get invitation recipient key: not found")
 	})
@@ -1018,7 +1095,7 @@ func TestGetDIDDocAndConnection(t *testing.T) {
 	t.Run("successfully getting did doc and connection for public did", func(t *testing.T) {
 		doc := createDIDDoc()
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveValue: doc}}
-		didDoc, conn, err := ctx.getDIDDocAndConnection(doc.ID)
+		didDoc, conn, err := ctx.getDIDDocAndConnection(gocontext.Background(), doc.ID)
 		require.NoError(t, err)
 		require.NotNil(t, didDoc)
 		require.NotNil(t, conn)
@@ -1026,7 +1103,7 @@ func TestGetDIDDocAndConnection(t *testing.T) {
 	})
 	t.Run("error getting public did doc from resolver", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveErr: errors.New("resolver error")}}
-		didDoc, conn, err := ctx.getDIDDocAndConnection("did-id")
+		didDoc, conn, err := ctx.getDIDDocAndConnection(gocontext.Background(), "did-id")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "resolver error")
 		require.Nil(t, didDoc)
@@ -1034,7 +1111,7 @@ func TestGetDIDDocAndConnection(t *testing.T) {
 	})
 	t.Run("error creating peer did", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{CreateErr: errors.New("creator error")}}
-		didDoc, conn, err := ctx.getDIDDocAndConnection("")
+		didDoc, conn, err := ctx.getDIDDocAndConnection(gocontext.Background(), "")
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "creator error")
 		require.Nil(t, didDoc)
@@ -1042,7 +1119,7 @@ func TestGetDIDDocAndConnection(t *testing.T) {
 	})
 	t.Run("successfully created peer did", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{CreateValue: getMockDID()}}
-		didDoc, conn, err := ctx.getDIDDocAndConnection("")
+		didDoc, conn, err := ctx.getDIDDocAndConnection(gocontext.Background(), "")
 		require.NoError(t, err)
 		require.NotNil(t, didDoc)
 		require.NotNil(t, conn)
@@ -1055,14 +1132,14 @@ func TestGetDestinationFromDID(t *testing.T) {
 
 	t.Run("successfully getting destination from public DID", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveValue: doc}}
-		destination, err := ctx.getDestinationFromDID(doc.ID)
+		destination, err := ctx.getDestinationFromDID(gocontext.Background(), doc.ID)
 		require.NoError(t, err)
 		require.NotNil(t, destination)
 	})
 	t.Run("test public key not found", func(t *testing.T) {
 		doc.PublicKey = nil
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveValue: doc}}
-		destination, err := ctx.getDestinationFromDID(doc.ID)
+		destination, err := ctx.getDestinationFromDID(gocontext.Background(), doc.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "key not found in DID document")
 		require.Nil(t, destination)
@@ -1071,7 +1148,7 @@ func TestGetDestinationFromDID(t *testing.T) {
 		doc2 := createDIDDoc()
 		doc2.Service = nil
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveValue: doc2}}
-		destination, err := ctx.getDestinationFromDID(doc2.ID)
+		destination, err := ctx.getDestinationFromDID(gocontext.Background(), doc2.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "service not found in DID document: did-communication")
 		require.Nil(t, destination)
@@ -1079,13 +1156,31 @@ func TestGetDestinationFromDID(t *testing.T) {
 	t.Run("get destination by invitation", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveValue: createDIDDoc()}}
 		invitation := &Invitation{DID: "test"}
-		destination, err := ctx.getDestination(invitation)
+		destination, err := ctx.getDestination(gocontext.Background(), invitation)
 		require.NoError(t, err)
 		require.NotNil(t, destination)
 	})
+	t.Run("get destination with fallbacks by invitation", func(t *testing.T) {
+		ctx := context{}
+		invitation := &Invitation{
+			RecipientKeys:            []string{"key"},
+			ServiceEndpoint:          "ws://endpoint",
+			FallbackServiceEndpoints: []string{"http://endpoint"},
+			RoutingKeys:              []string{"routing-key"},
+		}
+		destination, err := ctx.getDestination(gocontext.Background(), invitation)
+		require.NoError(t, err)
+		require.Equal(t, "ws://endpoint", destination.ServiceEndpoint)
+		require.Len(t, destination.Fallbacks, 1)
+		require.Equal(t, &service.Destination{
+			RecipientKeys:   []string{"key"},
+			ServiceEndpoint: "http://endpoint",
+			RoutingKeys:     []string{"routing-key"},
+		}, destination.Fallbacks[0])
+	})
 	t.Run("test did document not found", func(t *testing.T) {
 		ctx := context{vdriRegistry: &mockvdri.MockVDRIRegistry{ResolveErr: errors.New("resolver error")}}
-		destination, err := ctx.getDestinationFromDID(doc.ID)
+		destination, err := ctx.getDestinationFromDID(gocontext.Background(), doc.ID)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "resolver error")
 		require.Nil(t, destination)
@@ -1200,7 +1295,7 @@ func createResponse(request *Request, ctx *context) (*Response, error) {
 		DIDDoc: didDoc,
 	}
 
-	connectionSignature, err := ctx.prepareConnectionSignature(connection, request.Thread.PID)
+	connectionSignature, err := ctx.prepareConnectionSignature(gocontext.Background(), connection, request.Thread.PID)
 	if err != nil {
 		return nil, err
 	}
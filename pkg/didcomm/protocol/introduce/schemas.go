@@ -0,0 +1,95 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package introduce
+
+const (
+	proposalSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "to"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "to": {"$ref": "#/definitions/to"},
+    "nwise": {"type": "boolean"},
+    "~timing": {"type": "object"}
+  },
+  "definitions": {
+    "to": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "description": {"type": "string"},
+        "description~l10n": {"type": "object", "additionalProperties": {"type": "string"}},
+        "where": {"type": "string"},
+        "img~attach": {"type": "object"},
+        "proposed": {"type": "boolean"}
+      }
+    }
+  }
+}`
+
+	requestSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "please_introduce_to"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "please_introduce_to": {"type": "object"},
+    "nwise": {"type": "boolean"},
+    "~timing": {"type": "object"}
+  }
+}`
+
+	responseSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "~thread"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "~thread": {
+      "type": "object",
+      "required": ["thid"],
+      "properties": {
+        "thid": {"type": "string", "minLength": 1}
+      }
+    },
+    "approve": {"type": "boolean"},
+    "invitation": {"type": "object"}
+  }
+}`
+
+	ackSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["@id", "@type", "~thread"],
+  "properties": {
+    "@id": {"type": "string", "minLength": 1},
+    "@type": {"type": "string"},
+    "~thread": {
+      "type": "object",
+      "required": ["thid"],
+      "properties": {
+        "thid": {"type": "string", "minLength": 1}
+      }
+    }
+  }
+}`
+)
+
+// Schemas returns the JSON Schemas of the introduce messages by message type, the inbound messages
+// are validated against them before they are dispatched to the service.
+func Schemas() map[string]string {
+	return map[string]string{
+		ProposalMsgType: proposalSchema,
+		RequestMsgType:  requestSchema,
+		ResponseMsgType: responseSchema,
+		AckMsgType:      ackSchema,
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package introduce
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
+)
+
+func TestSchemas(t *testing.T) {
+	registry := schema.NewRegistry()
+	require.NoError(t, registry.RegisterAll(Schemas()))
+
+	validate := func(msg interface{}) error {
+		payload, err := json.Marshal(msg)
+		require.NoError(t, err)
+
+		didCommMsg, err := service.NewDIDCommMsg(payload)
+		require.NoError(t, err)
+
+		return registry.Validate(didCommMsg)
+	}
+
+	var validationErr *schema.ValidationError
+
+	require.NoError(t, validate(&Proposal{Type: ProposalMsgType, ID: "1",
+		To: To{Name: "Bob", DescriptionL10N: DescriptionL10N{"locale": "en"}}}))
+	require.NoError(t, validate(&Request{Type: RequestMsgType, ID: "1",
+		PleaseIntroduceTo: PleaseIntroduceTo{To: To{Name: "Carol"}}}))
+	require.NoError(t, validate(&Response{Type: ResponseMsgType, ID: "2", Thread: &decorator.Thread{ID: "1"},
+		Approve: true, Invitation: &didexchange.Invitation{ID: "3"}}))
+	require.NoError(t, validate(&model.Ack{Type: AckMsgType, ID: "4", Thread: &decorator.Thread{ID: "1"}}))
+
+	err := validate(map[string]interface{}{"@type": ProposalMsgType, "@id": "1", "to": "Bob"})
+	require.True(t, errors.As(err, &validationErr))
+	require.Contains(t, err.Error(), "to: Invalid type")
+
+	err = validate(&Response{Type: ResponseMsgType, ID: "2"})
+	require.True(t, errors.As(err, &validationErr))
+	require.Contains(t, err.Error(), "~thread is required")
+}
@@ -7,15 +7,21 @@ SPDX-License-Identifier: Apache-2.0
 package introduce
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"sync"
+	"strings"
 
 	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/statemachine"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 )
 
@@ -32,6 +38,8 @@ const (
 	ResponseMsgType = IntroduceSpec + "response"
 	// AckMsgType defines the introduce ack message type.
 	AckMsgType = IntroduceSpec + "ack"
+	// CallbackPool is the name of the worker pool resuming the threads continued by the action events.
+	CallbackPool = Introduce + "-callbacks"
 )
 
 const initialWaitCount = 2
@@ -65,10 +73,30 @@ type metaData struct {
 	ThreadID string
 	// keeps a dependency for the protocol injected by Continue() function
 	dependency InvitationEnvelope
-	// err is used to determine whether callback was stopped
-	// e.g the user received an action event and executes Stop(err) function
-	// in that case `err` is equal to `err` which was passing to Stop function
-	err error
+}
+
+// metaDataJSON is used to persist the metaData with the pending action events.
+type metaDataJSON struct {
+	record
+	Msg      *service.DIDCommMsg
+	ThreadID string
+}
+
+// MarshalJSON marshals the metaData. The dependency is provided by the consumer, it is not persisted.
+func (m *metaData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&metaDataJSON{record: m.record, Msg: m.Msg, ThreadID: m.ThreadID})
+}
+
+// UnmarshalJSON unmarshals the metaData.
+func (m *metaData) UnmarshalJSON(data []byte) error {
+	raw := &metaDataJSON{}
+	if err := json.Unmarshal(data, raw); err != nil {
+		return err
+	}
+
+	m.record, m.Msg, m.ThreadID = raw.record, raw.Msg, raw.ThreadID
+
+	return nil
 }
 
 type record struct {
@@ -82,13 +110,11 @@ type record struct {
 type Service struct {
 	service.Action
 	service.Message
-	store       storage.Store
-	callbacks   chan *metaData
-	ctx         internalContext
-	wg          sync.WaitGroup
-	stop        chan struct{}
-	closedMutex sync.Mutex
-	closed      bool
+	store   *statemachine.ThreadStore
+	machine *statemachine.Machine
+	ctx     internalContext
+	// pool processes the inbound messages, the callbacks are processed by the separate pool
+	pool *workerpool.Pool
 }
 
 // Provider contains dependencies for the DID exchange protocol and is typically created by using aries.Context()
@@ -97,6 +123,22 @@ type Provider interface {
 	StorageProvider() storage.Provider
 }
 
+// historyProvider is implemented by the providers which archive the state transitions, e.g. aries.Context().
+type historyProvider interface {
+	MessageHistory() *history.Archive
+}
+
+// tracerProvider is implemented by the providers tracing the protocol processing, e.g. aries.Context().
+type tracerProvider interface {
+	Tracer() trace.Tracer
+}
+
+// workerPoolProvider is implemented by the providers configuring the worker pools of the services,
+// e.g. aries.Context().
+type workerPoolProvider interface {
+	WorkerPool(name string) *workerpool.Pool
+}
+
 // New returns introduce service
 func New(p Provider) (*Service, error) {
 	store, err := p.StorageProvider().OpenStore(Introduce)
@@ -108,72 +150,90 @@ func New(p Provider) (*Service, error) {
 		ctx: internalContext{
 			Outbound: p.OutboundDispatcher(),
 		},
-		store:     store,
-		callbacks: make(chan *metaData),
-		stop:      make(chan struct{}),
+		store: statemachine.NewThreadStore(store),
+	}
+
+	machineOpts := []statemachine.Option{statemachine.WithPendingStore(store)}
+
+	// without the configured pools every inbound message is processed in a new goroutine
+	if wp, ok := p.(workerPoolProvider); ok {
+		svc.pool = wp.WorkerPool(Introduce)
+		machineOpts = append(machineOpts, statemachine.WithWorkerPool(wp.WorkerPool(CallbackPool)))
+	}
+
+	if tp, ok := p.(tracerProvider); ok {
+		machineOpts = append(machineOpts, statemachine.WithTracer(tp.Tracer()))
+	}
+
+	if hp, ok := p.(historyProvider); ok && hp.MessageHistory() != nil {
+		machineOpts = append(machineOpts, statemachine.WithTransitionRecorder(hp.MessageHistory()))
 	}
 
-	// start the listener
-	svc.wg.Add(1)
+	// the machine starts the callback listener
+	svc.machine = statemachine.New(Introduce, &svc.Message, svc.resume, svc.abandon, machineOpts...)
+
+	restored, err := svc.machine.Restore(func(p *statemachine.Pending) (interface{}, error) {
+		// the dependency is not persisted, the action event is re-emitted to get it from the consumer again
+		if p.Status == statemachine.PendingCallback && p.Err == "" {
+			p.Status = statemachine.PendingAction
+		}
 
-	go svc.startInternalListener()
+		msg := &metaData{}
+
+		return msg, json.Unmarshal(p.Data, msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("restore pending actions: %w", err)
+	}
+
+	// the restored action events are kept by the action event bus until a subscriber owning them is registered
+	for _, cb := range restored {
+		action, err := svc.newAction(cb)
+		if err != nil {
+			return nil, fmt.Errorf("restore pending actions: %w", err)
+		}
+
+		svc.PublishActionEvent(action)
+	}
 
 	return svc, nil
 }
 
-// Stop stops service (callback listener)
+// Stop stops the service: the queued callbacks are processed, then the action event bus is closed.
 func (s *Service) Stop() error {
-	s.closedMutex.Lock()
-	defer s.closedMutex.Unlock()
-
-	if s.closed {
-		return errors.New("server was already stopped")
+	if err := s.machine.Stop(); err != nil {
+		return err
 	}
 
-	close(s.stop)
-	s.closed = true
-	s.wg.Wait()
+	s.Action.Close()
 
 	return nil
 }
 
-// startInternalListener listens to messages in gochannel for callback messages from clients.
-func (s *Service) startInternalListener() {
-	for {
-		select {
-		case msg := <-s.callbacks:
-			// if no error - do handle
-			if msg.err == nil {
-				msg.err = s.handle(msg, nil)
-			}
-
-			// no error - continue
-			if msg.err == nil {
-				continue
-			}
-
-			if err := s.abandon(msg.ThreadID, msg.Msg, msg.err); err != nil {
-				logger.Errorf("process callback : %s", err)
-			}
-		case <-s.stop:
-			logger.Infof("the callback listener was stopped")
-			s.wg.Done()
-
-			return
-		}
+// resume continues the execution of the thread once the consumer continued the action event.
+func (s *Service) resume(cb *statemachine.Callback) error {
+	msg, ok := cb.Data.(*metaData)
+	if !ok {
+		return errors.New("invalid callback data")
 	}
+
+	defer s.machine.LockThread(msg.ThreadID)()
+
+	return s.handle(context.Background(), msg, nil)
 }
 
 // abandon updates the state to abandoned and trigger failure event.
 func (s *Service) abandon(thID string, msg *service.DIDCommMsg, _ error) error {
+	defer s.machine.LockThread(thID)()
+
 	// update the state to abandoned
-	if err := s.save(thID, &abandoning{}); err != nil {
+	if err := s.save(thID, record{StateName: stateNameAbandoning}); err != nil {
 		return fmt.Errorf("save abandoning sate: %w", err)
 	}
 
 	// TODO: add received error to Properties
 	// send the message event
-	s.sendMsgEvents(&service.StateMsg{
+	s.machine.SendMsgEvents(&service.StateMsg{
 		ProtocolName: Introduce,
 		Type:         service.PostState,
 		Msg:          msg.Clone(),
@@ -183,6 +243,16 @@ func (s *Service) abandon(thID string, msg *service.DIDCommMsg, _ error) error {
 	return nil
 }
 
+// lockThread locks the thread of the message, it returns the function which unlocks the thread.
+func (s *Service) lockThread(msg *service.DIDCommMsg) (func(), error) {
+	thID, err := msg.ThreadID()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.machine.LockThread(thID), nil
+}
+
 func (s *Service) doHandle(msg *service.DIDCommMsg, outbound bool) (*metaData, error) {
 	thID, err := msg.ThreadID()
 	if err != nil {
@@ -210,8 +280,8 @@ func (s *Service) doHandle(msg *service.DIDCommMsg, outbound bool) (*metaData, e
 
 	logger.Infof("state will transition from %q to %q if the msgType is processed", current.Name(), next.Name())
 
-	if !current.CanTransitionTo(next) {
-		return nil, fmt.Errorf("invalid state transition: %s -> %s", current.Name(), next.Name())
+	if err := statemachine.ValidateTransition(current, next); err != nil {
+		return nil, err
 	}
 
 	logger.Infof("sent pre event for state %s", next.Name())
@@ -226,29 +296,78 @@ func (s *Service) doHandle(msg *service.DIDCommMsg, outbound bool) (*metaData, e
 	}, nil
 }
 
-// HandleInbound handles inbound message (introduce protocol)
+// HandleInbound handles inbound message (introduce protocol). The message is validated against the current state
+// of the thread, then it is processed by the worker pool of the service after the call returns.
 func (s *Service) HandleInbound(msg *service.DIDCommMsg) (string, error) {
+	return s.HandleInboundContext(context.Background(), msg)
+}
+
+// HandleInboundContext handles the inbound message like HandleInbound, the states of the thread are traced
+// in the child spans of the span in the context.
+func (s *Service) HandleInboundContext(ctx context.Context, msg *service.DIDCommMsg) (string, error) {
 	aEvent := s.ActionEvent()
 
+	// the type switches of the service match the canonical types of the supported version only
+	msgtype.NormalizeMsg(msg)
+	msgtype.NegotiateMsg(msg, s.Protocols())
+
 	logger.Infof("entered into HandleInbound: %v", msg.Header)
 	// throw error if there is no action event registered for inbound messages
 	if aEvent == nil {
 		return "", errors.New("no clients are registered to handle the message")
 	}
 
+	// serialize the transitions of the thread, the lock is released once the message is processed
+	unlock, err := s.lockThread(msg)
+	if err != nil {
+		return "", err
+	}
+
 	mData, err := s.doHandle(msg, false)
 	if err != nil {
+		unlock()
 		return "", err
 	}
 
+	// the processing outlives the inbound request, only its trace is continued
+	goCtx := trace.Detach(ctx)
+
+	// the message is rejected if the pool is full, the sender is asked to retry later
+	err = s.pool.Submit(func() {
+		defer unlock()
+
+		if err := s.process(goCtx, mData); err != nil {
+			logger.Errorf("introduce processing error : %s", err)
+		}
+	})
+	if err != nil {
+		unlock()
+		return "", fmt.Errorf("handle inbound: %w", err)
+	}
+
+	return "", nil
+}
+
+// process triggers the action event of the inbound message or continues the execution of the thread.
+func (s *Service) process(ctx context.Context, mData *metaData) error {
 	// trigger action event based on message type for inbound messages
-	if canTriggerActionEvents(msg) {
-		aEvent <- s.newDIDCommActionMsg(mData)
-		return "", nil
+	if canTriggerActionEvents(mData.Msg) {
+		cb := newCallback(mData)
+
+		action, err := s.newAction(cb)
+		if err != nil {
+			return err
+		}
+
+		// the delivery is abandoned once the service is stopped, the action event none of the subscribers
+		// owns is re-emitted to the next owner
+		s.PublishActionEvent(action)
+
+		return nil
 	}
 
 	// if no action event is triggered, continue the execution
-	return "", s.handle(mData, nil)
+	return s.handle(ctx, mData, nil)
 }
 
 func (s *Service) sendRequest(msg *service.DIDCommMsg, dest *service.Destination) error {
@@ -264,54 +383,51 @@ func (s *Service) HandleOutbound(msg *service.DIDCommMsg, dest *service.Destinat
 		return s.sendRequest(msg, dest)
 	}
 
+	unlock, err := s.lockThread(msg)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
 	mData, err := s.doHandle(msg, true)
 	if err != nil {
 		return err
 	}
 
-	return s.handle(mData, dest)
+	return s.handle(context.Background(), mData, dest)
 }
 
-// sendMsgEvents triggers the message events.
-func (s *Service) sendMsgEvents(msg *service.StateMsg) {
-	// trigger the message events
-	for _, handler := range s.MsgEvents() {
-		handler <- *msg
-	}
+// newCallback creates the callback of the action event. The thread is resumed by the callback listener once
+// the consumer continued the action event with the dependency.
+func newCallback(msg *metaData) *statemachine.Callback {
+	return &statemachine.Callback{ThreadID: msg.ThreadID, Msg: msg.Msg, Data: msg}
 }
 
-// sendActionEvent triggers the action event. This function stores the state of current processing and passes a callback
-// function in the event message.
-func (s *Service) newDIDCommActionMsg(msg *metaData) service.DIDCommAction {
-	// create the message for the channel
-	// trigger the registered action event
-	return service.DIDCommAction{
-		ProtocolName: Introduce,
-		Message:      msg.Msg.Clone(),
-		Continue: func(args interface{}) {
-			// there is no way to receive another interface
-			if dep, ok := args.(InvitationEnvelope); ok {
-				msg.dependency = dep
-				s.processCallback(msg)
-				return
-			}
-
-			// sets an error to the message
-			msg.err = errors.New("action dependency is missing")
-			s.processCallback(msg)
-		},
-		Stop: func(err error) {
-			// sets an error to the message
-			msg.err = err
-			s.processCallback(msg)
-		},
+func (s *Service) newAction(cb *statemachine.Callback) (service.DIDCommAction, error) {
+	msg, ok := cb.Data.(*metaData)
+	if !ok {
+		return service.DIDCommAction{}, errors.New("invalid callback data")
 	}
-}
 
-func (s *Service) processCallback(msg *metaData) {
-	// pass the callback data to internal channel. This is created to unblock consumer go routine and wrap the callback
-	// channel internally.
-	s.callbacks <- msg
+	action, err := s.machine.NewAction(cb, nil, func(args interface{}) error {
+		// there is no way to receive another interface
+		dep, ok := args.(InvitationEnvelope)
+		if !ok {
+			return errors.New("action dependency is missing")
+		}
+
+		msg.dependency = dep
+
+		return nil
+	})
+	if err != nil {
+		return service.DIDCommAction{}, err
+	}
+
+	action.StateID = msg.StateName
+
+	return action, nil
 }
 
 func nextState(msg *service.DIDCommMsg, rec *record, outbound bool) (state, error) {
@@ -342,7 +458,9 @@ func nextState(msg *service.DIDCommMsg, rec *record, outbound bool) (state, erro
 }
 
 func (s *Service) currentStateRecord(thID string) (*record, error) {
-	src, err := s.store.Get(thID)
+	var r *record
+
+	err := s.store.Get(thID, &r)
 	if errors.Is(err, storage.ErrDataNotFound) {
 		return &record{
 			StateName: stateNameStart,
@@ -351,11 +469,6 @@ func (s *Service) currentStateRecord(thID string) (*record, error) {
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("cannot fetch state from store: thid=%s err=%s", thID, err)
-	}
-
-	var r *record
-	if err := json.Unmarshal(src, &r); err != nil {
 		return nil, err
 	}
 
@@ -363,39 +476,7 @@ func (s *Service) currentStateRecord(thID string) (*record, error) {
 }
 
 func (s *Service) save(id string, data interface{}) error {
-	src, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("service save: %w", err)
-	}
-
-	return s.store.Put(id, src)
-}
-
-// nolint: gocyclo
-// stateFromName returns the state by given name.
-func stateFromName(name string) (state, error) {
-	switch name {
-	case stateNameNoop:
-		return &noOp{}, nil
-	case stateNameStart:
-		return &start{}, nil
-	case stateNameDone:
-		return &done{}, nil
-	case stateNameArranging:
-		return &arranging{}, nil
-	case stateNameDelivering:
-		return &delivering{}, nil
-	case stateNameConfirming:
-		return &confirming{}, nil
-	case stateNameAbandoning:
-		return &abandoning{}, nil
-	case stateNameDeciding:
-		return &deciding{}, nil
-	case stateNameWaiting:
-		return &waiting{}, nil
-	default:
-		return nil, fmt.Errorf("invalid state name %s", name)
-	}
+	return s.store.Save(id, data)
 }
 
 // canTriggerActionEvents checks if the incoming message can trigger an action event
@@ -404,12 +485,7 @@ func canTriggerActionEvents(msg *service.DIDCommMsg) bool {
 	return msg.Header.Type == ProposalMsgType || msg.Header.Type == ResponseMsgType
 }
 
-func isNoOp(s state) bool {
-	_, ok := s.(*noOp)
-	return ok
-}
-
-func (s *Service) handle(msg *metaData, dest *service.Destination) error {
+func (s *Service) handle(ctx context.Context, msg *metaData, dest *service.Destination) error {
 	logger.Infof("entered into private handle message: %v ", msg.Msg.Header)
 	// if we got one destination value, this is definitely skip proposal
 	if msg.dependency != nil && len(msg.dependency.Destinations()) == 1 {
@@ -423,53 +499,45 @@ func (s *Service) handle(msg *metaData, dest *service.Destination) error {
 
 	logger.Infof("next valid state to transition -> %s ", next.Name())
 
-	for !isNoOp(next) {
-		s.sendMsgEvents(&service.StateMsg{
-			ProtocolName: Introduce,
-			Type:         service.PreState,
-			Msg:          msg.Msg.Clone(),
-			StateID:      next.Name(),
+	return s.machine.RunContext(ctx, msg.Msg, next, nil,
+		func(stateCtx context.Context, current statemachine.State) (*statemachine.Transition, error) {
+			return s.execute(stateCtx, current.(state), msg, dest)
 		})
-		logger.Infof("sent pre event for state %s", next.Name())
-
-		var (
-			followup state
-			err      error
-		)
-
-		if dest != nil {
-			followup, err = next.ExecuteOutbound(s.ctx, msg, dest)
-		} else {
-			followup, err = next.ExecuteInbound(s.ctx, msg)
-		}
-
-		if err != nil {
-			return fmt.Errorf("execute state %s %w", next.Name(), err)
-		}
-
-		logger.Infof("finish execute next state: %s", next.Name())
+}
 
-		if err = s.save(msg.ThreadID, record{
-			StateName: next.Name(),
-			WaitCount: msg.WaitCount,
-		}); err != nil {
-			return fmt.Errorf("failed to persist state %s %w", next.Name(), err)
-		}
+// execute executes the state and persists the thread record, the messages of the state are sent in the given context.
+func (s *Service) execute(goCtx context.Context, next state, msg *metaData,
+	dest *service.Destination) (*statemachine.Transition, error) {
+	var (
+		followup state
+		err      error
+	)
+
+	ctx := s.ctx
+	ctx.goCtx = goCtx
+
+	if dest != nil {
+		followup, err = next.ExecuteOutbound(ctx, msg, dest)
+	} else {
+		followup, err = next.ExecuteInbound(ctx, msg)
+	}
 
-		logger.Infof("persisted the connection using %s and updated the state to %s", msg.ThreadID, next.Name())
+	if err != nil {
+		return nil, fmt.Errorf("execute state %s %w", next.Name(), err)
+	}
 
-		s.sendMsgEvents(&service.StateMsg{
-			ProtocolName: Introduce,
-			Type:         service.PostState,
-			Msg:          msg.Msg.Clone(),
-			StateID:      next.Name(),
-		})
-		logger.Infof("sent post event for state %s", next.Name())
+	logger.Infof("finish execute next state: %s", next.Name())
 
-		next = followup
+	if err = s.save(msg.ThreadID, record{
+		StateName: next.Name(),
+		WaitCount: msg.WaitCount,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to persist state %s %w", next.Name(), err)
 	}
 
-	return nil
+	logger.Infof("persisted the connection using %s and updated the state to %s", msg.ThreadID, next.Name())
+
+	return &statemachine.Transition{Followup: followup}, nil
 }
 
 // Name returns service name
@@ -477,9 +545,14 @@ func (s *Service) Name() string {
 	return Introduce
 }
 
+// Protocols returns the supported versions of the introduce protocol.
+func (s *Service) Protocols() []string {
+	return []string{strings.TrimSuffix(IntroduceSpec, "/")}
+}
+
 // Accept msg checks the msg type
 func (s *Service) Accept(msgType string) bool {
-	switch msgType {
+	switch msgtype.Normalize(msgType) {
 	case ProposalMsgType, RequestMsgType, ResponseMsgType, AckMsgType:
 		return true
 	}
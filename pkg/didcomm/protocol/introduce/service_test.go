@@ -7,9 +7,11 @@ SPDX-License-Identifier: Apache-2.0
 package introduce
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,11 +19,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
 	dispatcherMocks "github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher/gomocks"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
 	mocks "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/introduce/gomocks"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 	storageMocks "github.com/hyperledger/aries-framework-go/pkg/storage/gomocks"
 )
@@ -89,7 +95,7 @@ func TestService_handle(t *testing.T) {
 
 		defer stop(t, svc)
 
-		require.EqualError(t, svc.handle(&metaData{
+		require.EqualError(t, svc.handle(context.Background(), &metaData{
 			Msg: &service.DIDCommMsg{},
 		}, nil), "state from name: invalid state name ")
 	})
@@ -104,6 +110,7 @@ func TestService_handle(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
@@ -142,7 +149,7 @@ func TestService_handle(t *testing.T) {
 			}
 		}()
 
-		require.NoError(t, svc.handle(&metaData{
+		require.NoError(t, svc.handle(context.Background(), &metaData{
 			record:   record{StateName: stateNameStart},
 			Msg:      &service.DIDCommMsg{},
 			ThreadID: "ID",
@@ -175,10 +182,11 @@ func TestService_abandon(t *testing.T) {
 	defer ctrl.Finish()
 
 	store := storageMocks.NewMockStore(ctrl)
-	store.EXPECT().Put("ID", []byte(`{}`)).Return(errors.New(errMsg))
+	store.EXPECT().Put("ID", []byte(`{"StateName":"abandoning","WaitCount":0}`)).Return(errors.New(errMsg))
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+	expectPending(store)
 
 	provider := mocks.NewMockProvider(ctrl)
 	provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -236,7 +244,7 @@ func TestService_Action(t *testing.T) {
 
 	// register action event
 	require.Nil(t, svc.RegisterActionEvent(ch))
-	require.Equal(t, ch, svc.ActionEvent())
+	require.NotNil(t, svc.ActionEvent())
 
 	// unregister action event
 	require.Nil(t, svc.UnregisterActionEvent(ch))
@@ -302,6 +310,7 @@ func TestService_HandleOutbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -326,6 +335,7 @@ func TestService_HandleOutbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -353,6 +363,7 @@ func TestService_HandleOutbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
@@ -403,10 +414,11 @@ func TestService_HandleInboundStop(t *testing.T) {
 
 	store := storageMocks.NewMockStore(ctrl)
 	store.EXPECT().Get(gomock.Any()).Return(nil, storage.ErrDataNotFound).Times(1)
-	store.EXPECT().Put("ID", []byte(`{}`)).Return(nil)
+	store.EXPECT().Put("ID", []byte(`{"StateName":"abandoning","WaitCount":0}`)).Return(nil)
 
 	storageProvider := storageMocks.NewMockProvider(ctrl)
 	storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+	expectPending(store)
 
 	provider := mocks.NewMockProvider(ctrl)
 	provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -501,6 +513,7 @@ func TestService_HandleInbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -528,6 +541,7 @@ func TestService_HandleInbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -559,6 +573,7 @@ func TestService_HandleInbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -585,6 +600,7 @@ func TestService_HandleInbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -608,10 +624,11 @@ func TestService_HandleInbound(t *testing.T) {
 
 		store := storageMocks.NewMockStore(ctrl)
 		store.EXPECT().Get("ID").Return(nil, storage.ErrDataNotFound)
-		store.EXPECT().Put("ID", []byte(`{}`)).Return(nil)
+		store.EXPECT().Put("ID", []byte(`{"StateName":"abandoning","WaitCount":0}`)).Return(nil)
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -647,6 +664,7 @@ func TestService_HandleInbound(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -686,6 +704,8 @@ func TestService_Accept(t *testing.T) {
 	require.True(t, svc.Accept(RequestMsgType))
 	require.True(t, svc.Accept(ResponseMsgType))
 	require.True(t, svc.Accept(AckMsgType))
+	require.True(t, svc.Accept("did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/introduce/1.0/proposal"))
+	require.Equal(t, []string{"https://didcomm.org/introduce/1.0"}, svc.Protocols())
 }
 
 func Test_stateFromName(t *testing.T) {
@@ -739,6 +759,7 @@ func TestService_save(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		provider := mocks.NewMockProvider(ctrl)
 		provider.EXPECT().StorageProvider().Return(storageProvider)
@@ -805,6 +826,7 @@ func TestService_Proposal(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
@@ -898,6 +920,7 @@ func TestService_Proposal(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
@@ -980,6 +1003,7 @@ func TestService_SkipProposal(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
@@ -1051,6 +1075,7 @@ func TestService_SkipProposal(t *testing.T) {
 
 		storageProvider := storageMocks.NewMockProvider(ctrl)
 		storageProvider.EXPECT().OpenStore(Introduce).Return(store, nil)
+		expectPending(store)
 
 		dispatcher := dispatcherMocks.NewMockOutbound(ctrl)
 		dispatcher.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
@@ -1139,6 +1164,174 @@ type stopper interface {
 	Stop() error
 }
 
+func TestService_HandleInbound_WorkerPool(t *testing.T) {
+	pool := workerpool.New(Introduce, 1, 1)
+	defer pool.Stop()
+
+	svc, err := New(&poolProvider{storage: mockstorage.NewMockStoreProvider(), pool: pool})
+	require.NoError(t, err)
+
+	defer stop(t, svc)
+
+	// nobody reads the action events yet
+	ch := make(chan service.DIDCommAction)
+	require.NoError(t, svc.RegisterActionEvent(ch))
+
+	handle := func(thID string) error {
+		msg, e := service.NewDIDCommMsg([]byte(fmt.Sprintf(`{"@id":%q,"@type":%q}`, thID, ProposalMsgType)))
+		require.NoError(t, e)
+
+		_, e = svc.HandleInbound(msg)
+
+		return e
+	}
+
+	// the call returns while the worker waits for the action event to be read
+	require.NoError(t, handle("1"))
+
+	for pool.Metrics().Active != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	require.NoError(t, handle("2"))
+
+	// the sender is asked to retry later once the queue is full
+	err = handle("3")
+	require.True(t, errors.Is(err, workerpool.ErrQueueFull))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case action := <-ch:
+			action.Stop(errors.New("stop"))
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestService_Tracer(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+	outbound := &contextOutbound{}
+
+	svc, err := New(&tracingProvider{storage: mockstorage.NewMockStoreProvider(), tracer: tracer, outbound: outbound})
+	require.NoError(t, err)
+
+	defer stop(t, svc)
+
+	require.NoError(t, svc.RegisterActionEvent(make(chan service.DIDCommAction)))
+
+	t.Run("test inbound states traced in the span of the inbound message", func(t *testing.T) {
+		require.NoError(t, svc.save("thid", record{StateName: stateNameDelivering}))
+
+		ctx, parent := tracer.Start(context.Background(), trace.HandleInboundSpan)
+
+		msg, err := service.NewDIDCommMsg([]byte(`{"@id":"1","@type":"` + AckMsgType + `","~thread":{"thid":"thid"}}`))
+		require.NoError(t, err)
+
+		_, err = svc.HandleInboundContext(ctx, msg)
+		require.NoError(t, err)
+
+		// the message is processed after the call returns
+		for len(exporter.ThreadSpans("thid")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		spans := exporter.ThreadSpans("thid")
+		require.Equal(t, trace.StateSpan, spans[0].Name)
+		require.Equal(t, parent.SpanContext(), spans[0].Parent)
+
+		state, ok := spans[0].Attribute(trace.StateKey)
+		require.True(t, ok)
+		require.Equal(t, stateNameDone, state)
+	})
+
+	t.Run("test message sent in the span of the state", func(t *testing.T) {
+		msg, err := service.NewDIDCommMsg([]byte(`{"@id":"thid2","@type":"` + ProposalMsgType + `"}`))
+		require.NoError(t, err)
+
+		require.NoError(t, svc.HandleOutbound(msg, &service.Destination{}))
+		require.NotNil(t, outbound.ctx)
+		require.Equal(t, "thid2", trace.ThreadIDFromContext(outbound.ctx))
+
+		spans := exporter.ThreadSpans("thid2")
+		require.Len(t, spans, 1)
+		require.Equal(t, spans[0].SpanContext, trace.SpanFromContext(outbound.ctx).SpanContext())
+	})
+}
+
+type tracingProvider struct {
+	storage  storage.Provider
+	tracer   trace.Tracer
+	outbound dispatcher.Outbound
+}
+
+func (p *tracingProvider) OutboundDispatcher() dispatcher.Outbound {
+	return p.outbound
+}
+
+func (p *tracingProvider) StorageProvider() storage.Provider {
+	return p.storage
+}
+
+func (p *tracingProvider) Tracer() trace.Tracer {
+	return p.tracer
+}
+
+// contextOutbound keeps the context of the last sent message.
+type contextOutbound struct {
+	ctx context.Context
+}
+
+func (o *contextOutbound) Send(interface{}, string, *service.Destination) error {
+	return errors.New("not expected")
+}
+
+func (o *contextOutbound) SendContext(ctx context.Context, _ interface{}, _ string, _ *service.Destination) error {
+	o.ctx = ctx
+	return nil
+}
+
+type poolProvider struct {
+	storage storage.Provider
+	pool    *workerpool.Pool
+}
+
+func (p *poolProvider) OutboundDispatcher() dispatcher.Outbound {
+	return nil
+}
+
+func (p *poolProvider) StorageProvider() storage.Provider {
+	return p.storage
+}
+
+func (p *poolProvider) WorkerPool(name string) *workerpool.Pool {
+	if name == Introduce {
+		return p.pool
+	}
+
+	return nil
+}
+
 func stop(t *testing.T, s stopper) {
 	require.NoError(t, s.Stop())
 }
+
+// expectPending expects the pending action events to be restored and persisted.
+func expectPending(store *storageMocks.MockStore) {
+	store.EXPECT().Iterator("pending_", "pending_~").Return(mockstorage.NewMockIterator(nil))
+	store.EXPECT().Put(pendingKey{}, gomock.Any()).Return(nil).AnyTimes()
+	store.EXPECT().Delete(pendingKey{}).Return(nil).AnyTimes()
+}
+
+// pendingKey matches the keys of the pending action events.
+type pendingKey struct{}
+
+func (pendingKey) Matches(x interface{}) bool {
+	key, ok := x.(string)
+	return ok && strings.HasPrefix(key, "pending_")
+}
+
+func (pendingKey) String() string {
+	return "has prefix pending_"
+}
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package introduce
 
 import (
+	"context"
 	"errors"
 
 	"github.com/google/uuid"
@@ -14,11 +15,12 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/statemachine"
 )
 
 const (
 	// common states
-	stateNameNoop  = "noop"
+	stateNameNoop  = statemachine.StateNameNoop
 	stateNameStart = "start"
 	stateNameDone  = "done"
 
@@ -35,30 +37,46 @@ const (
 
 type internalContext struct {
 	dispatcher.Outbound
+	// goCtx is the context of the executed state, the messages are sent in the child span of the state
+	goCtx context.Context
+}
+
+// Send sends the message in the context of the executed state.
+func (c internalContext) Send(msg interface{}, senderVerKey string, des *service.Destination) error {
+	goCtx := c.goCtx
+	if goCtx == nil {
+		goCtx = context.Background()
+	}
+
+	return dispatcher.SendContext(goCtx, c.Outbound, msg, senderVerKey, des)
 }
 
 // The introduce protocol's state.
 type state interface {
-	// Name of this state.
-	Name() string
-	// Whether this state allows transitioning into the next state.
-	CanTransitionTo(next state) bool
+	statemachine.State
 	// Executes this state, returning a followup state to be immediately executed as well.
 	// The 'noOp' state should be returned if the state has no followup.
 	ExecuteInbound(ctx internalContext, msg *metaData) (followup state, err error)
 	ExecuteOutbound(ctx internalContext, msg *metaData, dest *service.Destination) (followup state, err error)
 }
 
-// noOp state
-type noOp struct {
-}
+// nolint: gochecknoglobals
+var states = statemachine.NewStates(&noOp{}, &start{}, &done{}, &arranging{}, &delivering{}, &confirming{},
+	&abandoning{}, &deciding{}, &waiting{})
+
+// stateFromName returns the state by given name.
+func stateFromName(name string) (state, error) {
+	st, err := states.FromName(name)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *noOp) Name() string {
-	return stateNameNoop
+	return st.(state), nil
 }
 
-func (s *noOp) CanTransitionTo(_ state) bool {
-	return false
+// noOp state
+type noOp struct {
+	statemachine.NoOp
 }
 
 func (s *noOp) ExecuteInbound(ctx internalContext, _ *metaData) (state, error) {
@@ -77,7 +95,7 @@ func (s *start) Name() string {
 	return stateNameStart
 }
 
-func (s *start) CanTransitionTo(next state) bool {
+func (s *start) CanTransitionTo(next statemachine.State) bool {
 	// Introducer can go to arranging or delivering state
 	// Introducee can go to deciding
 	return next.Name() == stateNameArranging || next.Name() == stateNameDeciding
@@ -99,7 +117,7 @@ func (s *done) Name() string {
 	return stateNameDone
 }
 
-func (s *done) CanTransitionTo(next state) bool {
+func (s *done) CanTransitionTo(next statemachine.State) bool {
 	// done is the last state there is no possibility for the next state
 	return false
 }
@@ -120,7 +138,7 @@ func (s *arranging) Name() string {
 	return stateNameArranging
 }
 
-func (s *arranging) CanTransitionTo(next state) bool {
+func (s *arranging) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameArranging || next.Name() == stateNameDone ||
 		next.Name() == stateNameAbandoning || next.Name() == stateNameDelivering
 }
@@ -149,7 +167,7 @@ func (s *delivering) Name() string {
 	return stateNameDelivering
 }
 
-func (s *delivering) CanTransitionTo(next state) bool {
+func (s *delivering) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameConfirming || next.Name() == stateNameDone || next.Name() == stateNameAbandoning
 }
 
@@ -170,7 +188,7 @@ func (s *confirming) Name() string {
 	return stateNameConfirming
 }
 
-func (s *confirming) CanTransitionTo(next state) bool {
+func (s *confirming) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameDone || next.Name() == stateNameAbandoning
 }
 
@@ -190,7 +208,7 @@ func (s *abandoning) Name() string {
 	return stateNameAbandoning
 }
 
-func (s *abandoning) CanTransitionTo(next state) bool {
+func (s *abandoning) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameDone
 }
 
@@ -210,7 +228,7 @@ func (s *deciding) Name() string {
 	return stateNameDeciding
 }
 
-func (s *deciding) CanTransitionTo(next state) bool {
+func (s *deciding) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameWaiting || next.Name() == stateNameDone
 }
 
@@ -235,7 +253,7 @@ func (s *waiting) Name() string {
 	return stateNameWaiting
 }
 
-func (s *waiting) CanTransitionTo(next state) bool {
+func (s *waiting) CanTransitionTo(next statemachine.State) bool {
 	return next.Name() == stateNameDone
 }
 
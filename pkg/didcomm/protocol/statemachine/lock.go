@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"sync"
+)
+
+// ThreadLocks serializes the processing of the messages which belong to the same thread.
+// Messages of different threads are processed concurrently.
+type ThreadLocks struct {
+	mutex sync.Mutex
+	locks map[string]*threadLock
+}
+
+type threadLock struct {
+	sync.Mutex
+	// refs is the number of goroutines holding or waiting for the lock
+	refs int
+}
+
+// NewThreadLocks returns new thread locks instance.
+func NewThreadLocks() *ThreadLocks {
+	return &ThreadLocks{locks: make(map[string]*threadLock)}
+}
+
+// Lock locks the given thread and returns the function which unlocks it.
+// Lock blocks until the thread is unlocked by the previous holder.
+func (l *ThreadLocks) Lock(thID string) (unlock func()) {
+	l.mutex.Lock()
+
+	lock, ok := l.locks[thID]
+	if !ok {
+		lock = &threadLock{}
+		l.locks[thID] = lock
+	}
+
+	lock.refs++
+	l.mutex.Unlock()
+
+	lock.Lock()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			lock.Unlock()
+
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+
+			// the lock is removed when nobody is waiting for it
+			lock.refs--
+			if lock.refs == 0 {
+				delete(l.locks, thID)
+			}
+		})
+	}
+}
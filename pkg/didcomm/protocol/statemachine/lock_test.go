@@ -0,0 +1,78 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadLocks(t *testing.T) {
+	const (
+		threads    = 10
+		goroutines = 50
+	)
+
+	locks := NewThreadLocks()
+	// counters are not synchronized, the thread locks protect them
+	counters := make([]int, threads)
+	// active keeps the number of goroutines processing the thread at the same time
+	active := make([]int, threads)
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		parallel bool
+	)
+
+	for i := 0; i < threads*goroutines; i++ {
+		wg.Add(1)
+
+		go func(th int) {
+			defer wg.Done()
+
+			unlock := locks.Lock(fmt.Sprintf("thread-%d", th))
+			defer unlock()
+
+			mutex.Lock()
+			active[th]++
+			parallel = parallel || active[th] > 1
+			mutex.Unlock()
+
+			counters[th]++
+
+			mutex.Lock()
+			active[th]--
+			mutex.Unlock()
+		}(i % threads)
+	}
+
+	wg.Wait()
+
+	require.False(t, parallel)
+
+	for i := range counters {
+		require.Equal(t, goroutines, counters[i])
+	}
+
+	require.Empty(t, locks.locks)
+}
+
+func TestThreadLocks_UnlockTwice(t *testing.T) {
+	locks := NewThreadLocks()
+
+	unlock := locks.Lock("thID")
+	unlock()
+	require.NotPanics(t, unlock)
+
+	// the thread can be locked again
+	locks.Lock("thID")()
+	require.Empty(t, locks.locks)
+}
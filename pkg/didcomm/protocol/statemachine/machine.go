@@ -0,0 +1,446 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+var logger = log.New("aries-framework/statemachine")
+
+// Callback is a protocol thread halted by an action event, it waits for the consumer to call Continue or Stop.
+type Callback struct {
+	// ID identifies the pending action event or callback, it is generated if empty.
+	ID       string
+	ThreadID string
+	Msg      *service.DIDCommMsg
+	// Data keeps the protocol specific data required to resume the thread.
+	Data interface{}
+	// Err is set when the consumer stopped the action event processing or resuming the thread failed.
+	Err error
+}
+
+// Transition is the outcome of executing a single state.
+type Transition struct {
+	// Followup state to be executed next. The NoOp state ends the execution.
+	Followup State
+	// Halt stops the execution after the post state event was sent,
+	// e.g an action event was triggered and the thread is resumed by the callback.
+	Halt bool
+	// Properties are passed to the post state event.
+	Properties service.EventProperties
+}
+
+// ExecuteFunc executes the state and persists the result. The context holds the span of the state and the thread ID,
+// the work of the state, e.g. the DID resolution and the sending, is traced in its child spans.
+type ExecuteFunc func(ctx context.Context, current State) (*Transition, error)
+
+// ResumeFunc continues the execution of a thread once the consumer continued the action event.
+type ResumeFunc func(cb *Callback) error
+
+// AbandonFunc moves the thread to the abandoned state of the protocol.
+type AbandonFunc func(thID string, msg *service.DIDCommMsg, err error) error
+
+// TransitionRecorder records the states the protocol threads moved to, typically the message history archive.
+type TransitionRecorder interface {
+	RecordTransition(protocol, state string, msg *service.DIDCommMsg, props service.EventProperties)
+}
+
+// msgEvents delivers the message events to the subscribers, typically service.Message.
+type msgEvents interface {
+	SendMsgEvent(msg service.StateMsg)
+}
+
+// Machine runs protocol states and provides the event plumbing shared by the protocol services:
+// message events around every executed state, action events and the worker pool which resumes
+// or abandons the threads halted by action events.
+type Machine struct {
+	protocol    string
+	events      msgEvents
+	resume      ResumeFunc
+	abandon     AbandonFunc
+	pool        *workerpool.Pool
+	ownPool     bool
+	pending     *PendingStore
+	tracer      trace.Tracer
+	recorder    TransitionRecorder
+	locks       *ThreadLocks
+	wg          sync.WaitGroup
+	stopCtx     context.Context
+	stop        context.CancelFunc
+	closedMutex sync.Mutex
+	closed      bool
+}
+
+// Option configures the Machine.
+type Option func(m *Machine)
+
+// WithCallbackBuffer sets the size of the callback queue of the single worker processing the callbacks.
+func WithCallbackBuffer(size int) Option {
+	return func(m *Machine) {
+		m.pool, m.ownPool = workerpool.New(m.protocol, 1, size), true
+	}
+}
+
+// WithWorkerPool processes the callbacks by the given pool, typically the pool of the protocol service.
+// The pool is shared, it is not stopped by the Machine.
+func WithWorkerPool(pool *workerpool.Pool) Option {
+	return func(m *Machine) {
+		if pool != nil {
+			m.pool, m.ownPool = pool, false
+		}
+	}
+}
+
+// WithPendingStore persists the pending action events and callbacks to the store,
+// the threads are restored by Machine.Restore after the agent restart.
+func WithPendingStore(store storage.Store) Option {
+	return func(m *Machine) {
+		if store != nil {
+			m.pending = NewPendingStore(store)
+		}
+	}
+}
+
+// WithTracer traces the execution of every state in the child span of the span passed to RunContext.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(m *Machine) {
+		if tracer != nil {
+			m.tracer = tracer
+		}
+	}
+}
+
+// WithTransitionRecorder records every executed state with the transition properties.
+func WithTransitionRecorder(recorder TransitionRecorder) Option {
+	return func(m *Machine) {
+		m.recorder = recorder
+	}
+}
+
+// New returns a new Machine. By default the callbacks are processed one by one by the single worker.
+func New(protocol string, events msgEvents, resume ResumeFunc, abandon AbandonFunc, opts ...Option) *Machine {
+	m := &Machine{
+		protocol: protocol,
+		events:   events,
+		resume:   resume,
+		abandon:  abandon,
+		tracer:   trace.Noop,
+		locks:    NewThreadLocks(),
+	}
+
+	m.stopCtx, m.stop = context.WithCancel(context.Background())
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.pool == nil {
+		m.pool, m.ownPool = workerpool.New(protocol, 1, 0), true
+	}
+
+	return m
+}
+
+// Run executes the states starting with next until the NoOp state is reached or the execution is halted.
+// The pre state event is sent with the given properties, the post state event uses the transition properties.
+func (m *Machine) Run(msg *service.DIDCommMsg, next State, props service.EventProperties, execute ExecuteFunc) error {
+	return m.RunContext(context.Background(), msg, next, props, execute)
+}
+
+// RunContext executes the states like Run, every state is executed in the child span of the span in the context.
+// The context passed to ExecuteFunc is done when the given context is done.
+func (m *Machine) RunContext(ctx context.Context, msg *service.DIDCommMsg, next State,
+	props service.EventProperties, execute ExecuteFunc) error {
+	for !IsNoOp(next) {
+		transition, err := m.runState(ctx, msg, next, props, execute)
+		if err != nil {
+			return err
+		}
+
+		if transition.Halt {
+			break
+		}
+
+		props = transition.Properties
+		next = transition.Followup
+	}
+
+	return nil
+}
+
+// runState executes the state between the pre and post state events.
+func (m *Machine) runState(ctx context.Context, msg *service.DIDCommMsg, current State,
+	props service.EventProperties, execute ExecuteFunc) (*Transition, error) {
+	thID, _ := msg.ThreadID()
+
+	ctx, span := m.tracer.Start(trace.ContextWithThreadID(ctx, thID), trace.StateSpan, trace.WithAttributes(
+		trace.String(trace.ServiceKey, m.protocol),
+		trace.String(trace.StateKey, current.Name()),
+		trace.String(trace.ThreadIDKey, thID)))
+	defer span.End()
+
+	m.SendMsgEvents(&service.StateMsg{
+		ProtocolName: m.protocol,
+		Type:         service.PreState,
+		Msg:          msg.Clone(),
+		StateID:      current.Name(),
+		Properties:   props,
+	})
+	logger.Debugf("sent pre event for state %s", current.Name())
+
+	transition, err := execute(ctx, current)
+	if err != nil {
+		span.RecordError(err)
+
+		return nil, err
+	}
+
+	m.SendMsgEvents(&service.StateMsg{
+		ProtocolName: m.protocol,
+		Type:         service.PostState,
+		Msg:          msg.Clone(),
+		StateID:      current.Name(),
+		Properties:   transition.Properties,
+	})
+	logger.Debugf("sent post event for state %s", current.Name())
+
+	if m.recorder != nil {
+		m.recorder.RecordTransition(m.protocol, current.Name(), msg, transition.Properties)
+	}
+
+	return transition, nil
+}
+
+// LockThread serializes the state transitions of the thread, it returns the function which unlocks the thread.
+// The lock must be held while the current state is read, executed and persisted.
+func (m *Machine) LockThread(thID string) (unlock func()) {
+	return m.locks.Lock(thID)
+}
+
+// SendMsgEvents triggers the message events.
+func (m *Machine) SendMsgEvents(msg *service.StateMsg) {
+	m.events.SendMsgEvent(*msg)
+}
+
+// NewAction creates the action event for the halted thread. Continue passes the consumer arguments
+// to onContinue and queues the thread to be resumed, an error returned by onContinue abandons the thread.
+// Stop queues the thread to be abandoned. The action event is persisted if the pending store is configured.
+func (m *Machine) NewAction(cb *Callback, props service.EventProperties,
+	onContinue func(args interface{}) error) (service.DIDCommAction, error) {
+	if cb.ID == "" {
+		cb.ID = uuid.New().String()
+	}
+
+	if err := m.savePending(cb, PendingAction); err != nil {
+		return service.DIDCommAction{}, fmt.Errorf("new action: %w", err)
+	}
+
+	return service.DIDCommAction{
+		ProtocolName: m.protocol,
+		Message:      cb.Msg.Clone(),
+		Continue: func(args interface{}) {
+			if onContinue != nil {
+				cb.Err = onContinue(args)
+			}
+
+			m.queueCallback(cb)
+		},
+		Stop: func(err error) {
+			if err == nil {
+				err = errors.New("action was stopped")
+			}
+
+			cb.Err = err
+			m.queueCallback(cb)
+		},
+		Properties: props,
+	}, nil
+}
+
+// Pending returns the pending action events and callbacks with the given status, e.g PendingAction.
+func (m *Machine) Pending(status string) ([]*Pending, error) {
+	if m.pending == nil {
+		return nil, nil
+	}
+
+	return m.pending.List(status)
+}
+
+// Restore restores the threads which were halted before the agent restart. The data function decodes
+// the protocol specific callback data. The queued callbacks are processed by the callback listener,
+// the callbacks of the pending action events are returned, the protocol re-emits the action events.
+// The data function might reset the status to PendingAction if the callback can't be processed without
+// the consumer, e.g the arguments passed to the Continue function are not persisted.
+func (m *Machine) Restore(data func(p *Pending) (interface{}, error)) ([]*Callback, error) {
+	pending, err := m.Pending("")
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+
+	var actions, callbacks []*Callback
+
+	for _, p := range pending {
+		cb := &Callback{ID: p.ID, ThreadID: p.ThreadID, Msg: p.Msg}
+
+		cb.Data, err = data(p)
+		if err != nil {
+			return nil, fmt.Errorf("restore: %w", err)
+		}
+
+		if p.Status == PendingAction {
+			actions = append(actions, cb)
+			continue
+		}
+
+		if p.Err != "" {
+			cb.Err = errors.New(p.Err)
+		}
+
+		callbacks = append(callbacks, cb)
+	}
+
+	if len(callbacks) > 0 {
+		// queued callbacks are processed in the background, the listener might be busy
+		go func() {
+			for _, cb := range callbacks {
+				m.ProcessCallback(cb)
+			}
+		}()
+	}
+
+	return actions, nil
+}
+
+// DiscardPending deletes the pending action event, e.g the thread was resumed by the protocol API
+// instead of the action event.
+func (m *Machine) DiscardPending(id string) error {
+	return m.deletePending(id)
+}
+
+// queueCallback persists the callback before it is passed to the internal listener.
+func (m *Machine) queueCallback(cb *Callback) {
+	if err := m.savePending(cb, PendingCallback); err != nil {
+		logger.Errorf("save pending callback: %s", err)
+	}
+
+	m.ProcessCallback(cb)
+}
+
+func (m *Machine) savePending(cb *Callback, status string) error {
+	// callbacks without ID are not persisted, e.g they were not created by NewAction
+	if m.pending == nil || cb.ID == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cb.Data)
+	if err != nil {
+		return fmt.Errorf("marshal callback data: %w", err)
+	}
+
+	p := &Pending{ID: cb.ID, ThreadID: cb.ThreadID, Status: status, Msg: cb.Msg, Data: data}
+
+	if cb.Err != nil {
+		p.Err = cb.Err.Error()
+	}
+
+	return m.pending.Save(p)
+}
+
+func (m *Machine) deletePending(id string) error {
+	if m.pending == nil || id == "" {
+		return nil
+	}
+
+	return m.pending.Delete(id)
+}
+
+// ProcessCallback queues the callback to the worker pool, it blocks until the callback is queued.
+// The callbacks queued after the Machine was stopped are dropped, the persisted ones are restored
+// after the agent restart.
+func (m *Machine) ProcessCallback(cb *Callback) {
+	m.closedMutex.Lock()
+
+	if m.closed {
+		m.closedMutex.Unlock()
+		logger.Warnf("the %s callback %s was dropped: the machine was stopped", m.protocol, cb.ID)
+
+		return
+	}
+
+	m.wg.Add(1)
+	m.closedMutex.Unlock()
+
+	err := m.pool.SubmitWait(m.stopCtx, func() {
+		defer m.wg.Done()
+
+		m.handleCallback(cb)
+	})
+	if err != nil {
+		m.wg.Done()
+		logger.Warnf("the %s callback %s was dropped: %s", m.protocol, cb.ID, err)
+	}
+}
+
+// Stop stops processing the callbacks, it waits until the queued callbacks are processed.
+func (m *Machine) Stop() error {
+	m.closedMutex.Lock()
+
+	if m.closed {
+		m.closedMutex.Unlock()
+
+		return errors.New("server was already stopped")
+	}
+
+	m.closed = true
+	m.stop()
+	m.closedMutex.Unlock()
+
+	m.wg.Wait()
+
+	if m.ownPool {
+		m.pool.Stop()
+	}
+
+	logger.Infof("the %s callback processing was stopped", m.protocol)
+
+	return nil
+}
+
+func (m *Machine) handleCallback(cb *Callback) {
+	defer func() {
+		if err := m.deletePending(cb.ID); err != nil {
+			logger.Errorf("delete processed callback: %s", err)
+		}
+	}()
+
+	// if no error - resume the thread
+	if cb.Err == nil {
+		cb.Err = m.resume(cb)
+	}
+
+	// no error - continue
+	if cb.Err == nil {
+		return
+	}
+
+	if err := m.abandon(cb.ThreadID, cb.Msg, cb.Err); err != nil {
+		logger.Errorf("process callback : %s", err)
+	}
+}
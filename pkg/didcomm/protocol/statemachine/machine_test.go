@@ -0,0 +1,453 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+)
+
+type msgEventsFunc func() []chan<- service.StateMsg
+
+func (f msgEventsFunc) SendMsgEvent(msg service.StateMsg) {
+	for _, ch := range f() {
+		ch <- msg
+	}
+}
+
+func newMachine(t *testing.T, events chan service.StateMsg, resume ResumeFunc, abandon AbandonFunc) *Machine {
+	m := New("test", msgEventsFunc(func() []chan<- service.StateMsg {
+		if events == nil {
+			return nil
+		}
+
+		return []chan<- service.StateMsg{events}
+	}), resume, abandon, WithCallbackBuffer(1))
+	require.NotNil(t, m)
+
+	return m
+}
+
+func stop(t *testing.T, m *Machine) {
+	require.NoError(t, m.Stop())
+}
+
+func newAction(t *testing.T, m *Machine, cb *Callback, onContinue func(args interface{}) error) service.DIDCommAction {
+	action, err := m.NewAction(cb, nil, onContinue)
+	require.NoError(t, err)
+
+	return action
+}
+
+func TestMachine_Run(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+	start := &testState{name: "start"}
+	done := &testState{name: "done"}
+
+	t.Run("executes states until noop", func(t *testing.T) {
+		events := make(chan service.StateMsg, 10)
+		m := newMachine(t, events, nil, nil)
+		defer stop(t, m)
+
+		var executed []string
+
+		err := m.Run(msg, start, service.EventProperties(nil), func(_ context.Context, current State) (*Transition, error) {
+			executed = append(executed, current.Name())
+
+			if current.Name() == start.Name() {
+				return &Transition{Followup: done}, nil
+			}
+
+			return &Transition{Followup: &NoOp{}}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"start", "done"}, executed)
+
+		close(events)
+
+		var received []service.StateMsg
+		for e := range events {
+			require.Equal(t, "test", e.ProtocolName)
+			require.Equal(t, "ID", e.Msg.Header.ID)
+			received = append(received, e)
+		}
+
+		require.Len(t, received, 4)
+		require.Equal(t, service.PreState, received[0].Type)
+		require.Equal(t, "start", received[0].StateID)
+		require.Equal(t, service.PostState, received[3].Type)
+		require.Equal(t, "done", received[3].StateID)
+	})
+
+	t.Run("halt", func(t *testing.T) {
+		m := newMachine(t, nil, nil, nil)
+		defer stop(t, m)
+
+		var executed int
+
+		err := m.Run(msg, start, nil, func(_ context.Context, current State) (*Transition, error) {
+			executed++
+			return &Transition{Followup: done, Halt: true}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, executed)
+	})
+
+	t.Run("execute error", func(t *testing.T) {
+		m := newMachine(t, nil, nil, nil)
+		defer stop(t, m)
+
+		err := m.Run(msg, start, nil, func(_ context.Context, current State) (*Transition, error) {
+			return nil, errors.New("execute error")
+		})
+		require.EqualError(t, err, "execute error")
+	})
+}
+
+func TestMachine_RunContext(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID", Thread: decorator.Thread{ID: "thid"}}}
+	start := &testState{name: "start"}
+	done := &testState{name: "done"}
+
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+
+	m := New("test", msgEventsFunc(func() []chan<- service.StateMsg { return nil }), nil, nil, WithTracer(tracer))
+	defer stop(t, m)
+
+	ctx, parent := tracer.Start(context.Background(), trace.HandleInboundSpan)
+
+	var stateSpans []trace.Span
+
+	err := m.RunContext(ctx, msg, start, nil, func(stateCtx context.Context, current State) (*Transition, error) {
+		// the work of the state is traced in the child spans of the state span
+		stateSpans = append(stateSpans, trace.SpanFromContext(stateCtx))
+		require.Equal(t, "thid", trace.ThreadIDFromContext(stateCtx))
+
+		if current.Name() == start.Name() {
+			return &Transition{Followup: done}, nil
+		}
+
+		return nil, errors.New("execute error")
+	})
+	require.EqualError(t, err, "execute error")
+
+	parent.End()
+
+	spans := exporter.ThreadSpans("thid")
+	require.Len(t, spans, 2)
+
+	for i, name := range []string{"start", "done"} {
+		require.Equal(t, trace.StateSpan, spans[i].Name)
+		require.Equal(t, parent.SpanContext(), spans[i].Parent)
+		require.Equal(t, stateSpans[i].SpanContext(), spans[i].SpanContext)
+
+		state, ok := spans[i].Attribute(trace.StateKey)
+		require.True(t, ok)
+		require.Equal(t, name, state)
+
+		protocol, ok := spans[i].Attribute(trace.ServiceKey)
+		require.True(t, ok)
+		require.Equal(t, "test", protocol)
+	}
+
+	require.Empty(t, spans[0].Errors)
+	require.Equal(t, []string{"execute error"}, spans[1].Errors)
+}
+
+func TestMachine_WithTransitionRecorder(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+	start := &testState{name: "start"}
+	done := &testState{name: "done"}
+
+	recorder := &transitionRecorder{}
+
+	m := New("test", msgEventsFunc(func() []chan<- service.StateMsg { return nil }), nil, nil,
+		WithTransitionRecorder(recorder))
+	defer stop(t, m)
+
+	props := service.EventProperties(nil)
+
+	err := m.Run(msg, start, props, func(_ context.Context, current State) (*Transition, error) {
+		if current.Name() == start.Name() {
+			return &Transition{Followup: done}, nil
+		}
+
+		if current.Name() == done.Name() {
+			return &Transition{Followup: &NoOp{}}, nil
+		}
+
+		return nil, errors.New("unexpected state")
+	})
+	require.NoError(t, err)
+
+	// the failed states are not recorded
+	err = m.Run(msg, start, props, func(_ context.Context, current State) (*Transition, error) {
+		return nil, errors.New("execute error")
+	})
+	require.EqualError(t, err, "execute error")
+
+	require.Equal(t, []string{"test:start", "test:done"}, recorder.states)
+}
+
+func TestMachine_NewAction(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+
+	t.Run("continue resumes the thread", func(t *testing.T) {
+		resumed := make(chan *Callback)
+		m := newMachine(t, nil, func(cb *Callback) error {
+			resumed <- cb
+			return nil
+		}, nil)
+		defer stop(t, m)
+
+		action := newAction(t, m, &Callback{ThreadID: "thID", Msg: msg, Data: "data"}, func(args interface{}) error {
+			require.Equal(t, "args", args)
+			return nil
+		})
+		require.Equal(t, "test", action.ProtocolName)
+
+		action.Continue("args")
+
+		select {
+		case cb := <-resumed:
+			require.Equal(t, "thID", cb.ThreadID)
+			require.Equal(t, "data", cb.Data)
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+	})
+
+	t.Run("stop abandons the thread", func(t *testing.T) {
+		abandoned := make(chan error)
+		m := newMachine(t, nil, nil, func(thID string, _ *service.DIDCommMsg, err error) error {
+			require.Equal(t, "thID", thID)
+			abandoned <- err
+
+			return nil
+		})
+		defer stop(t, m)
+
+		newAction(t, m, &Callback{ThreadID: "thID", Msg: msg}, nil).Stop(errors.New("stop error"))
+
+		select {
+		case err := <-abandoned:
+			require.EqualError(t, err, "stop error")
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+
+		newAction(t, m, &Callback{ThreadID: "thID", Msg: msg}, nil).Stop(nil)
+
+		select {
+		case err := <-abandoned:
+			require.EqualError(t, err, "action was stopped")
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+	})
+
+	t.Run("continue and resume errors abandon the thread", func(t *testing.T) {
+		abandoned := make(chan error)
+		m := newMachine(t, nil, func(cb *Callback) error {
+			return errors.New("resume error")
+		}, func(_ string, _ *service.DIDCommMsg, err error) error {
+			abandoned <- err
+			return errors.New("abandon error")
+		})
+		defer stop(t, m)
+
+		newAction(t, m, &Callback{Msg: msg}, func(args interface{}) error {
+			return errors.New("continue error")
+		}).Continue(nil)
+
+		select {
+		case err := <-abandoned:
+			require.EqualError(t, err, "continue error")
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+
+		newAction(t, m, &Callback{Msg: msg}, nil).Continue(nil)
+
+		select {
+		case err := <-abandoned:
+			require.EqualError(t, err, "resume error")
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+	})
+}
+
+func TestMachine_Stop(t *testing.T) {
+	m := New("test", msgEventsFunc(func() []chan<- service.StateMsg { return nil }), nil, nil)
+
+	require.NoError(t, m.Stop())
+	require.EqualError(t, m.Stop(), "server was already stopped")
+
+	// the callbacks are dropped after the machine was stopped
+	m.ProcessCallback(&Callback{ID: "ID"})
+}
+
+func TestMachine_WithWorkerPool(t *testing.T) {
+	pool := workerpool.New("test", 2, 10)
+	defer pool.Stop()
+
+	resumed := make(chan string, 2)
+
+	m := New("test", msgEventsFunc(func() []chan<- service.StateMsg { return nil }), func(cb *Callback) error {
+		resumed <- cb.ThreadID
+		return nil
+	}, nil, WithWorkerPool(pool))
+
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+
+	newAction(t, m, &Callback{ThreadID: "1", Msg: msg}, nil).Continue(nil)
+	newAction(t, m, &Callback{ThreadID: "2", Msg: msg}, nil).Continue(nil)
+
+	// the queued callbacks are processed before the machine is stopped
+	require.NoError(t, m.Stop())
+	require.Len(t, resumed, 2)
+
+	// the shared pool is not stopped by the machine
+	require.NoError(t, pool.Submit(func() {}))
+}
+
+func TestMachine_Pending(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+
+	t.Run("action events are persisted until processed", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		resumed := make(chan *Callback)
+
+		m := New("test", msgEventsFunc(func() []chan<- service.StateMsg { return nil }), func(cb *Callback) error {
+			resumed <- cb
+			return nil
+		}, nil, WithPendingStore(store))
+		defer stop(t, m)
+
+		action := newAction(t, m, &Callback{ThreadID: "thID", Msg: msg, Data: "data"}, nil)
+
+		pending, err := m.Pending(PendingAction)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.Equal(t, "thID", pending[0].ThreadID)
+		require.Equal(t, `"data"`, string(pending[0].Data))
+
+		action.Continue(nil)
+
+		select {
+		case <-resumed:
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+
+		require.Eventually(t, func() bool {
+			pending, err = m.Pending("")
+			return err == nil && len(pending) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("discard pending action", func(t *testing.T) {
+		m := New("test", nil, nil, nil, WithPendingStore(&mockstorage.MockStore{Store: make(map[string][]byte)}))
+		defer stop(t, m)
+
+		newAction(t, m, &Callback{ID: "ID", ThreadID: "thID", Msg: msg}, nil)
+		require.NoError(t, m.DiscardPending("ID"))
+
+		pending, err := m.Pending("")
+		require.NoError(t, err)
+		require.Empty(t, pending)
+	})
+
+	t.Run("invalid callback data", func(t *testing.T) {
+		m := New("test", nil, nil, nil, WithPendingStore(&mockstorage.MockStore{Store: make(map[string][]byte)}))
+		defer stop(t, m)
+
+		_, err := m.NewAction(&Callback{Msg: msg, Data: make(chan int)}, nil, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "new action: marshal callback data")
+	})
+}
+
+func TestMachine_Restore(t *testing.T) {
+	msg := &service.DIDCommMsg{Header: &service.Header{ID: "ID"}}
+	store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+	pending := NewPendingStore(store)
+
+	require.NoError(t, pending.Save(&Pending{ID: "1", ThreadID: "th1", Status: PendingAction, Msg: msg,
+		Data: []byte(`"action"`)}))
+	require.NoError(t, pending.Save(&Pending{ID: "2", ThreadID: "th2", Status: PendingCallback, Msg: msg,
+		Data: []byte(`"callback"`)}))
+	require.NoError(t, pending.Save(&Pending{ID: "3", ThreadID: "th3", Status: PendingCallback, Msg: msg,
+		Err: "stopped"}))
+	require.NoError(t, pending.Save(&Pending{ID: "4", ThreadID: "th4", Status: PendingAction}))
+	require.NoError(t, pending.Delete("4"))
+
+	resumed := make(chan *Callback)
+	abandoned := make(chan error)
+
+	m := New("test", nil, func(cb *Callback) error {
+		resumed <- cb
+		return nil
+	}, func(thID string, _ *service.DIDCommMsg, err error) error {
+		require.Equal(t, "th3", thID)
+		abandoned <- err
+
+		return nil
+	}, WithPendingStore(store))
+	defer stop(t, m)
+
+	actions, err := m.Restore(func(p *Pending) (interface{}, error) {
+		var data string
+		if p.Data == nil {
+			return data, nil
+		}
+
+		return data, json.Unmarshal(p.Data, &data)
+	})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	require.Equal(t, "th1", actions[0].ThreadID)
+	require.Equal(t, "action", actions[0].Data)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case cb := <-resumed:
+			require.Equal(t, "th2", cb.ThreadID)
+			require.Equal(t, "callback", cb.Data)
+		case err := <-abandoned:
+			require.EqualError(t, err, "stopped")
+		case <-time.After(time.Second):
+			t.Error("timeout")
+		}
+	}
+
+	_, err = m.Restore(func(p *Pending) (interface{}, error) {
+		return nil, errors.New("data error")
+	})
+	require.EqualError(t, err, "restore: data error")
+}
+
+type transitionRecorder struct {
+	states []string
+}
+
+func (r *transitionRecorder) RecordTransition(protocol, state string, _ *service.DIDCommMsg, _ service.EventProperties) {
+	r.states = append(r.states, protocol+":"+state)
+}
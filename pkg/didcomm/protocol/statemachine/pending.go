@@ -0,0 +1,124 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+const (
+	pendingKeyPrefix = "pending_"
+	// limitPattern with `~` at the end for lte of given prefix (less than or equal)
+	limitPattern = "%s~"
+)
+
+const (
+	// PendingAction the action event waits for the consumer to continue or stop it.
+	PendingAction = "action"
+	// PendingCallback the consumer continued or stopped the action event, the transition is queued.
+	PendingCallback = "callback"
+)
+
+// pendingStatuses are the statuses of the pending entries, the entries are keyed by the status.
+// nolint:gochecknoglobals
+var pendingStatuses = []string{PendingAction, PendingCallback}
+
+// Pending is an action event or a queued callback which was not processed yet.
+// Pending entries are persisted to resume the threads after the agent restart, they are deleted
+// once the callback is processed or the action event is discarded.
+type Pending struct {
+	ID       string              `json:"id"`
+	ThreadID string              `json:"thread_id"`
+	Status   string              `json:"status"`
+	Msg      *service.DIDCommMsg `json:"msg"`
+	// Data keeps the protocol specific data required to resume the thread.
+	Data json.RawMessage `json:"data,omitempty"`
+	// Err keeps the error passed to the Stop function.
+	Err string `json:"error,omitempty"`
+}
+
+// PendingStore persists the pending action events and callbacks.
+type PendingStore struct {
+	store storage.Store
+}
+
+// NewPendingStore returns new pending store instance.
+func NewPendingStore(store storage.Store) *PendingStore {
+	return &PendingStore{store: store}
+}
+
+// Save saves the pending entry, the entry saved with the previous status is deleted.
+func (s *PendingStore) Save(p *Pending) error {
+	src, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("save pending: %w", err)
+	}
+
+	if err := s.store.Put(pendingKey(p.Status, p.ID), src); err != nil {
+		return err
+	}
+
+	for _, status := range pendingStatuses {
+		if status == p.Status {
+			continue
+		}
+
+		if err := s.store.Delete(pendingKey(status, p.ID)); err != nil {
+			return fmt.Errorf("save pending: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes the pending entry, e.g. the callback was processed.
+func (s *PendingStore) Delete(id string) error {
+	for _, status := range pendingStatuses {
+		if err := s.store.Delete(pendingKey(status, id)); err != nil {
+			return fmt.Errorf("delete pending: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// List returns the pending entries with the given status, only the entries with the status are iterated.
+// All entries are returned if the status is empty.
+func (s *PendingStore) List(status string) ([]*Pending, error) {
+	searchKey := pendingKeyPrefix
+	if status != "" {
+		searchKey = pendingKey(status, "")
+	}
+
+	itr := s.store.Iterator(searchKey, fmt.Sprintf(limitPattern, searchKey))
+	defer itr.Release()
+
+	var result []*Pending
+
+	for itr.Next() {
+		p := &Pending{}
+		if err := json.Unmarshal(itr.Value(), p); err != nil {
+			return nil, fmt.Errorf("list pending: %w", err)
+		}
+
+		result = append(result, p)
+	}
+
+	if err := itr.Error(); err != nil {
+		return nil, fmt.Errorf("list pending: %w", err)
+	}
+
+	return result, nil
+}
+
+func pendingKey(status, id string) string {
+	return pendingKeyPrefix + status + "_" + id
+}
@@ -0,0 +1,88 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+)
+
+func TestPendingStore(t *testing.T) {
+	t.Run("save and list", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: map[string][]byte{"thID": []byte("{}")}}
+		pending := NewPendingStore(store)
+
+		require.NoError(t, pending.Save(&Pending{ID: "1", Status: PendingAction}))
+		require.NoError(t, pending.Save(&Pending{ID: "2", Status: PendingCallback}))
+
+		all, err := pending.List("")
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+
+		actions, err := pending.List(PendingAction)
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+		require.Equal(t, "1", actions[0].ID)
+
+		// the entry saved with the previous status is deleted
+		require.NoError(t, pending.Save(&Pending{ID: "1", Status: PendingCallback}))
+
+		actions, err = pending.List(PendingAction)
+		require.NoError(t, err)
+		require.Empty(t, actions)
+
+		callbacks, err := pending.List(PendingCallback)
+		require.NoError(t, err)
+		require.Len(t, callbacks, 2)
+
+		require.NoError(t, pending.Delete("1"))
+		require.NoError(t, pending.Delete("2"))
+		// the unknown entry
+		require.NoError(t, pending.Delete("3"))
+
+		all, err = pending.List("")
+		require.NoError(t, err)
+		require.Empty(t, all)
+		require.Equal(t, map[string][]byte{"thID": []byte("{}")}, store.Store)
+	})
+
+	t.Run("invalid entry", func(t *testing.T) {
+		pending := NewPendingStore(&mockstorage.MockStore{Store: map[string][]byte{
+			pendingKey(PendingAction, "1"): []byte("[]"),
+		}})
+
+		_, err := pending.List("")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "list pending")
+	})
+
+	t.Run("iterator error", func(t *testing.T) {
+		pending := NewPendingStore(&mockstorage.MockStore{
+			Store:  make(map[string][]byte),
+			ErrItr: errors.New("iterator error"),
+		})
+
+		_, err := pending.List("")
+		require.EqualError(t, err, "list pending: iterator error")
+	})
+
+	t.Run("put error", func(t *testing.T) {
+		pending := NewPendingStore(&mockstorage.MockStore{Store: make(map[string][]byte), ErrPut: errors.New("put")})
+		require.EqualError(t, pending.Save(&Pending{ID: "1"}), "put")
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		pending := NewPendingStore(&mockstorage.MockStore{Store: make(map[string][]byte),
+			ErrDelete: errors.New("delete")})
+		require.EqualError(t, pending.Save(&Pending{ID: "1", Status: PendingAction}), "save pending: delete")
+		require.EqualError(t, pending.Delete("1"), "delete pending: delete")
+	})
+}
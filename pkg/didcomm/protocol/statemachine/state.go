@@ -0,0 +1,76 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"fmt"
+)
+
+// StateNameNoop is the name of the NoOp state.
+const StateNameNoop = "noop"
+
+// State is a protocol state. Protocols extend this interface with their own execute functions.
+type State interface {
+	// Name of this state.
+	Name() string
+
+	// Whether this state allows transitioning into the next state.
+	CanTransitionTo(next State) bool
+}
+
+// NoOp state is returned as a followup by states which have no followup, it ends the execution.
+// Protocols usually embed NoOp into their own noop state.
+type NoOp struct {
+}
+
+// Name returns the name of the NoOp state.
+func (s *NoOp) Name() string {
+	return StateNameNoop
+}
+
+// CanTransitionTo always returns false, there is no transition from the NoOp state.
+func (s *NoOp) CanTransitionTo(_ State) bool {
+	return false
+}
+
+// IsNoOp checks whether the given state is the NoOp state.
+func IsNoOp(s State) bool {
+	return s != nil && s.Name() == StateNameNoop
+}
+
+// States is a set of protocol states indexed by name.
+type States map[string]State
+
+// NewStates returns the set of given states.
+func NewStates(states ...State) States {
+	result := make(States, len(states))
+
+	for _, s := range states {
+		result[s.Name()] = s
+	}
+
+	return result
+}
+
+// FromName returns the state representing the name.
+func (s States) FromName(name string) (State, error) {
+	st, ok := s[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid state name %s", name)
+	}
+
+	return st, nil
+}
+
+// ValidateTransition returns an error if the current state can't transition to the next state.
+func ValidateTransition(current, next State) error {
+	if !current.CanTransitionTo(next) {
+		return fmt.Errorf("invalid state transition: %s -> %s", current.Name(), next.Name())
+	}
+
+	return nil
+}
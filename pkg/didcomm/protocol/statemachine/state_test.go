@@ -0,0 +1,66 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testState struct {
+	name string
+	next []string
+}
+
+func (s *testState) Name() string {
+	return s.name
+}
+
+func (s *testState) CanTransitionTo(next State) bool {
+	for _, name := range s.next {
+		if next.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestNoOp(t *testing.T) {
+	noop := &NoOp{}
+	require.Equal(t, StateNameNoop, noop.Name())
+	require.False(t, noop.CanTransitionTo(&NoOp{}))
+	require.False(t, noop.CanTransitionTo(&testState{name: "start"}))
+	require.True(t, IsNoOp(noop))
+	require.False(t, IsNoOp(&testState{name: "start"}))
+}
+
+func TestStates_FromName(t *testing.T) {
+	start := &testState{name: "start"}
+	states := NewStates(&NoOp{}, start)
+
+	st, err := states.FromName("start")
+	require.NoError(t, err)
+	require.Equal(t, start, st)
+
+	st, err = states.FromName(StateNameNoop)
+	require.NoError(t, err)
+	require.True(t, IsNoOp(st))
+
+	st, err = states.FromName("unknown")
+	require.EqualError(t, err, "invalid state name unknown")
+	require.Nil(t, st)
+}
+
+func TestValidateTransition(t *testing.T) {
+	start := &testState{name: "start", next: []string{"done"}}
+	done := &testState{name: "done"}
+
+	require.NoError(t, ValidateTransition(start, done))
+	require.EqualError(t, ValidateTransition(done, start), "invalid state transition: done -> start")
+}
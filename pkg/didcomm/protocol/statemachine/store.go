@@ -0,0 +1,46 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+// ThreadStore persists the protocol state record of every thread. The record is protocol specific,
+// it is stored as JSON using the thread ID as the key.
+type ThreadStore struct {
+	store storage.Store
+}
+
+// NewThreadStore returns new thread store instance.
+func NewThreadStore(store storage.Store) *ThreadStore {
+	return &ThreadStore{store: store}
+}
+
+// Save saves the record of the given thread.
+func (s *ThreadStore) Save(thID string, record interface{}) error {
+	src, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("service save: %w", err)
+	}
+
+	return s.store.Put(thID, src)
+}
+
+// Get gets the record of the given thread and stores the result in the value pointed to by record.
+// The returned error wraps storage.ErrDataNotFound if the thread is unknown.
+func (s *ThreadStore) Get(thID string, record interface{}) error {
+	src, err := s.store.Get(thID)
+	if err != nil {
+		return fmt.Errorf("cannot fetch state from store: thid=%s err=%w", thID, err)
+	}
+
+	return json.Unmarshal(src, record)
+}
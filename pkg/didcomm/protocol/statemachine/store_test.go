@@ -0,0 +1,55 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package statemachine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+type testRecord struct {
+	StateName string
+}
+
+func TestThreadStore(t *testing.T) {
+	t.Run("save and get", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: make(map[string][]byte)}
+		threads := NewThreadStore(store)
+
+		require.NoError(t, threads.Save("thID", &testRecord{StateName: "start"}))
+		require.Equal(t, `{"StateName":"start"}`, string(store.Store["thID"]))
+
+		rec := &testRecord{}
+		require.NoError(t, threads.Get("thID", rec))
+		require.Equal(t, "start", rec.StateName)
+	})
+
+	t.Run("unknown thread", func(t *testing.T) {
+		threads := NewThreadStore(&mockstorage.MockStore{Store: make(map[string][]byte)})
+
+		err := threads.Get("thID", &testRecord{})
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("invalid record", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: map[string][]byte{"thID": []byte("[]")}}
+		threads := NewThreadStore(store)
+
+		require.Error(t, threads.Get("thID", &testRecord{}))
+		require.Contains(t, threads.Save("thID", make(chan int)).Error(), "service save")
+	})
+
+	t.Run("put error", func(t *testing.T) {
+		threads := NewThreadStore(&mockstorage.MockStore{Store: make(map[string][]byte), ErrPut: errors.New("put")})
+		require.EqualError(t, threads.Save("thID", &testRecord{}), "put")
+	})
+}
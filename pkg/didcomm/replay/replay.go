@@ -0,0 +1,241 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+var logger = log.New("aries-framework/replay")
+
+const (
+	// StoreName is the name of the transient store of the seen messages.
+	StoreName = "replaycache"
+
+	defaultRetention = 24 * time.Hour
+	seenKeyPrefix    = "seen_"
+
+	// limitPattern with `~` at the end for lte of given prefix (less than or equal)
+	limitPattern = "%s~"
+)
+
+// ErrDuplicate is returned for the message which was already received from the sender
+// when the duplicates are rejected.
+var ErrDuplicate = errors.New("duplicate message")
+
+// provider contains dependencies for the replay cache and is typically created by using aries.Context()
+type provider interface {
+	TransientStorageProvider() storage.Provider
+}
+
+// seen is the record of the received message.
+type seen struct {
+	Expires time.Time `json:"expires"`
+}
+
+// Cache detects the inbound messages which were already received, the message is identified by its @id
+// and the key of the sender. The received messages are remembered for the retention window in the transient
+// store, the duplicates received within the window are not passed to the protocol services. The expired
+// records are deleted once per retention window.
+type Cache struct {
+	store     storage.Store
+	retention time.Duration
+	reject    bool
+	now       func() time.Time
+	nextSweep time.Time
+	// mu serializes the check and the update of the seen messages
+	mu sync.Mutex
+}
+
+// Option configures the replay cache.
+type Option func(c *Cache)
+
+// WithRetention sets how long the received messages are remembered, defaults to 24 hours.
+func WithRetention(retention time.Duration) Option {
+	return func(c *Cache) {
+		c.retention = retention
+	}
+}
+
+// WithRejectDuplicates rejects the duplicates with ErrDuplicate. By default the duplicates are ignored: they
+// are acknowledged to the sender as if they were handled, so that the retried deliveries are not retried again.
+func WithRejectDuplicates() Option {
+	return func(c *Cache) {
+		c.reject = true
+	}
+}
+
+// New returns new replay cache instance.
+func New(prov provider, opts ...Option) (*Cache, error) {
+	store, err := prov.TransientStorageProvider().OpenStore(StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("open replay cache store: %w", err)
+	}
+
+	c := &Cache{store: store, retention: defaultRetention, now: time.Now}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.retention <= 0 {
+		return nil, fmt.Errorf("invalid retention: %s", c.retention)
+	}
+
+	c.nextSweep = c.now().Add(c.retention)
+
+	return c, nil
+}
+
+// Middleware returns the inbound middleware passing only the messages which were not received yet. The message
+// is forgotten if it fails to be handled, so that the sender can retry the delivery. The anonymous messages
+// are always passed: the message of one sender would hide the message of another one with the same ID.
+func (c *Cache) Middleware() dispatcher.InboundMiddleware {
+	return func(next dispatcher.InboundHandler) dispatcher.InboundHandler {
+		return func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string, recipientVerKeys []string) error {
+			// the messages without ID or sender can't be told apart
+			if msg.Header == nil || msg.Header.ID == "" || senderVerKey == "" {
+				return next(ctx, msg, senderVerKey, recipientVerKeys)
+			}
+
+			key := seenKey(msg.Header.ID, senderVerKey)
+
+			duplicate, err := c.markSeen(key)
+			if err != nil {
+				return fmt.Errorf("replay cache: %w", err)
+			}
+
+			if duplicate {
+				logger.Infof("duplicate message %s of type %s", msg.Header.ID, msg.Header.Type)
+
+				if c.reject {
+					return ErrDuplicate
+				}
+
+				return nil
+			}
+
+			err = next(ctx, msg, senderVerKey, recipientVerKeys)
+			if err != nil {
+				c.forget(key)
+			}
+
+			return err
+		}
+	}
+}
+
+// Seen returns true if the message with the given ID was received from the sender within the retention window.
+func (c *Cache) Seen(msgID, senderVerKey string) (bool, error) {
+	return c.seen(seenKey(msgID, senderVerKey))
+}
+
+// markSeen remembers the message and returns true if it was already seen.
+func (c *Cache) markSeen(key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ok, err := c.seen(key)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	now := c.now()
+
+	if err := c.put(key, &seen{Expires: now.Add(c.retention)}); err != nil {
+		return false, err
+	}
+
+	if !now.Before(c.nextSweep) {
+		c.nextSweep = now.Add(c.retention)
+		c.sweep(now)
+	}
+
+	return false, nil
+}
+
+// sweep deletes the records which expired before now. The failures are logged only, the expired records
+// are not considered by the lookups anyway.
+func (c *Cache) sweep(now time.Time) {
+	itr := c.store.Iterator(seenKeyPrefix, fmt.Sprintf(limitPattern, seenKeyPrefix))
+	defer itr.Release()
+
+	var expired []string
+
+	for itr.Next() {
+		s := &seen{}
+		if err := json.Unmarshal(itr.Value(), s); err != nil || !now.Before(s.Expires) {
+			expired = append(expired, string(itr.Key()))
+		}
+	}
+
+	if err := itr.Error(); err != nil {
+		logger.Warnf("failed to sweep seen messages: %s", err)
+	}
+
+	for _, key := range expired {
+		if err := c.store.Delete(key); err != nil {
+			logger.Warnf("failed to delete seen message: %s", err)
+		}
+	}
+}
+
+func (c *Cache) seen(key string) (bool, error) {
+	src, err := c.store.Get(key)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("get seen message: %w", err)
+	}
+
+	s := &seen{}
+	if err := json.Unmarshal(src, s); err != nil {
+		return false, fmt.Errorf("unmarshal seen message: %w", err)
+	}
+
+	// the expired record is overwritten when the message is seen again or deleted by the sweep
+	return c.now().Before(s.Expires), nil
+}
+
+// forget deletes the record of the message.
+func (c *Cache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.store.Delete(key); err != nil {
+		logger.Errorf("failed to forget message: %s", err)
+	}
+}
+
+func (c *Cache) put(key string, s *seen) error {
+	src, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("marshal seen message: %w", err)
+	}
+
+	if err := c.store.Put(key, src); err != nil {
+		return fmt.Errorf("put seen message: %w", err)
+	}
+
+	return nil
+}
+
+func seenKey(msgID, senderVerKey string) string {
+	return seenKeyPrefix + senderVerKey + "_" + msgID
+}
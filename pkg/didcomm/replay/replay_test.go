@@ -0,0 +1,278 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("test success", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+		require.Equal(t, defaultRetention, c.retention)
+	})
+
+	t.Run("test error from open store", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: &mockstorage.MockStoreProvider{
+			ErrOpenStoreHandle: errors.New("open store error")}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open store error")
+	})
+
+	t.Run("test invalid retention", func(t *testing.T) {
+		_, err := New(&mockProvider{storage: mem.NewProvider()}, WithRetention(0))
+		require.EqualError(t, err, "invalid retention: 0s")
+	})
+}
+
+func TestCache_Middleware(t *testing.T) {
+	t.Run("test duplicates are ignored", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		handled := 0
+		handler := newHandler(c, func() error {
+			handled++
+			return nil
+		})
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.Equal(t, 1, handled)
+
+		// the same ID from the other sender is not a duplicate
+		require.NoError(t, handler(context.Background(), newMsg("1"), "other", nil))
+		require.NoError(t, handler(context.Background(), newMsg("2"), "sender", nil))
+		require.Equal(t, 3, handled)
+
+		// the messages without ID are always passed
+		require.NoError(t, handler(context.Background(), newMsg(""), "sender", nil))
+		require.NoError(t, handler(context.Background(), newMsg(""), "sender", nil))
+		require.Equal(t, 5, handled)
+
+		seen, err := c.Seen("1", "sender")
+		require.NoError(t, err)
+		require.True(t, seen)
+
+		seen, err = c.Seen("3", "sender")
+		require.NoError(t, err)
+		require.False(t, seen)
+	})
+
+	t.Run("test duplicates are rejected", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()}, WithRejectDuplicates())
+		require.NoError(t, err)
+
+		handler := newHandler(c, func() error { return nil })
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.True(t, errors.Is(handler(context.Background(), newMsg("1"), "sender", nil), ErrDuplicate))
+	})
+
+	t.Run("test message is received again after the retention window", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()}, WithRetention(time.Minute))
+		require.NoError(t, err)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		handled := 0
+		handler := newHandler(c, func() error {
+			handled++
+			return nil
+		})
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+
+		now = now.Add(59 * time.Second)
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.Equal(t, 1, handled)
+
+		now = now.Add(time.Second)
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.Equal(t, 2, handled)
+	})
+
+	t.Run("test failed message can be retried", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		handleErr := errors.New("handle error")
+		handler := newHandler(c, func() error { return handleErr })
+
+		require.Equal(t, handleErr, handler(context.Background(), newMsg("1"), "sender", nil))
+		require.Equal(t, handleErr, handler(context.Background(), newMsg("1"), "sender", nil))
+
+		seen, err := c.Seen("1", "sender")
+		require.NoError(t, err)
+		require.False(t, seen)
+
+		// the record of the message is deleted
+		_, err = c.store.Get(seenKey("1", "sender"))
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+
+	t.Run("test anonymous messages are always passed", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		handled := 0
+		handler := newHandler(c, func() error {
+			handled++
+			return nil
+		})
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "", nil))
+		require.NoError(t, handler(context.Background(), newMsg("1"), "", nil))
+		require.Equal(t, 2, handled)
+
+		seen, err := c.Seen("1", "")
+		require.NoError(t, err)
+		require.False(t, seen)
+	})
+
+	t.Run("test expired records are deleted", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()}, WithRetention(time.Minute))
+		require.NoError(t, err)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		handler := newHandler(c, func() error { return nil })
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+
+		now = now.Add(30 * time.Second)
+		require.NoError(t, handler(context.Background(), newMsg("2"), "sender", nil))
+
+		// the sweep runs once per retention window
+		now = now.Add(30 * time.Second)
+		require.NoError(t, handler(context.Background(), newMsg("3"), "sender", nil))
+
+		_, err = c.store.Get(seenKey("1", "sender"))
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		for _, id := range []string{"2", "3"} {
+			seen, err := c.Seen(id, "sender")
+			require.NoError(t, err)
+			require.True(t, seen)
+		}
+	})
+
+	t.Run("test sweep errors", func(t *testing.T) {
+		prov := mockstorage.NewMockStoreProvider()
+
+		c, err := New(&mockProvider{storage: prov}, WithRetention(time.Minute))
+		require.NoError(t, err)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		handler := newHandler(c, func() error { return nil })
+
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+
+		now = now.Add(time.Minute)
+		prov.Store.ErrDelete = errors.New("delete error")
+		require.NoError(t, handler(context.Background(), newMsg("2"), "sender", nil))
+
+		now = now.Add(time.Minute)
+		prov.Store.ErrItr = errors.New("iterator error")
+		require.NoError(t, handler(context.Background(), newMsg("3"), "sender", nil))
+	})
+
+	t.Run("test concurrent duplicates are handled once", func(t *testing.T) {
+		c, err := New(&mockProvider{storage: mem.NewProvider()})
+		require.NoError(t, err)
+
+		var mu sync.Mutex
+
+		handled := 0
+		handler := newHandler(c, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handled++
+
+			return nil
+		})
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+			}()
+		}
+
+		wg.Wait()
+		require.Equal(t, 1, handled)
+	})
+
+	t.Run("test store errors", func(t *testing.T) {
+		prov := mockstorage.NewMockStoreProvider()
+
+		c, err := New(&mockProvider{storage: prov})
+		require.NoError(t, err)
+
+		handler := newHandler(c, func() error { return nil })
+
+		prov.Store.ErrPut = errors.New("put error")
+		err = handler(context.Background(), newMsg("1"), "sender", nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "put error")
+
+		prov.Store.ErrPut = nil
+		require.NoError(t, handler(context.Background(), newMsg("1"), "sender", nil))
+
+		prov.Store.ErrGet = errors.New("get error")
+		err = handler(context.Background(), newMsg("1"), "sender", nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get error")
+
+		prov.Store.ErrGet = nil
+		prov.Store.Store[seenKey("2", "sender")] = []byte("{")
+		err = handler(context.Background(), newMsg("2"), "sender", nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unmarshal seen message")
+	})
+}
+
+func newHandler(c *Cache, handle func() error) dispatcher.InboundHandler {
+	return dispatcher.ChainInbound(func(context.Context, *service.DIDCommMsg, string, []string) error {
+		return handle()
+	}, c.Middleware())
+}
+
+func newMsg(id string) *service.DIDCommMsg {
+	return &service.DIDCommMsg{Header: &service.Header{ID: id, Type: "https://didcomm.org/test/1.0/message"}}
+}
+
+type mockProvider struct {
+	storage storage.Provider
+}
+
+func (p *mockProvider) TransientStorageProvider() storage.Provider {
+	return p.storage
+}
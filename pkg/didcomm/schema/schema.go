@@ -0,0 +1,104 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+// ProblemCode is the code of the problem report sent for the message which failed the validation.
+const ProblemCode = "invalid-message"
+
+// ValidationError is returned for the message which doesn't conform to the schema of its type. It holds
+// the details needed to report the problem to the sender.
+type ValidationError struct {
+	// MsgID is the @id of the invalid message, the problem report is threaded by it.
+	MsgID   string
+	MsgType string
+	// Details are the violations of the schema, e.g. "connection: did is required".
+	Details []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid message %s of type %s: %s", e.MsgID, e.MsgType, strings.Join(e.Details, "; "))
+}
+
+// Registry holds the JSON Schemas of the messages by message type. The schemas can be registered
+// while the messages are validated.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*gojsonschema.Schema
+}
+
+// NewRegistry returns new empty schema registry.
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*gojsonschema.Schema)}
+}
+
+// Register compiles the JSON Schema of the message type, the schema registered for the type before is replaced.
+func (r *Registry) Register(msgType, jsonSchema string) error {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(jsonSchema))
+	if err != nil {
+		return fmt.Errorf("invalid schema of message type %s: %w", msgType, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.schemas[msgType] = s
+
+	return nil
+}
+
+// RegisterAll registers the schemas by message type.
+func (r *Registry) RegisterAll(schemas map[string]string) error {
+	for msgType, jsonSchema := range schemas {
+		if err := r.Register(msgType, jsonSchema); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the message against the schema of its type, it returns ValidationError if the message
+// doesn't conform to the schema. The messages of the types without the schema are not validated.
+func (r *Registry) Validate(msg *service.DIDCommMsg) error {
+	if msg.Header == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	s, ok := r.schemas[msg.Header.Type]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	result, err := s.Validate(gojsonschema.NewBytesLoader(msg.Payload))
+	if err != nil {
+		return &ValidationError{MsgID: msg.Header.ID, MsgType: msg.Header.Type, Details: []string{err.Error()}}
+	}
+
+	if result.Valid() {
+		return nil
+	}
+
+	details := make([]string, len(result.Errors()))
+	for i, desc := range result.Errors() {
+		details[i] = desc.String()
+	}
+
+	return &ValidationError{MsgID: msg.Header.ID, MsgType: msg.Header.Type, Details: details}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+)
+
+const (
+	testType   = "https://didcomm.org/test/1.0/message"
+	testSchema = `{
+  "type": "object",
+  "required": ["@id", "content"],
+  "properties": {
+    "content": {"type": "string", "minLength": 1}
+  }
+}`
+)
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+
+	require.NoError(t, r.Register(testType, testSchema))
+	require.NoError(t, r.RegisterAll(map[string]string{testType: `{}`}))
+
+	err := r.Register(testType, `{"type": 1}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid schema of message type "+testType)
+
+	err = r.RegisterAll(map[string]string{testType: `{`})
+	require.Error(t, err)
+
+	// the schema registered before is kept if the new one is invalid
+	require.NoError(t, r.Validate(newMsg(t, `{"@id": "1", "@type": "`+testType+`"}`)))
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(testType, testSchema))
+
+	t.Run("test valid message", func(t *testing.T) {
+		require.NoError(t, r.Validate(newMsg(t, `{"@id": "1", "@type": "`+testType+`", "content": "hi"}`)))
+	})
+
+	t.Run("test message type without schema", func(t *testing.T) {
+		require.NoError(t, r.Validate(newMsg(t, `{"@id": "1", "@type": "https://didcomm.org/other/1.0/message"}`)))
+		require.NoError(t, r.Validate(&service.DIDCommMsg{}))
+	})
+
+	t.Run("test invalid message", func(t *testing.T) {
+		err := r.Validate(newMsg(t, `{"@id": "1", "@type": "`+testType+`", "content": ""}`))
+		require.Error(t, err)
+
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Equal(t, "1", validationErr.MsgID)
+		require.Equal(t, testType, validationErr.MsgType)
+		require.Len(t, validationErr.Details, 1)
+		require.Contains(t, validationErr.Details[0], "content")
+		require.Contains(t, err.Error(), "invalid message 1 of type "+testType)
+
+		err = r.Validate(&service.DIDCommMsg{Header: &service.Header{ID: "2", Type: testType}, Payload: []byte("{")})
+		require.True(t, errors.As(err, &validationErr))
+		require.Equal(t, "2", validationErr.MsgID)
+	})
+}
+
+func newMsg(t *testing.T, payload string) *service.DIDCommMsg {
+	msg, err := service.NewDIDCommMsg([]byte(payload))
+	require.NoError(t, err)
+
+	return msg
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/hyperledger/aries-framework-go/pkg/common/log"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
@@ -52,6 +53,12 @@ func processPOSTRequest(w http.ResponseWriter, r *http.Request, prov transport.I
 		return
 	}
 
+	// the rate of the remote address is limited before the expensive unpacking
+	if err := transport.AllowAddress(prov, r.RemoteAddr); err != nil {
+		sendRateLimitError(w, err)
+		return
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		logger.Errorf("Error reading request body: %s - returning Code: %d", err, http.StatusInternalServerError)
@@ -60,7 +67,10 @@ func processPOSTRequest(w http.ResponseWriter, r *http.Request, prov transport.I
 		return
 	}
 
-	unpackMsg, err := prov.Packager().UnpackMessage(body)
+	ctx, span := transport.StartInboundSpan(r.Context(), prov, "http")
+	defer span.End()
+
+	unpackMsg, err := transport.Unpack(ctx, prov, body)
 	if err != nil {
 		logger.Errorf("failed to unpack msg: %s - returning Code: %d", err, http.StatusInternalServerError)
 		http.Error(w, "failed to unpack msg", http.StatusInternalServerError)
@@ -68,9 +78,30 @@ func processPOSTRequest(w http.ResponseWriter, r *http.Request, prov transport.I
 		return
 	}
 
+	if err = transport.AllowSender(prov, unpackMsg); err != nil {
+		span.RecordError(err)
+		sendRateLimitError(w, err)
+
+		return
+	}
+
 	messageHandler := prov.InboundMessageHandler()
 
-	err = messageHandler(unpackMsg.Message)
+	var busy *transport.BusyError
+
+	err = messageHandler(ctx, unpackMsg)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	if errors.As(err, &busy) {
+		logger.Warnf("incoming msg rejected: %s", err)
+		w.Header().Set("Retry-After", strconv.Itoa(busy.RetryAfterSeconds()))
+		http.Error(w, "agent is busy", http.StatusServiceUnavailable)
+
+		return
+	}
+
 	if err != nil {
 		// TODO https://github.com/hyperledger/aries-framework-go/issues/271 HTTP Response Codes based on errors
 		//  from service
@@ -81,6 +112,18 @@ func processPOSTRequest(w http.ResponseWriter, r *http.Request, prov transport.I
 	}
 }
 
+// sendRateLimitError asks the sender to retry after the rate limit allows the next message.
+func sendRateLimitError(w http.ResponseWriter, err error) {
+	logger.Warnf("incoming msg rejected: %s", err)
+
+	var limited *transport.RateLimitError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(limited.RetryAfterSeconds()))
+	}
+
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
 // validatePayload validate and get the payload from the request
 func validatePayload(r *http.Request, w http.ResponseWriter) bool {
 	if r.ContentLength == 0 { // empty payload should not be accepted
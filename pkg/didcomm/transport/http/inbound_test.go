@@ -8,6 +8,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -15,11 +16,14 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/ratelimit"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	mockpackager "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/packager"
@@ -27,12 +31,13 @@ import (
 
 type mockProvider struct {
 	packagerValue commontransport.Packager
+	handlerErr    error
 }
 
 func (p *mockProvider) InboundMessageHandler() transport.InboundMessageHandler {
-	return func(message []byte) error {
-		logger.Debugf("message received is %s", message)
-		return nil
+	return func(ctx context.Context, envelope *commontransport.Envelope) error {
+		logger.Debugf("message received is %s", envelope.Message)
+		return p.handlerErr
 	}
 }
 
@@ -127,6 +132,163 @@ func TestInboundHandler(t *testing.T) {
 	require.NoError(t, resp.Body.Close())
 }
 
+func TestInboundHandler_Busy(t *testing.T) {
+	prov := &mockProvider{
+		packagerValue: &mockpackager.Packager{UnpackValue: &commontransport.Envelope{Message: []byte("data")}},
+		handlerErr:    fmt.Errorf("dispatch: %w", &transport.BusyError{RetryAfter: 1500 * time.Millisecond}),
+	}
+
+	inHandler, err := NewInboundHandler(prov)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("data"))
+	req.Header.Set("Content-Type", commContentType)
+
+	rec := httptest.NewRecorder()
+	inHandler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// other errors are internal server errors
+	prov.handlerErr = errors.New("handler error")
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("data"))
+	req.Header.Set("Content-Type", commContentType)
+
+	rec = httptest.NewRecorder()
+	inHandler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Empty(t, rec.Header().Get("Retry-After"))
+}
+
+type tracingProvider struct {
+	mockProvider
+	tracer trace.Tracer
+}
+
+func (p *tracingProvider) Tracer() trace.Tracer {
+	return p.tracer
+}
+
+func TestInboundHandler_Tracer(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	prov := &tracingProvider{
+		mockProvider: mockProvider{
+			packagerValue: &mockpackager.Packager{UnpackValue: &commontransport.Envelope{Message: []byte("data")}},
+			handlerErr:    errors.New("handler error"),
+		},
+		tracer: trace.NewTracer(exporter),
+	}
+
+	inHandler, err := NewInboundHandler(prov)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("data"))
+	req.Header.Set("Content-Type", commContentType)
+
+	inHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, trace.UnpackSpan, spans[0].Name)
+	require.Equal(t, spans[1].SpanContext, spans[0].Parent)
+	require.Equal(t, trace.InboundSpan, spans[1].Name)
+	require.Equal(t, []string{"handler error"}, spans[1].Errors)
+
+	scheme, ok := spans[1].Attribute(trace.TransportKey)
+	require.True(t, ok)
+	require.Equal(t, "http", scheme)
+
+	// the unpack error is recorded by the unpack span
+	exporter.Reset()
+
+	prov.packagerValue = &mockpackager.Packager{UnpackErr: errors.New("unpack error")}
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("data"))
+	req.Header.Set("Content-Type", commContentType)
+
+	inHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans = exporter.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, []string{"unpack error"}, spans[0].Errors)
+	require.Empty(t, spans[1].Errors)
+}
+
+type rateLimitingProvider struct {
+	mockProvider
+	address *ratelimit.Limiter
+	sender  *ratelimit.Limiter
+}
+
+func (p *rateLimitingProvider) AddressRateLimiter() *ratelimit.Limiter {
+	return p.address
+}
+
+func (p *rateLimitingProvider) SenderRateLimiter() *ratelimit.Limiter {
+	return p.sender
+}
+
+func TestInboundHandler_RateLimit(t *testing.T) {
+	newLimiter := func() *ratelimit.Limiter {
+		l, err := ratelimit.New(0.5, 1)
+		require.NoError(t, err)
+
+		return l
+	}
+
+	send := func(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("data"))
+		req.Header.Set("Content-Type", commContentType)
+		req.RemoteAddr = remoteAddr
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("test rate limit per remote address", func(t *testing.T) {
+		unpackErr := errors.New("unpack error")
+		prov := &rateLimitingProvider{
+			mockProvider: mockProvider{packagerValue: &mockpackager.Packager{UnpackErr: unpackErr}},
+			address:      newLimiter(),
+		}
+
+		inHandler, err := NewInboundHandler(prov)
+		require.NoError(t, err)
+
+		// the message is unpacked only if the address is within the limit
+		require.Equal(t, http.StatusInternalServerError, send(inHandler, "192.0.2.1:1234").Code)
+
+		rec := send(inHandler, "192.0.2.1:5678")
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusInternalServerError, send(inHandler, "192.0.2.2:1234").Code)
+	})
+
+	t.Run("test rate limit per sender", func(t *testing.T) {
+		envelope := &commontransport.Envelope{Message: []byte("data"), FromVerKey: "sender"}
+		prov := &rateLimitingProvider{
+			mockProvider: mockProvider{packagerValue: &mockpackager.Packager{UnpackValue: envelope}},
+			sender:       newLimiter(),
+		}
+
+		inHandler, err := NewInboundHandler(prov)
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusAccepted, send(inHandler, "192.0.2.1:1234").Code)
+		require.Equal(t, http.StatusTooManyRequests, send(inHandler, "192.0.2.2:1234").Code)
+
+		// the anonymous messages are not limited per sender
+		envelope.FromVerKey = ""
+		require.Equal(t, http.StatusAccepted, send(inHandler, "192.0.2.1:1234").Code)
+	})
+}
+
 func TestInboundTransport(t *testing.T) {
 	t.Run("test inbound transport - with host/port", func(t *testing.T) {
 		port := "26601"
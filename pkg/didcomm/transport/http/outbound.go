@@ -8,6 +8,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -84,7 +85,19 @@ func NewOutbound(opts ...OutboundHTTPOpt) (*OutboundHTTPClient, error) {
 
 // Send sends a2a exchange data via HTTP (client side)
 func (cs *OutboundHTTPClient) Send(data []byte, url string) (string, error) {
-	resp, err := cs.client.Post(url, commContentType, bytes.NewBuffer(data))
+	return cs.SendContext(context.Background(), data, url)
+}
+
+// SendContext sends a2a exchange data via HTTP (client side), the request is aborted when the context is done.
+func (cs *OutboundHTTPClient) SendContext(ctx context.Context, data []byte, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", commContentType)
+
+	resp, err := cs.client.Do(req)
 	if err != nil {
 		logger.Errorf("posting DID envelope to agent failed [%s, %v]", url, err)
 		return "", err
@@ -7,10 +7,15 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -94,3 +99,29 @@ func TestOutboundHTTPTransport(t *testing.T) {
 	require.True(t, ot.Accept("http://example.com"))
 	require.False(t, ot.Accept("123:22"))
 }
+
+func TestOutboundHTTPTransport_SendContext(t *testing.T) {
+	done := make(chan struct{})
+
+	// the slow peer does not respond until the test is done
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+
+	defer server.Close()
+	defer close(done)
+
+	ot, err := NewOutbound(WithOutboundHTTPClient(&http.Client{}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = ot.SendContext(ctx, []byte("Hello World"), server.URL)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	_, err = ot.SendContext(context.Background(), []byte("Hello World"), "://invalid")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "create request")
+}
@@ -7,6 +7,13 @@ SPDX-License-Identifier: Apache-2.0
 package transport
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/ratelimit"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 )
 
@@ -19,9 +26,83 @@ type OutboundTransport interface {
 	Accept(string) bool
 }
 
+// ContextOutboundTransport is implemented by the outbound transports which can be cancelled, the sending
+// is aborted when the context is done.
+type ContextOutboundTransport interface {
+	OutboundTransport
+	// SendContext send a2a exchange data
+	SendContext(ctx context.Context, data []byte, destination string) (string, error)
+}
+
+// SendContext sends the data using the outbound transport. The transports not implementing
+// ContextOutboundTransport cannot be cancelled, the context is only checked before sending.
+func SendContext(ctx context.Context, t OutboundTransport, data []byte, destination string) (string, error) {
+	if ct, ok := t.(ContextOutboundTransport); ok {
+		return ct.SendContext(ctx, data, destination)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return t.Send(data, destination)
+}
+
 // InboundMessageHandler handles the inbound requests. The transport will unpack the payload prior to the
-// message handle invocation.
-type InboundMessageHandler func(message []byte) error
+// message handle invocation, the envelope contains the unpacked message with the sender and recipient keys.
+// The context is cancelled when the inbound request is done, it must not be used after the handler returns.
+type InboundMessageHandler func(ctx context.Context, envelope *transport.Envelope) error
+
+// BusyError is returned by the InboundMessageHandler when the message was not accepted because the agent
+// is overloaded, the inbound transports ask the sender to retry after RetryAfter, e.g. HTTP 503 with Retry-After.
+type BusyError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *BusyError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("agent is busy, retry after %s", e.RetryAfter)
+	}
+
+	return fmt.Sprintf("agent is busy, retry after %s: %v", e.RetryAfter, e.Err)
+}
+
+// Unwrap returns the cause of the rejection.
+func (e *BusyError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds rounded up, at least one second.
+func (e *BusyError) RetryAfterSeconds() int {
+	return retryAfterSeconds(e.RetryAfter)
+}
+
+// RateLimitError is returned when the remote address or the sender exceeded the rate limit, the inbound transports
+// reject the message and ask the sender to retry after RetryAfter, e.g. HTTP 429 with Retry-After.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	// Key is the remote address or the sender key which exceeded the limit.
+	Key string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded by %s, retry after %s", e.Key, e.RetryAfter)
+}
+
+// RetryAfterSeconds returns RetryAfter in whole seconds rounded up, at least one second.
+func (e *RateLimitError) RetryAfterSeconds() int {
+	return retryAfterSeconds(e.RetryAfter)
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
 
 // InboundProvider contains dependencies for starting the inbound transport.
 // It is typically created by using aries.Context().
@@ -30,6 +111,88 @@ type InboundProvider interface {
 	Packager() transport.Packager
 }
 
+// TracingProvider is implemented by the inbound providers which trace the inbound messages.
+type TracingProvider interface {
+	Tracer() trace.Tracer
+}
+
+// StartInboundSpan starts the root span of the envelope received by the inbound transport with the given scheme.
+// The span records nothing if the provider doesn't implement TracingProvider.
+func StartInboundSpan(ctx context.Context, prov InboundProvider, scheme string) (context.Context, trace.Span) {
+	return inboundTracer(prov).Start(ctx, trace.InboundSpan,
+		trace.WithAttributes(trace.String(trace.TransportKey, scheme)))
+}
+
+// Unpack unpacks the inbound envelope in the child span of the span in the context.
+func Unpack(ctx context.Context, prov InboundProvider, message []byte) (*transport.Envelope, error) {
+	_, span := inboundTracer(prov).Start(ctx, trace.UnpackSpan)
+	defer span.End()
+
+	envelope, err := prov.Packager().UnpackMessage(message)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return envelope, err
+}
+
+// RateLimitingProvider is implemented by the inbound providers limiting the rate of the inbound messages.
+// The limiters are nil if the rate is not limited.
+type RateLimitingProvider interface {
+	// AddressRateLimiter limits the messages per remote address, it is applied before the message is unpacked.
+	AddressRateLimiter() *ratelimit.Limiter
+	// SenderRateLimiter limits the messages per sender key, it is applied after the message is unpacked.
+	SenderRateLimiter() *ratelimit.Limiter
+}
+
+// AllowAddress returns RateLimitError if the remote address (host:port) exceeded the rate limit of the provider.
+// The rate is limited per host, the messages are always allowed if the provider doesn't implement
+// RateLimitingProvider.
+func AllowAddress(prov InboundProvider, remoteAddr string) error {
+	rp, ok := prov.(RateLimitingProvider)
+	if !ok {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	return allow(rp.AddressRateLimiter(), host)
+}
+
+// AllowSender returns RateLimitError if the sender of the unpacked envelope exceeded the rate limit
+// of the provider. The anonymous messages are limited by the remote address only.
+func AllowSender(prov InboundProvider, envelope *transport.Envelope) error {
+	rp, ok := prov.(RateLimitingProvider)
+	if !ok || envelope.FromVerKey == "" {
+		return nil
+	}
+
+	return allow(rp.SenderRateLimiter(), envelope.FromVerKey)
+}
+
+func allow(limiter *ratelimit.Limiter, key string) error {
+	if limiter == nil {
+		return nil
+	}
+
+	if ok, retryAfter := limiter.Allow(key); !ok {
+		return &RateLimitError{RetryAfter: retryAfter, Key: key}
+	}
+
+	return nil
+}
+
+func inboundTracer(prov InboundProvider) trace.Tracer {
+	if tp, ok := prov.(TracingProvider); ok && tp.Tracer() != nil {
+		return tp.Tracer()
+	}
+
+	return trace.Noop
+}
+
 // InboundTransport interface definition for inbound transport layer
 type InboundTransport interface {
 	// starts the inbound transport
@@ -20,7 +20,12 @@ import (
 
 var logger = log.New("aries-framework/ws")
 
-const processFailureErrMsg = "failed to process the message"
+const (
+	processFailureErrMsg = "failed to process the message"
+	busyErrMsgFormat     = "agent is busy, retry after %d seconds"
+	// rateLimitErrMsgFormat is the reason of the close frame, it must fit into 123 bytes
+	rateLimitErrMsgFormat = "rate limit exceeded, retry after %d seconds"
+)
 
 // Inbound http(ws) type.
 type Inbound struct {
@@ -85,16 +90,21 @@ func newInboundHandler(prov transport.InboundProvider) (http.Handler, error) {
 }
 
 func processRequest(w http.ResponseWriter, r *http.Request, prov transport.InboundProvider) {
-	c, cleanup, err := upgradeConnection(w, r)
+	c, err := upgradeConnection(w, r)
 	if err != nil {
 		logger.Errorf("failed to upgrade the connection : %v", err)
 		return
 	}
 
-	defer cleanup()
+	status, reason := websocket.StatusNormalClosure, "closing the connection"
+
+	defer func() { closeConnection(c, status, reason) }()
+
+	// the context is cancelled when the connection is closed
+	ctx := r.Context()
 
 	for {
-		_, message, err := c.Read(context.Background())
+		_, message, err := c.Read(ctx)
 		if err != nil {
 			if websocket.CloseStatus(err) != websocket.StatusNormalClosure {
 				logger.Errorf("Error reading request message: %v", err)
@@ -103,47 +113,90 @@ func processRequest(w http.ResponseWriter, r *http.Request, prov transport.Inbou
 			break
 		}
 
-		unpackMsg, err := prov.Packager().UnpackMessage(message)
-		if err != nil {
-			logger.Errorf("failed to unpack msg: %v", err)
+		var limited *transport.RateLimitError
 
-			err = c.Write(context.Background(), websocket.MessageText, []byte(processFailureErrMsg))
-			if err != nil {
-				logger.Errorf("error writing the message: %v", err)
-			}
+		// the connection exceeding the rate limit is closed, the sender reconnects after the given time
+		if err := handleMessage(ctx, c, prov, r.RemoteAddr, message); errors.As(err, &limited) {
+			logger.Warnf("incoming msg rejected: %v", err)
 
-			continue
-		}
+			status, reason = websocket.StatusPolicyViolation, fmt.Sprintf(rateLimitErrMsgFormat, limited.RetryAfterSeconds())
 
-		messageHandler := prov.InboundMessageHandler()
+			break
+		}
+	}
+}
 
-		resp := ""
+// handleMessage handles the message received over the connection and writes the processing result back.
+// RateLimitError is returned if the remote address or the sender exceeded the rate limit.
+func handleMessage(ctx context.Context, c *websocket.Conn, prov transport.InboundProvider, remoteAddr string,
+	message []byte) error {
+	// the rate of the remote address is limited before the expensive unpacking
+	if err := transport.AllowAddress(prov, remoteAddr); err != nil {
+		return err
+	}
 
-		err = messageHandler(unpackMsg.Message)
-		if err != nil {
-			logger.Errorf("incoming msg processing failed: %v", err)
+	ctx, span := transport.StartInboundSpan(ctx, prov, "ws")
+	defer span.End()
 
-			resp = processFailureErrMsg
-		}
+	unpackMsg, err := transport.Unpack(ctx, prov, message)
+	if err != nil {
+		logger.Errorf("failed to unpack msg: %v", err)
 
-		err = c.Write(context.Background(), websocket.MessageText, []byte(resp))
+		err = c.Write(ctx, websocket.MessageText, []byte(processFailureErrMsg))
 		if err != nil {
 			logger.Errorf("error writing the message: %v", err)
 		}
+
+		return nil
+	}
+
+	if err = transport.AllowSender(prov, unpackMsg); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	messageHandler := prov.InboundMessageHandler()
+
+	resp := ""
+
+	var busy *transport.BusyError
+
+	err = messageHandler(ctx, unpackMsg)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	if errors.As(err, &busy) {
+		logger.Warnf("incoming msg rejected: %v", err)
+
+		resp = fmt.Sprintf(busyErrMsgFormat, busy.RetryAfterSeconds())
+	} else if err != nil {
+		logger.Errorf("incoming msg processing failed: %v", err)
+
+		resp = processFailureErrMsg
 	}
+
+	err = c.Write(ctx, websocket.MessageText, []byte(resp))
+	if err != nil {
+		logger.Errorf("error writing the message: %v", err)
+	}
+
+	return nil
 }
 
-func upgradeConnection(w http.ResponseWriter, r *http.Request) (*websocket.Conn, func(), error) {
+func upgradeConnection(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
 	c, err := websocket.Accept(w, r, nil)
 	if err != nil {
 		logger.Errorf("failed to upgrade the connection : %v", err)
-		return nil, nil, err
+		return nil, err
 	}
 
-	return c, func() {
-		err := c.Close(websocket.StatusNormalClosure, "closing the connection")
-		if err != nil && websocket.CloseStatus(err) != websocket.StatusNormalClosure {
-			logger.Errorf("failed to close connection: %v", err)
-		}
-	}, nil
+	return c, nil
+}
+
+func closeConnection(c *websocket.Conn, status websocket.StatusCode, reason string) {
+	err := c.Close(status, reason)
+	if err != nil && websocket.CloseStatus(err) != websocket.StatusNormalClosure {
+		logger.Errorf("failed to close connection: %v", err)
+	}
 }
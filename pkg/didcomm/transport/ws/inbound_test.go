@@ -18,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"nhooyr.io/websocket"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/ratelimit"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	mockpackager "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/packager"
@@ -29,11 +30,14 @@ type mockProvider struct {
 }
 
 func (p *mockProvider) InboundMessageHandler() transport.InboundMessageHandler {
-	return func(message []byte) error {
-		logger.Infof("message received is %s", string(message))
-		if string(message) == "invalid-data" {
+	return func(ctx context.Context, envelope *commontransport.Envelope) error {
+		logger.Infof("message received is %s", string(envelope.Message))
+		if string(envelope.Message) == "invalid-data" {
 			return errors.New("error")
 		}
+		if string(envelope.Message) == "busy" {
+			return &transport.BusyError{RetryAfter: 3 * time.Second}
+		}
 		return nil
 	}
 }
@@ -42,6 +46,20 @@ func (p *mockProvider) Packager() commontransport.Packager {
 	return p.packagerValue
 }
 
+type rateLimitingProvider struct {
+	mockProvider
+	address *ratelimit.Limiter
+	sender  *ratelimit.Limiter
+}
+
+func (p *rateLimitingProvider) AddressRateLimiter() *ratelimit.Limiter {
+	return p.address
+}
+
+func (p *rateLimitingProvider) SenderRateLimiter() *ratelimit.Limiter {
+	return p.sender
+}
+
 func TestInboundTransport(t *testing.T) {
 	t.Run("test inbound transport - with host/port", func(t *testing.T) {
 		port := ":" + strconv.Itoa(transportutil.GetRandomPort(5))
@@ -173,6 +191,77 @@ func TestInboundDataProcessing(t *testing.T) {
 		require.Equal(t, processFailureErrMsg, string(val))
 	})
 
+	t.Run("test inbound transport - agent busy", func(t *testing.T) {
+		port := ":" + strconv.Itoa(transportutil.GetRandomPort(5))
+
+		// initiate inbound with port
+		inbound, err := NewInbound(port, "")
+		require.NoError(t, err)
+		require.NotEmpty(t, inbound)
+
+		// start server
+		mockPackager := &mockpackager.Packager{UnpackValue: &commontransport.Envelope{Message: []byte("busy")}}
+		err = inbound.Start(&mockProvider{packagerValue: mockPackager})
+		require.NoError(t, err)
+
+		// create ws client
+		client, cleanup := websocketClient(t, port)
+		defer cleanup()
+
+		ctx := context.Background()
+
+		err = client.Write(ctx, websocket.MessageText, []byte(""))
+		require.NoError(t, err)
+
+		messageType, val, err := client.Read(ctx)
+		require.NoError(t, err)
+		require.Equal(t, messageType, websocket.MessageText)
+		require.Equal(t, "agent is busy, retry after 3 seconds", string(val))
+	})
+
+	t.Run("test inbound transport - rate limit exceeded", func(t *testing.T) {
+		for _, sender := range []bool{false, true} {
+			port := ":" + strconv.Itoa(transportutil.GetRandomPort(5))
+
+			inbound, err := NewInbound(port, "")
+			require.NoError(t, err)
+
+			limiter, err := ratelimit.New(0.5, 1)
+			require.NoError(t, err)
+
+			prov := &rateLimitingProvider{mockProvider: mockProvider{packagerValue: &mockpackager.Packager{
+				UnpackValue: &commontransport.Envelope{Message: []byte("valid-data"), FromVerKey: "sender"}}}}
+
+			if sender {
+				prov.sender = limiter
+			} else {
+				prov.address = limiter
+			}
+
+			require.NoError(t, inbound.Start(prov))
+
+			client, _ := websocketClient(t, port)
+
+			ctx := context.Background()
+
+			require.NoError(t, client.Write(ctx, websocket.MessageText, []byte("")))
+
+			_, val, err := client.Read(ctx)
+			require.NoError(t, err)
+			require.Equal(t, "", string(val))
+
+			// the connection exceeding the limit is closed
+			require.NoError(t, client.Write(ctx, websocket.MessageText, []byte("")))
+
+			_, _, err = client.Read(ctx)
+			require.Error(t, err)
+			require.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+			require.Contains(t, err.Error(), "rate limit exceeded, retry after 2 seconds")
+
+			require.NoError(t, inbound.Stop())
+		}
+	})
+
 	t.Run("test inbound transport - client close error", func(t *testing.T) {
 		port := ":" + strconv.Itoa(transportutil.GetRandomPort(5))
 
@@ -28,11 +28,16 @@ func NewOutbound() *OutboundClient {
 
 // Send sends a2a data via WS.
 func (cs *OutboundClient) Send(data []byte, url string) (string, error) {
+	return cs.SendContext(context.Background(), data, url)
+}
+
+// SendContext sends a2a data via WS, the dial, write and read are aborted when the context is done.
+func (cs *OutboundClient) SendContext(ctx context.Context, data []byte, url string) (string, error) {
 	if url == "" {
 		return "", errors.New("url is mandatory")
 	}
 
-	client, _, err := websocket.Dial(context.Background(), url, nil)
+	client, _, err := websocket.Dial(ctx, url, nil)
 	if err != nil {
 		return "", fmt.Errorf("websocket client : %w", err)
 	}
@@ -44,8 +49,6 @@ func (cs *OutboundClient) Send(data []byte, url string) (string, error) {
 		}
 	}()
 
-	ctx := context.Background()
-
 	err = client.Write(ctx, websocket.MessageText, data)
 	if err != nil {
 		return "", fmt.Errorf("websocket write message : %w", err)
@@ -57,6 +57,28 @@ func TestClient(t *testing.T) {
 		require.Equal(t, data, resp)
 	})
 
+	t.Run("test outbound transport - context deadline", func(t *testing.T) {
+		outbound := NewOutbound()
+		addr := startWebSocketServer(t, func(_ *testing.T, w http.ResponseWriter, r *http.Request) {
+			c, err := websocket.Accept(w, r, nil)
+			require.NoError(t, err)
+
+			// the slow peer never responds, it only reads the close frame
+			_, _, err = c.Read(r.Context())
+			require.NoError(t, err)
+
+			_, _, err = c.Read(r.Context())
+			require.Error(t, err)
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := outbound.SendContext(ctx, []byte("ws-request"), "ws://"+addr)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "websocket read message")
+	})
+
 	t.Run("test outbound transport - not a websocket server", func(t *testing.T) {
 		outbound := NewOutbound()
 		require.NotNil(t, outbound)
@@ -9,8 +9,12 @@ package api
 import (
 	"errors"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
@@ -30,6 +34,10 @@ type Provider interface {
 	VDRIRegistry() vdriapi.Registry
 	Signer() kms.Signer
 	TransientStorageProvider() storage.Provider
+	WorkerPool(name string) *workerpool.Pool
+	Metrics() metrics.Sink
+	Tracer() trace.Tracer
+	MessageHistory() *history.Archive
 }
 
 // ProtocolSvcCreator method to create new protocol service
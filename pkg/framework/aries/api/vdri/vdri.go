@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package vdri
 
 import (
+	"context"
 	"errors"
 	"io"
 	"time"
@@ -53,6 +54,8 @@ type ResolveDIDOpts struct {
 	VersionID   interface{}
 	VersionTime string
 	NoCache     bool
+	// Context aborts the resolution when done, nil means the resolution cannot be aborted
+	Context context.Context
 }
 
 // ResolveOpts is a did resolve option
@@ -65,6 +68,13 @@ func WithResultType(resultType ResultType) ResolveOpts {
 	}
 }
 
+// WithContext the context input option can be used to cancel the resolution or to set its deadline
+func WithContext(ctx context.Context) ResolveOpts {
+	return func(opts *ResolveDIDOpts) {
+		opts.Context = ctx
+	}
+}
+
 // WithVersionID the version id input option can be used to request a specific version of a DID Document
 func WithVersionID(versionID interface{}) ResolveOpts {
 	return func(opts *ResolveDIDOpts) {
@@ -91,7 +101,9 @@ type CreateDIDOpts struct {
 	ServiceType     string
 	KeyType         string
 	ServiceEndpoint string
-	RequestBuilder  func([]byte) (io.Reader, error)
+	// AdditionalServiceEndpoints are published as separate services with lower priority than ServiceEndpoint
+	AdditionalServiceEndpoints []string
+	RequestBuilder             func([]byte) (io.Reader, error)
 }
 
 // DocOpts is a create DID option
@@ -118,6 +130,14 @@ func WithServiceEndpoint(serviceEndpoint string) DocOpts {
 	}
 }
 
+// WithAdditionalServiceEndpoints allows for setting the service endpoints published in addition to
+// the service endpoint, the endpoints are given the priority in the given order
+func WithAdditionalServiceEndpoints(serviceEndpoints ...string) DocOpts {
+	return func(opts *CreateDIDOpts) {
+		opts.AdditionalServiceEndpoints = append(opts.AdditionalServiceEndpoints, serviceEndpoints...)
+	}
+}
+
 // WithRequestBuilder allows to supply request builder
 // which can be used to add headers to request stream to be sent to HTTP binding URL
 func WithRequestBuilder(builder func(payload []byte) (io.Reader, error)) DocOpts {
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packager"
@@ -58,13 +59,13 @@ func defFrameworkOpts(frameworkOpts *Aries) error {
 		frameworkOpts.storeProvider = storeProv
 	}
 
-	if frameworkOpts.inboundTransport == nil {
+	if len(frameworkOpts.inboundTransports) == 0 {
 		inbound, err := inboundTransport()
 		if err != nil {
 			return fmt.Errorf("http inbound transport initialization failed: %w", err)
 		}
 
-		frameworkOpts.inboundTransport = inbound
+		frameworkOpts.inboundTransports = append(frameworkOpts.inboundTransports, inbound)
 	}
 
 	frameworkOpts.protocolSvcCreators = append(frameworkOpts.protocolSvcCreators, newExchangeSvc())
@@ -100,9 +101,13 @@ func setAdditionalDefaultOpts(frameworkOpts *Aries) error {
 		}
 	}
 
+	if frameworkOpts.metrics == nil {
+		frameworkOpts.metrics = metrics.NewRegistry()
+	}
+
 	if frameworkOpts.packagerCreator == nil {
 		frameworkOpts.packagerCreator = func(prov packager.Provider) (transport.Packager, error) {
-			return packager.New(prov)
+			return packager.New(prov, packager.WithMetrics(frameworkOpts.metrics))
 		}
 	}
 
@@ -10,15 +10,15 @@ import (
 	"fmt"
 
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
-	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
 )
 
 func Example() {
 	// create the framework with user options
 	framework, err := New(
 		WithInboundTransport(newMockInTransport()),
-		WithStoreProvider(newMockDBProvider()),
-		WithTransientStoreProvider(newMockDBProvider()),
+		WithStoreProvider(mem.NewProvider()),
+		WithTransientStoreProvider(mem.NewProvider()),
 	)
 	if err != nil {
 		fmt.Println("failed to create framework")
@@ -56,22 +56,3 @@ func (c *mockInTransport) Stop() error {
 func (c *mockInTransport) Endpoint() string {
 	return "http://server"
 }
-
-// mock DB provider
-type mockDBProvider struct {
-}
-
-func newMockDBProvider() *mockDBProvider {
-	return &mockDBProvider{}
-}
-
-func (c *mockDBProvider) OpenStore(name string) (storage.Store, error) {
-	return nil, nil
-}
-
-func (c *mockDBProvider) CloseStore(name string) error {
-	return nil
-}
-func (c *mockDBProvider) Close() error {
-	return nil
-}
@@ -7,31 +7,55 @@ SPDX-License-Identifier: Apache-2.0
 package aries
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/ratelimit"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packager"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/introduce"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/replay"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 	"github.com/hyperledger/aries-framework-go/pkg/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/vdri/peer"
 )
 
+var logger = log.New("aries-framework/framework")
+
+// defaultShutdownTimeout is the default time Close waits for the in-flight messages and callbacks.
+const defaultShutdownTimeout = 10 * time.Second
+
+// ErrShutdownTimeout is returned by Close when the protocol services were not stopped in the shutdown timeout.
+var ErrShutdownTimeout = errors.New("shutdown timeout")
+
 // Aries provides access to the context being managed by the framework. The context can be used to create aries clients.
 type Aries struct {
 	storeProvider storage.Provider
 	// TODO Rename transient store to protocol state store https://github.com/hyperledger/aries-framework-go/issues/835
 	transientStoreProvider storage.Provider
 	protocolSvcCreators    []api.ProtocolSvcCreator
-	services               []dispatcher.Service
+	services               *dispatcher.ServiceRegistry
 	outboundDispatcher     dispatcher.Outbound
 	outboundTransports     []transport.OutboundTransport
-	inboundTransport       transport.InboundTransport
+	inboundTransports      []transport.InboundTransport
 	kmsCreator             api.KMSCreator
 	kms                    api.CloseableKMS
 	packagerCreator        packager.Creator
@@ -42,29 +66,55 @@ type Aries struct {
 	packers                []packer.Packer
 	vdriRegistry           vdriapi.Registry
 	vdri                   []vdriapi.VDRI
+	inboundMiddleware      []dispatcher.InboundMiddleware
+	outboundMiddleware     []dispatcher.OutboundMiddleware
+	outboxOpts             []outbox.Option
+	outboxEnabled          bool
+	outbox                 *outbox.Outbox
+	workerPoolOpts         []workerpool.Option
+	workerPools            *workerpool.Pools
+	shutdownTimeout        time.Duration
+	metrics                metrics.Sink
+	tracer                 trace.Tracer
+	historyEnabled         bool
+	historyOpts            []history.Option
+	middleware             *agentMiddleware
+	replayEnabled          bool
+	replayOpts             []replay.Option
+	addressRateLimiter     *ratelimit.Limiter
+	senderRateLimiter      *ratelimit.Limiter
+	schemas                []map[string]string
+	schemaRegistry         *schema.Registry
+	typeAliases            []msgtype.Option
+	typeNormalizer         *msgtype.Normalizer
+	multiTenancyEnabled    bool
+	multiKMS               *kms.MultiKMS
+	tenantStore            storage.Store
+	tenantsMu              sync.RWMutex
+	tenants                map[string]*tenant
 }
 
 // Option configures the framework.
 type Option func(opts *Aries) error
 
 // New initializes the Aries framework based on the set of options provided. This function returns a framework
-// which can be used to manage Aries clients by getting the framework context.
+// which can be used to manage Aries clients by getting the framework context. The resources opened so far are
+// released if the initialization fails.
 func New(opts ...Option) (*Aries, error) {
-	frameworkOpts := &Aries{}
+	frameworkOpts := &Aries{services: dispatcher.NewServiceRegistry(), shutdownTimeout: defaultShutdownTimeout}
 
 	// generate framework configs from options
 	for _, option := range opts {
 		err := option(frameworkOpts)
 		if err != nil {
-			closeErr := frameworkOpts.Close()
-			return nil, fmt.Errorf("close err: %v Error in option passed to New: %w", closeErr, err)
+			return nil, frameworkOpts.closeOnError(fmt.Errorf("error in option passed to New: %w", err))
 		}
 	}
 
 	// get the default framework options
 	err := defFrameworkOpts(frameworkOpts)
 	if err != nil {
-		return nil, fmt.Errorf("default option initialization failed: %w", err)
+		return nil, frameworkOpts.closeOnError(fmt.Errorf("default option initialization failed: %w", err))
 	}
 
 	// TODO: https://github.com/hyperledger/aries-framework-go/issues/212
@@ -75,38 +125,60 @@ func New(opts ...Option) (*Aries, error) {
 
 	// Order of initializing service is important
 
+	// the gauges of the pools are exported with the other metrics of the framework
+	poolOpts := append([]workerpool.Option{workerpool.WithMetrics(frameworkOpts.metrics)}, frameworkOpts.workerPoolOpts...)
+	frameworkOpts.workerPools = workerpool.NewPools(poolOpts...)
+
+	// Create schema registry of the inbound messages
+	if e := createSchemaRegistry(frameworkOpts); e != nil {
+		return nil, frameworkOpts.closeOnError(e)
+	}
+
 	// Create kms
 	if e := createKMS(frameworkOpts); e != nil {
-		return nil, e
+		return nil, frameworkOpts.closeOnError(e)
 	}
 
 	// Create vdri
 	if e := createVDRI(frameworkOpts); e != nil {
-		return nil, e
+		return nil, frameworkOpts.closeOnError(e)
 	}
 
 	// create packers and packager (must be done after KMS)
 	err = createPackersAndPackager(frameworkOpts)
 	if err != nil {
-		return nil, err
+		return nil, frameworkOpts.closeOnError(err)
+	}
+
+	// Create replay cache, message history and message type normalizer (must be done before the middleware
+	// is passed to the dispatchers)
+	err = createMiddleware(frameworkOpts)
+	if err != nil {
+		return nil, frameworkOpts.closeOnError(err)
 	}
 
 	// Create outbound dispatcher
 	err = createOutboundDispatcher(frameworkOpts)
 	if err != nil {
-		return nil, err
+		return nil, frameworkOpts.closeOnError(err)
 	}
 
 	// Load services
 	err = loadServices(frameworkOpts)
 	if err != nil {
-		return nil, err
+		return nil, frameworkOpts.closeOnError(err)
+	}
+
+	// Load tenants (must be done before the inbound transports route the envelopes to them)
+	err = loadTenants(frameworkOpts)
+	if err != nil {
+		return nil, frameworkOpts.closeOnError(err)
 	}
 
 	// Start inbound transport
 	err = startInboundTransport(frameworkOpts)
 	if err != nil {
-		return nil, err
+		return nil, frameworkOpts.closeOnError(err)
 	}
 
 	return frameworkOpts, nil
@@ -120,10 +192,11 @@ func WithOutboundTransports(outboundTransports ...transport.OutboundTransport) O
 	}
 }
 
-// WithInboundTransport injects an inbound transport to the Aries framework.
-func WithInboundTransport(inboundTransport transport.InboundTransport) Option {
+// WithInboundTransport injects the inbound transports to the Aries framework. All transports are started and
+// their endpoints are published in the created DID documents with the priority in the given order.
+func WithInboundTransport(inboundTransports ...transport.InboundTransport) Option {
 	return func(opts *Aries) error {
-		opts.inboundTransport = inboundTransport
+		opts.inboundTransports = append(opts.inboundTransports, inboundTransports...)
 		return nil
 	}
 }
@@ -179,52 +252,356 @@ func WithPacker(primary packer.Creator, additionalPackers ...packer.Creator) Opt
 	}
 }
 
+// WithInboundMiddleware injects the middleware invoked for the unpacked inbound messages before they are
+// dispatched to the protocol services. The middleware is invoked in the given order.
+func WithInboundMiddleware(middleware ...dispatcher.InboundMiddleware) Option {
+	return func(opts *Aries) error {
+		opts.inboundMiddleware = append(opts.inboundMiddleware, middleware...)
+		return nil
+	}
+}
+
+// WithOutboundMiddleware injects the middleware invoked for the outbound messages before they are packed
+// and sent by the outbound dispatcher. The middleware is invoked in the given order.
+func WithOutboundMiddleware(middleware ...dispatcher.OutboundMiddleware) Option {
+	return func(opts *Aries) error {
+		opts.outboundMiddleware = append(opts.outboundMiddleware, middleware...)
+		return nil
+	}
+}
+
+// WithOutbox enables the outbox: the outbound messages are persisted before sending and the failed deliveries
+// are retried with backoff until they are moved to the dead-letter store.
+func WithOutbox(outboxOpts ...outbox.Option) Option {
+	return func(opts *Aries) error {
+		opts.outboxEnabled = true
+		opts.outboxOpts = append(opts.outboxOpts, outboxOpts...)
+
+		return nil
+	}
+}
+
+// WithMessageHistory enables the message history: every inbound and outbound message and every protocol state
+// transition is archived with the connection it belongs to. The history of the connection is queried
+// by the DID exchange client.
+func WithMessageHistory(historyOpts ...history.Option) Option {
+	return func(opts *Aries) error {
+		opts.historyEnabled = true
+		opts.historyOpts = append(opts.historyOpts, historyOpts...)
+
+		return nil
+	}
+}
+
+// WithReplayProtection enables the replay cache: the inbound message already received from the sender
+// within the retention window is not passed to the protocol services again.
+func WithReplayProtection(replayOpts ...replay.Option) Option {
+	return func(opts *Aries) error {
+		opts.replayEnabled = true
+		opts.replayOpts = append(opts.replayOpts, replayOpts...)
+
+		return nil
+	}
+}
+
+// WithAddressRateLimit limits the inbound messages per remote address to rate messages per second with bursts
+// of up to burst messages. The messages are rejected before they are unpacked, the HTTP transport responds
+// with 429 and the WebSocket transport closes the connection.
+func WithAddressRateLimit(rate float64, burst int) Option {
+	return func(opts *Aries) error {
+		limiter, err := ratelimit.New(rate, burst)
+		if err != nil {
+			return fmt.Errorf("address rate limit: %w", err)
+		}
+
+		opts.addressRateLimiter = limiter
+
+		return nil
+	}
+}
+
+// WithSenderRateLimit limits the inbound messages per sender key to rate messages per second with bursts
+// of up to burst messages. The messages are rejected after they are unpacked, before they are dispatched
+// to the protocol services.
+func WithSenderRateLimit(rate float64, burst int) Option {
+	return func(opts *Aries) error {
+		limiter, err := ratelimit.New(rate, burst)
+		if err != nil {
+			return fmt.Errorf("sender rate limit: %w", err)
+		}
+
+		opts.senderRateLimiter = limiter
+
+		return nil
+	}
+}
+
+// WithMessageSchemas registers the JSON Schemas of the inbound messages by message type, they replace
+// the built-in schemas of the same message types. The inbound messages are validated against the schema
+// of their type before they are dispatched to the protocol services, the sender of the invalid message
+// is sent the problem report.
+func WithMessageSchemas(schemas map[string]string) Option {
+	return func(opts *Aries) error {
+		opts.schemas = append(opts.schemas, schemas)
+		return nil
+	}
+}
+
+// WithMessageTypeAlias aliases the message type prefix to the canonical one, e.g. the prefix of the protocol
+// renamed since the older agents were deployed. The inbound message types starting with the prefix are rewritten
+// before the messages are dispatched to the protocol services. The legacy did:sov prefix is always aliased
+// to https://didcomm.org/, the prefix of the outbound message types is chosen per connection by
+// the connection metadata.
+func WithMessageTypeAlias(prefix, canonical string) Option {
+	return func(opts *Aries) error {
+		if prefix == "" || canonical == "" {
+			return fmt.Errorf("invalid message type alias: %q to %q", prefix, canonical)
+		}
+
+		opts.typeAliases = append(opts.typeAliases, msgtype.WithAlias(prefix, canonical))
+
+		return nil
+	}
+}
+
+// WithWorkerPools configures the worker pools of the protocol services. Every service processes the inbound
+// messages by its own pool with the bounded queue, the message is rejected and the sender is asked to retry
+// later when the queue is full.
+func WithWorkerPools(poolOpts ...workerpool.Option) Option {
+	return func(opts *Aries) error {
+		opts.workerPoolOpts = append(opts.workerPoolOpts, poolOpts...)
+		return nil
+	}
+}
+
+// WithShutdownTimeout sets the time Close waits for the in-flight messages and callbacks to be processed
+// before the protocol services are abandoned and the stores are closed.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(opts *Aries) error {
+		opts.shutdownTimeout = timeout
+		return nil
+	}
+}
+
+// WithMetrics sets the sink receiving the metrics of the framework, e.g. the number of the messages received
+// and sent by the protocol and the message type. The metrics are kept in memory by metrics.Registry
+// by default, the registry exposes them in the Prometheus text format.
+func WithMetrics(sink metrics.Sink) Option {
+	return func(opts *Aries) error {
+		opts.metrics = sink
+		return nil
+	}
+}
+
+// WithTracer sets the tracer of the framework. The spans of the envelope received by the inbound transport,
+// its unpacking, handling and state transitions, the DID resolution and the outbound sending are correlated
+// by the thread ID of the message. Nothing is traced by default.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(opts *Aries) error {
+		opts.tracer = tracer
+		return nil
+	}
+}
+
 // Context provides a handle to the framework context.
 func (a *Aries) Context() (*context.Provider, error) {
 	return context.New(
 		context.WithOutboundDispatcher(a.outboundDispatcher),
 		context.WithOutboundTransports(a.outboundTransports...),
-		context.WithProtocolServices(a.services...),
+		context.WithServiceRegistry(a.services),
 		context.WithKMS(a.kms),
-		context.WithInboundTransportEndpoint(a.inboundTransport.Endpoint()),
+		context.WithInboundTransportEndpoint(a.inboundTransportEndpoints()...),
 		context.WithStorageProvider(a.storeProvider),
 		context.WithTransientStorageProvider(a.transientStoreProvider),
 		context.WithPacker(a.primaryPacker, a.packers...),
 		context.WithPackager(a.packager),
 		context.WithVDRIRegistry(a.vdriRegistry),
+		context.WithInboundMiddleware(a.middleware.inbound...),
+		context.WithOutbox(a.outbox),
+		context.WithWorkerPools(a.workerPools),
+		context.WithMetrics(a.metrics),
+		context.WithTracer(a.tracer),
+		context.WithMessageHistory(a.middleware.history),
+		context.WithRateLimiters(a.addressRateLimiter, a.senderRateLimiter),
+		context.WithSchemaRegistry(a.schemaRegistry),
+		context.WithMessageTypeNormalizer(a.typeNormalizer),
 	)
 }
 
-// Close frees resources being maintained by the framework.
+// RegisterService registers the protocol service while the framework is running, the inbound messages
+// accepted by the service are dispatched to it from then on.
+func (a *Aries) RegisterService(svc dispatcher.Service) error {
+	return a.services.Register(svc)
+}
+
+// ReplaceService replaces the running protocol service having the same name.
+func (a *Aries) ReplaceService(svc dispatcher.Service) error {
+	return a.services.Replace(svc)
+}
+
+// UnregisterService unregisters the protocol service with the given name, the inbound messages are not
+// dispatched to the service anymore.
+func (a *Aries) UnregisterService(name string) error {
+	return a.services.Unregister(name)
+}
+
+// Close frees resources being maintained by the framework. The inbound transports are stopped first, then
+// the in-flight messages and callbacks are processed and the protocol services are stopped, finally the outbox,
+// kms, stores and vdri are closed. Close keeps closing the resources if one fails to close and returns
+// the first error. If the services were not stopped in the shutdown timeout ErrShutdownTimeout is returned,
+// the resources the services are using are closed once they stop.
 func (a *Aries) Close() error {
+	var errs []error
+
+	for _, inbound := range a.inboundTransports {
+		if err := inbound.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("inbound transport close failed: %w", err))
+		}
+	}
+
+	return closeErr(append(errs, a.release()...))
+}
+
+// release stops the protocol services and closes the tenants and the resources of the framework,
+// it returns the errors of every step.
+func (a *Aries) release() []error {
+	var errs []error
+
+	stopped, err := stopServices(a.workerPools, a.services, a.shutdownTimeout)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// the resources of the framework are closed even if the tenants were not
+	if err := a.closeTenants(); err != nil {
+		errs = append(errs, err)
+	}
+
+	select {
+	case <-stopped:
+		errs = append(errs, a.closeResources()...)
+	default:
+		// the services still use the stores, they are closed once the services stop
+		go func() {
+			<-stopped
+
+			if err := closeErr(a.closeResources()); err != nil {
+				logger.Warnf("close after the shutdown timeout: %s", err)
+			}
+		}()
+	}
+
+	return errs
+}
+
+// closeResources closes the outbox, kms, stores and vdri, it returns the errors of every resource.
+func (a *Aries) closeResources() []error {
+	var errs []error
+
+	if a.outbox != nil {
+		if err := a.outbox.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the outbox: %w", err))
+		}
+	}
+
 	if a.kms != nil {
-		err := a.kms.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close the kms: %w", err)
+		if err := a.kms.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the kms: %w", err))
 		}
 	}
 
 	if a.storeProvider != nil {
-		err := a.storeProvider.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close the store: %w", err)
+		if err := a.storeProvider.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the store: %w", err))
 		}
 	}
 
 	if a.transientStoreProvider != nil {
-		err := a.transientStoreProvider.Close()
-		if err != nil {
-			return fmt.Errorf("failed to close the store: %w", err)
+		if err := a.transientStoreProvider.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the store: %w", err))
 		}
 	}
 
-	if a.inboundTransport != nil {
-		if err := a.inboundTransport.Stop(); err != nil {
-			return fmt.Errorf("inbound transport close failed: %w", err)
+	if err := a.closeVDRI(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// closeErr returns the first close error, the other errors are logged.
+func closeErr(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	for _, err := range errs[1:] {
+		logger.Warnf("close: %s", err)
+	}
+
+	return errs[0]
+}
+
+// closeOnError releases the resources opened by New before the initialization failed with the given error.
+// The inbound transports are not started then.
+func (a *Aries) closeOnError(err error) error {
+	if e := closeErr(a.release()); e != nil {
+		logger.Warnf("close after the initialization failed: %s", e)
+	}
+
+	return err
+}
+
+// actionEventBus is implemented by the protocol services publishing action events.
+type actionEventBus interface {
+	Close()
+}
+
+// stopServices processes the queued inbound messages and callbacks, then stops the protocol services.
+// The action event buses are closed first: the messages waiting for a consumer which stopped reading
+// the action events are processed, their action events stay pending. It gives up after the shutdown timeout,
+// the returned channel is closed once the services are stopped.
+func stopServices(pools *workerpool.Pools, services *dispatcher.ServiceRegistry,
+	timeout time.Duration) (<-chan struct{}, error) {
+	for _, svc := range services.Services() {
+		if bus, ok := svc.(actionEventBus); ok {
+			bus.Close()
 		}
 	}
 
-	return a.closeVDRI()
+	stopped := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		defer close(stopped)
+
+		pools.Stop()
+		done <- services.Stop()
+	}()
+
+	select {
+	case err := <-done:
+		<-stopped
+
+		if err != nil {
+			return stopped, fmt.Errorf("stop protocol services: %w", err)
+		}
+
+		return stopped, nil
+	case <-time.After(timeout):
+		return stopped, fmt.Errorf("stop protocol services: %w", ErrShutdownTimeout)
+	}
+}
+
+// inboundTransportEndpoints returns the endpoints of the inbound transports.
+func (a *Aries) inboundTransportEndpoints() []string {
+	endpoints := make([]string, len(a.inboundTransports))
+
+	for i, inbound := range a.inboundTransports {
+		endpoints[i] = inbound.Endpoint()
+	}
+
+	return endpoints
 }
 
 func (a *Aries) closeVDRI() error {
@@ -238,7 +615,7 @@ func (a *Aries) closeVDRI() error {
 }
 
 func createKMS(frameworkOpts *Aries) error {
-	ctx, err := context.New(context.WithInboundTransportEndpoint(frameworkOpts.inboundTransport.Endpoint()),
+	ctx, err := context.New(context.WithInboundTransportEndpoint(frameworkOpts.inboundTransportEndpoints()...),
 		context.WithStorageProvider(frameworkOpts.storeProvider))
 	if err != nil {
 		return fmt.Errorf("create context failed: %w", err)
@@ -249,59 +626,214 @@ func createKMS(frameworkOpts *Aries) error {
 		return fmt.Errorf("create kms failed: %w", err)
 	}
 
+	// the packers unpack the envelopes addressed to the tenants by their keys
+	if frameworkOpts.multiTenancyEnabled {
+		frameworkOpts.multiKMS = kms.NewMultiKMS(frameworkOpts.kms)
+	}
+
 	return nil
 }
 
 func createVDRI(frameworkOpts *Aries) error {
-	ctx, err := context.New(context.WithKMS(frameworkOpts.kms),
-		context.WithStorageProvider(frameworkOpts.storeProvider),
-		context.WithInboundTransportEndpoint(frameworkOpts.inboundTransport.Endpoint()))
+	var err error
+
+	frameworkOpts.vdriRegistry, err = frameworkOpts.newVDRIRegistry(frameworkOpts.kms, frameworkOpts.storeProvider)
+
+	return err
+}
+
+// newVDRIRegistry creates the VDRI registry creating the DIDs by the given KMS, the peer DIDs are stored
+// in the given store provider.
+func (a *Aries) newVDRIRegistry(k kms.KMS, storeProvider storage.Provider) (vdriapi.Registry, error) {
+	ctx, err := context.New(context.WithKMS(k),
+		context.WithStorageProvider(storeProvider),
+		context.WithInboundTransportEndpoint(a.inboundTransportEndpoints()...))
 	if err != nil {
-		return fmt.Errorf("create context failed: %w", err)
+		return nil, fmt.Errorf("create context failed: %w", err)
 	}
 
 	var opts []vdri.Option
-	for _, v := range frameworkOpts.vdri {
+	for _, v := range a.vdri {
 		opts = append(opts, vdri.WithVDRI(v))
 	}
 
 	p, err := peer.New(ctx.StorageProvider())
 	if err != nil {
-		return fmt.Errorf("create new vdri peer failed: %w", err)
+		return nil, fmt.Errorf("create new vdri peer failed: %w", err)
 	}
 
 	opts = append(opts, vdri.WithVDRI(p), vdri.WithDefaultServiceType(vdriapi.DIDCommServiceType),
-		vdri.WithDefaultServiceEndpoint(ctx.InboundTransportEndpoint()))
+		vdri.WithDefaultServiceEndpoint(ctx.InboundTransportEndpoints()...))
+
+	opts = append(opts, vdri.WithMetrics(a.metrics), vdri.WithTracer(a.tracer))
+
+	return vdri.New(ctx, opts...), nil
+}
+
+func createSchemaRegistry(frameworkOpts *Aries) error {
+	frameworkOpts.schemaRegistry = schema.NewRegistry()
 
-	frameworkOpts.vdriRegistry = vdri.New(ctx, opts...)
+	// the built-in protocol messages are validated by default
+	schemas := append([]map[string]string{didexchange.Schemas(), introduce.Schemas()}, frameworkOpts.schemas...)
+
+	for _, s := range schemas {
+		if err := frameworkOpts.schemaRegistry.RegisterAll(s); err != nil {
+			return fmt.Errorf("create schema registry failed: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// agentMiddleware is the message history and the middleware of the agent, either the framework itself
+// or its tenant. Every agent archives the messages and resolves the connections in its own stores.
+type agentMiddleware struct {
+	history  *history.Archive
+	inbound  []dispatcher.InboundMiddleware
+	outbound []dispatcher.OutboundMiddleware
+}
+
+func createMiddleware(frameworkOpts *Aries) error {
+	frameworkOpts.typeNormalizer = msgtype.NewNormalizer(frameworkOpts.typeAliases...)
+
+	var err error
+
+	frameworkOpts.middleware, err = frameworkOpts.newAgentMiddleware(frameworkOpts.storeProvider,
+		frameworkOpts.transientStoreProvider)
+
+	return err
+}
+
+// newAgentMiddleware creates the replay cache, the message history and the middleware of the agent whose
+// messages and connections are kept by the given store providers. The middleware injected by the options
+// is shared by all agents.
+func (a *Aries) newAgentMiddleware(storeProvider, transientStoreProvider storage.Provider) (*agentMiddleware, error) {
+	store, err := storeProvider.OpenStore(didexchange.DIDExchange)
+	if err != nil {
+		return nil, fmt.Errorf("open connection store failed: %w", err)
+	}
+
+	transientStore, err := transientStoreProvider.OpenStore(didexchange.DIDExchange)
+	if err != nil {
+		return nil, fmt.Errorf("open connection store failed: %w", err)
+	}
+
+	connections := didexchange.NewConnectionRecorder(transientStore, store)
+	m := &agentMiddleware{}
+
+	if a.replayEnabled {
+		ctx, e := context.New(context.WithTransientStorageProvider(transientStoreProvider))
+		if e != nil {
+			return nil, fmt.Errorf("context creation failed: %w", e)
+		}
+
+		cache, e := replay.New(ctx, a.replayOpts...)
+		if e != nil {
+			return nil, fmt.Errorf("create replay cache failed: %w", e)
+		}
+
+		// the duplicates are dropped before the message history and the middleware injected by the options see them
+		m.inbound = append(m.inbound, cache.Middleware())
+	}
+
+	if a.historyEnabled {
+		ctx, e := context.New(context.WithStorageProvider(storeProvider))
+		if e != nil {
+			return nil, fmt.Errorf("context creation failed: %w", e)
+		}
+
+		m.history, err = history.New(ctx,
+			append([]history.Option{history.WithConnectionLookup(connections)}, a.historyOpts...)...)
+		if err != nil {
+			return nil, fmt.Errorf("create message history failed: %w", err)
+		}
+
+		// the messages are archived before the middleware injected by the options rejects them
+		m.inbound = append(m.inbound, m.history.InboundMiddleware())
+		m.outbound = append(m.outbound, m.history.OutboundMiddleware())
+	}
+
+	m.inbound = append(m.inbound, a.inboundMiddleware...)
+	m.outbound = append(m.outbound, a.outboundMiddleware...)
+
+	// the prefix of the sender is recorded once the other middleware accepted the message
+	m.inbound = append(m.inbound, msgtype.InboundMiddleware(connections))
+
+	// the type is rewritten after any other middleware has seen the canonical one
+	m.outbound = append(m.outbound, msgtype.OutboundMiddleware(connections))
+
+	return m, nil
+}
+
 func createOutboundDispatcher(frameworkOpts *Aries) error {
 	ctx, err := context.New(context.WithKMS(frameworkOpts.kms),
 		context.WithOutboundTransports(frameworkOpts.outboundTransports...),
-		context.WithPackager(frameworkOpts.packager))
+		context.WithPackager(frameworkOpts.packager),
+		context.WithStorageProvider(frameworkOpts.storeProvider))
 	if err != nil {
 		return fmt.Errorf("context creation failed: %w", err)
 	}
 
-	frameworkOpts.outboundDispatcher = dispatcher.NewOutbound(ctx)
+	frameworkOpts.outboundDispatcher = frameworkOpts.newOutboundDispatcher(ctx, frameworkOpts.middleware)
+
+	if !frameworkOpts.outboxEnabled {
+		return nil
+	}
+
+	// the outbox persists the messages and retries the delivery through the outbound dispatcher
+	frameworkOpts.outbox, err = outbox.New(ctx, frameworkOpts.outboundDispatcher, frameworkOpts.outboxOpts...)
+	if err != nil {
+		return fmt.Errorf("create outbox failed: %w", err)
+	}
+
+	frameworkOpts.outboundDispatcher = frameworkOpts.outbox
 
 	return nil
 }
 
+// newOutboundDispatcher creates the outbound dispatcher sending the messages of the agent through the outbound
+// transports of the framework.
+func (a *Aries) newOutboundDispatcher(ctx *context.Provider, m *agentMiddleware) *dispatcher.OutboundDispatcher {
+	return dispatcher.NewOutbound(ctx,
+		dispatcher.WithOutboundMiddleware(m.outbound...),
+		dispatcher.WithOutboundMetrics(a.metrics),
+		dispatcher.WithOutboundTracer(a.tracer))
+}
+
 func startInboundTransport(frameworkOpts *Aries) error {
+	var router context.TenantRouter
+	if frameworkOpts.multiTenancyEnabled {
+		router = frameworkOpts.routeTenant
+	}
+
 	ctx, err := context.New(context.WithKMS(frameworkOpts.kms),
+		context.WithOutboundDispatcher(frameworkOpts.outboundDispatcher),
 		context.WithPackager(frameworkOpts.packager),
-		context.WithInboundTransportEndpoint(frameworkOpts.inboundTransport.Endpoint()),
-		context.WithProtocolServices(frameworkOpts.services...))
+		context.WithInboundTransportEndpoint(frameworkOpts.inboundTransportEndpoints()...),
+		context.WithServiceRegistry(frameworkOpts.services),
+		context.WithInboundMiddleware(frameworkOpts.middleware.inbound...),
+		context.WithWorkerPools(frameworkOpts.workerPools),
+		context.WithMetrics(frameworkOpts.metrics),
+		context.WithTracer(frameworkOpts.tracer),
+		context.WithRateLimiters(frameworkOpts.addressRateLimiter, frameworkOpts.senderRateLimiter),
+		context.WithSchemaRegistry(frameworkOpts.schemaRegistry),
+		context.WithMessageTypeNormalizer(frameworkOpts.typeNormalizer),
+		context.WithTenantRouter(router))
 	if err != nil {
 		return fmt.Errorf("context creation failed: %w", err)
 	}
-	// Start the inbound transport
-	if err = frameworkOpts.inboundTransport.Start(ctx); err != nil {
-		return fmt.Errorf("inbound transport start failed: %w", err)
+	// Start the inbound transports
+	for i, inbound := range frameworkOpts.inboundTransports {
+		if err = inbound.Start(ctx); err != nil {
+			// stop the transports started so far
+			for _, started := range frameworkOpts.inboundTransports[:i] {
+				if e := started.Stop(); e != nil {
+					logger.Warnf("failed to stop inbound transport %s: %s", started.Endpoint(), e)
+				}
+			}
+
+			return fmt.Errorf("inbound transport start failed: %w", err)
+		}
 	}
 
 	return nil
@@ -313,8 +845,12 @@ func loadServices(frameworkOpts *Aries) error {
 		context.WithTransientStorageProvider(frameworkOpts.transientStoreProvider),
 		context.WithKMS(frameworkOpts.kms),
 		context.WithPackager(frameworkOpts.packager),
-		context.WithInboundTransportEndpoint(frameworkOpts.inboundTransport.Endpoint()),
-		context.WithVDRIRegistry(frameworkOpts.vdriRegistry))
+		context.WithInboundTransportEndpoint(frameworkOpts.inboundTransportEndpoints()...),
+		context.WithVDRIRegistry(frameworkOpts.vdriRegistry),
+		context.WithWorkerPools(frameworkOpts.workerPools),
+		context.WithMetrics(frameworkOpts.metrics),
+		context.WithTracer(frameworkOpts.tracer),
+		context.WithMessageHistory(frameworkOpts.middleware.history))
 
 	if err != nil {
 		return fmt.Errorf("create context failed: %w", err)
@@ -326,14 +862,21 @@ func loadServices(frameworkOpts *Aries) error {
 			return fmt.Errorf("new protocol service failed: %w", svcErr)
 		}
 
-		frameworkOpts.services = append(frameworkOpts.services, svc)
+		if err = frameworkOpts.services.Register(svc); err != nil {
+			return fmt.Errorf("new protocol service failed: %w", err)
+		}
 	}
 
 	return nil
 }
 
 func createPackersAndPackager(frameworkOpts *Aries) error {
-	ctx, err := context.New(context.WithKMS(frameworkOpts.kms))
+	var k kms.KMS = frameworkOpts.kms
+	if frameworkOpts.multiKMS != nil {
+		k = frameworkOpts.multiKMS
+	}
+
+	ctx, err := context.New(context.WithKMS(k))
 	if err != nil {
 		return fmt.Errorf("create envelope context failed: %w", err)
 	}
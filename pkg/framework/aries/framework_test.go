@@ -9,21 +9,34 @@ SPDX-License-Identifier: Apache-2.0
 package aries
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/replay"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
@@ -238,6 +251,480 @@ func TestFramework(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("test register, replace and unregister service at runtime", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		inbound := &mockInboundTransport{}
+
+		aries, err := New(WithInboundTransport(inbound))
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, aries.Close()) }()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		handled := make(chan string, 1)
+		newSvc := func(id string) dispatcher.Service {
+			return &protocol.MockDIDExchangeSvc{
+				ProtocolName: "custom",
+				AcceptFunc: func(msgType string) bool {
+					return msgType == "custom-type"
+				},
+				HandleFunc: func(*service.DIDCommMsg) (string, error) {
+					handled <- id
+					return "", nil
+				},
+			}
+		}
+
+		envelope := &commontransport.Envelope{Message: []byte(`{"@id":"1","@type":"custom-type"}`)}
+
+		// the message is dispatched by the running inbound transport
+		require.NoError(t, aries.RegisterService(newSvc("first")))
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), envelope))
+		require.Equal(t, "first", <-handled)
+
+		svc, err := ctx.Service("custom")
+		require.NoError(t, err)
+		require.NotNil(t, svc)
+
+		err = aries.RegisterService(newSvc("duplicate"))
+		require.True(t, errors.Is(err, dispatcher.ErrServiceRegistered))
+
+		require.NoError(t, aries.ReplaceService(newSvc("second")))
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), envelope))
+		require.Equal(t, "second", <-handled)
+
+		require.NoError(t, aries.UnregisterService("custom"))
+
+		err = inbound.prov.InboundMessageHandler()(context.Background(), envelope)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no message handlers found for the message type: custom-type")
+
+		_, err = ctx.Service("custom")
+		require.Equal(t, api.ErrSvcNotFound, err)
+
+		err = aries.UnregisterService("custom")
+		require.True(t, errors.Is(err, dispatcher.ErrServiceNotRegistered))
+
+		err = aries.ReplaceService(newSvc("third"))
+		require.True(t, errors.Is(err, dispatcher.ErrServiceNotRegistered))
+	})
+
+	t.Run("test new with inbound and outbound middleware", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		var inbound, outbound []string
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithOutboundTransports(&didcomm.MockOutboundTransport{AcceptValue: true}),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return &protocol.MockDIDExchangeSvc{ProtocolName: "mockProtocolSvc"}, nil
+			}),
+			WithInboundMiddleware(func(next dispatcher.InboundHandler) dispatcher.InboundHandler {
+				return func(ctx context.Context, msg *service.DIDCommMsg, senderVerKey string,
+					recipientVerKeys []string) error {
+					inbound = append(inbound, senderVerKey)
+					return next(ctx, msg, senderVerKey, recipientVerKeys)
+				}
+			}),
+			WithOutboundMiddleware(func(next dispatcher.OutboundHandler) dispatcher.OutboundHandler {
+				return func(ctx context.Context, msg interface{}, senderVerKey string, des *service.Destination) error {
+					outbound = append(outbound, senderVerKey)
+					return next(ctx, msg, senderVerKey, des)
+				}
+			}))
+		require.NoError(t, err)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		_, senderKey, err := ctx.KMS().CreateKeySet()
+		require.NoError(t, err)
+
+		_, recipientKey, err := ctx.KMS().CreateKeySet()
+		require.NoError(t, err)
+
+		err = ctx.OutboundDispatcher().Send("data", senderKey,
+			&service.Destination{ServiceEndpoint: "url", RecipientKeys: []string{recipientKey}})
+		require.NoError(t, err)
+		require.Equal(t, []string{senderKey}, outbound)
+
+		err = ctx.InboundMessageHandler()(context.Background(), &commontransport.Envelope{
+			Message:    []byte(`{"@id": "1", "@type": "https://didcomm.org/test/1.0/message"}`),
+			FromVerKey: "sender",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"sender"}, inbound)
+
+		require.NoError(t, aries.Close())
+	})
+
+	t.Run("test new with outbox", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithOutboundTransports(&didcomm.MockOutboundTransport{AcceptValue: false}),
+			WithOutbox(outbox.WithMaxAttempts(1)))
+		require.NoError(t, err)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+		require.NotNil(t, ctx.Outbox())
+		require.Equal(t, ctx.Outbox(), ctx.OutboundDispatcher())
+
+		// the failed delivery is moved to the dead-letter store
+		err = ctx.OutboundDispatcher().Send("data", "sender", &service.Destination{ServiceEndpoint: "url"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "moved to dead-letter store")
+
+		deadLetters, err := ctx.Outbox().DeadLetters()
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		require.Contains(t, deadLetters[0].LastError, "no outbound transport found for serviceEndpoint: url")
+
+		require.NoError(t, aries.Close())
+	})
+
+	t.Run("test new with worker pools", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithWorkerPools(workerpool.WithPool(didexchange.DIDExchange, 3, 4)))
+		require.NoError(t, err)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		// the pools of the did exchange service are created when the service is loaded
+		require.Equal(t, []workerpool.Metrics{
+			{Name: didexchange.DIDExchange, Workers: 3, QueueSize: 4},
+			{Name: didexchange.CallbackPool, Workers: workerpool.DefaultWorkers, QueueSize: workerpool.DefaultQueueSize},
+		}, ctx.WorkerPoolMetrics())
+
+		// the pools are stopped
+		require.NoError(t, aries.Close())
+		require.Equal(t, workerpool.ErrStopped, ctx.WorkerPool(didexchange.DIDExchange).Submit(func() {}))
+	})
+
+	t.Run("test new with metrics", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}))
+		require.NoError(t, err)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		// the metrics are exported in the Prometheus text format by default
+		exporter, ok := ctx.Metrics().(metrics.Exporter)
+		require.True(t, ok)
+
+		// the gauges of the worker pools are exported with the other metrics
+		var buf bytes.Buffer
+		require.NoError(t, exporter.WritePrometheus(&buf))
+		require.Contains(t, buf.String(), fmt.Sprintf(`aries_worker_pool_workers{pool=%q} %d`,
+			didexchange.DIDExchange, workerpool.DefaultWorkers))
+		require.Contains(t, buf.String(), fmt.Sprintf(`aries_worker_pool_queue_size{pool=%q} %d`,
+			didexchange.DIDExchange, workerpool.DefaultQueueSize))
+		require.NoError(t, aries.Close())
+
+		sink := &recordingSink{}
+
+		aries, err = New(WithInboundTransport(&mockInboundTransport{endpoint: "http://localhost:8080"}), WithMetrics(sink))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err = aries.Context()
+		require.NoError(t, err)
+		require.True(t, ctx.Metrics() == sink)
+
+		doc, err := ctx.VDRIRegistry().Create("peer")
+		require.NoError(t, err)
+
+		_, err = ctx.VDRIRegistry().Resolve(doc.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{metrics.VDRIResolveDuration}, sink.observed)
+	})
+
+	t.Run("test new with tracer", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		exporter := trace.NewInMemoryExporter()
+		tracer := trace.NewTracer(exporter)
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{endpoint: "http://localhost:8080"}),
+			WithTracer(tracer))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+		require.True(t, ctx.Tracer() == tracer)
+
+		doc, err := ctx.VDRIRegistry().Create("peer")
+		require.NoError(t, err)
+
+		_, err = ctx.VDRIRegistry().Resolve(doc.ID)
+		require.NoError(t, err)
+
+		spans := exporter.Spans()
+		require.Len(t, spans, 1)
+		require.Equal(t, trace.ResolveSpan, spans[0].Name)
+	})
+
+	t.Run("test new with message history", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{endpoint: "http://localhost:8080"}),
+			WithMessageHistory())
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+		require.NotNil(t, ctx.MessageHistory())
+
+		entries, err := ctx.MessageHistory().Messages("conn")
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("test new with replay protection", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		inbound := &mockInboundTransport{}
+		handled := make(chan string, 2)
+
+		aries, err := New(WithInboundTransport(inbound), WithReplayProtection(replay.WithRetention(time.Hour)),
+			WithMessageHistory(), WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return &protocol.MockDIDExchangeSvc{
+					ProtocolName: "custom",
+					AcceptFunc: func(msgType string) bool {
+						return msgType == "custom-type"
+					},
+					HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+						handled <- msg.Header.ID
+						return "", nil
+					},
+				}, nil
+			}))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		envelope := &commontransport.Envelope{Message: []byte(`{"@id":"1","@type":"custom-type"}`),
+			FromVerKey: "sender"}
+
+		// the replayed message is not handled again
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), envelope))
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), envelope))
+
+		envelope.Message = []byte(`{"@id":"2","@type":"custom-type"}`)
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), envelope))
+
+		require.Equal(t, "1", <-handled)
+		require.Equal(t, "2", <-handled)
+
+		// the replayed message is dropped before it is archived
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		entries, err := ctx.MessageHistory().Messages("conn", "1", "2")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+	})
+
+	t.Run("test new with rate limits", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		inbound := &mockInboundTransport{}
+
+		aries, err := New(WithInboundTransport(inbound), WithAddressRateLimit(10, 20), WithSenderRateLimit(1, 5))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+		require.NotNil(t, ctx.AddressRateLimiter())
+		require.NotNil(t, ctx.SenderRateLimiter())
+
+		// the limits are applied by the started inbound transports
+		prov, ok := inbound.prov.(transport.RateLimitingProvider)
+		require.True(t, ok)
+		require.True(t, prov.AddressRateLimiter() == ctx.AddressRateLimiter())
+		require.True(t, prov.SenderRateLimiter() == ctx.SenderRateLimiter())
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{}), WithAddressRateLimit(0, 1))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "address rate limit: invalid rate")
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{}), WithSenderRateLimit(1, 0))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "sender rate limit: invalid burst")
+	})
+
+	t.Run("test new with message schemas", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		const customType = "https://didcomm.org/custom/1.0/message"
+
+		handled := make(chan string, 2)
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithMessageSchemas(map[string]string{customType: `{"required": ["content"]}`}),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return &protocol.MockDIDExchangeSvc{
+					ProtocolName: "custom",
+					HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+						handled <- msg.Header.ID
+						return "", nil
+					},
+				}, nil
+			}))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		// the built-in and the custom schemas are applied before the dispatch
+		for _, msg := range []string{
+			`{"@id": "1", "@type": "` + didexchange.RequestMsgType + `"}`,
+			`{"@id": "2", "@type": "` + customType + `"}`,
+		} {
+			err = ctx.InboundMessageHandler()(context.Background(), &commontransport.Envelope{Message: []byte(msg)})
+
+			var validationErr *schema.ValidationError
+			require.True(t, errors.As(err, &validationErr))
+		}
+
+		err = ctx.InboundMessageHandler()(context.Background(), &commontransport.Envelope{
+			Message: []byte(`{"@id": "3", "@type": "` + customType + `", "content": "hello"}`)})
+		require.NoError(t, err)
+		require.Equal(t, "3", <-handled)
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{}),
+			WithMessageSchemas(map[string]string{customType: `{"type": 1}`}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create schema registry failed")
+	})
+
+	t.Run("test new with message type alias", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		const customType = "https://didcomm.org/custom/1.0/message"
+
+		handled := make(chan string, 1)
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithMessageTypeAlias(msgtype.LegacyPrefix+"custom/0.1/", "https://didcomm.org/custom/1.0/"),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return &protocol.MockDIDExchangeSvc{
+					ProtocolName: "custom",
+					AcceptFunc: func(msgType string) bool {
+						return msgType == customType
+					},
+					HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+						handled <- msg.Header.Type
+						return "", nil
+					},
+				}, nil
+			}))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		err = ctx.InboundMessageHandler()(context.Background(), &commontransport.Envelope{
+			Message: []byte(`{"@id": "1", "@type": "` + msgtype.LegacyPrefix + `custom/0.1/message"}`)})
+		require.NoError(t, err)
+		require.Equal(t, customType, <-handled)
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{}), WithMessageTypeAlias("", customType))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid message type alias")
+	})
+
+	t.Run("test error from replay protection", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithReplayProtection(replay.WithRetention(-1)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create replay cache failed")
+	})
+
+	t.Run("test error from message history", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithMessageHistory(),
+			WithStoreProvider(&storage.MockStoreProvider{FailNameSpace: history.StoreName}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create message history failed")
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{}), WithMessageHistory(history.WithRetention(-1)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid retention")
+	})
+
+	t.Run("test error from outbox", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithOutbox(outbox.WithMaxAttempts(-1)))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "create outbox failed")
+	})
+
 	t.Run("test error from protocol service", func(t *testing.T) {
 		path, cleanup := generateTempDir(t)
 		defer cleanup()
@@ -290,18 +777,82 @@ func TestFramework(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "inbound transport start failed")
 
+		// the stores opened by New were closed, the agent can be created again
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}))
+		require.NoError(t, err)
+		require.NoError(t, aries.Close())
+
 		path, cleanup = generateTempDir(t)
 		defer cleanup()
 		dbPath = path
 
 		// stop error
-		aries, err := New(WithInboundTransport(&mockInboundTransport{stopError: errors.New("stop error")}))
+		other := &mockInboundTransport{}
+		aries, err = New(WithInboundTransport(&mockInboundTransport{stopError: errors.New("stop error")}, other))
 		require.NoError(t, err)
 		require.NotEmpty(t, aries)
 
 		err = aries.Close()
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "inbound transport close failed")
+
+		// the other transport and the stores were closed anyway
+		require.False(t, other.started)
+
+		aries, err = New(WithInboundTransport(&mockInboundTransport{}))
+		require.NoError(t, err)
+		require.NoError(t, aries.Close())
+	})
+
+	t.Run("test multiple inbound transports", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		httpInbound := &mockInboundTransport{endpoint: "http://localhost:8090"}
+		wsInbound := &mockInboundTransport{endpoint: "ws://localhost:8091"}
+
+		aries, err := New(WithInboundTransport(httpInbound, wsInbound))
+		require.NoError(t, err)
+		require.True(t, httpInbound.started)
+		require.True(t, wsInbound.started)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+		require.Equal(t, "http://localhost:8090", ctx.InboundTransportEndpoint())
+		require.Equal(t, []string{"http://localhost:8090", "ws://localhost:8091"}, ctx.InboundTransportEndpoints())
+
+		// every endpoint is published as a separate service
+		doc, err := ctx.VDRIRegistry().Create("peer")
+		require.NoError(t, err)
+		require.Len(t, doc.Service, 2)
+		require.Equal(t, "http://localhost:8090", doc.Service[0].ServiceEndpoint)
+		require.Equal(t, "ws://localhost:8091", doc.Service[1].ServiceEndpoint)
+		require.Equal(t, uint(1), doc.Service[1].Priority)
+
+		require.NoError(t, aries.Close())
+		require.False(t, httpInbound.started)
+		require.False(t, wsInbound.started)
+
+		path, cleanup = generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		// the started transports are stopped if the other transport fails to start
+		httpInbound = &mockInboundTransport{}
+		_, err = New(WithInboundTransport(httpInbound, &mockInboundTransport{startError: errors.New("start error")}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "inbound transport start failed")
+		require.False(t, httpInbound.started)
+
+		path, cleanup = generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		_, err = New(WithInboundTransport(&mockInboundTransport{stopError: errors.New("stop error")},
+			&mockInboundTransport{startError: errors.New("start error")}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "start error")
 	})
 
 	t.Run("test kms svc - with user provided kms", func(t *testing.T) {
@@ -368,6 +919,155 @@ func TestFramework(t *testing.T) {
 	})
 }
 
+func TestFramework_Close(t *testing.T) {
+	t.Run("test protocol services are stopped", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		var stopped []string
+
+		inbound := &mockInboundTransport{}
+		svc := &stoppableService{MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{ProtocolName: "mockProtocolSvc"},
+			stop: func() error {
+				// the inbound transport is stopped before the services
+				require.False(t, inbound.started)
+
+				stopped = append(stopped, "mockProtocolSvc")
+
+				return nil
+			}}
+
+		aries, err := New(WithInboundTransport(inbound), WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+			return svc, nil
+		}))
+		require.NoError(t, err)
+
+		require.NoError(t, aries.Close())
+		require.Equal(t, []string{"mockProtocolSvc"}, stopped)
+	})
+
+	t.Run("test error from stopping the protocol service", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		svc := &stoppableService{MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{ProtocolName: "mockProtocolSvc"},
+			stop: func() error { return errors.New("stop error") }}
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return svc, nil
+			}))
+		require.NoError(t, err)
+
+		err = aries.Close()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "mockProtocolSvc: stop error")
+	})
+
+	t.Run("test shutdown timeout", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		release := make(chan struct{})
+
+		svc := &stoppableService{MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{ProtocolName: "mockProtocolSvc"},
+			stop: func() error {
+				<-release
+				return nil
+			}}
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithShutdownTimeout(10*time.Millisecond),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				return svc, nil
+			}))
+		require.NoError(t, err)
+
+		err = aries.Close()
+		require.True(t, errors.Is(err, ErrShutdownTimeout))
+
+		// the stores are still used by the service which was not stopped
+		_, err = New(WithInboundTransport(&mockInboundTransport{}))
+		require.Error(t, err)
+
+		close(release)
+
+		// the stores were closed once the service stopped, the agent can be created again
+		require.Eventually(t, func() bool {
+			aries, err = New(WithInboundTransport(&mockInboundTransport{}))
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		require.NoError(t, aries.Close())
+	})
+
+	t.Run("test action events not read by the consumer do not block the shutdown", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithShutdownTimeout(5*time.Second))
+		require.NoError(t, err)
+
+		ctx, err := aries.Context()
+		require.NoError(t, err)
+
+		svc, err := ctx.Service(didexchange.DIDExchange)
+		require.NoError(t, err)
+
+		// the consumer stopped reading the action events
+		require.NoError(t, svc.(*didexchange.Service).RegisterActionEvent(make(chan service.DIDCommAction)))
+
+		for i := 0; i < 3; i++ {
+			msg, err := service.NewDIDCommMsg([]byte(fmt.Sprintf(
+				`{"@type":%q,"@id":"invitation-%d","label":"Bob","recipientKeys":["key-%d"],`+
+					`"serviceEndpoint":"http://bob.example.com"}`, didexchange.InvitationMsgType, i, i)))
+			require.NoError(t, err)
+
+			_, err = svc.(*didexchange.Service).HandleInbound(msg)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, aries.Close())
+	})
+
+	t.Run("test agents are created and closed without leaking goroutines", func(t *testing.T) {
+		newAgent := func() {
+			path, cleanup := generateTempDir(t)
+			defer cleanup()
+			dbPath = path
+
+			aries, err := New(WithInboundTransport(&mockInboundTransport{}))
+			require.NoError(t, err)
+
+			ctx, err := aries.Context()
+			require.NoError(t, err)
+
+			// the action event dispatcher of the service is started
+			svc, err := ctx.Service(didexchange.DIDExchange)
+			require.NoError(t, err)
+			require.NoError(t, svc.(*didexchange.Service).RegisterActionEvent(make(chan service.DIDCommAction)))
+
+			require.NoError(t, aries.Close())
+		}
+
+		// the first agent starts the goroutines living for the lifetime of the process
+		newAgent()
+
+		goroutines := runtime.NumGoroutine()
+
+		for i := 0; i < 3; i++ {
+			newAgent()
+		}
+
+		for i := 0; runtime.NumGoroutine() > goroutines; i++ {
+			require.True(t, i < 100, "goroutines leaked: %d > %d", runtime.NumGoroutine(), goroutines)
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
 func Test_Packager(t *testing.T) {
 	t.Run("test error from packager svc - primary packer", func(t *testing.T) {
 		f, err := New(WithInboundTransport(&mockInboundTransport{}),
@@ -447,9 +1147,33 @@ func getServerPort(server net.Listener) int {
 	return server.Addr().(*net.TCPAddr).Port
 }
 
+type recordingSink struct {
+	observed []string
+}
+
+func (s *recordingSink) IncCounter(string, metrics.Labels) {}
+
+func (s *recordingSink) AddGauge(string, float64, metrics.Labels) {}
+
+func (s *recordingSink) Observe(name string, _ float64, _ metrics.Labels) {
+	s.observed = append(s.observed, name)
+}
+
+type stoppableService struct {
+	*protocol.MockDIDExchangeSvc
+	stop func() error
+}
+
+func (s *stoppableService) Stop() error {
+	return s.stop()
+}
+
 type mockInboundTransport struct {
 	startError error
 	stopError  error
+	endpoint   string
+	started    bool
+	prov       transport.InboundProvider
 }
 
 func (m *mockInboundTransport) Start(prov transport.InboundProvider) error {
@@ -457,6 +1181,9 @@ func (m *mockInboundTransport) Start(prov transport.InboundProvider) error {
 		return m.startError
 	}
 
+	m.started = true
+	m.prov = prov
+
 	return nil
 }
 
@@ -465,9 +1192,11 @@ func (m *mockInboundTransport) Stop() error {
 		return m.stopError
 	}
 
+	m.started = false
+
 	return nil
 }
 
 func (m *mockInboundTransport) Endpoint() string {
-	return ""
+	return m.endpoint
 }
@@ -0,0 +1,496 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package aries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
+	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/namespace"
+)
+
+const (
+	tenantStoreName = "tenants"
+	tenantKeyPrefix = "tenant_"
+	// limitPattern with `~` at the end for lte of given prefix (less than or equal)
+	limitPattern = "%s~"
+)
+
+var (
+	// ErrMultiTenancyDisabled is returned by the tenant operations if the framework was created
+	// without WithMultiTenancy.
+	ErrMultiTenancyDisabled = errors.New("multi-tenancy is not enabled")
+
+	// ErrInvalidTenantID is returned by CreateTenant if the tenant ID is not valid.
+	ErrInvalidTenantID = errors.New("invalid tenant ID")
+
+	// ErrTenantExists is returned by CreateTenant if the tenant with the given ID exists.
+	ErrTenantExists = errors.New("tenant already exists")
+
+	// ErrTenantNotFound is returned if the tenant with the given ID does not exist.
+	ErrTenantNotFound = errors.New("tenant not found")
+
+	// ErrTenantRemoved is returned by CreateTenant if the tenant with the given ID was removed, the removed
+	// tenant is restored by RestoreTenant.
+	ErrTenantRemoved = errors.New("tenant was removed")
+)
+
+// the tenant ID is a part of the store names, the underscore separates the namespace from the store name
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9-]{1,64}$`) //nolint:gochecknoglobals
+
+// tenant is the agent sharing the transports of the framework with its isolated keys, stores
+// and protocol services.
+type tenant struct {
+	id                     string
+	storeProvider          *namespace.Provider
+	transientStoreProvider *namespace.Provider
+	kms                    api.CloseableKMS
+	vdriRegistry           vdriapi.Registry
+	services               *dispatcher.ServiceRegistry
+	workerPools            *workerpool.Pools
+	middleware             *agentMiddleware
+	outboundDispatcher     dispatcher.Outbound
+	ctx                    *context.Provider
+	handler                transport.InboundMessageHandler
+}
+
+// tenantRecord is the persisted tenant, the removed tenant is kept with the flag as the stores
+// can't delete the records.
+type tenantRecord struct {
+	ID      string `json:"id"`
+	Removed bool   `json:"removed,omitempty"`
+}
+
+// WithMultiTenancy enables the tenants sharing the inbound and outbound transports of the framework. Every tenant
+// has its own KMS keystore, stores, connection records and protocol services, the inbound envelopes are routed
+// to the tenant owning the recipient key after they are unpacked. The tenants are created by CreateTenant
+// and they are restored by New until they are removed, the removed tenants are restored by RestoreTenant.
+func WithMultiTenancy() Option {
+	return func(opts *Aries) error {
+		opts.multiTenancyEnabled = true
+		return nil
+	}
+}
+
+// CreateTenant creates the tenant with the given ID, the ID consists of up to 64 lowercase letters, digits
+// and hyphens. The ID of the removed tenant is not reused as the store provider keeps the data of the removed
+// tenant, ErrTenantRemoved is returned then.
+func (a *Aries) CreateTenant(id string) error {
+	if !a.multiTenancyEnabled {
+		return ErrMultiTenancyDisabled
+	}
+
+	if !tenantIDPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenantID, id)
+	}
+
+	a.tenantsMu.Lock()
+	defer a.tenantsMu.Unlock()
+
+	if _, ok := a.tenants[id]; ok {
+		return fmt.Errorf("create tenant %s: %w", id, ErrTenantExists)
+	}
+
+	record, err := a.getTenantRecord(id)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("create tenant %s: %w", id, err)
+	}
+
+	if record != nil && record.Removed {
+		return fmt.Errorf("create tenant %s: %w", id, ErrTenantRemoved)
+	}
+
+	return a.activateTenant(id)
+}
+
+// RestoreTenant restores the removed tenant with its keys and stores.
+func (a *Aries) RestoreTenant(id string) error {
+	if !a.multiTenancyEnabled {
+		return ErrMultiTenancyDisabled
+	}
+
+	a.tenantsMu.Lock()
+	defer a.tenantsMu.Unlock()
+
+	if _, ok := a.tenants[id]; ok {
+		return fmt.Errorf("restore tenant %s: %w", id, ErrTenantExists)
+	}
+
+	record, err := a.getTenantRecord(id)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("restore tenant %s: %w", id, ErrTenantNotFound)
+	}
+
+	if err != nil {
+		return fmt.Errorf("restore tenant %s: %w", id, err)
+	}
+
+	if !record.Removed {
+		return fmt.Errorf("restore tenant %s: %w", id, ErrTenantExists)
+	}
+
+	return a.activateTenant(id)
+}
+
+// activateTenant starts the tenant and persists it, the caller holds the tenants lock.
+func (a *Aries) activateTenant(id string) error {
+	t, err := a.startTenant(id)
+	if err != nil {
+		return err
+	}
+
+	if err = a.putTenantRecord(&tenantRecord{ID: id}); err != nil {
+		if e := a.closeTenant(t); e != nil {
+			logger.Warnf("failed to close tenant %s: %s", id, e)
+		}
+
+		return fmt.Errorf("activate tenant %s: %w", id, err)
+	}
+
+	a.addTenant(t)
+
+	return nil
+}
+
+// RemoveTenant stops the protocol services of the tenant and closes its KMS and stores, the envelopes
+// addressed to the tenant are not routed to it anymore. The data of the tenant is kept by the store provider
+// until the tenant is restored by RestoreTenant.
+func (a *Aries) RemoveTenant(id string) error {
+	if !a.multiTenancyEnabled {
+		return ErrMultiTenancyDisabled
+	}
+
+	a.tenantsMu.Lock()
+
+	t, ok := a.tenants[id]
+	if !ok {
+		a.tenantsMu.Unlock()
+		return fmt.Errorf("remove tenant %s: %w", id, ErrTenantNotFound)
+	}
+
+	err := a.putTenantRecord(&tenantRecord{ID: id, Removed: true})
+	if err != nil {
+		a.tenantsMu.Unlock()
+		return fmt.Errorf("remove tenant %s: %w", id, err)
+	}
+
+	delete(a.tenants, id)
+	a.multiKMS.Remove(id)
+	a.tenantsMu.Unlock()
+
+	if err = a.closeTenant(t); err != nil {
+		return fmt.Errorf("remove tenant %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// Tenants returns the sorted IDs of the tenants.
+func (a *Aries) Tenants() []string {
+	a.tenantsMu.RLock()
+	defer a.tenantsMu.RUnlock()
+
+	ids := make([]string, 0, len(a.tenants))
+	for id := range a.tenants {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// TenantContext provides a handle to the context of the tenant, the clients created from it act
+// on behalf of the tenant. The tenant has its own message history, the outbox of the framework is not available
+// to the tenants.
+func (a *Aries) TenantContext(id string) (*context.Provider, error) {
+	if !a.multiTenancyEnabled {
+		return nil, ErrMultiTenancyDisabled
+	}
+
+	a.tenantsMu.RLock()
+	defer a.tenantsMu.RUnlock()
+
+	t, ok := a.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant %s: %w", id, ErrTenantNotFound)
+	}
+
+	return t.ctx, nil
+}
+
+// routeTenant returns the inbound message handler of the tenant owning one of the recipient keys.
+func (a *Aries) routeTenant(recipientVerKeys []string) transport.InboundMessageHandler {
+	id, ok := a.multiKMS.FindOwner(recipientVerKeys)
+	if !ok {
+		return nil
+	}
+
+	a.tenantsMu.RLock()
+	defer a.tenantsMu.RUnlock()
+
+	if t, ok := a.tenants[id]; ok {
+		return t.handler
+	}
+
+	return nil
+}
+
+func (a *Aries) getTenantRecord(id string) (*tenantRecord, error) {
+	bytes, err := a.tenantStore.Get(tenantKeyPrefix + id)
+	if err != nil {
+		return nil, fmt.Errorf("get tenant record: %w", err)
+	}
+
+	record := &tenantRecord{}
+	if err = json.Unmarshal(bytes, record); err != nil {
+		return nil, fmt.Errorf("unmarshal tenant record: %w", err)
+	}
+
+	return record, nil
+}
+
+func (a *Aries) putTenantRecord(record *tenantRecord) error {
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal tenant record: %w", err)
+	}
+
+	if err = a.tenantStore.Put(tenantKeyPrefix+record.ID, bytes); err != nil {
+		return fmt.Errorf("save tenant record: %w", err)
+	}
+
+	return nil
+}
+
+// startTenant creates the KMS, stores and protocol services of the tenant, the resources created so far
+// are closed on failure.
+func (a *Aries) startTenant(id string) (*tenant, error) {
+	t, err := a.newTenant(id)
+	if err != nil {
+		if e := a.closeTenant(t); e != nil {
+			logger.Warnf("failed to close tenant %s: %s", id, e)
+		}
+
+		return nil, fmt.Errorf("start tenant %s: %w", id, err)
+	}
+
+	return t, nil
+}
+
+// addTenant routes the envelopes addressed to the tenant to it, the caller holds the tenants lock.
+func (a *Aries) addTenant(t *tenant) {
+	a.tenants[t.id] = t
+	a.multiKMS.Add(t.id, t.kms)
+}
+
+func (a *Aries) newTenant(id string) (*tenant, error) {
+	t := &tenant{
+		id:                     id,
+		storeProvider:          namespace.NewProvider(a.storeProvider, tenantKeyPrefix+id),
+		transientStoreProvider: namespace.NewProvider(a.transientStoreProvider, tenantKeyPrefix+id),
+		services:               dispatcher.NewServiceRegistry(),
+		workerPools:            workerpool.NewPools(a.workerPoolOpts...),
+	}
+
+	ctx, err := context.New(context.WithInboundTransportEndpoint(a.inboundTransportEndpoints()...),
+		context.WithStorageProvider(t.storeProvider))
+	if err != nil {
+		return t, fmt.Errorf("create context failed: %w", err)
+	}
+
+	t.kms, err = a.kmsCreator(ctx)
+	if err != nil {
+		return t, fmt.Errorf("create kms failed: %w", err)
+	}
+
+	t.vdriRegistry, err = a.newVDRIRegistry(t.kms, t.storeProvider)
+	if err != nil {
+		return t, err
+	}
+
+	// the messages of the tenant are archived and checked for replays in the stores of the tenant
+	t.middleware, err = a.newAgentMiddleware(t.storeProvider, t.transientStoreProvider)
+	if err != nil {
+		return t, err
+	}
+
+	ctx, err = context.New(context.WithOutboundTransports(a.outboundTransports...), context.WithPackager(a.packager))
+	if err != nil {
+		return t, fmt.Errorf("create context failed: %w", err)
+	}
+
+	t.outboundDispatcher = a.newOutboundDispatcher(ctx, t.middleware)
+
+	// the tenant shares the transports, packers and type normalizer of the framework
+	t.ctx, err = context.New(
+		context.WithOutboundDispatcher(t.outboundDispatcher),
+		context.WithOutboundTransports(a.outboundTransports...),
+		context.WithServiceRegistry(t.services),
+		context.WithKMS(t.kms),
+		context.WithInboundTransportEndpoint(a.inboundTransportEndpoints()...),
+		context.WithStorageProvider(t.storeProvider),
+		context.WithTransientStorageProvider(t.transientStoreProvider),
+		context.WithPacker(a.primaryPacker, a.packers...),
+		context.WithPackager(a.packager),
+		context.WithVDRIRegistry(t.vdriRegistry),
+		context.WithInboundMiddleware(t.middleware.inbound...),
+		context.WithWorkerPools(t.workerPools),
+		context.WithMetrics(a.metrics),
+		context.WithTracer(a.tracer),
+		context.WithMessageHistory(t.middleware.history),
+		context.WithRateLimiters(a.addressRateLimiter, a.senderRateLimiter),
+		context.WithSchemaRegistry(a.schemaRegistry),
+		context.WithMessageTypeNormalizer(a.typeNormalizer),
+	)
+	if err != nil {
+		return t, fmt.Errorf("create context failed: %w", err)
+	}
+
+	for _, v := range a.protocolSvcCreators {
+		svc, svcErr := v(t.ctx)
+		if svcErr != nil {
+			return t, fmt.Errorf("new protocol service failed: %w", svcErr)
+		}
+
+		if err = t.services.Register(svc); err != nil {
+			return t, fmt.Errorf("new protocol service failed: %w", err)
+		}
+	}
+
+	t.handler = t.ctx.InboundMessageHandler()
+
+	return t, nil
+}
+
+// closeTenant stops the protocol services of the tenant and closes its KMS and stores. The VDRI registry
+// is not closed as it shares the VDRI of the framework. The KMS and stores are closed once the services stop.
+func (a *Aries) closeTenant(t *tenant) error {
+	stopped, stopErr := stopServices(t.workerPools, t.services, a.shutdownTimeout)
+	if stopErr != nil {
+		logger.Warnf("close tenant %s: %s", t.id, stopErr)
+	}
+
+	select {
+	case <-stopped:
+		if err := closeErr(t.closeResources()); err != nil {
+			return err
+		}
+	default:
+		go func() {
+			<-stopped
+
+			if err := closeErr(t.closeResources()); err != nil {
+				logger.Warnf("close tenant %s after the shutdown timeout: %s", t.id, err)
+			}
+		}()
+	}
+
+	return stopErr
+}
+
+// closeResources closes the KMS and stores of the tenant, it returns the errors of every resource.
+func (t *tenant) closeResources() []error {
+	var errs []error
+
+	if t.kms != nil {
+		if err := t.kms.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the kms: %w", err))
+		}
+	}
+
+	if err := t.storeProvider.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close the store: %w", err))
+	}
+
+	if err := t.transientStoreProvider.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close the store: %w", err))
+	}
+
+	return errs
+}
+
+// closeTenants closes all tenants, the tenants are restored by New.
+func (a *Aries) closeTenants() error {
+	a.tenantsMu.Lock()
+	defer a.tenantsMu.Unlock()
+
+	var errs []error
+
+	for id, t := range a.tenants {
+		if err := a.closeTenant(t); err != nil {
+			errs = append(errs, err)
+		}
+
+		delete(a.tenants, id)
+		a.multiKMS.Remove(id)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close tenants: %v", errs)
+	}
+
+	return nil
+}
+
+func loadTenants(frameworkOpts *Aries) error {
+	if !frameworkOpts.multiTenancyEnabled {
+		return nil
+	}
+
+	var err error
+
+	frameworkOpts.tenantStore, err = frameworkOpts.storeProvider.OpenStore(tenantStoreName)
+	if err != nil {
+		return fmt.Errorf("open tenant store failed: %w", err)
+	}
+
+	frameworkOpts.tenants = make(map[string]*tenant)
+
+	itr := frameworkOpts.tenantStore.Iterator(tenantKeyPrefix, fmt.Sprintf(limitPattern, tenantKeyPrefix))
+	defer itr.Release()
+
+	var records []*tenantRecord
+
+	for itr.Next() {
+		record := &tenantRecord{}
+		if err = json.Unmarshal(itr.Value(), record); err != nil {
+			return fmt.Errorf("load tenants: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err = itr.Error(); err != nil {
+		return fmt.Errorf("load tenants: %w", err)
+	}
+
+	for _, record := range records {
+		if record.Removed {
+			continue
+		}
+
+		t, e := frameworkOpts.startTenant(record.ID)
+		if e != nil {
+			return fmt.Errorf("load tenants: %w", e)
+		}
+
+		frameworkOpts.addTenant(t)
+	}
+
+	return nil
+}
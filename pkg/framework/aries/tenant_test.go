@@ -0,0 +1,398 @@
+// +build !js,!wasm
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package aries
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	storageapi "github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+func TestFramework_Tenants(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+	dbPath = path
+
+	// the message is handled by the service of the agent owning the KMS
+	handled := make(chan kms.KeyManager, 1)
+	customSvc := func(prv api.Provider) (dispatcher.Service, error) {
+		return &protocol.MockDIDExchangeSvc{
+			ProtocolName: "custom",
+			AcceptFunc: func(msgType string) bool {
+				return msgType == "custom-type"
+			},
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				handled <- prv.KMS()
+				return "", nil
+			},
+		}, nil
+	}
+
+	inbound := &mockInboundTransport{}
+
+	aries, err := New(WithInboundTransport(inbound), WithMultiTenancy(), WithProtocols(customSvc))
+	require.NoError(t, err)
+	require.Empty(t, aries.Tenants())
+
+	require.NoError(t, aries.CreateTenant("acme"))
+	require.Equal(t, []string{"acme"}, aries.Tenants())
+
+	err = aries.CreateTenant("acme")
+	require.True(t, errors.Is(err, ErrTenantExists))
+
+	for _, id := range []string{"", "Acme", "acme_corp", "acme/corp", string(make([]byte, 65))} {
+		require.True(t, errors.Is(aries.CreateTenant(id), ErrInvalidTenantID), id)
+	}
+
+	_, err = aries.TenantContext("other")
+	require.True(t, errors.Is(err, ErrTenantNotFound))
+
+	ctx, err := aries.Context()
+	require.NoError(t, err)
+
+	tenantCtx, err := aries.TenantContext("acme")
+	require.NoError(t, err)
+
+	_, agentKey, err := ctx.KMS().CreateKeySet()
+	require.NoError(t, err)
+
+	_, tenantKey, err := tenantCtx.KMS().CreateKeySet()
+	require.NoError(t, err)
+
+	// the keys of the tenant are isolated
+	_, err = ctx.KMS().FindVerKey([]string{tenantKey})
+	require.Error(t, err)
+
+	_, err = tenantCtx.KMS().FindVerKey([]string{agentKey})
+	require.Error(t, err)
+
+	// the stores of the tenant are isolated
+	tenantStore, err := tenantCtx.StorageProvider().OpenStore("custom")
+	require.NoError(t, err)
+	require.NoError(t, tenantStore.Put("key", []byte("value")))
+
+	agentStore, err := ctx.StorageProvider().OpenStore("custom")
+	require.NoError(t, err)
+
+	_, err = agentStore.Get("key")
+	require.True(t, errors.Is(err, storageapi.ErrDataNotFound))
+
+	// the envelopes are routed by the recipient keys
+	send := func(recipientKey string) kms.KeyManager {
+		require.NoError(t, inbound.prov.InboundMessageHandler()(context.Background(), &commontransport.Envelope{
+			Message:   []byte(`{"@id":"1","@type":"custom-type"}`),
+			ToVerKeys: []string{recipientKey},
+		}))
+
+		return <-handled
+	}
+
+	require.Equal(t, tenantCtx.KMS(), send(tenantKey))
+	require.Equal(t, ctx.KMS(), send(agentKey))
+
+	// the envelope packed by the tenant is unpacked by the shared packers
+	packed, err := tenantCtx.Packager().PackMessage(&commontransport.Envelope{
+		Message:    []byte(`{"@id":"1","@type":"custom-type"}`),
+		FromVerKey: tenantKey,
+		ToVerKeys:  []string{agentKey},
+	})
+	require.NoError(t, err)
+
+	envelope, err := inbound.prov.Packager().UnpackMessage(packed)
+	require.NoError(t, err)
+	require.Equal(t, tenantKey, envelope.FromVerKey)
+
+	packed, err = ctx.Packager().PackMessage(&commontransport.Envelope{
+		Message:    []byte(`{"@id":"1","@type":"custom-type"}`),
+		FromVerKey: agentKey,
+		ToVerKeys:  []string{tenantKey},
+	})
+	require.NoError(t, err)
+
+	envelope, err = inbound.prov.Packager().UnpackMessage(packed)
+	require.NoError(t, err)
+	require.Equal(t, []string{tenantKey}, envelope.ToVerKeys)
+
+	// the tenants are restored with their keys
+	require.NoError(t, aries.Close())
+
+	aries, err = New(WithInboundTransport(inbound), WithMultiTenancy(), WithProtocols(customSvc))
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme"}, aries.Tenants())
+
+	tenantCtx, err = aries.TenantContext("acme")
+	require.NoError(t, err)
+
+	_, err = tenantCtx.KMS().FindVerKey([]string{tenantKey})
+	require.NoError(t, err)
+	require.Equal(t, tenantCtx.KMS(), send(tenantKey))
+
+	// the envelopes addressed to the removed tenant are not routed to it
+	require.NoError(t, aries.RemoveTenant("acme"))
+	require.Empty(t, aries.Tenants())
+
+	err = aries.RemoveTenant("acme")
+	require.True(t, errors.Is(err, ErrTenantNotFound))
+
+	ctx, err = aries.Context()
+	require.NoError(t, err)
+	require.Equal(t, ctx.KMS(), send(tenantKey))
+
+	require.NoError(t, aries.Close())
+
+	aries, err = New(WithInboundTransport(inbound), WithMultiTenancy(), WithProtocols(customSvc))
+	require.NoError(t, err)
+	require.Empty(t, aries.Tenants())
+
+	// the ID of the removed tenant is not reused
+	err = aries.CreateTenant("acme")
+	require.True(t, errors.Is(err, ErrTenantRemoved))
+	require.Empty(t, aries.Tenants())
+
+	err = aries.RestoreTenant("other")
+	require.True(t, errors.Is(err, ErrTenantNotFound))
+
+	// the restored tenant gets back its keys
+	require.NoError(t, aries.RestoreTenant("acme"))
+	require.Equal(t, []string{"acme"}, aries.Tenants())
+
+	err = aries.RestoreTenant("acme")
+	require.True(t, errors.Is(err, ErrTenantExists))
+
+	tenantCtx, err = aries.TenantContext("acme")
+	require.NoError(t, err)
+
+	_, err = tenantCtx.KMS().FindVerKey([]string{tenantKey})
+	require.NoError(t, err)
+	require.Equal(t, tenantCtx.KMS(), send(tenantKey))
+
+	require.NoError(t, aries.Close())
+}
+
+func TestFramework_TenantMiddleware(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+	dbPath = path
+
+	aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(), WithMessageHistory(),
+		WithReplayProtection())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, aries.Close())
+	}()
+
+	require.NoError(t, aries.CreateTenant("acme"))
+
+	ctx, err := aries.Context()
+	require.NoError(t, err)
+
+	tenantCtx, err := aries.TenantContext("acme")
+	require.NoError(t, err)
+
+	// the tenant archives its messages by its own history and sends them through its own middleware
+	require.NotNil(t, tenantCtx.MessageHistory())
+	require.False(t, ctx.MessageHistory() == tenantCtx.MessageHistory())
+	require.False(t, ctx.OutboundDispatcher() == tenantCtx.OutboundDispatcher())
+}
+
+func TestFramework_TenantsDisabled(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+	dbPath = path
+
+	aries, err := New(WithInboundTransport(&mockInboundTransport{}))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, aries.Close())
+	}()
+
+	require.True(t, errors.Is(aries.CreateTenant("acme"), ErrMultiTenancyDisabled))
+	require.True(t, errors.Is(aries.RemoveTenant("acme"), ErrMultiTenancyDisabled))
+	require.True(t, errors.Is(aries.RestoreTenant("acme"), ErrMultiTenancyDisabled))
+	require.Empty(t, aries.Tenants())
+
+	_, err = aries.TenantContext("acme")
+	require.True(t, errors.Is(err, ErrMultiTenancyDisabled))
+}
+
+func TestFramework_TenantErrors(t *testing.T) {
+	t.Run("test error from tenant store", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		storeProvider := storage.NewMockStoreProvider()
+		storeProvider.FailNameSpace = tenantStoreName
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithStoreProvider(storeProvider))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open tenant store failed")
+	})
+
+	t.Run("test error from invalid tenant record", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		storeProvider := storage.NewMockStoreProvider()
+		storeProvider.Store.Store[tenantKeyPrefix+"acme"] = []byte("invalid")
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithStoreProvider(storeProvider))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "load tenants")
+	})
+
+	t.Run("test error from get tenant record", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		storeProvider := storage.NewMockStoreProvider()
+		storeProvider.Store.Store[tenantKeyPrefix+"acme"] = []byte(`{"id":"acme","removed":true}`)
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithStoreProvider(storeProvider))
+		require.NoError(t, err)
+
+		defer func() {
+			storeProvider.Store.ErrGet = nil
+			require.NoError(t, aries.Close())
+		}()
+
+		storeProvider.Store.ErrGet = errors.New("get error")
+
+		err = aries.CreateTenant("acme")
+		require.EqualError(t, err, "create tenant acme: get tenant record: get error")
+
+		err = aries.RestoreTenant("acme")
+		require.EqualError(t, err, "restore tenant acme: get tenant record: get error")
+
+		storeProvider.Store.ErrGet = nil
+		storeProvider.Store.Store[tenantKeyPrefix+"acme"] = []byte("invalid")
+
+		err = aries.RestoreTenant("acme")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "restore tenant acme: unmarshal tenant record")
+	})
+
+	t.Run("test error from tenant kms", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		storeProvider := storage.NewMockStoreProvider()
+		storeProvider.Store.Store[tenantKeyPrefix+"acme"] = []byte(`{"id":"acme"}`)
+		storeProvider.FailNameSpace = tenantKeyPrefix + "acme_keystore"
+
+		_, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithStoreProvider(storeProvider))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "load tenants: start tenant acme: create kms failed")
+	})
+
+	t.Run("test error from closing tenant", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		created := 0
+		storeProvider := &closeCountingProvider{MockStoreProvider: storage.NewMockStoreProvider()}
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithStoreProvider(storeProvider),
+			WithKMS(func(prv api.Provider) (api.CloseableKMS, error) {
+				k, e := kms.New(prv)
+				if e != nil {
+					return nil, e
+				}
+
+				// the KMS of the tenant fails to close
+				created++
+				if created > 1 {
+					return &closeErrKMS{k}, nil
+				}
+
+				return k, nil
+			}))
+		require.NoError(t, err)
+		require.NoError(t, aries.CreateTenant("acme"))
+
+		err = aries.Close()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to close tenants")
+		require.Contains(t, err.Error(), "close error")
+
+		// the framework is closed anyway
+		require.Equal(t, 1, storeProvider.closed)
+	})
+
+	t.Run("test error from tenant protocol service", func(t *testing.T) {
+		path, cleanup := generateTempDir(t)
+		defer cleanup()
+		dbPath = path
+
+		created := 0
+
+		aries, err := New(WithInboundTransport(&mockInboundTransport{}), WithMultiTenancy(),
+			WithProtocols(func(prv api.Provider) (dispatcher.Service, error) {
+				created++
+				if created > 1 {
+					return nil, errors.New("protocol error")
+				}
+
+				return &protocol.MockDIDExchangeSvc{ProtocolName: "custom"}, nil
+			}))
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, aries.Close())
+		}()
+
+		err = aries.CreateTenant("acme")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "start tenant acme: new protocol service failed: protocol error")
+		require.Empty(t, aries.Tenants())
+	})
+}
+
+// closeErrKMS fails to close.
+type closeErrKMS struct {
+	api.CloseableKMS
+}
+
+func (k *closeErrKMS) Close() error {
+	return errors.New("close error")
+}
+
+// closeCountingProvider counts the closing of the store provider.
+type closeCountingProvider struct {
+	*storage.MockStoreProvider
+	closed int
+}
+
+func (p *closeCountingProvider) Close() error {
+	p.closed++
+
+	return p.MockStoreProvider.Close()
+}
@@ -7,12 +7,28 @@ SPDX-License-Identifier: Apache-2.0
 package context
 
 import (
+	gocontext "context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/ratelimit"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	commontransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
@@ -20,24 +36,41 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
 )
 
+var logger = log.New("aries-framework/context")
+
 // Provider supplies the framework configuration to client objects.
 type Provider struct {
-	services                 []dispatcher.Service
-	storeProvider            storage.Provider
-	transientStoreProvider   storage.Provider
-	kms                      kms.KMS
-	packager                 commontransport.Packager
-	primaryPacker            packer.Packer
-	packers                  []packer.Packer
-	inboundTransportEndpoint string
-	outboundDispatcher       dispatcher.Outbound
-	outboundTransports       []transport.OutboundTransport
-	vdriRegistry             vdriapi.Registry
+	services                  *dispatcher.ServiceRegistry
+	storeProvider             storage.Provider
+	transientStoreProvider    storage.Provider
+	kms                       kms.KMS
+	packager                  commontransport.Packager
+	primaryPacker             packer.Packer
+	packers                   []packer.Packer
+	inboundTransportEndpoints []string
+	outboundDispatcher        dispatcher.Outbound
+	outboundTransports        []transport.OutboundTransport
+	vdriRegistry              vdriapi.Registry
+	inboundMiddleware         []dispatcher.InboundMiddleware
+	outbox                    *outbox.Outbox
+	workerPools               *workerpool.Pools
+	metrics                   metrics.Sink
+	tracer                    trace.Tracer
+	history                   *history.Archive
+	addressRateLimiter        *ratelimit.Limiter
+	senderRateLimiter         *ratelimit.Limiter
+	schemas                   *schema.Registry
+	typeNormalizer            *msgtype.Normalizer
+	tenantRouter              TenantRouter
 }
 
+// TenantRouter returns the inbound message handler of the tenant owning one of the recipient keys of the
+// envelope, nil if the envelope is addressed to none of the tenants.
+type TenantRouter func(recipientVerKeys []string) transport.InboundMessageHandler
+
 // New instantiates a new context provider.
 func New(opts ...ProviderOption) (*Provider, error) {
-	ctxProvider := Provider{}
+	ctxProvider := Provider{services: dispatcher.NewServiceRegistry()}
 
 	for _, opt := range opts {
 		err := opt(&ctxProvider)
@@ -54,6 +87,78 @@ func (p *Provider) OutboundDispatcher() dispatcher.Outbound {
 	return p.outboundDispatcher
 }
 
+// Outbox returns the outbox, nil if the outbox is not enabled.
+func (p *Provider) Outbox() *outbox.Outbox {
+	return p.outbox
+}
+
+// WorkerPool returns the worker pool of the protocol service with the given name, nil if the worker pools
+// are not configured. The nil pool runs every task in a new goroutine.
+func (p *Provider) WorkerPool(name string) *workerpool.Pool {
+	return p.workerPools.Pool(name)
+}
+
+// WorkerPoolRetryAfter returns the time the callers are asked to wait before retrying the rejected message.
+func (p *Provider) WorkerPoolRetryAfter() time.Duration {
+	return p.workerPools.RetryAfter()
+}
+
+// WorkerPoolMetrics returns the metrics of the worker pools of the protocol services, e.g. the queue depth.
+func (p *Provider) WorkerPoolMetrics() []workerpool.Metrics {
+	return p.workerPools.Metrics()
+}
+
+// Metrics returns the sink receiving the metrics of the framework, the sink discarding the metrics
+// if no sink is configured.
+func (p *Provider) Metrics() metrics.Sink {
+	if p.metrics == nil {
+		return metrics.Nop
+	}
+
+	return p.metrics
+}
+
+// Tracer returns the tracer of the framework, the tracer recording nothing if no tracer is configured.
+func (p *Provider) Tracer() trace.Tracer {
+	if p.tracer == nil {
+		return trace.Noop
+	}
+
+	return p.tracer
+}
+
+// MessageHistory returns the archive of the messages and state transitions, nil if the message history
+// is not enabled.
+func (p *Provider) MessageHistory() *history.Archive {
+	return p.history
+}
+
+// AddressRateLimiter returns the limiter of the inbound messages per remote address, nil if the rate is not limited.
+func (p *Provider) AddressRateLimiter() *ratelimit.Limiter {
+	return p.addressRateLimiter
+}
+
+// SenderRateLimiter returns the limiter of the inbound messages per sender key, nil if the rate is not limited.
+func (p *Provider) SenderRateLimiter() *ratelimit.Limiter {
+	return p.senderRateLimiter
+}
+
+// SchemaRegistry returns the schemas the inbound messages are validated against, nil if the messages
+// are not validated.
+func (p *Provider) SchemaRegistry() *schema.Registry {
+	return p.schemas
+}
+
+// MessageTypeNormalizer returns the normalizer of the inbound message types, the legacy prefix only
+// is aliased if no normalizer was injected.
+func (p *Provider) MessageTypeNormalizer() *msgtype.Normalizer {
+	if p.typeNormalizer == nil {
+		return msgtype.NewNormalizer()
+	}
+
+	return p.typeNormalizer
+}
+
 // OutboundTransports returns an outbound transports.
 func (p *Provider) OutboundTransports() []transport.OutboundTransport {
 	return p.outboundTransports
@@ -61,10 +166,8 @@ func (p *Provider) OutboundTransports() []transport.OutboundTransport {
 
 // Service return protocol service
 func (p *Provider) Service(id string) (interface{}, error) {
-	for _, v := range p.services {
-		if v.Name() == id {
-			return v, nil
-		}
+	if svc, ok := p.services.Service(id); ok {
+		return svc, nil
 	}
 
 	return nil, api.ErrSvcNotFound
@@ -95,28 +198,327 @@ func (p *Provider) Signer() kms.Signer {
 	return p.kms
 }
 
-// InboundTransportEndpoint returns an inbound transport endpoint.
+// InboundTransportEndpoint returns the endpoint of the first inbound transport.
 func (p *Provider) InboundTransportEndpoint() string {
-	return p.inboundTransportEndpoint
+	if len(p.inboundTransportEndpoints) == 0 {
+		return ""
+	}
+
+	return p.inboundTransportEndpoints[0]
+}
+
+// InboundTransportEndpoints returns the endpoints of all inbound transports in the order of their priority.
+func (p *Provider) InboundTransportEndpoints() []string {
+	return p.inboundTransportEndpoints
 }
 
-// InboundMessageHandler return an inbound message handler.
+// InboundMessageHandler return an inbound message handler. The message is passed through the inbound
+// middleware before it is dispatched to the protocol service. The keys of the envelope and the connection
+// of the sender are passed to the middleware and the protocol service with the message.
 func (p *Provider) InboundMessageHandler() transport.InboundMessageHandler {
-	return func(message []byte) error {
-		msg, err := service.NewDIDCommMsg(message)
+	handler := dispatcher.ChainInbound(p.dispatchInbound, p.inboundMiddleware...)
+	normalizer := p.MessageTypeNormalizer()
+
+	return func(ctx gocontext.Context, envelope *commontransport.Envelope) error {
+		// the tenants sharing the inbound transports handle the envelopes addressed to them
+		if p.tenantRouter != nil {
+			if tenantHandler := p.tenantRouter(envelope.ToVerKeys); tenantHandler != nil {
+				return tenantHandler(ctx, envelope)
+			}
+		}
+
+		msg, err := service.NewDIDCommMsg(envelope.Message)
 		if err != nil {
 			return err
 		}
 
-		// find the service which accepts the message type
-		for _, svc := range p.services {
-			if svc.Accept(msg.Header.Type) {
-				_, err = svc.HandleInbound(msg)
-				return err
-			}
+		// the middleware and the services see the canonical message type, the prefix of the sender is kept
+		// to be mirrored in the replies
+		prefix := normalizer.Prefix(msg.Header.Type)
+		normalizer.NormalizeMsg(msg)
+
+		// the spans of the exchange are correlated by the thread ID
+		thID, _ := msg.ThreadID()
+		trace.SpanFromContext(ctx).SetAttributes(
+			trace.String(trace.ThreadIDKey, thID), trace.String(trace.MessageTypeKey, msg.Header.Type))
+		ctx = trace.ContextWithThreadID(ctx, thID)
+
+		msg.Inbound, err = p.inboundContext(envelope)
+		if err != nil {
+			return err
 		}
+
+		msg.Inbound.MessageTypePrefix = prefix
+
+		return handler(ctx, msg, envelope.FromVerKey, envelope.ToVerKeys)
+	}
+}
+
+// inboundContext returns the inbound context of the envelope with the connection resolved by the first
+// service which knows the sender.
+func (p *Provider) inboundContext(envelope *commontransport.Envelope) (*service.InboundContext, error) {
+	inbound := &service.InboundContext{SenderVerKey: envelope.FromVerKey, RecipientVerKeys: envelope.ToVerKeys}
+
+	if envelope.FromVerKey == "" {
+		return inbound, nil
+	}
+
+	for _, svc := range p.services.Services() {
+		resolver, ok := svc.(service.ConnectionResolver)
+		if !ok {
+			continue
+		}
+
+		conn, err := resolver.ResolveConnection(envelope.FromVerKey, envelope.ToVerKeys)
+		if err != nil {
+			return nil, fmt.Errorf("resolve connection: %w", err)
+		}
+
+		if conn != nil {
+			inbound.Connection = conn
+			break
+		}
+	}
+
+	return inbound, nil
+}
+
+func (p *Provider) dispatchInbound(ctx gocontext.Context, msg *service.DIDCommMsg, _ string, _ []string) error {
+	svc, err := p.inboundService(msg)
+	p.countReceived(msg, svc != nil)
+
+	if err != nil {
+		p.reportProblem(ctx, msg, err)
+		return err
+	}
+
+	if svc == nil {
 		return fmt.Errorf("no message handlers found for the message type: %s", msg.Header.Type)
 	}
+
+	// the invalid message is rejected before the service starts to process it, the message of another
+	// minor version is validated against the schema of the version it was negotiated to
+	if p.schemas != nil {
+		if err := p.schemas.Validate(msg); err != nil {
+			p.reportProblem(ctx, msg, err)
+			return err
+		}
+	}
+
+	return p.dispatch(ctx, svc, msg)
+}
+
+// inboundService returns the service which accepts the message type. The message of another minor version
+// is handled as the message of the best matching supported version, nil if the type is not supported.
+func (p *Provider) inboundService(msg *service.DIDCommMsg) (dispatcher.Service, error) {
+	for _, svc := range p.services.Services() {
+		if svc.Accept(msg.Header.Type) {
+			return svc, nil
+		}
+	}
+
+	return p.negotiateVersion(msg)
+}
+
+// countReceived counts the inbound message. The message is counted by its type only if the type is known
+// to the agent: the sender must not be able to create the label values.
+func (p *Provider) countReceived(msg *service.DIDCommMsg, known bool) {
+	msgType := ""
+	if known {
+		msgType = msg.Header.Type
+	}
+
+	p.Metrics().IncCounter(metrics.MessagesReceived, metrics.MessageLabels(msgType))
+}
+
+func (p *Provider) dispatch(ctx gocontext.Context, svc dispatcher.Service, msg *service.DIDCommMsg) error {
+	err := p.handleInbound(ctx, svc, msg)
+	if errors.Is(err, workerpool.ErrQueueFull) {
+		// the transport asks the sender to retry later
+		return &transport.BusyError{RetryAfter: p.workerPools.RetryAfter(), Err: err}
+	}
+
+	return err
+}
+
+// negotiateVersion returns the service supporting the version of the message protocol which matches the message
+// type best, the message type is rewritten to the type of that version. It returns msgtype.VersionError if
+// the protocol is supported in the other major versions only, nil if the protocol is not supported at all.
+func (p *Provider) negotiateVersion(msg *service.DIDCommMsg) (dispatcher.Service, error) {
+	var protocols []string
+
+	services := make(map[string]dispatcher.Service)
+
+	for _, svc := range p.services.Services() {
+		versioned, ok := svc.(dispatcher.VersionedService)
+		if !ok {
+			continue
+		}
+
+		for _, protocol := range versioned.Protocols() {
+			if _, exists := services[protocol]; !exists {
+				services[protocol] = svc
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+
+	msgType, err := msgtype.Negotiate(msg.Header.Type, protocols)
+	if err != nil {
+		var versionErr *msgtype.VersionError
+		if errors.As(err, &versionErr) {
+			versionErr.MsgID = msg.Header.ID
+			return nil, versionErr
+		}
+
+		return nil, nil
+	}
+
+	svc, ok := services[msgType.PIURI()]
+	if !ok || !svc.Accept(msgType.String()) {
+		return nil, nil
+	}
+
+	logger.Debugf("message type %s is handled as %s", msg.Header.Type, msgType)
+
+	msg.Header.Type = msgType.String()
+
+	return svc, nil
+}
+
+// reportProblem sends the problem report of the unsupported message version or the message failing the schema
+// validation to the sender. The report is sent to the destination of the connection of the sender, or to the
+// destination found in the message by the services if the sender has no connection, e.g. the DID exchange request.
+func (p *Provider) reportProblem(ctx gocontext.Context, msg *service.DIDCommMsg, err error) {
+	if p.outboundDispatcher == nil || msg.Inbound == nil {
+		return
+	}
+
+	var (
+		code, msgID   string
+		versionErr    *msgtype.VersionError
+		validationErr *schema.ValidationError
+	)
+
+	switch {
+	case errors.As(err, &versionErr):
+		code, msgID = msgtype.VersionProblemCode, versionErr.MsgID
+	case errors.As(err, &validationErr):
+		code, msgID = schema.ProblemCode, validationErr.MsgID
+	default:
+		return
+	}
+
+	des := p.senderDestination(ctx, msg)
+	if des == nil {
+		logger.Debugf("problem report not sent, the destination of the sender is unknown: %s", err)
+		return
+	}
+
+	// the report is sent with the key the message was packed for
+	myVerKey := p.recipientVerKey(msg.Inbound.RecipientVerKeys)
+	if myVerKey == "" {
+		logger.Debugf("problem report not sent, the recipient key is unknown: %s", err)
+		return
+	}
+
+	// the report belongs to the thread of the message
+	thID, thErr := msg.ThreadID()
+	if thErr != nil {
+		thID = msgID
+	}
+
+	report := &model.ProblemReport{
+		Type:   model.ProblemReportMsgType,
+		ID:     uuid.New().String(),
+		Thread: &decorator.Thread{ID: thID},
+		Description: model.Description{
+			Code:    code,
+			English: err.Error(),
+		},
+	}
+
+	sendErr := dispatcher.SendContext(ctx, p.outboundDispatcher, report, myVerKey, des)
+	if sendErr != nil {
+		logger.Warnf("failed to send problem report: %s", sendErr)
+	}
+}
+
+// senderDestination returns the destination of the connection of the sender, or the destination the services
+// find in the message. The destination found in the message is used only if it is the destination of the key
+// the message was sent with: the message can't redirect the report to another party.
+func (p *Provider) senderDestination(ctx gocontext.Context, msg *service.DIDCommMsg) *service.Destination {
+	if conn, ok := msg.Inbound.Connection.(interface{ Destination() *service.Destination }); ok {
+		if des := conn.Destination(); des != nil {
+			return des
+		}
+	}
+
+	if msg.Inbound.SenderVerKey == "" {
+		return nil
+	}
+
+	for _, svc := range p.services.Services() {
+		resolver, ok := svc.(service.DestinationResolver)
+		if !ok {
+			continue
+		}
+
+		des, err := resolver.ResolveDestination(ctx, msg)
+		if err != nil {
+			logger.Debugf("resolve the destination of the sender: %s", err)
+			continue
+		}
+
+		if des != nil && contains(des.RecipientKeys, msg.Inbound.SenderVerKey) {
+			return des
+		}
+	}
+
+	return nil
+}
+
+// recipientVerKey returns the key of the agent the message was packed for, the packers open the message
+// with the first key of the agent among the recipient keys.
+func (p *Provider) recipientVerKey(recipientVerKeys []string) string {
+	if p.kms == nil || len(recipientVerKeys) == 0 {
+		return ""
+	}
+
+	i, err := p.kms.FindVerKey(recipientVerKeys)
+	if err != nil {
+		return ""
+	}
+
+	return recipientVerKeys[i]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleInbound passes the message to the service in the handle_inbound span.
+func (p *Provider) handleInbound(ctx gocontext.Context, svc dispatcher.Service, msg *service.DIDCommMsg) error {
+	thID, _ := msg.ThreadID()
+
+	ctx, span := p.Tracer().Start(ctx, trace.HandleInboundSpan, trace.WithAttributes(
+		trace.String(trace.ServiceKey, svc.Name()),
+		trace.String(trace.ThreadIDKey, thID),
+		trace.String(trace.MessageTypeKey, msg.Header.Type)))
+	defer span.End()
+
+	_, err := service.HandleInboundContext(ctx, svc, msg)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return err
 }
 
 // StorageProvider return a storage provider.
@@ -153,10 +555,51 @@ func WithOutboundDispatcher(outboundDispatcher dispatcher.Outbound) ProviderOpti
 	}
 }
 
+// WithOutbox injects an outbox into the context.
+func WithOutbox(o *outbox.Outbox) ProviderOption {
+	return func(opts *Provider) error {
+		opts.outbox = o
+		return nil
+	}
+}
+
+// WithWorkerPools injects the worker pools of the protocol services into the context.
+func WithWorkerPools(pools *workerpool.Pools) ProviderOption {
+	return func(opts *Provider) error {
+		opts.workerPools = pools
+		return nil
+	}
+}
+
+// WithMetrics injects the sink receiving the metrics of the framework into the context.
+func WithMetrics(sink metrics.Sink) ProviderOption {
+	return func(opts *Provider) error {
+		opts.metrics = sink
+		return nil
+	}
+}
+
 // WithProtocolServices injects a protocol services into the context.
 func WithProtocolServices(services ...dispatcher.Service) ProviderOption {
 	return func(opts *Provider) error {
-		opts.services = services
+		opts.services = dispatcher.NewServiceRegistry(services...)
+		return nil
+	}
+}
+
+// WithServiceRegistry injects the registry of the protocol services into the context, the services registered
+// or unregistered after the context is created are visible to the context.
+func WithServiceRegistry(registry *dispatcher.ServiceRegistry) ProviderOption {
+	return func(opts *Provider) error {
+		opts.services = registry
+		return nil
+	}
+}
+
+// WithInboundMiddleware injects the middleware wrapping the inbound message handler into the context.
+func WithInboundMiddleware(middleware ...dispatcher.InboundMiddleware) ProviderOption {
+	return func(opts *Provider) error {
+		opts.inboundMiddleware = append(opts.inboundMiddleware, middleware...)
 		return nil
 	}
 }
@@ -177,10 +620,11 @@ func WithVDRIRegistry(vdri vdriapi.Registry) ProviderOption {
 	}
 }
 
-// WithInboundTransportEndpoint injects an inbound transport endpoint into the context.
-func WithInboundTransportEndpoint(endpoint string) ProviderOption {
+// WithInboundTransportEndpoint injects the inbound transport endpoints into the context, the first endpoint
+// has the highest priority.
+func WithInboundTransportEndpoint(endpoints ...string) ProviderOption {
 	return func(opts *Provider) error {
-		opts.inboundTransportEndpoint = endpoint
+		opts.inboundTransportEndpoints = endpoints
 		return nil
 	}
 }
@@ -219,3 +663,57 @@ func WithPacker(primary packer.Packer, additionalPackers ...packer.Packer) Provi
 		return nil
 	}
 }
+
+// WithTracer injects the tracer of the inbound, service and outbound processing into the context.
+func WithTracer(tracer trace.Tracer) ProviderOption {
+	return func(opts *Provider) error {
+		opts.tracer = tracer
+		return nil
+	}
+}
+
+// WithMessageHistory injects the archive of the messages and state transitions into the context.
+func WithMessageHistory(archive *history.Archive) ProviderOption {
+	return func(opts *Provider) error {
+		opts.history = archive
+		return nil
+	}
+}
+
+// WithRateLimiters injects the limiters of the inbound messages per remote address and per sender key
+// into the context, nil limiter doesn't limit the rate.
+func WithRateLimiters(address, sender *ratelimit.Limiter) ProviderOption {
+	return func(opts *Provider) error {
+		opts.addressRateLimiter = address
+		opts.senderRateLimiter = sender
+
+		return nil
+	}
+}
+
+// WithSchemaRegistry injects the schemas the inbound messages are validated against before they are dispatched
+// to the protocol services.
+func WithSchemaRegistry(registry *schema.Registry) ProviderOption {
+	return func(opts *Provider) error {
+		opts.schemas = registry
+		return nil
+	}
+}
+
+// WithMessageTypeNormalizer injects the normalizer rewriting the aliased inbound message types to their canonical
+// form before the messages are dispatched to the protocol services.
+func WithMessageTypeNormalizer(normalizer *msgtype.Normalizer) ProviderOption {
+	return func(opts *Provider) error {
+		opts.typeNormalizer = normalizer
+		return nil
+	}
+}
+
+// WithTenantRouter injects the router of the inbound envelopes to the tenants sharing the framework instance,
+// the envelopes addressed to none of the tenants are handled by the context itself.
+func WithTenantRouter(router TenantRouter) ProviderOption {
+	return func(opts *Provider) error {
+		opts.tenantRouter = router
+		return nil
+	}
+}
@@ -7,21 +7,35 @@ SPDX-License-Identifier: Apache-2.0
 package context
 
 import (
+	"bytes"
+	gocontext "context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/model"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/transport"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/msgtype"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/schema"
+	didcommtransport "github.com/hyperledger/aries-framework-go/pkg/didcomm/transport"
 	mockdidcomm "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm"
 	mockdispatcher "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/dispatcher"
 	mockpackager "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/packager"
 	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/internal/mock/kms"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/internal/mock/provider"
 	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
 	mockvdri "github.com/hyperledger/aries-framework-go/pkg/internal/mock/vdri"
 )
@@ -39,6 +53,18 @@ func TestNewProvider(t *testing.T) {
 		require.NoError(t, prov.OutboundDispatcher().Send(nil, "", nil))
 	})
 
+	t.Run("test new with outbox", func(t *testing.T) {
+		o, err := outbox.New(&mockprovider.Provider{StorageProviderValue: storage.NewMockStoreProvider()},
+			&mockdispatcher.MockOutbound{})
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, o.Close()) }()
+
+		prov, err := New(WithOutbox(o))
+		require.NoError(t, err)
+		require.Equal(t, o, prov.Outbox())
+	})
+
 	t.Run("test error return from options", func(t *testing.T) {
 		_, err := New(func(opts *Provider) error {
 			return errors.New("error creating the framework option")
@@ -93,42 +119,344 @@ func TestNewProvider(t *testing.T) {
 		inboundHandler := ctx.InboundMessageHandler()
 
 		// valid json and message type
-		err = inboundHandler([]byte(`
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{Message: []byte(`
 		{
 			"@id": "5678876542345",
 			"@type": "valid-message-type"
-		}`))
+		}`)})
 		require.NoError(t, err)
 
 		// invalid json
-		err = inboundHandler([]byte("invalid json"))
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{Message: []byte("invalid json")})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid payload data format")
 
 		// invalid json
-		err = inboundHandler([]byte("invalid json"))
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{Message: []byte("invalid json")})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid payload data format")
 
 		// no handlers
-		err = inboundHandler([]byte(`
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{Message: []byte(`
 		{
 			"@type": "invalid-message-type",
 			"label": "Bob"
-		}`))
+		}`)})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "no message handlers found for the message type: invalid-message-type")
 
 		// valid json, message type but service handlers returns error
-		err = inboundHandler([]byte(`
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{Message: []byte(`
 		{
 			"label": "Carol",
 			"@type": "valid-message-type"
-		}`))
+		}`)})
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "error handling the message")
 	})
 
+	t.Run("test inbound message handler normalizes message type", func(t *testing.T) {
+		var handled, prefixes []string
+
+		ctx, err := New(WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			ProtocolName: "mockProtocolSvc",
+			AcceptFunc: func(msgType string) bool {
+				return msgType == "https://didcomm.org/test/1.0/message"
+			},
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				handled = append(handled, msg.Header.Type)
+				prefixes = append(prefixes, msg.Inbound.MessageTypePrefix)
+
+				return "", nil
+			},
+		}), WithMessageTypeNormalizer(msgtype.NewNormalizer(
+			msgtype.WithAlias("https://example.com/", "https://didcomm.org/"))))
+		require.NoError(t, err)
+		require.NotNil(t, ctx.MessageTypeNormalizer())
+
+		for _, msgType := range []string{
+			"https://didcomm.org/test/1.0/message",
+			"did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/test/1.0/message",
+			"https://example.com/test/1.0/message",
+		} {
+			err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+				Message: []byte(`{"@id": "1", "@type": "` + msgType + `"}`),
+			})
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, []string{
+			"https://didcomm.org/test/1.0/message",
+			"https://didcomm.org/test/1.0/message",
+			"https://didcomm.org/test/1.0/message",
+		}, handled)
+
+		// the prefix of the sender is kept to be mirrored in the replies
+		require.Equal(t, []string{"", "did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/", "https://example.com/"}, prefixes)
+
+		// the legacy prefix is aliased by default
+		ctx, err = New()
+		require.NoError(t, err)
+		require.Equal(t, "https://didcomm.org/test/1.0/message",
+			ctx.MessageTypeNormalizer().Normalize("did:sov:BzCbsNYhMrjHiqZDTUASHg;spec/test/1.0/message"))
+	})
+
+	t.Run("test inbound message handler routes envelope to tenant", func(t *testing.T) {
+		var handled, tenantHandled []string
+
+		ctx, err := New(WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			ProtocolName: "mockProtocolSvc",
+			AcceptFunc: func(msgType string) bool {
+				return true
+			},
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				handled = append(handled, msg.Header.ID)
+				return "", nil
+			},
+		}), WithTenantRouter(func(recipientVerKeys []string) didcommtransport.InboundMessageHandler {
+			if len(recipientVerKeys) == 0 || recipientVerKeys[0] != "tenantKey" {
+				return nil
+			}
+
+			return func(_ gocontext.Context, envelope *transport.Envelope) error {
+				tenantHandled = append(tenantHandled, string(envelope.Message))
+				return nil
+			}
+		}))
+		require.NoError(t, err)
+
+		err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message:   []byte(`{"@id": "1", "@type": "https://didcomm.org/test/1.0/message"}`),
+			ToVerKeys: []string{"tenantKey"},
+		})
+		require.NoError(t, err)
+
+		err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message:   []byte(`{"@id": "2", "@type": "https://didcomm.org/test/1.0/message"}`),
+			ToVerKeys: []string{"agentKey"},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []string{`{"@id": "1", "@type": "https://didcomm.org/test/1.0/message"}`}, tenantHandled)
+		require.Equal(t, []string{"2"}, handled)
+	})
+
+	t.Run("test inbound message handler with middleware", func(t *testing.T) {
+		var handled []string
+
+		ctx, err := New(WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			ProtocolName: "mockProtocolSvc",
+			AcceptFunc: func(msgType string) bool {
+				return true
+			},
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				handled = append(handled, msg.Header.ID)
+				return "", nil
+			},
+		}), WithInboundMiddleware(func(next dispatcher.InboundHandler) dispatcher.InboundHandler {
+			return func(ctx gocontext.Context, msg *service.DIDCommMsg, senderVerKey string,
+				recipientVerKeys []string) error {
+				if senderVerKey != "trusted" {
+					return fmt.Errorf("sender %s not trusted", senderVerKey)
+				}
+
+				require.Equal(t, []string{"recipient"}, recipientVerKeys)
+
+				return next(ctx, msg, senderVerKey, recipientVerKeys)
+			}
+		}))
+		require.NoError(t, err)
+
+		inboundHandler := ctx.InboundMessageHandler()
+
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "1", "@type": "valid-message-type"}`),
+			FromVerKey: "trusted",
+			ToVerKeys:  []string{"recipient"},
+		})
+		require.NoError(t, err)
+
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "2", "@type": "valid-message-type"}`),
+			FromVerKey: "unknown",
+			ToVerKeys:  []string{"recipient"},
+		})
+		require.EqualError(t, err, "sender unknown not trusted")
+		require.Equal(t, []string{"1"}, handled)
+
+		// the message is not dispatched with the cancelled context
+		cancelled, cancel := gocontext.WithCancel(gocontext.Background())
+		cancel()
+
+		err = inboundHandler(cancelled, &transport.Envelope{
+			Message:    []byte(`{"@id": "3", "@type": "valid-message-type"}`),
+			FromVerKey: "trusted",
+			ToVerKeys:  []string{"recipient"},
+		})
+		require.Equal(t, gocontext.Canceled, err)
+		require.Equal(t, []string{"1"}, handled)
+	})
+
+	t.Run("test inbound message handler resolves the connection", func(t *testing.T) {
+		var handled []*service.DIDCommMsg
+
+		svc := &protocol.MockDIDExchangeSvc{
+			ProtocolName: "mockProtocolSvc",
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				handled = append(handled, msg)
+				return "", nil
+			},
+		}
+
+		resolver := &mockResolver{connections: map[string]interface{}{"sender": "connection"}}
+
+		ctx, err := New(WithProtocolServices(&mockResolverSvc{MockDIDExchangeSvc: svc, mockResolver: resolver}))
+		require.NoError(t, err)
+
+		inboundHandler := ctx.InboundMessageHandler()
+
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "1", "@type": "valid-message-type"}`),
+			FromVerKey: "sender",
+			ToVerKeys:  []string{"recipient"},
+		})
+		require.NoError(t, err)
+
+		// unknown sender
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "2", "@type": "valid-message-type"}`),
+			FromVerKey: "unknown",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, handled, 2)
+		require.Equal(t, &service.InboundContext{
+			SenderVerKey:     "sender",
+			RecipientVerKeys: []string{"recipient"},
+			Connection:       "connection",
+		}, handled[0].Inbound)
+		require.Equal(t, &service.InboundContext{SenderVerKey: "unknown"}, handled[1].Inbound)
+
+		// resolver error
+		resolver.err = errors.New("store error")
+
+		err = inboundHandler(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "3", "@type": "valid-message-type"}`),
+			FromVerKey: "sender",
+		})
+		require.EqualError(t, err, "resolve connection: store error")
+		require.Len(t, handled, 2)
+	})
+
+	t.Run("test inbound message handler rejects the message when the worker pool is full", func(t *testing.T) {
+		pools := workerpool.NewPools(workerpool.WithPool("mockProtocolSvc", 1, 2),
+			workerpool.WithRetryAfter(time.Minute))
+		defer pools.Stop()
+
+		ctx, err := New(WithWorkerPools(pools), WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			ProtocolName: "mockProtocolSvc",
+			HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+				return "", fmt.Errorf("handle: %w", workerpool.ErrQueueFull)
+			},
+		}))
+		require.NoError(t, err)
+
+		require.True(t, ctx.WorkerPool("mockProtocolSvc") == pools.Pool("mockProtocolSvc"))
+		require.Equal(t, []workerpool.Metrics{{Name: "mockProtocolSvc", Workers: 1, QueueSize: 2}},
+			ctx.WorkerPoolMetrics())
+		require.Equal(t, time.Minute, ctx.WorkerPoolRetryAfter())
+
+		err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message: []byte(`{"@id": "1", "@type": "valid-message-type"}`),
+		})
+
+		var busy *didcommtransport.BusyError
+		require.True(t, errors.As(err, &busy))
+		require.Equal(t, time.Minute, busy.RetryAfter)
+		require.True(t, errors.Is(err, workerpool.ErrQueueFull))
+	})
+
+	t.Run("test inbound messages counted by the message type", func(t *testing.T) {
+		ctx, err := New(WithProtocolServices(&protocol.MockDIDExchangeSvc{}))
+		require.NoError(t, err)
+		require.Equal(t, metrics.Nop, ctx.Metrics())
+
+		registry := metrics.NewRegistry()
+
+		ctx, err = New(WithMetrics(registry), WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			AcceptFunc: func(msgType string) bool {
+				return strings.HasPrefix(msgType, "https://didcomm.org/didexchange/1.0/")
+			},
+		}))
+		require.NoError(t, err)
+		require.True(t, ctx.Metrics() == registry)
+
+		for i := 0; i < 2; i++ {
+			err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+				Message: []byte(`{"@id": "1", "@type": "https://didcomm.org/didexchange/1.0/request"}`),
+			})
+			require.NoError(t, err)
+		}
+
+		// the types not accepted by any service are not used as the label values
+		for i := 0; i < 2; i++ {
+			err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+				Message: []byte(fmt.Sprintf(`{"@id": "1", "@type": "https://example.com/random/1.0/type-%d"}`, i)),
+			})
+			require.Error(t, err)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, registry.WritePrometheus(&buf))
+		require.Contains(t, buf.String(), `aries_messages_received_total{protocol="didexchange/1.0",`+
+			`type="https://didcomm.org/didexchange/1.0/request"} 2`)
+		require.Contains(t, buf.String(), `aries_messages_received_total{protocol="unknown",type="unknown"} 2`)
+		require.NotContains(t, buf.String(), "random")
+	})
+
+	t.Run("test inbound messages traced by the thread ID", func(t *testing.T) {
+		ctx, err := New()
+		require.NoError(t, err)
+		require.Equal(t, trace.Noop, ctx.Tracer())
+
+		exporter := trace.NewInMemoryExporter()
+		tracer := trace.NewTracer(exporter)
+
+		ctx, err = New(WithTracer(tracer), WithProtocolServices(&protocol.MockDIDExchangeSvc{
+			HandleFunc: func(*service.DIDCommMsg) (string, error) {
+				return "", errors.New("handle error")
+			},
+		}))
+		require.NoError(t, err)
+
+		reqCtx, root := tracer.Start(gocontext.Background(), trace.InboundSpan)
+
+		err = ctx.InboundMessageHandler()(reqCtx, &transport.Envelope{
+			Message: []byte(`{"@id": "2", "@type": "https://didcomm.org/didexchange/1.0/response",` +
+				`"~thread": {"thid": "1"}}`),
+		})
+		require.EqualError(t, err, "handle error")
+
+		root.End()
+
+		spans := exporter.ThreadSpans("1")
+		require.Len(t, spans, 2)
+
+		require.Equal(t, trace.HandleInboundSpan, spans[0].Name)
+		require.Equal(t, root.SpanContext(), spans[0].Parent)
+		require.Equal(t, []string{"handle error"}, spans[0].Errors)
+
+		name, ok := spans[0].Attribute(trace.ServiceKey)
+		require.True(t, ok)
+		require.Equal(t, "didexchange", name)
+
+		require.Equal(t, trace.InboundSpan, spans[1].Name)
+
+		msgType, ok := spans[1].Attribute(trace.MessageTypeKey)
+		require.True(t, ok)
+		require.Equal(t, "https://didcomm.org/didexchange/1.0/response", msgType)
+	})
+
 	t.Run("test new with kms and packager service", func(t *testing.T) {
 		prov, err := New(
 			WithKMS(&mockkms.CloseableKMS{SignMessageValue: []byte("mockValue")}),
@@ -172,6 +500,15 @@ func TestNewProvider(t *testing.T) {
 		prov, err := New(WithInboundTransportEndpoint("endpoint"))
 		require.NoError(t, err)
 		require.Equal(t, "endpoint", prov.InboundTransportEndpoint())
+
+		prov, err = New(WithInboundTransportEndpoint("http://endpoint", "ws://endpoint"))
+		require.NoError(t, err)
+		require.Equal(t, "http://endpoint", prov.InboundTransportEndpoint())
+		require.Equal(t, []string{"http://endpoint", "ws://endpoint"}, prov.InboundTransportEndpoints())
+
+		prov, err = New()
+		require.NoError(t, err)
+		require.Empty(t, prov.InboundTransportEndpoint())
 	})
 
 	t.Run("test new with storage provider", func(t *testing.T) {
@@ -208,3 +545,278 @@ func TestNewProvider(t *testing.T) {
 		require.Equal(t, "data1", r)
 	})
 }
+
+type mockResolver struct {
+	connections map[string]interface{}
+	err         error
+}
+
+func (r *mockResolver) ResolveConnection(senderVerKey string, _ []string) (interface{}, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.connections[senderVerKey], nil
+}
+
+type mockResolverSvc struct {
+	*protocol.MockDIDExchangeSvc
+	*mockResolver
+}
+
+func TestProvider_InboundMessageHandler_VersionNegotiation(t *testing.T) {
+	const received = "https://didcomm.org/didexchange/%s/request"
+
+	handled := make(map[string][]string)
+
+	versionedSvc := func(name, version string) *versionedService {
+		msgType := fmt.Sprintf(received, version)
+
+		return &versionedService{
+			MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{
+				ProtocolName: name,
+				AcceptFunc: func(t string) bool {
+					return t == msgType
+				},
+				HandleFunc: func(msg *service.DIDCommMsg) (string, error) {
+					handled[name] = append(handled[name], msg.Header.Type)
+					return "", nil
+				},
+			},
+			protocols: []string{"https://didcomm.org/didexchange/" + version},
+		}
+	}
+
+	des := &service.Destination{RecipientKeys: []string{"sender"}, ServiceEndpoint: "http://sender"}
+	strangerDes := &service.Destination{RecipientKeys: []string{"stranger"}, ServiceEndpoint: "http://stranger"}
+	outbound := &captureOutbound{}
+
+	ctx, err := New(
+		WithOutboundDispatcher(outbound),
+		WithKMS(&mockkms.CloseableKMS{FindVerKeyValue: 1}),
+		WithProtocolServices(versionedSvc("v1.0", "1.0"), versionedSvc("v1.2", "1.2"), &mockDestinationSvc{
+			MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{
+				ProtocolName: "destination",
+				AcceptFunc: func(string) bool {
+					return false
+				},
+			},
+			des: strangerDes,
+		}, &mockResolverSvc{
+			MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{
+				ProtocolName: "resolver",
+				AcceptFunc: func(string) bool {
+					return false
+				},
+			},
+			mockResolver: &mockResolver{connections: map[string]interface{}{
+				"sender": &mockConnection{des: des},
+				"other":  &mockConnection{},
+			}},
+		}))
+	require.NoError(t, err)
+
+	handle := func(version, sender string) error {
+		return ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message:    []byte(`{"@id": "1", "@type": "` + fmt.Sprintf(received, version) + `"}`),
+			FromVerKey: sender,
+			ToVerKeys:  []string{"other-agent", "recipient"},
+		})
+	}
+
+	t.Run("test best matching minor version", func(t *testing.T) {
+		for _, version := range []string{"1.0", "1.1", "1.2", "1.3"} {
+			require.NoError(t, handle(version, "sender"))
+		}
+
+		require.Equal(t, []string{fmt.Sprintf(received, "1.0"), fmt.Sprintf(received, "1.0")}, handled["v1.0"])
+		require.Equal(t, []string{fmt.Sprintf(received, "1.2"), fmt.Sprintf(received, "1.2")}, handled["v1.2"])
+		require.Empty(t, outbound.sent)
+	})
+
+	t.Run("test unsupported major version reported", func(t *testing.T) {
+		err := handle("2.0", "sender")
+		require.Error(t, err)
+
+		var versionErr *msgtype.VersionError
+		require.True(t, errors.As(err, &versionErr))
+		require.Equal(t, "1", versionErr.MsgID)
+		require.Equal(t, []string{"https://didcomm.org/didexchange/1.0", "https://didcomm.org/didexchange/1.2"},
+			versionErr.Supported)
+
+		require.Len(t, outbound.sent, 1)
+		require.Equal(t, "recipient", outbound.senderVerKey)
+		require.Equal(t, des, outbound.des)
+
+		report, ok := outbound.sent[0].(*model.ProblemReport)
+		require.True(t, ok)
+		require.Equal(t, model.ProblemReportMsgType, report.Type)
+		require.Equal(t, "1", report.Thread.ID)
+		require.Equal(t, msgtype.VersionProblemCode, report.Description.Code)
+		require.Equal(t, err.Error(), report.Description.English)
+	})
+
+	t.Run("test problem report not sent without destination", func(t *testing.T) {
+		outbound.sent = nil
+		outbound.err = errors.New("send error")
+
+		for _, sender := range []string{"other", "unknown", "sender"} {
+			var versionErr *msgtype.VersionError
+			require.True(t, errors.As(handle("2.0", sender), &versionErr))
+		}
+
+		// the report is sent to the sender with the destination only
+		require.Len(t, outbound.sent, 1)
+	})
+
+	t.Run("test problem report sent to the destination in the message", func(t *testing.T) {
+		outbound.sent = nil
+		outbound.err = nil
+
+		var versionErr *msgtype.VersionError
+		require.True(t, errors.As(handle("2.0", "stranger"), &versionErr))
+
+		require.Len(t, outbound.sent, 1)
+		require.Equal(t, "recipient", outbound.senderVerKey)
+		require.Equal(t, strangerDes, outbound.des)
+	})
+
+	t.Run("test problem report on the thread of the message", func(t *testing.T) {
+		outbound.sent = nil
+
+		err := ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message: []byte(`{"@id": "2", "@type": "` + fmt.Sprintf(received, "2.0") +
+				`", "~thread": {"thid": "thread"}}`),
+			FromVerKey: "sender",
+			ToVerKeys:  []string{"other-agent", "recipient"},
+		})
+		require.Error(t, err)
+
+		require.Len(t, outbound.sent, 1)
+
+		report, ok := outbound.sent[0].(*model.ProblemReport)
+		require.True(t, ok)
+		require.Equal(t, "thread", report.Thread.ID)
+	})
+
+	t.Run("test unknown protocol", func(t *testing.T) {
+		err := ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+			Message: []byte(`{"@id": "1", "@type": "https://didcomm.org/other/1.0/request"}`),
+		})
+		require.EqualError(t, err, "no message handlers found for the message type: "+
+			"https://didcomm.org/other/1.0/request")
+	})
+}
+
+func TestProvider_InboundMessageHandler_SchemaValidation(t *testing.T) {
+	const msgType = "https://didcomm.org/didexchange/1.0/request"
+
+	registry := schema.NewRegistry()
+	require.NoError(t, registry.Register(msgType, `{"type": "object", "required": ["label"]}`))
+
+	des := &service.Destination{RecipientKeys: []string{"sender"}, ServiceEndpoint: "http://sender"}
+	outbound := &captureOutbound{}
+
+	ctx, err := New(
+		WithOutboundDispatcher(outbound),
+		WithSchemaRegistry(registry),
+		WithKMS(&mockkms.CloseableKMS{}),
+		WithProtocolServices(&versionedService{
+			MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{
+				ProtocolName: "didexchange",
+				AcceptFunc: func(t string) bool {
+					return t == msgType
+				},
+				HandleFunc: func(*service.DIDCommMsg) (string, error) {
+					return "", nil
+				},
+			},
+			protocols: []string{"https://didcomm.org/didexchange/1.0"},
+		}, &mockResolverSvc{
+			MockDIDExchangeSvc: &protocol.MockDIDExchangeSvc{
+				ProtocolName: "resolver",
+				AcceptFunc: func(string) bool {
+					return false
+				},
+			},
+			mockResolver: &mockResolver{connections: map[string]interface{}{
+				"sender": &mockConnection{des: des},
+			}},
+		}))
+	require.NoError(t, err)
+
+	err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+		Message:    []byte(`{"@id": "1", "@type": "` + msgType + `"}`),
+		FromVerKey: "sender",
+		ToVerKeys:  []string{"recipient"},
+	})
+
+	var validationErr *schema.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+
+	// the sender is told why the message was rejected
+	require.Len(t, outbound.sent, 1)
+	require.Equal(t, des, outbound.des)
+
+	report, ok := outbound.sent[0].(*model.ProblemReport)
+	require.True(t, ok)
+	require.Equal(t, "1", report.Thread.ID)
+	require.Equal(t, schema.ProblemCode, report.Description.Code)
+	require.Equal(t, err.Error(), report.Description.English)
+
+	// the message of another minor version is validated against the schema of the negotiated version
+	err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+		Message:    []byte(`{"@id": "2", "@type": "https://didcomm.org/didexchange/1.1/request"}`),
+		FromVerKey: "sender",
+		ToVerKeys:  []string{"recipient"},
+	})
+	require.True(t, errors.As(err, &validationErr))
+
+	err = ctx.InboundMessageHandler()(gocontext.Background(), &transport.Envelope{
+		Message:    []byte(`{"@id": "3", "@type": "https://didcomm.org/didexchange/1.1/request", "label": "alice"}`),
+		FromVerKey: "sender",
+		ToVerKeys:  []string{"recipient"},
+	})
+	require.NoError(t, err)
+}
+
+type mockDestinationSvc struct {
+	*protocol.MockDIDExchangeSvc
+	des *service.Destination
+}
+
+func (s *mockDestinationSvc) ResolveDestination(gocontext.Context, *service.DIDCommMsg) (*service.Destination, error) {
+	return s.des, nil
+}
+
+type versionedService struct {
+	*protocol.MockDIDExchangeSvc
+	protocols []string
+}
+
+func (s *versionedService) Protocols() []string {
+	return s.protocols
+}
+
+type mockConnection struct {
+	des *service.Destination
+}
+
+func (c *mockConnection) Destination() *service.Destination {
+	return c.des
+}
+
+type captureOutbound struct {
+	sent         []interface{}
+	senderVerKey string
+	des          *service.Destination
+	err          error
+}
+
+func (o *captureOutbound) Send(msg interface{}, senderVerKey string, des *service.Destination) error {
+	o.sent = append(o.sent, msg)
+	o.senderVerKey = senderVerKey
+	o.des = des
+
+	return o.err
+}
@@ -9,8 +9,12 @@ package protocol
 import (
 	"github.com/google/uuid"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/workerpool"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/dispatcher"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	mockdispatcher "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/dispatcher"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/internal/mock/kms"
@@ -71,7 +75,7 @@ func (m *MockDIDExchangeSvc) Name() string {
 }
 
 // RegisterActionEvent register action event.
-func (m *MockDIDExchangeSvc) RegisterActionEvent(ch chan<- service.DIDCommAction) error {
+func (m *MockDIDExchangeSvc) RegisterActionEvent(ch chan<- service.DIDCommAction, opts ...service.EventOption) error {
 	if m.RegisterActionEventErr != nil {
 		return m.RegisterActionEventErr
 	}
@@ -89,7 +93,7 @@ func (m *MockDIDExchangeSvc) UnregisterActionEvent(ch chan<- service.DIDCommActi
 }
 
 // RegisterMsgEvent register message event.
-func (m *MockDIDExchangeSvc) RegisterMsgEvent(ch chan<- service.StateMsg) error {
+func (m *MockDIDExchangeSvc) RegisterMsgEvent(ch chan<- service.StateMsg, opts ...service.EventOption) error {
 	if m.RegisterMsgEventErr != nil {
 		return m.RegisterMsgEventErr
 	}
@@ -138,10 +142,47 @@ type MockProvider struct {
 	StoreProvider          *mockstore.MockStoreProvider
 	TransientStoreProvider *mockstore.MockStoreProvider
 	CustomVDRI             vdriapi.Registry
+	WorkerPools            *workerpool.Pools
+	MetricsSink            metrics.Sink
+	CustomTracer           trace.Tracer
+	History                *history.Archive
+	CustomOutbound         dispatcher.Outbound
 }
 
-// OutboundDispatcher is mock outbound dispatcher for DID exchange service
+// MessageHistory returns History, nil if the message history is not enabled
+func (p *MockProvider) MessageHistory() *history.Archive {
+	return p.History
+}
+
+// Tracer returns CustomTracer, the tracer recording nothing if CustomTracer is not set
+func (p *MockProvider) Tracer() trace.Tracer {
+	if p.CustomTracer != nil {
+		return p.CustomTracer
+	}
+
+	return trace.Noop
+}
+
+// Metrics returns MetricsSink, the sink discarding the metrics if MetricsSink is not set
+func (p *MockProvider) Metrics() metrics.Sink {
+	if p.MetricsSink != nil {
+		return p.MetricsSink
+	}
+
+	return metrics.Nop
+}
+
+// WorkerPool returns the worker pool of the service, the nil pool if WorkerPools is not set
+func (p *MockProvider) WorkerPool(name string) *workerpool.Pool {
+	return p.WorkerPools.Pool(name)
+}
+
+// OutboundDispatcher returns CustomOutbound, the mock outbound dispatcher if CustomOutbound is not set
 func (p *MockProvider) OutboundDispatcher() dispatcher.Outbound {
+	if p.CustomOutbound != nil {
+		return p.CustomOutbound
+	}
+
 	return &mockdispatcher.MockOutbound{}
 }
 
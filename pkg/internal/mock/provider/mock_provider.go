@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package provider
 
 import (
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/packer"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
 	"github.com/hyperledger/aries-framework-go/pkg/storage"
@@ -18,10 +19,12 @@ type Provider struct {
 	ServiceErr                    error
 	KMSValue                      kms.KeyManager
 	InboundEndpointValue          string
+	InboundEndpointsValue         []string
 	StorageProviderValue          storage.Provider
 	TransientStorageProviderValue storage.Provider
 	PackerList                    []packer.Packer
 	PackerValue                   packer.Packer
+	MessageHistoryValue           *history.Archive
 }
 
 // Service return service
@@ -39,6 +42,16 @@ func (p *Provider) InboundTransportEndpoint() string {
 	return p.InboundEndpointValue
 }
 
+// InboundTransportEndpoints returns the inbound transport endpoints, the inbound transport endpoint
+// if they are not set
+func (p *Provider) InboundTransportEndpoints() []string {
+	if p.InboundEndpointsValue == nil && p.InboundEndpointValue != "" {
+		return []string{p.InboundEndpointValue}
+	}
+
+	return p.InboundEndpointsValue
+}
+
 // StorageProvider returns the storage provider
 func (p *Provider) StorageProvider() storage.Provider {
 	return p.StorageProviderValue
@@ -58,3 +71,8 @@ func (p *Provider) Packers() []packer.Packer {
 func (p *Provider) PrimaryPacker() packer.Packer {
 	return p.PackerValue
 }
+
+// MessageHistory returns the message history archive
+func (p *Provider) MessageHistory() *history.Archive {
+	return p.MessageHistoryValue
+}
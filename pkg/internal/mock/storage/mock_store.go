@@ -49,11 +49,12 @@ func (s *MockStoreProvider) CloseStore(name string) error {
 
 // MockStore mock store.
 type MockStore struct {
-	Store  map[string][]byte
-	lock   sync.RWMutex
-	ErrPut error
-	ErrGet error
-	ErrItr error
+	Store     map[string][]byte
+	lock      sync.RWMutex
+	ErrPut    error
+	ErrGet    error
+	ErrItr    error
+	ErrDelete error
 }
 
 // Put stores the key and the record
@@ -82,6 +83,15 @@ func (s *MockStore) Get(k string) ([]byte, error) {
 	return val, s.ErrGet
 }
 
+// Delete deletes the record based on key
+func (s *MockStore) Delete(k string) error {
+	s.lock.Lock()
+	delete(s.Store, k)
+	s.lock.Unlock()
+
+	return s.ErrDelete
+}
+
 // Iterator returns an iterator for the underlying mockstore
 func (s *MockStore) Iterator(start, limit string) storage.StoreIterator {
 	if s.ErrItr != nil {
@@ -30,12 +30,17 @@ import (
 //   for encryption/decryption, so clients do not need to see
 //   the secrets themselves.
 type CryptoBox struct {
-	km *BaseKMS
+	km keyPairStore
+}
+
+// keyPairStore is implemented by the KMS keeping the key pairs the CryptoBox reads the secret keys from.
+type keyPairStore interface {
+	getKeyPairSet(verKey string) (*cryptoutil.MessagingKeys, error)
 }
 
 // NewCryptoBox creates a CryptoBox which provides crypto box encryption using the given KMS's keypairs
 func NewCryptoBox(w KeyManager) (*CryptoBox, error) {
-	wa, ok := w.(*BaseKMS)
+	wa, ok := w.(keyPairStore)
 	if !ok {
 		return nil, fmt.Errorf("cannot use parameter as KMS")
 	}
@@ -0,0 +1,180 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcutil/base58"
+
+	"github.com/hyperledger/aries-framework-go/pkg/internal/cryptoutil"
+)
+
+// MultiKMS combines the key stores of the KMS instances sharing the packers, e.g. the KMS instances
+// of the tenants of the multi-tenant agent. The operations on the existing key are delegated to the KMS
+// owning the key, the new keys are created by the primary KMS.
+type MultiKMS struct {
+	primary KMS
+
+	mu     sync.RWMutex
+	others map[string]KMS
+	// owners maps the keys found in the added KMS instances to the ID of the KMS, the added KMS instances
+	// are queried only for the keys looked up for the first time
+	owners map[string]string
+}
+
+// NewMultiKMS returns new MultiKMS instance with the primary KMS only.
+func NewMultiKMS(primary KMS) *MultiKMS {
+	return &MultiKMS{primary: primary, others: make(map[string]KMS), owners: make(map[string]string)}
+}
+
+// Add adds the KMS of the given ID, the KMS added with the same ID before is replaced.
+func (m *MultiKMS) Add(id string, k KMS) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.others[id] = k
+	m.unindex(id)
+}
+
+// Remove removes the KMS of the given ID, its keys are not accessible anymore.
+func (m *MultiKMS) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.others, id)
+	m.unindex(id)
+}
+
+// unindex removes the keys of the KMS from the index, the caller holds the lock.
+func (m *MultiKMS) unindex(id string) {
+	for key, owner := range m.owners {
+		if owner == id {
+			delete(m.owners, key)
+		}
+	}
+}
+
+// FindOwner returns the ID of the added KMS owning one of the candidate keys, false if none of the added
+// KMS instances owns any of them.
+func (m *MultiKMS) FindOwner(candidateKeys []string) (string, bool) {
+	for _, key := range candidateKeys {
+		// the keys of the primary KMS are not looked up in the added KMS instances
+		if _, err := m.primary.FindVerKey([]string{key}); err == nil {
+			continue
+		}
+
+		if id, _, ok := m.findOwner(key); ok {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// findOwner returns the ID and the added KMS owning the key, the owner found by querying the added
+// KMS instances is indexed.
+func (m *MultiKMS) findOwner(key string) (string, KMS, bool) {
+	m.mu.RLock()
+
+	if id, ok := m.owners[key]; ok {
+		k := m.others[id]
+		m.mu.RUnlock()
+
+		return id, k, true
+	}
+
+	others := make(map[string]KMS, len(m.others))
+	for id, k := range m.others {
+		others[id] = k
+	}
+
+	m.mu.RUnlock()
+
+	for id, k := range others {
+		if _, err := k.FindVerKey([]string{key}); err != nil {
+			continue
+		}
+
+		m.mu.Lock()
+		// the KMS might have been removed or replaced while it was queried
+		if m.others[id] == k {
+			m.owners[key] = id
+		}
+		m.mu.Unlock()
+
+		return id, k, true
+	}
+
+	return "", nil, false
+}
+
+// owner returns the KMS owning the key, the primary KMS if no KMS owns it.
+func (m *MultiKMS) owner(verKey string) KMS {
+	if _, err := m.primary.FindVerKey([]string{verKey}); err == nil {
+		return m.primary
+	}
+
+	if _, k, ok := m.findOwner(verKey); ok {
+		return k
+	}
+
+	return m.primary
+}
+
+// CreateKeySet creates the key set in the primary KMS.
+func (m *MultiKMS) CreateKeySet() (string, string, error) {
+	return m.primary.CreateKeySet()
+}
+
+// ConvertToEncryptionKey converts the key of the KMS owning it.
+func (m *MultiKMS) ConvertToEncryptionKey(key []byte) ([]byte, error) {
+	return m.owner(base58.Encode(key)).ConvertToEncryptionKey(key)
+}
+
+// DeriveKEK derives the key encryption key using the KMS owning the fromPubKey.
+func (m *MultiKMS) DeriveKEK(alg, apu, fromPubKey, toPubKey []byte) ([]byte, error) {
+	return m.owner(base58.Encode(fromPubKey)).DeriveKEK(alg, apu, fromPubKey, toPubKey)
+}
+
+// FindVerKey returns the index of the first candidate key found in the primary KMS, or in the added KMS
+// instances if the primary KMS has none of them.
+func (m *MultiKMS) FindVerKey(candidateKeys []string) (int, error) {
+	i, err := m.primary.FindVerKey(candidateKeys)
+	if err == nil || !errors.Is(err, cryptoutil.ErrKeyNotFound) {
+		return i, err
+	}
+
+	for i, key := range candidateKeys {
+		if _, _, ok := m.findOwner(key); ok {
+			return i, nil
+		}
+	}
+
+	return -1, err
+}
+
+// GetEncryptionKey returns the encryption key of the KMS owning the verification key.
+func (m *MultiKMS) GetEncryptionKey(verKey []byte) ([]byte, error) {
+	return m.owner(base58.Encode(verKey)).GetEncryptionKey(verKey)
+}
+
+// SignMessage signs the message by the KMS owning the verification key.
+func (m *MultiKMS) SignMessage(message []byte, fromVerKey string) ([]byte, error) {
+	return m.owner(fromVerKey).SignMessage(message, fromVerKey)
+}
+
+func (m *MultiKMS) getKeyPairSet(verKey string) (*cryptoutil.MessagingKeys, error) {
+	store, ok := m.owner(verKey).(keyPairStore)
+	if !ok {
+		return nil, fmt.Errorf("key pairs of key %s are not accessible", verKey)
+	}
+
+	return store.getKeyPairSet(verKey)
+}
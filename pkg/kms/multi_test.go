@@ -0,0 +1,166 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kms
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/internal/cryptoutil"
+)
+
+func TestMultiKMS(t *testing.T) {
+	primary, _ := newKMS(t)
+	tenant, _ := newKMS(t)
+
+	m := NewMultiKMS(primary)
+
+	_, primaryKey, err := m.CreateKeySet()
+	require.NoError(t, err)
+
+	_, tenantKey, err := tenant.CreateKeySet()
+	require.NoError(t, err)
+
+	// the keys of the tenant are not accessible before it is added
+	_, err = m.FindVerKey([]string{tenantKey})
+	require.True(t, errors.Is(err, cryptoutil.ErrKeyNotFound))
+
+	_, ok := m.FindOwner([]string{tenantKey})
+	require.False(t, ok)
+
+	m.Add("tenant", tenant)
+
+	i, err := m.FindVerKey([]string{tenantKey})
+	require.NoError(t, err)
+	require.Equal(t, 0, i)
+
+	i, err = m.FindVerKey([]string{tenantKey, primaryKey})
+	require.NoError(t, err)
+	require.Equal(t, 1, i)
+
+	id, ok := m.FindOwner([]string{primaryKey, tenantKey})
+	require.True(t, ok)
+	require.Equal(t, "tenant", id)
+
+	_, ok = m.FindOwner([]string{primaryKey})
+	require.False(t, ok)
+
+	// the operations on the keys are delegated to the owner
+	for _, key := range []string{primaryKey, tenantKey} {
+		encKey, err := m.GetEncryptionKey(base58.Decode(key))
+		require.NoError(t, err)
+
+		converted, err := m.ConvertToEncryptionKey(base58.Decode(key))
+		require.NoError(t, err)
+		require.Equal(t, encKey, converted)
+
+		_, err = m.DeriveKEK(nil, nil, encKey, encKey)
+		require.NoError(t, err)
+
+		_, err = m.SignMessage([]byte("message"), key)
+		require.NoError(t, err)
+
+		kp, err := m.getKeyPairSet(key)
+		require.NoError(t, err)
+		require.Equal(t, key, base58.Encode(kp.SigKeyPair.Pub))
+	}
+
+	// the crypto box opens the messages sealed for the keys of any KMS
+	b, err := NewCryptoBox(m)
+	require.NoError(t, err)
+
+	tenantEncKey, err := m.GetEncryptionKey(base58.Decode(tenantKey))
+	require.NoError(t, err)
+
+	sealed, err := b.Seal([]byte("message"), tenantEncKey, rand.Reader)
+	require.NoError(t, err)
+
+	opened, err := b.SealOpen(sealed, tenantEncKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("message"), opened)
+
+	m.Remove("tenant")
+
+	_, err = m.FindVerKey([]string{tenantKey})
+	require.True(t, errors.Is(err, cryptoutil.ErrKeyNotFound))
+
+	_, err = m.SignMessage([]byte("message"), tenantKey)
+	require.Error(t, err)
+}
+
+func TestMultiKMS_OwnerIndex(t *testing.T) {
+	primary, _ := newKMS(t)
+	k, _ := newKMS(t)
+	tenant := &countingKMS{KMS: k}
+
+	m := NewMultiKMS(primary)
+	m.Add("tenant", tenant)
+	m.Add("other", &countingKMS{KMS: primary})
+
+	_, tenantKey, err := tenant.CreateKeySet()
+	require.NoError(t, err)
+
+	// the tenant KMS is queried for the first lookup only
+	for i := 0; i < 3; i++ {
+		id, ok := m.FindOwner([]string{tenantKey})
+		require.True(t, ok)
+		require.Equal(t, "tenant", id)
+
+		_, err = m.SignMessage([]byte("message"), tenantKey)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 1, tenant.lookups)
+
+	// the index is dropped with the KMS
+	m.Remove("tenant")
+
+	_, ok := m.FindOwner([]string{tenantKey})
+	require.False(t, ok)
+
+	m.Add("tenant", tenant)
+
+	_, ok = m.FindOwner([]string{tenantKey})
+	require.True(t, ok)
+	require.Equal(t, 2, tenant.lookups)
+}
+
+func TestMultiKMS_KeyPairsNotAccessible(t *testing.T) {
+	primary, _ := newKMS(t)
+
+	m := NewMultiKMS(primary)
+	m.Add("tenant", &stubKMS{KMS: primary})
+
+	_, err := m.getKeyPairSet("key")
+	require.True(t, errors.Is(err, cryptoutil.ErrKeyNotFound))
+
+	m = NewMultiKMS(&stubKMS{KMS: primary})
+
+	_, err = m.getKeyPairSet("key")
+	require.EqualError(t, err, "key pairs of key key are not accessible")
+}
+
+// stubKMS hides the key pairs of the wrapped KMS.
+type stubKMS struct {
+	KMS
+}
+
+// countingKMS counts the key lookups.
+type countingKMS struct {
+	KMS
+	lookups int
+}
+
+func (k *countingKMS) FindVerKey(candidateKeys []string) (int, error) {
+	k.lookups++
+
+	return k.KMS.FindVerKey(candidateKeys)
+}
@@ -38,6 +38,18 @@ const (
 
 	// Introduce error group for Introduce protocol rest api errors
 	Introduce Group = 3000
+
+	// Policy error group for auto-accept policy rest api errors
+	Policy Group = 4000
+
+	// Outbox error group for outbox rest api errors
+	Outbox Group = 5000
+
+	// Metrics error group for metrics rest api errors
+	Metrics Group = 6000
+
+	// Tenant error group for multi-tenancy rest api errors
+	Tenant Group = 7000
 )
 
 // Code is the error code of aries rest api errors
@@ -39,6 +39,8 @@ const (
 	connectionsByID         = operationID + "/{id}"
 	acceptExchangeRequest   = operationID + "/{id}/accept-request"
 	removeConnection        = operationID + "/{id}/remove"
+	connectionMetadata      = operationID + "/{id}/metadata"
+	messageHistory          = operationID + "/{id}/messages"
 	connectionsWebhookTopic = "connections"
 )
 
@@ -64,13 +66,19 @@ const (
 
 	// RemoveConnectionErrorCode is for failures in remove connection endpoint
 	RemoveConnectionErrorCode
+
+	// ConnectionMetadataErrorCode is for failures in connection metadata endpoints
+	ConnectionMetadataErrorCode
+
+	// MessageHistoryErrorCode is for failures in message history endpoint
+	MessageHistoryErrorCode
 )
 
 // provider contains dependencies for the Exchange protocol and is typically created by using aries.Context()
 type provider interface {
 	Service(id string) (interface{}, error)
 	KMS() kms.KeyManager
-	InboundTransportEndpoint() string
+	InboundTransportEndpoints() []string
 	StorageProvider() storage.Provider
 	TransientStorageProvider() storage.Provider
 }
@@ -169,7 +177,7 @@ func (c *Operation) ReceiveInvitation(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	connectionID, err := c.client.HandleInvitation(request.Invitation)
+	connectionID, err := c.client.HandleInvitationContext(req.Context(), request.Invitation)
 	if err != nil {
 		resterrors.SendHTTPInternalServerError(rw, ReceiveInvitationErrorCode, err)
 		return
@@ -205,7 +213,7 @@ func (c *Operation) AcceptInvitation(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	err = c.client.AcceptInvitation(id, request.Public, c.defaultLabel)
+	err = c.client.AcceptInvitationContext(req.Context(), id, request.Public, c.defaultLabel)
 	if err != nil {
 		logger.Errorf("accept invitation api failed for id %s with error %s", id, err)
 		resterrors.SendHTTPInternalServerError(rw, AcceptInvitationErrorCode, err)
@@ -243,7 +251,7 @@ func (c *Operation) AcceptExchangeRequest(rw http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	err = c.client.AcceptExchangeRequest(id, request.Public, c.defaultLabel)
+	err = c.client.AcceptExchangeRequestContext(req.Context(), id, request.Public, c.defaultLabel)
 	if err != nil {
 		logger.Errorf("accepting connection request failed for id %s with error %s", id, err)
 		resterrors.SendHTTPInternalServerError(rw, AcceptExchangeRequestErrorCode, err)
@@ -341,6 +349,97 @@ func (c *Operation) RemoveConnection(rw http.ResponseWriter, req *http.Request)
 	}
 }
 
+// SaveConnectionMetadata swagger:route POST /connections/{id}/metadata did-exchange saveConnectionMetadata
+//
+// Saves alias, tags and JSON metadata of given connection.
+//
+// Responses:
+//    default: genericError
+//        200: connectionMetadataResponse
+func (c *Operation) SaveConnectionMetadata(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	logger.Debugf("Saving connection metadata for id [%s]", id)
+
+	var request models.SaveConnectionMetadataRequest
+
+	err := json.NewDecoder(req.Body).Decode(&request.Params)
+	if err != nil {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, err)
+		return
+	}
+
+	if request.Params == nil || request.Params.ConnectionMetadata == nil {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, fmt.Errorf("empty connection metadata"))
+		return
+	}
+
+	err = c.client.SaveConnectionMetadata(id, request.Params)
+	if err != nil {
+		c.sendConnectionMetadataError(rw, err)
+		return
+	}
+
+	c.writeResponse(rw, models.ConnectionMetadataResponse{Result: request.Params})
+}
+
+// GetConnectionMetadata swagger:route GET /connections/{id}/metadata did-exchange getConnectionMetadata
+//
+// Fetch alias, tags and JSON metadata of given connection.
+//
+// Responses:
+//    default: genericError
+//        200: connectionMetadataResponse
+func (c *Operation) GetConnectionMetadata(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	logger.Debugf("Querying connection metadata for id [%s]", id)
+
+	result, err := c.client.GetConnectionMetadata(id)
+	if err != nil {
+		c.sendConnectionMetadataError(rw, err)
+		return
+	}
+
+	c.writeResponse(rw, models.ConnectionMetadataResponse{Result: result})
+}
+
+// GetMessageHistory swagger:route GET /connections/{id}/messages did-exchange getMessageHistory
+//
+// Fetch the messages exchanged over given connection and its state transitions.
+//
+// Responses:
+//    default: genericError
+//        200: messageHistoryResponse
+func (c *Operation) GetMessageHistory(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+
+	logger.Debugf("Querying message history for connection id [%s]", id)
+
+	result, err := c.client.MessageHistory(id)
+	if err != nil {
+		if errors.Is(err, didexchange.ErrMessageHistoryDisabled) {
+			resterrors.SendHTTPStatusError(rw, MessageHistoryErrorCode, err, http.StatusNotImplemented)
+			return
+		}
+
+		resterrors.SendHTTPInternalServerError(rw, MessageHistoryErrorCode, err)
+
+		return
+	}
+
+	c.writeResponse(rw, models.MessageHistoryResponse{Result: result})
+}
+
+func (c *Operation) sendConnectionMetadataError(rw http.ResponseWriter, err error) {
+	if errors.Is(err, didexchange.ErrConnectionNotFound) {
+		resterrors.SendHTTPStatusError(rw, ConnectionMetadataErrorCode, err, http.StatusNotFound)
+		return
+	}
+
+	resterrors.SendHTTPInternalServerError(rw, ConnectionMetadataErrorCode, err)
+}
+
 // writeResponse writes interface value to response
 func (c *Operation) writeResponse(rw io.Writer, v interface{}) {
 	err := json.NewEncoder(rw).Encode(v)
@@ -366,6 +465,9 @@ func (c *Operation) registerHandler() {
 		support.NewHTTPHandler(acceptInvitationPath, http.MethodPost, c.AcceptInvitation),
 		support.NewHTTPHandler(acceptExchangeRequest, http.MethodPost, c.AcceptExchangeRequest),
 		support.NewHTTPHandler(removeConnection, http.MethodPost, c.RemoveConnection),
+		support.NewHTTPHandler(connectionMetadata, http.MethodPost, c.SaveConnectionMetadata),
+		support.NewHTTPHandler(connectionMetadata, http.MethodGet, c.GetConnectionMetadata),
+		support.NewHTTPHandler(messageHistory, http.MethodGet, c.GetMessageHistory),
 	}
 }
 
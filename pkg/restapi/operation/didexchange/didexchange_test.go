@@ -8,6 +8,7 @@ package didexchange
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/hyperledger/aries-framework-go/pkg/client/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
 	didexsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
 	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
@@ -230,6 +232,29 @@ func TestOperation_ReceiveInvitationFailure(t *testing.T) {
 	verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
 }
 
+func TestOperation_ReceiveInvitationRequestContext(t *testing.T) {
+	var jsonStr = []byte(`{
+		"serviceEndpoint":"http://alice.agent.example.com:8081",
+		"recipientKeys":["FDmegH8upiNquathbHZiGBZKwcudNfNWPeGQFBt8eNNi"],
+		"@id":"a35c0ac6-4fc3-46af-a072-c1036d036057",
+		"label":"agent",
+		"@type":"https://didcomm.org/didexchange/1.0/invitation"}`)
+
+	handler := getHandler(t, receiveInvitationPath, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the invitation is not handled once the client went away
+	req := httptest.NewRequest(handler.Method(), handler.Path(), bytes.NewBuffer(jsonStr)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.Handle()(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+	verifyRESTError(t, ReceiveInvitationErrorCode, rr.Body.Bytes())
+}
+
 func TestOperation_AcceptInvitation(t *testing.T) {
 	t.Run("test accept invitation success", func(t *testing.T) {
 		handler := getHandler(t, acceptInvitationPath, nil, nil)
@@ -293,6 +318,103 @@ func TestOperation_RemoveConnection(t *testing.T) {
 	require.Empty(t, buf.Bytes())
 }
 
+func TestOperation_ConnectionMetadata(t *testing.T) {
+	op := getOperation(t, nil, nil)
+	saveHandler := handlerLookupWithMethod(t, op, connectionMetadata, http.MethodPost)
+	getMetaHandler := handlerLookupWithMethod(t, op, connectionMetadata, http.MethodGet)
+
+	t.Run("test save and get connection metadata", func(t *testing.T) {
+		buf, err := getSuccessResponseFromHandler(saveHandler,
+			bytes.NewBufferString(`{"alias":"alice","tags":["partner"],"metadata":{"customerID":"c-1"}}`),
+			operationID+"/1234/metadata")
+		require.NoError(t, err)
+
+		response := models.ConnectionMetadataResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &response))
+		require.Equal(t, "alice", response.Result.Alias)
+
+		buf, err = getSuccessResponseFromHandler(getMetaHandler, nil, operationID+"/1234/metadata")
+		require.NoError(t, err)
+
+		response = models.ConnectionMetadataResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &response))
+		require.Equal(t, "alice", response.Result.Alias)
+		require.Equal(t, []string{"partner"}, response.Result.Tags)
+		require.JSONEq(t, `{"customerID":"c-1"}`, string(response.Result.Metadata))
+
+		buf, err = getSuccessResponseFromHandler(handlerLookup(t, op, connections), nil, operationID+"?tag=partner")
+		require.NoError(t, err)
+
+		queryResponse := models.QueryConnectionsResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &queryResponse))
+		require.Len(t, queryResponse.Results, 1)
+		require.Equal(t, "alice", queryResponse.Results[0].Alias)
+	})
+
+	t.Run("test save connection metadata invalid request", func(t *testing.T) {
+		buf, code, err := sendRequestToHandler(saveHandler, bytes.NewBufferString("--"), operationID+"/1234/metadata")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, code)
+		verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
+
+		buf, code, err = sendRequestToHandler(saveHandler, bytes.NewBufferString("null"), operationID+"/1234/metadata")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, code)
+		verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
+	})
+
+	t.Run("test connection not found", func(t *testing.T) {
+		buf, code, err := sendRequestToHandler(saveHandler, bytes.NewBufferString(`{"alias":"alice"}`),
+			operationID+"/5555/metadata")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, ConnectionMetadataErrorCode, buf.Bytes())
+
+		buf, code, err = sendRequestToHandler(getMetaHandler, nil, operationID+"/5555/metadata")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, ConnectionMetadataErrorCode, buf.Bytes())
+	})
+}
+
+func TestOperation_GetMessageHistory(t *testing.T) {
+	t.Run("test message history is not enabled", func(t *testing.T) {
+		handler := getHandler(t, messageHistory, nil, nil)
+
+		buf, code, err := sendRequestToHandler(handler, nil, operationID+"/1234/messages")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, code)
+		verifyRESTError(t, MessageHistoryErrorCode, buf.Bytes())
+	})
+
+	archive, err := history.New(&mockprovider.Provider{StorageProviderValue: mockstore.NewMockStoreProvider()})
+	require.NoError(t, err)
+
+	svc, err := New(&mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          mockstore.NewMockStoreProvider(),
+		ServiceValue:                  &protocol.MockDIDExchangeSvc{},
+		MessageHistoryValue:           archive},
+		webhook.NewHTTPNotifier(nil), "")
+	require.NoError(t, err)
+
+	handler := handlerLookup(t, svc, messageHistory)
+
+	t.Run("test get message history", func(t *testing.T) {
+		require.NoError(t, archive.Record(&history.Entry{ConnectionID: "1234", Direction: history.Inbound,
+			MessageType: "https://didcomm.org/basicmessage/1.0/message"}))
+
+		buf, err := getSuccessResponseFromHandler(handler, nil, operationID+"/1234/messages")
+		require.NoError(t, err)
+
+		response := models.MessageHistoryResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &response))
+		require.Len(t, response.Result, 1)
+		require.Equal(t, history.Inbound, response.Result[0].Direction)
+		require.Equal(t, "https://didcomm.org/basicmessage/1.0/message", response.Result[0].MessageType)
+	})
+}
+
 func TestOperation_WriteResponse(t *testing.T) {
 	svc, err := New(&mockprovider.Provider{
 		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
@@ -340,6 +462,10 @@ func getSuccessResponseFromHandler(handler operation.Handler, requestBody io.Rea
 }
 
 func getHandler(t *testing.T, lookup string, handleErr, acceptErr error) operation.Handler {
+	return handlerLookup(t, getOperation(t, handleErr, acceptErr), lookup)
+}
+
+func getOperation(t *testing.T, handleErr, acceptErr error) *Operation {
 	transientStore := mockstore.MockStore{Store: make(map[string][]byte)}
 	store := mockstore.MockStore{Store: make(map[string][]byte)}
 	connRec := &didexsvc.ConnectionRecord{State: "complete", ConnectionID: "1234", ThreadID: "th1234"}
@@ -372,7 +498,7 @@ func getHandler(t *testing.T, lookup string, handleErr, acceptErr error) operati
 	require.NoError(t, err)
 	require.NotNil(t, svc)
 
-	return handlerLookup(t, svc, lookup)
+	return svc
 }
 
 func handlerLookup(t *testing.T, op *Operation, lookup string) operation.Handler {
@@ -390,6 +516,18 @@ func handlerLookup(t *testing.T, op *Operation, lookup string) operation.Handler
 	return nil
 }
 
+func handlerLookupWithMethod(t *testing.T, op *Operation, lookup, method string) operation.Handler {
+	for _, h := range op.GetRESTHandlers() {
+		if h.Path() == lookup && h.Method() == method {
+			return h
+		}
+	}
+
+	require.Fail(t, "unable to find handler")
+
+	return nil
+}
+
 func TestAcceptExchangeRequest(t *testing.T) {
 	transientStore := mockstore.NewMockStoreProvider()
 	store := mockstore.NewMockStoreProvider()
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/hyperledger/aries-framework-go/pkg/client/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/history"
 )
 
 // CreateInvitationRequest model
@@ -340,3 +341,70 @@ type RemoveConnectionRequest struct {
 // swagger:response removeConnectionResponse
 type RemoveConnectionResponse struct {
 }
+
+// SaveConnectionMetadataRequest model
+//
+// This is used for saving alias, tags and metadata of a connection
+//
+// swagger:parameters saveConnectionMetadata
+type SaveConnectionMetadataRequest struct {
+	// Connection ID
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+
+	// Alias, tags and JSON metadata to be saved
+	//
+	// in: body
+	// required: true
+	Params *didexchange.ConnectionMetadata `json:""`
+}
+
+// ConnectionMetadataRequest model
+//
+// This is used for getting alias, tags and metadata of a connection
+//
+// swagger:parameters getConnectionMetadata
+type ConnectionMetadataRequest struct {
+	// The ID of the connection
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// ConnectionMetadataResponse model
+//
+// This is used for returning alias, tags and metadata of a connection
+//
+// swagger:response connectionMetadataResponse
+type ConnectionMetadataResponse struct {
+
+	// in: body
+	Result *didexchange.ConnectionMetadata `json:"result,omitempty"`
+}
+
+// MessageHistoryRequest model
+//
+// This is used for getting the messages and state transitions of a connection
+//
+// swagger:parameters getMessageHistory
+type MessageHistoryRequest struct {
+	// The ID of the connection
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// MessageHistoryResponse model
+//
+// This is used for returning the messages and state transitions of a connection ordered by time
+//
+// swagger:response messageHistoryResponse
+type MessageHistoryResponse struct {
+
+	// in: body
+	Result []*history.Entry `json:"result"`
+}
@@ -0,0 +1,92 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/common/support"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+var logger = log.New("aries-framework/controller/metrics")
+
+const (
+	metricsPath = "/metrics"
+	// contentType is the content type of the Prometheus text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// ExportMetricsErrorCode is for failures while exporting the metrics
+const ExportMetricsErrorCode = resterrors.Code(iota + resterrors.Metrics)
+
+// provider contains dependencies for the metrics controller and is typically created by using aries.Context()
+type provider interface {
+	Metrics() metrics.Sink
+}
+
+// Operation is controller REST service controller for the metrics.
+type Operation struct {
+	exporter metrics.Exporter
+	handlers []operation.Handler
+}
+
+// New returns new metrics rest client instance, the metrics sink of the framework must export
+// the metrics in the Prometheus text format.
+func New(ctx provider) (*Operation, error) {
+	exporter, ok := ctx.Metrics().(metrics.Exporter)
+	if !ok {
+		return nil, errors.New("metrics sink does not export the Prometheus text format")
+	}
+
+	o := &Operation{exporter: exporter}
+	o.registerHandler()
+
+	return o, nil
+}
+
+// Metrics swagger:route GET /metrics metrics metrics
+//
+// Fetch the metrics of the agent in the Prometheus text format.
+//
+// Produces:
+//    - text/plain
+//
+// Responses:
+//    default: genericError
+//        200: metricsResponse
+func (o *Operation) Metrics(rw http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+
+	if err := o.exporter.WritePrometheus(&buf); err != nil {
+		resterrors.SendHTTPInternalServerError(rw, ExportMetricsErrorCode, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+
+	if _, err := buf.WriteTo(rw); err != nil {
+		logger.Errorf("Unable to send metrics response, %s", err)
+	}
+}
+
+// GetRESTHandlers get all controller API handler available for this service
+func (o *Operation) GetRESTHandlers() []operation.Handler {
+	return o.handlers
+}
+
+// registerHandler register handlers to be exposed from this service as REST API endpoints
+func (o *Operation) registerHandler() {
+	o.handlers = []operation.Handler{
+		support.NewHTTPHandler(metricsPath, http.MethodGet, o.Metrics),
+	}
+}
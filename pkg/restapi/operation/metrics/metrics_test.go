@@ -0,0 +1,81 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("test sink not exporting the metrics", func(t *testing.T) {
+		_, err := New(&mockProvider{sink: metrics.Nop})
+		require.EqualError(t, err, "metrics sink does not export the Prometheus text format")
+	})
+
+	t.Run("test handlers", func(t *testing.T) {
+		op, err := New(&mockProvider{sink: metrics.NewRegistry()})
+		require.NoError(t, err)
+
+		handlers := op.GetRESTHandlers()
+		require.Len(t, handlers, 1)
+		require.Equal(t, metricsPath, handlers[0].Path())
+		require.Equal(t, http.MethodGet, handlers[0].Method())
+	})
+}
+
+func TestOperation_Metrics(t *testing.T) {
+	t.Run("test metrics exported", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		registry.IncCounter(metrics.OutboundFailures, metrics.Labels{"scheme": "http"})
+
+		op, err := New(&mockProvider{sink: registry})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		op.GetRESTHandlers()[0].Handle().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, contentType, rr.Header().Get("Content-Type"))
+		require.Contains(t, rr.Body.String(), "# TYPE aries_outbound_failures_total counter\n"+
+			`aries_outbound_failures_total{scheme="http"} 1`)
+	})
+
+	t.Run("test export error", func(t *testing.T) {
+		op, err := New(&mockProvider{sink: &failingExporter{}})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		op.GetRESTHandlers()[0].Handle().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "export error")
+	})
+}
+
+type mockProvider struct {
+	sink metrics.Sink
+}
+
+func (p *mockProvider) Metrics() metrics.Sink {
+	return p.sink
+}
+
+type failingExporter struct {
+	metrics.Sink
+}
+
+func (e *failingExporter) WritePrometheus(io.Writer) error {
+	return errors.New("export error")
+}
@@ -0,0 +1,18 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+// PrometheusResponse model
+//
+// This is used for returning the metrics in the Prometheus text format.
+//
+// swagger:response metricsResponse
+type PrometheusResponse struct {
+
+	// in: body
+	Body string
+}
@@ -0,0 +1,62 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
+)
+
+// QueuedMessagesResponse model
+//
+// This is used for returning the messages waiting for the delivery
+//
+// swagger:response queuedMessagesResponse
+type QueuedMessagesResponse struct {
+
+	// in: body
+	Results []*outbox.Record `json:"results"`
+}
+
+// DeadLettersResponse model
+//
+// This is used for returning the messages which could not be delivered
+//
+// swagger:response deadLettersResponse
+type DeadLettersResponse struct {
+
+	// in: body
+	Results []*outbox.Record `json:"results"`
+}
+
+// MessageIDParams model
+//
+// This is used for the outbox message operations
+//
+// swagger:parameters retryMessage purgeMessage
+type MessageIDParams struct {
+	// The ID of the outbox message
+	//
+	// in: path
+	// required: true
+	ID string `json:"id"`
+}
+
+// RetryMessageResponse model
+//
+// response of retry message action
+//
+// swagger:response retryMessageResponse
+type RetryMessageResponse struct {
+}
+
+// PurgeMessageResponse model
+//
+// response of purge message action
+//
+// swagger:response purgeMessageResponse
+type PurgeMessageResponse struct {
+}
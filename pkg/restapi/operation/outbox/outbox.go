@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/common/support"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+var logger = log.New("aries-framework/controller/outbox")
+
+const (
+	operationID     = "/outbox"
+	deadLettersPath = operationID + "/dead-letters"
+	retryPath       = operationID + "/{id}/retry"
+	purgePath       = operationID + "/{id}/purge"
+)
+
+const (
+	// InvalidRequestErrorCode is typically a code for validation errors
+	// for invalid outbox controller requests
+	InvalidRequestErrorCode = resterrors.Code(iota + resterrors.Outbox)
+
+	// QueryMessagesErrorCode is for failures in query outbox messages endpoints
+	QueryMessagesErrorCode
+
+	// RetryMessageErrorCode is for failures in retry message endpoint
+	RetryMessageErrorCode
+
+	// PurgeMessageErrorCode is for failures in purge message endpoint
+	PurgeMessageErrorCode
+)
+
+// provider contains dependencies for the outbox controller and is typically created by using aries.Context()
+type provider interface {
+	Outbox() *outbox.Outbox
+}
+
+// Operation is controller REST service controller for the outbox.
+type Operation struct {
+	outbox   *outbox.Outbox
+	handlers []operation.Handler
+}
+
+// New returns new outbox rest client instance
+func New(ctx provider) (*Operation, error) {
+	if ctx.Outbox() == nil {
+		return nil, errors.New("outbox is not enabled")
+	}
+
+	o := &Operation{outbox: ctx.Outbox()}
+	o.registerHandler()
+
+	return o, nil
+}
+
+// QueuedMessages swagger:route GET /outbox outbox queuedMessages
+//
+// Fetch the messages waiting for the delivery.
+//
+// Responses:
+//    default: genericError
+//        200: queuedMessagesResponse
+func (o *Operation) QueuedMessages(rw http.ResponseWriter, req *http.Request) {
+	records, err := o.outbox.Queued()
+	if err != nil {
+		resterrors.SendHTTPInternalServerError(rw, QueryMessagesErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, QueuedMessagesResponse{Results: records})
+}
+
+// DeadLetters swagger:route GET /outbox/dead-letters outbox deadLetters
+//
+// Fetch the messages which could not be delivered.
+//
+// Responses:
+//    default: genericError
+//        200: deadLettersResponse
+func (o *Operation) DeadLetters(rw http.ResponseWriter, req *http.Request) {
+	records, err := o.outbox.DeadLetters()
+	if err != nil {
+		resterrors.SendHTTPInternalServerError(rw, QueryMessagesErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, DeadLettersResponse{Results: records})
+}
+
+// RetryMessage swagger:route POST /outbox/{id}/retry outbox retryMessage
+//
+// Retry the delivery of the queued or dead-lettered message.
+//
+// Responses:
+//    default: genericError
+//        200: retryMessageResponse
+func (o *Operation) RetryMessage(rw http.ResponseWriter, req *http.Request) {
+	id, ok := messageID(rw, req)
+	if !ok {
+		return
+	}
+
+	if err := o.outbox.Retry(id); err != nil {
+		sendError(rw, RetryMessageErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, RetryMessageResponse{})
+}
+
+// PurgeMessage swagger:route POST /outbox/{id}/purge outbox purgeMessage
+//
+// Purge the queued or dead-lettered message.
+//
+// Responses:
+//    default: genericError
+//        200: purgeMessageResponse
+func (o *Operation) PurgeMessage(rw http.ResponseWriter, req *http.Request) {
+	id, ok := messageID(rw, req)
+	if !ok {
+		return
+	}
+
+	if err := o.outbox.Purge(id); err != nil {
+		sendError(rw, PurgeMessageErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, PurgeMessageResponse{})
+}
+
+func messageID(rw http.ResponseWriter, req *http.Request) (string, bool) {
+	id := mux.Vars(req)["id"]
+	if id == "" {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, fmt.Errorf("empty message ID"))
+		return "", false
+	}
+
+	return id, true
+}
+
+func sendError(rw http.ResponseWriter, code resterrors.Code, err error) {
+	if errors.Is(err, outbox.ErrNotFound) {
+		resterrors.SendHTTPStatusError(rw, code, err, http.StatusNotFound)
+		return
+	}
+
+	resterrors.SendHTTPInternalServerError(rw, code, err)
+}
+
+// writeResponse writes interface value to response
+func (o *Operation) writeResponse(rw io.Writer, v interface{}) {
+	err := json.NewEncoder(rw).Encode(v)
+	// as of now, just log errors for writing response
+	if err != nil {
+		logger.Errorf("Unable to send error response, %s", err)
+	}
+}
+
+// GetRESTHandlers get all controller API handler available for this service
+func (o *Operation) GetRESTHandlers() []operation.Handler {
+	return o.handlers
+}
+
+// registerHandler register handlers to be exposed from this service as REST API endpoints
+func (o *Operation) registerHandler() {
+	o.handlers = []operation.Handler{
+		support.NewHTTPHandler(operationID, http.MethodGet, o.QueuedMessages),
+		support.NewHTTPHandler(deadLettersPath, http.MethodGet, o.DeadLetters),
+		support.NewHTTPHandler(retryPath, http.MethodPost, o.RetryMessage),
+		support.NewHTTPHandler(purgePath, http.MethodPost, o.PurgeMessage),
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/outbox"
+	mockdispatcher "github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/dispatcher"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/internal/mock/provider"
+	mockstore "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ob := newOutbox(t, &mockdispatcher.MockOutbound{})
+
+		defer func() { require.NoError(t, ob.Close()) }()
+
+		op, err := New(&mockProvider{outbox: ob})
+		require.NoError(t, err)
+		require.Len(t, op.GetRESTHandlers(), 4)
+	})
+
+	t.Run("outbox not enabled", func(t *testing.T) {
+		_, err := New(&mockProvider{})
+		require.EqualError(t, err, "outbox is not enabled")
+	})
+}
+
+func TestOperation_Outbox(t *testing.T) {
+	outbound := &mockdispatcher.MockOutbound{SendErr: errors.New("endpoint unavailable")}
+	ob := newOutbox(t, outbound)
+
+	defer func() { require.NoError(t, ob.Close()) }()
+
+	op, err := New(&mockProvider{outbox: ob})
+	require.NoError(t, err)
+
+	require.Error(t, ob.Send("msg", "sender", &service.Destination{ServiceEndpoint: "url"}))
+
+	t.Run("queued messages", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, operationID), nil, operationID)
+		require.Equal(t, http.StatusOK, code)
+
+		response := &QueuedMessagesResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), response))
+		require.Empty(t, response.Results)
+	})
+
+	var id string
+
+	t.Run("dead letters", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, deadLettersPath), nil, deadLettersPath)
+		require.Equal(t, http.StatusOK, code)
+
+		response := &DeadLettersResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), response))
+		require.Len(t, response.Results, 1)
+		require.Equal(t, "endpoint unavailable", response.Results[0].LastError)
+
+		id = response.Results[0].ID
+	})
+
+	t.Run("retry message", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, retryPath), nil,
+			strings.Replace(retryPath, "{id}", id, 1))
+		require.Equal(t, http.StatusOK, code, buf.String())
+
+		records, err := ob.Queued()
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, id, records[0].ID)
+	})
+
+	t.Run("purge message", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, purgePath), nil,
+			strings.Replace(purgePath, "{id}", id, 1))
+		require.Equal(t, http.StatusOK, code, buf.String())
+
+		records, err := ob.Queued()
+		require.NoError(t, err)
+		require.Empty(t, records)
+	})
+
+	t.Run("unknown message", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, retryPath), nil,
+			strings.Replace(retryPath, "{id}", "unknown", 1))
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, RetryMessageErrorCode, buf.Bytes())
+
+		buf, code = sendRequestToHandler(t, handlerLookup(t, op, purgePath), nil,
+			strings.Replace(purgePath, "{id}", "unknown", 1))
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, PurgeMessageErrorCode, buf.Bytes())
+	})
+}
+
+func TestOperation_Errors(t *testing.T) {
+	store := &mockstore.MockStore{Store: make(map[string][]byte)}
+
+	ob, err := outbox.New(&mockprovider.Provider{StorageProviderValue: &mockstore.MockStoreProvider{Store: store}},
+		&mockdispatcher.MockOutbound{})
+	require.NoError(t, err)
+
+	// the worker is stopped before the store is broken
+	require.NoError(t, ob.Close())
+
+	// store with invalid records
+	store.Store["outbox_id"] = []byte("invalid")
+	store.ErrGet = errors.New("get error")
+
+	op, err := New(&mockProvider{outbox: ob})
+	require.NoError(t, err)
+
+	buf, code := sendRequestToHandler(t, handlerLookup(t, op, operationID), nil, operationID)
+	require.Equal(t, http.StatusInternalServerError, code)
+	verifyRESTError(t, QueryMessagesErrorCode, buf.Bytes())
+
+	buf, code = sendRequestToHandler(t, handlerLookup(t, op, deadLettersPath), nil, deadLettersPath)
+	require.Equal(t, http.StatusInternalServerError, code)
+	verifyRESTError(t, QueryMessagesErrorCode, buf.Bytes())
+
+	buf, code = sendRequestToHandler(t, handlerLookup(t, op, retryPath), nil,
+		strings.Replace(retryPath, "{id}", "id", 1))
+	require.Equal(t, http.StatusInternalServerError, code)
+	verifyRESTError(t, RetryMessageErrorCode, buf.Bytes())
+
+	buf, code = sendRequestToHandler(t, handlerLookup(t, op, purgePath), nil,
+		strings.Replace(purgePath, "{id}", "id", 1))
+	require.Equal(t, http.StatusInternalServerError, code)
+	verifyRESTError(t, PurgeMessageErrorCode, buf.Bytes())
+
+	// empty message ID
+	rr := httptest.NewRecorder()
+	op.RetryMessage(rr, httptest.NewRequest(http.MethodPost, "/outbox//retry", nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	verifyRESTError(t, InvalidRequestErrorCode, rr.Body.Bytes())
+
+	rr = httptest.NewRecorder()
+	op.PurgeMessage(rr, httptest.NewRequest(http.MethodPost, "/outbox//purge", nil))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	verifyRESTError(t, InvalidRequestErrorCode, rr.Body.Bytes())
+}
+
+func newOutbox(t *testing.T, outbound *mockdispatcher.MockOutbound) *outbox.Outbox {
+	ob, err := outbox.New(&mockprovider.Provider{StorageProviderValue: mem.NewProvider()}, outbound,
+		outbox.WithMaxAttempts(1))
+	require.NoError(t, err)
+
+	return ob
+}
+
+type mockProvider struct {
+	outbox *outbox.Outbox
+}
+
+func (p *mockProvider) Outbox() *outbox.Outbox {
+	return p.outbox
+}
+
+func handlerLookup(t *testing.T, op *Operation, lookup string) operation.Handler {
+	for _, h := range op.GetRESTHandlers() {
+		if h.Path() == lookup {
+			return h
+		}
+	}
+
+	require.Fail(t, "unable to find handler")
+
+	return nil
+}
+
+func sendRequestToHandler(t *testing.T, handler operation.Handler, requestBody io.Reader,
+	path string) (*bytes.Buffer, int) {
+	req, err := http.NewRequest(handler.Method(), path, requestBody)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr.Body, rr.Code
+}
+
+func verifyRESTError(t *testing.T, code resterrors.Code, data []byte) {
+	type restError struct {
+		Code    resterrors.Code `json:"code"`
+		Message string          `json:"message"`
+	}
+
+	errResponse := &restError{}
+	require.NoError(t, json.Unmarshal(data, errResponse))
+	require.Equal(t, code, errResponse.Code)
+	require.NotEmpty(t, errResponse.Message)
+}
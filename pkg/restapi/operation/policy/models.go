@@ -0,0 +1,43 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
+)
+
+// GetPolicyResponse model
+//
+// This is used for returning the auto-accept policy
+//
+// swagger:response getPolicyResponse
+type GetPolicyResponse struct {
+
+	// in: body
+	Result *policy.Policy `json:"result,omitempty"`
+}
+
+// UpdatePolicyRequest model
+//
+// This is used for replacing the auto-accept policy
+//
+// swagger:parameters updatePolicy
+type UpdatePolicyRequest struct {
+	// Default decision and ordered rules of the policy
+	//
+	// in: body
+	// required: true
+	Params *policy.Policy `json:""`
+}
+
+// UpdatePolicyResponse model
+//
+// response of update policy action
+//
+// swagger:response updatePolicyResponse
+type UpdatePolicyResponse struct {
+}
@@ -0,0 +1,143 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/common/support"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+var logger = log.New("aries-framework/controller/policy")
+
+const (
+	policyPath = "/policy"
+)
+
+const (
+	// InvalidRequestErrorCode is typically a code for validation errors
+	// for invalid policy controller requests
+	InvalidRequestErrorCode = resterrors.Code(iota + resterrors.Policy)
+)
+
+// provider contains dependencies for the policy controller and is typically created by using aries.Context()
+type provider interface {
+	Service(id string) (interface{}, error)
+}
+
+// Operation is controller REST service controller for the auto-accept policy. The action events of the
+// DID Exchange protocol are continued or stopped according to the policy, the action events requiring
+// the manual decision are left to the DID Exchange accept endpoints.
+type Operation struct {
+	engine   *policy.Engine
+	actionCh chan service.DIDCommAction
+	manualCh chan service.DIDCommAction
+	handlers []operation.Handler
+}
+
+// New returns new auto-accept policy rest client instance
+func New(ctx provider, engine *policy.Engine) (*Operation, error) {
+	svc, err := ctx.Service(didexchange.DIDExchange)
+	if err != nil {
+		return nil, err
+	}
+
+	event, ok := svc.(service.Event)
+	if !ok {
+		return nil, fmt.Errorf("cast service to service event failed")
+	}
+
+	o := &Operation{
+		engine:   engine,
+		actionCh: make(chan service.DIDCommAction),
+		manualCh: make(chan service.DIDCommAction),
+	}
+
+	if err := event.RegisterActionEvent(o.actionCh); err != nil {
+		return nil, fmt.Errorf("didexchange action event registration failed: %w", err)
+	}
+
+	go engine.Handle(o.actionCh, o.manualCh) //nolint:errcheck
+	go o.leaveManual()
+
+	o.registerHandler()
+
+	return o, nil
+}
+
+// leaveManual leaves the action events requiring the manual decision to the DID Exchange accept endpoints,
+// the endpoints resume the thread and the pending action event is discarded.
+func (o *Operation) leaveManual() {
+	for action := range o.manualCh {
+		logger.Debugf("%s action event is left to the accept endpoints", action.ProtocolName)
+	}
+}
+
+// GetPolicy swagger:route GET /policy policy getPolicy
+//
+// Fetch the auto-accept policy.
+//
+// Responses:
+//    default: genericError
+//        200: getPolicyResponse
+func (o *Operation) GetPolicy(rw http.ResponseWriter, req *http.Request) {
+	o.writeResponse(rw, GetPolicyResponse{Result: o.engine.Policy()})
+}
+
+// UpdatePolicy swagger:route PUT /policy policy updatePolicy
+//
+// Replace the auto-accept policy.
+//
+// Responses:
+//    default: genericError
+//        200: updatePolicyResponse
+func (o *Operation) UpdatePolicy(rw http.ResponseWriter, req *http.Request) {
+	p := &policy.Policy{}
+
+	if err := json.NewDecoder(req.Body).Decode(p); err != nil {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, err)
+		return
+	}
+
+	if err := o.engine.Update(p); err != nil {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, UpdatePolicyResponse{})
+}
+
+// writeResponse writes interface value to response
+func (o *Operation) writeResponse(rw io.Writer, v interface{}) {
+	err := json.NewEncoder(rw).Encode(v)
+	// as of now, just log errors for writing response
+	if err != nil {
+		logger.Errorf("Unable to send error response, %s", err)
+	}
+}
+
+// GetRESTHandlers get all controller API handler available for this service
+func (o *Operation) GetRESTHandlers() []operation.Handler {
+	return o.handlers
+}
+
+// registerHandler register handlers to be exposed from this service as REST API endpoints
+func (o *Operation) registerHandler() {
+	o.handlers = []operation.Handler{
+		support.NewHTTPHandler(policyPath, http.MethodGet, o.GetPolicy),
+		support.NewHTTPHandler(policyPath, http.MethodPut, o.UpdatePolicy),
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/client/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/common/service"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/decorator"
+	didexsvc "github.com/hyperledger/aries-framework-go/pkg/didcomm/protocol/didexchange"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/mock/didcomm/protocol"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/internal/mock/kms"
+	mockprovider "github.com/hyperledger/aries-framework-go/pkg/internal/mock/provider"
+	mockstore "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	mockvdri "github.com/hyperledger/aries-framework-go/pkg/internal/mock/vdri"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+func newEngine(t *testing.T, p *policy.Policy) *policy.Engine {
+	engine, err := policy.NewEngine(p)
+	require.NoError(t, err)
+
+	return engine
+}
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		op, err := New(&mockprovider.Provider{ServiceValue: &protocol.MockDIDExchangeSvc{}},
+			newEngine(t, &policy.Policy{}))
+		require.NoError(t, err)
+		require.Len(t, op.GetRESTHandlers(), 2)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		_, err := New(&mockprovider.Provider{ServiceErr: errors.New("service error")}, newEngine(t, &policy.Policy{}))
+		require.EqualError(t, err, "service error")
+	})
+
+	t.Run("invalid service", func(t *testing.T) {
+		_, err := New(&mockprovider.Provider{ServiceValue: struct{}{}}, newEngine(t, &policy.Policy{}))
+		require.EqualError(t, err, "cast service to service event failed")
+	})
+
+	t.Run("action event registration error", func(t *testing.T) {
+		_, err := New(&mockprovider.Provider{ServiceValue: &protocol.MockDIDExchangeSvc{
+			RegisterActionEventErr: errors.New("register error"),
+		}}, newEngine(t, &policy.Policy{}))
+		require.EqualError(t, err, "didexchange action event registration failed: register error")
+	})
+}
+
+func TestOperation_Policy(t *testing.T) {
+	op, err := New(&mockprovider.Provider{ServiceValue: &protocol.MockDIDExchangeSvc{}},
+		newEngine(t, &policy.Policy{Default: policy.Reject}))
+	require.NoError(t, err)
+
+	t.Run("get policy", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, http.MethodGet), nil)
+		require.Equal(t, http.StatusOK, code)
+		require.JSONEq(t, `{"result": {"default": "reject"}}`, buf.String())
+	})
+
+	t.Run("update policy", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, http.MethodPut), bytes.NewBufferString(`{
+			"default": "manual",
+			"rules": [{"name": "partners", "action": "accept", "labels": ["acme-*"]}]
+		}`))
+		require.Equal(t, http.StatusOK, code, buf.String())
+
+		p := op.engine.Policy()
+		require.Equal(t, policy.Manual, p.Default)
+		require.Len(t, p.Rules, 1)
+		require.Equal(t, []string{"acme-*"}, p.Rules[0].Labels)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, http.MethodPut), bytes.NewBufferString(`{`))
+		require.Equal(t, http.StatusBadRequest, code)
+		verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		buf, code := sendRequestToHandler(t, handlerLookup(t, op, http.MethodPut),
+			bytes.NewBufferString(`{"rules": [{"action": "skip"}]}`))
+		require.Equal(t, http.StatusBadRequest, code)
+		verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
+		require.Equal(t, policy.Manual, op.engine.Policy().Default)
+	})
+}
+
+func TestOperation_AutoAccept(t *testing.T) {
+	store := mockstore.NewMockStoreProvider()
+	didExSvc, err := didexsvc.New(&protocol.MockProvider{StoreProvider: store})
+	require.NoError(t, err)
+
+	ctx := &mockprovider.Provider{
+		TransientStorageProviderValue: mockstore.NewMockStoreProvider(),
+		StorageProviderValue:          store,
+		ServiceValue:                  didExSvc,
+		KMSValue:                      &mockkms.CloseableKMS{CreateEncryptionKeyValue: "sample-key"},
+	}
+
+	_, err = New(ctx, newEngine(t, &policy.Policy{Rules: []policy.Rule{
+		{Name: "partners", Action: policy.Accept, Protocols: []string{didexsvc.DIDExchange}, Labels: []string{"acme-*"}},
+	}}))
+	require.NoError(t, err)
+
+	client, err := didexchange.New(ctx)
+	require.NoError(t, err)
+
+	msgCh := make(chan service.StateMsg, 10)
+	require.NoError(t, didExSvc.RegisterMsgEvent(msgCh))
+
+	invitation, err := client.CreateInvitation("alice")
+	require.NoError(t, err)
+
+	newDidDoc, err := (&mockvdri.MockVDRIRegistry{}).Create("peer")
+	require.NoError(t, err)
+
+	request, err := json.Marshal(&didexsvc.Request{
+		Type:       didexsvc.RequestMsgType,
+		ID:         "valid-thread-id",
+		Label:      "acme-agent",
+		Thread:     &decorator.Thread{PID: invitation.ID},
+		Connection: &didexsvc.Connection{DID: newDidDoc.ID, DIDDoc: newDidDoc},
+	})
+	require.NoError(t, err)
+
+	msg, err := service.NewDIDCommMsg(request)
+	require.NoError(t, err)
+
+	_, err = didExSvc.HandleInbound(msg)
+	require.NoError(t, err)
+
+	for {
+		select {
+		case e := <-msgCh:
+			if e.Type == service.PostState && e.StateID == "responded" {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the request was not accepted by the policy")
+			return
+		}
+	}
+}
+
+func handlerLookup(t *testing.T, op *Operation, method string) operation.Handler {
+	for _, h := range op.GetRESTHandlers() {
+		if h.Path() == policyPath && h.Method() == method {
+			return h
+		}
+	}
+
+	require.Fail(t, "unable to find handler")
+
+	return nil
+}
+
+func sendRequestToHandler(t *testing.T, handler operation.Handler, requestBody io.Reader) (*bytes.Buffer, int) {
+	req, err := http.NewRequest(handler.Method(), handler.Path(), requestBody)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr.Body, rr.Code
+}
+
+func verifyRESTError(t *testing.T, code resterrors.Code, data []byte) {
+	type restError struct {
+		Code    resterrors.Code `json:"code"`
+		Message string          `json:"message"`
+	}
+
+	errResponse := &restError{}
+	require.NoError(t, json.Unmarshal(data, errResponse))
+	require.Equal(t, code, errResponse.Code)
+	require.NotEmpty(t, errResponse.Message)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tenant
+
+// CreateTenantRequest model
+//
+// This is used for creating the tenant
+//
+// swagger:parameters createTenant
+type CreateTenantRequest struct {
+	// Params for creating the tenant
+	//
+	// in: body
+	// required: true
+	Params CreateTenantParams `json:""`
+}
+
+// CreateTenantParams model
+//
+// This is used for creating the tenant
+//
+type CreateTenantParams struct {
+	// The ID of the tenant, up to 64 lowercase letters, digits and hyphens
+	ID string `json:"id"`
+}
+
+// CreateTenantResponse model
+//
+// response of create tenant action
+//
+// swagger:response createTenantResponse
+type CreateTenantResponse struct {
+
+	// in: body
+	ID string `json:"id"`
+}
+
+// TenantsResponse model
+//
+// This is used for returning the IDs of the tenants
+//
+// swagger:response tenantsResponse
+type TenantsResponse struct {
+
+	// in: body
+	Results []string `json:"results"`
+}
+
+// TenantIDParams model
+//
+// This is used for the tenant operations
+//
+// swagger:parameters removeTenant restoreTenant
+type TenantIDParams struct {
+	// The ID of the tenant
+	//
+	// in: path
+	// required: true
+	ID string `json:"tenantID"`
+}
+
+// RemoveTenantResponse model
+//
+// response of remove tenant action
+//
+// swagger:response removeTenantResponse
+type RemoveTenantResponse struct {
+}
+
+// RestoreTenantResponse model
+//
+// response of restore tenant action
+//
+// swagger:response restoreTenantResponse
+type RestoreTenantResponse struct {
+}
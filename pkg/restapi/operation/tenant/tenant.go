@@ -0,0 +1,272 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/hyperledger/aries-framework-go/pkg/common/log"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/aries"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/common/support"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+var logger = log.New("aries-framework/controller/tenant")
+
+const (
+	operationID = "/tenants"
+	tenantIDVar = "tenantID"
+	tenantPath  = operationID + "/{" + tenantIDVar + "}"
+	restorePath = tenantPath + "/restore"
+)
+
+const (
+	// InvalidRequestErrorCode is typically a code for validation errors
+	// for invalid tenant controller requests
+	InvalidRequestErrorCode = resterrors.Code(iota + resterrors.Tenant)
+
+	// CreateTenantErrorCode is for failures in create tenant endpoint
+	CreateTenantErrorCode
+
+	// RemoveTenantErrorCode is for failures in remove tenant endpoint
+	RemoveTenantErrorCode
+
+	// ScopeErrorCode is for failures in preparing the endpoints scoped by the tenant
+	ScopeErrorCode
+
+	// RestoreTenantErrorCode is for failures in restore tenant endpoint
+	RestoreTenantErrorCode
+)
+
+// provider contains the tenant management of the framework and is typically aries.Aries
+// created with aries.WithMultiTenancy()
+type provider interface {
+	CreateTenant(id string) error
+	RemoveTenant(id string) error
+	RestoreTenant(id string) error
+	Tenants() []string
+	TenantContext(id string) (*context.Provider, error)
+}
+
+// HandlersFactory creates the REST handlers acting on behalf of the tenant with the given ID from the tenant context.
+type HandlersFactory func(id string, ctx *context.Provider) ([]operation.Handler, error)
+
+// Operation is controller REST service controller for the tenants. Besides the tenant management endpoints
+// it exposes the scoped handlers under /tenants/{tenantID}, the requests are handled by the handlers created
+// by the factory from the context of the tenant. The handlers are created when the tenant is created or restored,
+// the handlers subscribing to the events of the tenant receive them before the first request of the tenant.
+type Operation struct {
+	tenants  provider
+	factory  HandlersFactory
+	handlers []operation.Handler
+
+	mu     sync.Mutex
+	scopes map[string]*scope
+}
+
+// scope holds the handlers of the tenant created from its context.
+type scope struct {
+	ctx      *context.Provider
+	handlers []operation.Handler
+}
+
+// New returns new tenant rest client instance. The scoped handlers are exposed under /tenants/{tenantID}
+// with the same paths and methods, they are handled by the handlers created by the factory. The handlers
+// of the existing tenants are created by New.
+func New(tenants provider, factory HandlersFactory, scoped []operation.Handler) (*Operation, error) {
+	o := &Operation{tenants: tenants, factory: factory, scopes: make(map[string]*scope)}
+	o.registerHandler(scoped)
+
+	for _, id := range tenants.Tenants() {
+		if _, err := o.tenantHandlers(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// CreateTenant swagger:route POST /tenants tenant createTenant
+//
+// Creates the tenant sharing the transports of the agent.
+//
+// Responses:
+//    default: genericError
+//        200: createTenantResponse
+func (o *Operation) CreateTenant(rw http.ResponseWriter, req *http.Request) {
+	var request CreateTenantRequest
+
+	if err := json.NewDecoder(req.Body).Decode(&request.Params); err != nil {
+		resterrors.SendHTTPBadRequest(rw, InvalidRequestErrorCode, err)
+		return
+	}
+
+	if err := o.tenants.CreateTenant(request.Params.ID); err != nil {
+		sendError(rw, CreateTenantErrorCode, err)
+		return
+	}
+
+	// the handlers not created now are created by the first request of the tenant
+	if _, err := o.tenantHandlers(request.Params.ID); err != nil {
+		sendError(rw, ScopeErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, CreateTenantResponse{ID: request.Params.ID})
+}
+
+// RestoreTenant swagger:route POST /tenants/{tenantID}/restore tenant restoreTenant
+//
+// Restores the removed tenant with its keys and connections.
+//
+// Responses:
+//    default: genericError
+//        200: restoreTenantResponse
+func (o *Operation) RestoreTenant(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[tenantIDVar]
+
+	if err := o.tenants.RestoreTenant(id); err != nil {
+		sendError(rw, RestoreTenantErrorCode, err)
+		return
+	}
+
+	// the handlers not created now are created by the first request of the tenant
+	if _, err := o.tenantHandlers(id); err != nil {
+		sendError(rw, ScopeErrorCode, err)
+		return
+	}
+
+	o.writeResponse(rw, RestoreTenantResponse{})
+}
+
+// Tenants swagger:route GET /tenants tenant tenants
+//
+// Fetch the IDs of the tenants.
+//
+// Responses:
+//    default: genericError
+//        200: tenantsResponse
+func (o *Operation) Tenants(rw http.ResponseWriter, req *http.Request) {
+	o.writeResponse(rw, TenantsResponse{Results: o.tenants.Tenants()})
+}
+
+// RemoveTenant swagger:route DELETE /tenants/{tenantID} tenant removeTenant
+//
+// Removes the tenant, the messages addressed to the tenant are not handled anymore.
+//
+// Responses:
+//    default: genericError
+//        200: removeTenantResponse
+func (o *Operation) RemoveTenant(rw http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[tenantIDVar]
+
+	if err := o.tenants.RemoveTenant(id); err != nil {
+		sendError(rw, RemoveTenantErrorCode, err)
+		return
+	}
+
+	o.mu.Lock()
+	delete(o.scopes, id)
+	o.mu.Unlock()
+
+	o.writeResponse(rw, RemoveTenantResponse{})
+}
+
+// scopedHandler returns the handler passing the request to the handler of the tenant with the same path and method.
+func (o *Operation) scopedHandler(h operation.Handler) operation.Handler {
+	return support.NewHTTPHandler(tenantPath+h.Path(), h.Method(), func(rw http.ResponseWriter, req *http.Request) {
+		handlers, err := o.tenantHandlers(mux.Vars(req)[tenantIDVar])
+		if err != nil {
+			sendError(rw, ScopeErrorCode, err)
+			return
+		}
+
+		for _, th := range handlers {
+			if th.Path() == h.Path() && th.Method() == h.Method() {
+				th.Handle()(rw, req)
+				return
+			}
+		}
+
+		resterrors.SendHTTPStatusError(rw, ScopeErrorCode,
+			fmt.Errorf("%s %s is not available to the tenant", h.Method(), h.Path()), http.StatusNotFound)
+	})
+}
+
+// tenantHandlers returns the handlers of the tenant, they are created again if the tenant was restored.
+func (o *Operation) tenantHandlers(id string) ([]operation.Handler, error) {
+	ctx, err := o.tenants.TenantContext(id)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if s, ok := o.scopes[id]; ok && s.ctx == ctx {
+		return s.handlers, nil
+	}
+
+	handlers, err := o.factory(id, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create handlers of tenant %s: %w", id, err)
+	}
+
+	o.scopes[id] = &scope{ctx: ctx, handlers: handlers}
+
+	return handlers, nil
+}
+
+func sendError(rw http.ResponseWriter, code resterrors.Code, err error) {
+	switch {
+	case errors.Is(err, aries.ErrInvalidTenantID):
+		resterrors.SendHTTPBadRequest(rw, code, err)
+	case errors.Is(err, aries.ErrTenantNotFound):
+		resterrors.SendHTTPStatusError(rw, code, err, http.StatusNotFound)
+	case errors.Is(err, aries.ErrTenantExists), errors.Is(err, aries.ErrTenantRemoved):
+		resterrors.SendHTTPStatusError(rw, code, err, http.StatusConflict)
+	default:
+		resterrors.SendHTTPInternalServerError(rw, code, err)
+	}
+}
+
+// writeResponse writes interface value to response
+func (o *Operation) writeResponse(rw io.Writer, v interface{}) {
+	err := json.NewEncoder(rw).Encode(v)
+	// as of now, just log errors for writing response
+	if err != nil {
+		logger.Errorf("Unable to send error response, %s", err)
+	}
+}
+
+// GetRESTHandlers get all controller API handler available for this service
+func (o *Operation) GetRESTHandlers() []operation.Handler {
+	return o.handlers
+}
+
+// registerHandler register handlers to be exposed from this service as REST API endpoints
+func (o *Operation) registerHandler(scoped []operation.Handler) {
+	o.handlers = []operation.Handler{
+		support.NewHTTPHandler(operationID, http.MethodPost, o.CreateTenant),
+		support.NewHTTPHandler(operationID, http.MethodGet, o.Tenants),
+		support.NewHTTPHandler(tenantPath, http.MethodDelete, o.RemoveTenant),
+		support.NewHTTPHandler(restorePath, http.MethodPost, o.RestoreTenant),
+	}
+
+	for _, h := range scoped {
+		o.handlers = append(o.handlers, o.scopedHandler(h))
+	}
+}
@@ -0,0 +1,347 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tenant
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hyperledger/aries-framework-go/pkg/framework/aries"
+	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
+	"github.com/hyperledger/aries-framework-go/pkg/internal/common/support"
+	resterrors "github.com/hyperledger/aries-framework-go/pkg/restapi/errors"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
+)
+
+const connectionsPath = "/connections/{id}"
+
+func TestNew(t *testing.T) {
+	op, err := New(newMockProvider(), nil, []operation.Handler{
+		support.NewHTTPHandler(connectionsPath, http.MethodGet, nil),
+	})
+	require.NoError(t, err)
+	require.Len(t, op.GetRESTHandlers(), 5)
+	require.Equal(t, "/tenants/{tenantID}/connections/{id}", op.GetRESTHandlers()[4].Path())
+	require.Equal(t, http.MethodGet, op.GetRESTHandlers()[4].Method())
+
+	t.Run("test the handlers of the existing tenants are created", func(t *testing.T) {
+		tenants := newMockProvider()
+		require.NoError(t, tenants.CreateTenant("acme"))
+
+		var created []string
+
+		_, err := New(tenants, func(id string, ctx *context.Provider) ([]operation.Handler, error) {
+			created = append(created, id)
+			return nil, nil
+		}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"acme"}, created)
+	})
+
+	t.Run("test error from factory", func(t *testing.T) {
+		tenants := newMockProvider()
+		require.NoError(t, tenants.CreateTenant("acme"))
+
+		_, err := New(tenants, func(string, *context.Provider) ([]operation.Handler, error) {
+			return nil, errors.New("factory error")
+		}, nil)
+		require.EqualError(t, err, "create handlers of tenant acme: factory error")
+	})
+}
+
+func TestOperation_Tenants(t *testing.T) {
+	tenants := newMockProvider()
+	op, err := New(tenants, func(string, *context.Provider) ([]operation.Handler, error) {
+		return nil, nil
+	}, nil)
+	require.NoError(t, err)
+
+	t.Run("create tenant", func(t *testing.T) {
+		buf, code := sendRequest(t, op, http.MethodPost, operationID, strings.NewReader(`{"id":"acme"}`))
+		require.Equal(t, http.StatusOK, code)
+
+		response := &CreateTenantResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), response))
+		require.Equal(t, "acme", response.ID)
+	})
+
+	t.Run("list tenants", func(t *testing.T) {
+		buf, code := sendRequest(t, op, http.MethodGet, operationID, nil)
+		require.Equal(t, http.StatusOK, code)
+
+		response := &TenantsResponse{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), response))
+		require.Equal(t, []string{"acme"}, response.Results)
+	})
+
+	t.Run("create tenant errors", func(t *testing.T) {
+		for body, status := range map[string]int{
+			`invalid`:          http.StatusBadRequest,
+			`{"id":"Acme"}`:    http.StatusBadRequest,
+			`{"id":"acme"}`:    http.StatusConflict,
+			`{"id":"failing"}`: http.StatusInternalServerError,
+		} {
+			buf, code := sendRequest(t, op, http.MethodPost, operationID, strings.NewReader(body))
+			require.Equal(t, status, code, body)
+
+			if body == `invalid` {
+				verifyRESTError(t, InvalidRequestErrorCode, buf.Bytes())
+			} else {
+				verifyRESTError(t, CreateTenantErrorCode, buf.Bytes())
+			}
+		}
+	})
+
+	t.Run("remove tenant", func(t *testing.T) {
+		_, code := sendRequest(t, op, http.MethodDelete, operationID+"/acme", nil)
+		require.Equal(t, http.StatusOK, code)
+
+		buf, code := sendRequest(t, op, http.MethodDelete, operationID+"/acme", nil)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, RemoveTenantErrorCode, buf.Bytes())
+
+		require.Empty(t, tenants.Tenants())
+	})
+
+	t.Run("restore tenant", func(t *testing.T) {
+		_, code := sendRequest(t, op, http.MethodPost, operationID+"/acme/restore", nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, []string{"acme"}, tenants.Tenants())
+
+		buf, code := sendRequest(t, op, http.MethodPost, operationID+"/acme/restore", nil)
+		require.Equal(t, http.StatusConflict, code)
+		verifyRESTError(t, RestoreTenantErrorCode, buf.Bytes())
+
+		buf, code = sendRequest(t, op, http.MethodPost, operationID+"/other/restore", nil)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, RestoreTenantErrorCode, buf.Bytes())
+	})
+
+	t.Run("removed tenant is not created again", func(t *testing.T) {
+		_, code := sendRequest(t, op, http.MethodDelete, operationID+"/acme", nil)
+		require.Equal(t, http.StatusOK, code)
+
+		buf, code := sendRequest(t, op, http.MethodPost, operationID, strings.NewReader(`{"id":"acme"}`))
+		require.Equal(t, http.StatusConflict, code)
+		verifyRESTError(t, CreateTenantErrorCode, buf.Bytes())
+	})
+}
+
+func TestOperation_Scoped(t *testing.T) {
+	tenants := newMockProvider()
+	require.NoError(t, tenants.CreateTenant("acme"))
+
+	created := 0
+	factory := func(_ string, ctx *context.Provider) ([]operation.Handler, error) {
+		created++
+
+		if ctx == tenants.failing {
+			return nil, errors.New("factory error")
+		}
+
+		return []operation.Handler{
+			support.NewHTTPHandler(connectionsPath, http.MethodGet, func(rw http.ResponseWriter, req *http.Request) {
+				// the handler of the tenant sees the path variables of the scoped path
+				_, err := fmt.Fprintf(rw, "%s/%s", mux.Vars(req)[tenantIDVar], mux.Vars(req)["id"])
+				require.NoError(t, err)
+			}),
+		}, nil
+	}
+
+	op, err := New(tenants, factory, []operation.Handler{
+		support.NewHTTPHandler(connectionsPath, http.MethodGet, nil),
+		support.NewHTTPHandler(connectionsPath, http.MethodPost, nil),
+	})
+	require.NoError(t, err)
+
+	t.Run("request is handled by the handler of the tenant", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			buf, code := sendRequest(t, op, http.MethodGet, "/tenants/acme/connections/1", nil)
+			require.Equal(t, http.StatusOK, code)
+			require.Equal(t, "acme/1", buf.String())
+		}
+
+		// the handlers are created once per tenant
+		require.Equal(t, 1, created)
+	})
+
+	t.Run("handlers are created again for the restored tenant", func(t *testing.T) {
+		_, code := sendRequest(t, op, http.MethodDelete, "/tenants/acme", nil)
+		require.Equal(t, http.StatusOK, code)
+
+		_, code = sendRequest(t, op, http.MethodPost, "/tenants/acme/restore", nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, 2, created)
+
+		_, code = sendRequest(t, op, http.MethodGet, "/tenants/acme/connections/1", nil)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, 2, created)
+	})
+
+	t.Run("handlers are created with the tenant", func(t *testing.T) {
+		_, code := sendRequest(t, op, http.MethodPost, operationID, strings.NewReader(`{"id":"other"}`))
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, 3, created)
+
+		_, code = sendRequest(t, op, http.MethodDelete, "/tenants/other", nil)
+		require.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("tenant not found", func(t *testing.T) {
+		buf, code := sendRequest(t, op, http.MethodGet, "/tenants/other/connections/1", nil)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, ScopeErrorCode, buf.Bytes())
+	})
+
+	t.Run("handler not available to the tenant", func(t *testing.T) {
+		buf, code := sendRequest(t, op, http.MethodPost, "/tenants/acme/connections/1", nil)
+		require.Equal(t, http.StatusNotFound, code)
+		verifyRESTError(t, ScopeErrorCode, buf.Bytes())
+	})
+
+	t.Run("error from factory", func(t *testing.T) {
+		tenants.failNext = true
+
+		buf, code := sendRequest(t, op, http.MethodPost, operationID, strings.NewReader(`{"id":"broken"}`))
+		require.Equal(t, http.StatusInternalServerError, code)
+		verifyRESTError(t, ScopeErrorCode, buf.Bytes())
+
+		// the handlers are created by the request of the tenant
+		buf, code = sendRequest(t, op, http.MethodGet, "/tenants/broken/connections/1", nil)
+		require.Equal(t, http.StatusInternalServerError, code)
+		verifyRESTError(t, ScopeErrorCode, buf.Bytes())
+
+		_, code = sendRequest(t, op, http.MethodDelete, "/tenants/broken", nil)
+		require.Equal(t, http.StatusOK, code)
+
+		tenants.failNext = true
+
+		buf, code = sendRequest(t, op, http.MethodPost, "/tenants/broken/restore", nil)
+		require.Equal(t, http.StatusInternalServerError, code)
+		verifyRESTError(t, ScopeErrorCode, buf.Bytes())
+	})
+}
+
+type mockProvider struct {
+	tenants map[string]*context.Provider
+	removed map[string]bool
+	failing *context.Provider
+	// failNext makes the context of the next created or restored tenant the failing one
+	failNext bool
+}
+
+func newMockProvider() *mockProvider {
+	return &mockProvider{tenants: make(map[string]*context.Provider), removed: make(map[string]bool)}
+}
+
+func (p *mockProvider) add(id string) {
+	p.tenants[id] = &context.Provider{}
+
+	if p.failNext {
+		p.failing = p.tenants[id]
+		p.failNext = false
+	}
+}
+
+func (p *mockProvider) CreateTenant(id string) error {
+	switch {
+	case id == "failing":
+		return errors.New("create error")
+	case strings.ToLower(id) != id:
+		return fmt.Errorf("%w: %q", aries.ErrInvalidTenantID, id)
+	case p.tenants[id] != nil:
+		return aries.ErrTenantExists
+	case p.removed[id]:
+		return aries.ErrTenantRemoved
+	}
+
+	p.add(id)
+
+	return nil
+}
+
+func (p *mockProvider) RestoreTenant(id string) error {
+	switch {
+	case p.tenants[id] != nil:
+		return aries.ErrTenantExists
+	case !p.removed[id]:
+		return aries.ErrTenantNotFound
+	}
+
+	delete(p.removed, id)
+	p.add(id)
+
+	return nil
+}
+
+func (p *mockProvider) RemoveTenant(id string) error {
+	if p.tenants[id] == nil {
+		return aries.ErrTenantNotFound
+	}
+
+	delete(p.tenants, id)
+	p.removed[id] = true
+
+	return nil
+}
+
+func (p *mockProvider) Tenants() []string {
+	ids := []string{}
+	for id := range p.tenants {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (p *mockProvider) TenantContext(id string) (*context.Provider, error) {
+	if p.tenants[id] == nil {
+		return nil, aries.ErrTenantNotFound
+	}
+
+	return p.tenants[id], nil
+}
+
+func sendRequest(t *testing.T, op *Operation, method, path string, requestBody io.Reader) (*bytes.Buffer, int) {
+	req, err := http.NewRequest(method, path, requestBody)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	for _, handler := range op.GetRESTHandlers() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr.Body, rr.Code
+}
+
+func verifyRESTError(t *testing.T, code resterrors.Code, data []byte) {
+	type restError struct {
+		Code    resterrors.Code `json:"code"`
+		Message string          `json:"message"`
+	}
+
+	errResponse := &restError{}
+	require.NoError(t, json.Unmarshal(data, errResponse))
+	require.Equal(t, code, errResponse.Code)
+	require.NotEmpty(t, errResponse.Message)
+}
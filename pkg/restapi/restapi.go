@@ -7,16 +7,34 @@ SPDX-License-Identifier: Apache-2.0
 package restapi
 
 import (
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
 	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation"
 	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation/common"
 	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation/didexchange"
+	metricsop "github.com/hyperledger/aries-framework-go/pkg/restapi/operation/metrics"
+	outboxop "github.com/hyperledger/aries-framework-go/pkg/restapi/operation/outbox"
+	policyop "github.com/hyperledger/aries-framework-go/pkg/restapi/operation/policy"
+	tenantop "github.com/hyperledger/aries-framework-go/pkg/restapi/operation/tenant"
 	"github.com/hyperledger/aries-framework-go/pkg/restapi/webhook"
 )
 
 type allOpts struct {
 	webhookURLs  []string
 	defaultLabel string
+	autoAccept   *policy.Policy
+	tenants      TenantProvider
+}
+
+// TenantProvider manages the tenants sharing the agent, it is typically aries.Aries created
+// with aries.WithMultiTenancy().
+type TenantProvider interface {
+	CreateTenant(id string) error
+	RemoveTenant(id string) error
+	RestoreTenant(id string) error
+	Tenants() []string
+	TenantContext(id string) (*context.Provider, error)
 }
 
 // Opt represents a REST Api option.
@@ -36,6 +54,25 @@ func WithDefaultLabel(defaultLabel string) Opt {
 	}
 }
 
+// WithAutoAcceptPolicy is an option for continuing or stopping the DID Exchange action events automatically
+// according to the given policy. The policy can be fetched and replaced through the /policy endpoints.
+func WithAutoAcceptPolicy(p *policy.Policy) Opt {
+	return func(opts *allOpts) {
+		opts.autoAccept = p
+	}
+}
+
+// WithTenants is an option for managing the tenants through the /tenants endpoints. The DID Exchange, VDRI
+// and auto-accept policy endpoints are scoped by the tenant under /tenants/{tenantID}, e.g.
+// /tenants/{tenantID}/connections acts on the connections of the tenant. The tenants start with the same
+// auto-accept policy and notify the same webhooks as the agent, the topics of the tenant are scoped by the tenant
+// like its endpoints, e.g. /tenants/{tenantID}/connections.
+func WithTenants(tenants TenantProvider) Opt {
+	return func(opts *allOpts) {
+		opts.tenants = tenants
+	}
+}
+
 // New returns new controller REST API instance.
 func New(ctx *context.Provider, opts ...Opt) (*Controller, error) {
 	restAPIOpts := &allOpts{}
@@ -44,10 +81,57 @@ func New(ctx *context.Provider, opts ...Opt) (*Controller, error) {
 		opt(restAPIOpts)
 	}
 
+	notifier := webhook.NewHTTPNotifier(restAPIOpts.webhookURLs)
+
+	allHandlers, err := protocolHandlers(ctx, notifier, restAPIOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add tenant Rest Handlers
+	if restAPIOpts.tenants != nil {
+		tenants, err := tenantop.New(restAPIOpts.tenants,
+			func(id string, tenantCtx *context.Provider) ([]operation.Handler, error) {
+				return protocolHandlers(tenantCtx, webhook.NewTenantNotifier(notifier, id), restAPIOpts)
+			}, allHandlers)
+		if err != nil {
+			return nil, err
+		}
+
+		allHandlers = append(allHandlers, tenants.GetRESTHandlers()...)
+	}
+
+	// Add outbox Rest Handlers
+	if ctx.Outbox() != nil {
+		outbox, err := outboxop.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		allHandlers = append(allHandlers, outbox.GetRESTHandlers()...)
+	}
+
+	// Add metrics Rest Handlers
+	if _, ok := ctx.Metrics().(metrics.Exporter); ok {
+		metricsOp, err := metricsop.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		allHandlers = append(allHandlers, metricsOp.GetRESTHandlers()...)
+	}
+
+	return &Controller{handlers: allHandlers}, nil
+}
+
+// protocolHandlers returns the handlers acting on behalf of the agent of the context, the agent
+// is either the framework itself or its tenant. The events of the agent are notified by the notifier.
+func protocolHandlers(ctx *context.Provider, notifier webhook.Notifier,
+	restAPIOpts *allOpts) ([]operation.Handler, error) {
 	var allHandlers []operation.Handler
 
 	// Add DID Exchange Rest Handlers
-	exchange, err := didexchange.New(ctx, webhook.NewHTTPNotifier(restAPIOpts.webhookURLs), restAPIOpts.defaultLabel)
+	exchange, err := didexchange.New(ctx, notifier, restAPIOpts.defaultLabel)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +142,22 @@ func New(ctx *context.Provider, opts ...Opt) (*Controller, error) {
 	allHandlers = append(allHandlers, exchange.GetRESTHandlers()...)
 	allHandlers = append(allHandlers, general.GetRESTHandlers()...)
 
-	return &Controller{handlers: allHandlers}, nil
+	// Add auto-accept policy Rest Handlers
+	if restAPIOpts.autoAccept != nil {
+		engine, err := policy.NewEngine(restAPIOpts.autoAccept)
+		if err != nil {
+			return nil, err
+		}
+
+		autoAccept, err := policyop.New(ctx, engine)
+		if err != nil {
+			return nil, err
+		}
+
+		allHandlers = append(allHandlers, autoAccept.GetRESTHandlers()...)
+	}
+
+	return allHandlers, nil
 }
 
 // Controller contains handlers for controller REST API
@@ -7,16 +7,25 @@ SPDX-License-Identifier: Apache-2.0
 package restapi
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/didcomm/policy"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/api"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/aries/defaults"
 	"github.com/hyperledger/aries-framework-go/pkg/framework/context"
+	"github.com/hyperledger/aries-framework-go/pkg/restapi/operation/didexchange/models"
 )
 
 func TestNew_Failure(t *testing.T) {
@@ -74,6 +83,183 @@ func TestWithDefaultLabelOption(t *testing.T) {
 	require.Equal(t, label, restAPIOpts.defaultLabel)
 }
 
+func TestWithAutoAcceptPolicyOption(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	framework, err := aries.New(defaults.WithStorePath(path), defaults.WithInboundHTTPAddr(":26509", ""))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, framework.Close())
+	}()
+
+	ctx, err := framework.Context()
+	require.NoError(t, err)
+
+	withoutPolicy, err := New(ctx)
+	require.NoError(t, err)
+
+	_, err = New(ctx, WithAutoAcceptPolicy(&policy.Policy{Default: "maybe"}))
+	require.EqualError(t, err, "update policy: invalid default decision: maybe")
+
+	controller, err := New(ctx, WithAutoAcceptPolicy(&policy.Policy{Default: policy.Accept}))
+	require.NoError(t, err)
+	require.Len(t, controller.GetOperations(), len(withoutPolicy.GetOperations())+2)
+}
+
+func TestNew_WithOutbox(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	framework, err := aries.New(defaults.WithStorePath(path), defaults.WithInboundHTTPAddr(":26510", ""),
+		aries.WithOutbox())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, framework.Close())
+	}()
+
+	ctx, err := framework.Context()
+	require.NoError(t, err)
+
+	controller, err := New(ctx)
+	require.NoError(t, err)
+
+	var outboxOps int
+
+	for _, op := range controller.GetOperations() {
+		if strings.HasPrefix(op.Path(), "/outbox") {
+			outboxOps++
+		}
+	}
+
+	require.Equal(t, 4, outboxOps)
+}
+
+func TestNew_WithMetrics(t *testing.T) {
+	hasMetricsOp := func(framework *aries.Aries) bool {
+		ctx, err := framework.Context()
+		require.NoError(t, err)
+
+		controller, err := New(ctx)
+		require.NoError(t, err)
+
+		for _, op := range controller.GetOperations() {
+			if op.Path() == "/metrics" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	framework, err := aries.New(defaults.WithStorePath(path), defaults.WithInboundHTTPAddr(":26511", ""))
+	require.NoError(t, err)
+	require.True(t, hasMetricsOp(framework))
+	require.NoError(t, framework.Close())
+
+	// the custom sink not exporting the metrics
+	framework, err = aries.New(defaults.WithStorePath(path), defaults.WithInboundHTTPAddr(":26511", ""),
+		aries.WithMetrics(metrics.Nop))
+	require.NoError(t, err)
+	require.False(t, hasMetricsOp(framework))
+	require.NoError(t, framework.Close())
+}
+
+func TestNew_WithTenants(t *testing.T) {
+	path, cleanup := generateTempDir(t)
+	defer cleanup()
+
+	framework, err := aries.New(defaults.WithStorePath(path), defaults.WithInboundHTTPAddr(":26512", ""),
+		aries.WithMultiTenancy())
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, framework.Close())
+	}()
+
+	ctx, err := framework.Context()
+	require.NoError(t, err)
+
+	withoutTenants, err := New(ctx)
+	require.NoError(t, err)
+
+	// the webhook receives the notifications of the tenant on the topics scoped by the tenant
+	notified := make(chan string, 10)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		notified <- req.URL.Path
+	}))
+	defer webhookServer.Close()
+
+	controller, err := New(ctx, WithTenants(framework), WithWebhookURLs(webhookServer.URL))
+	require.NoError(t, err)
+
+	var scoped int
+
+	for _, op := range controller.GetOperations() {
+		if strings.HasPrefix(op.Path(), "/tenants/{tenantID}/") && op.Path() != "/tenants/{tenantID}/restore" {
+			scoped++
+		}
+	}
+
+	// all endpoints but the metrics one are scoped, the tenant management endpoints are added
+	require.Equal(t, len(withoutTenants.GetOperations())-1, scoped)
+	require.Len(t, controller.GetOperations(), len(withoutTenants.GetOperations())+scoped+4)
+
+	router := mux.NewRouter()
+	for _, handler := range controller.GetOperations() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, e := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, e)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/tenants", `{"id":"acme"}`).Code)
+
+	// the invitation of the tenant is created with the key of the tenant
+	rr := send(http.MethodPost, "/tenants/acme/connections/create-invitation", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	response := &models.CreateInvitationResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), response))
+	require.Len(t, response.Invitation.RecipientKeys, 1)
+
+	tenantCtx, err := framework.TenantContext("acme")
+	require.NoError(t, err)
+
+	_, err = tenantCtx.KMS().FindVerKey(response.Invitation.RecipientKeys)
+	require.NoError(t, err)
+
+	_, err = ctx.KMS().FindVerKey(response.Invitation.RecipientKeys)
+	require.Error(t, err)
+
+	invitation, err := json.Marshal(response.Invitation)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK,
+		send(http.MethodPost, "/tenants/acme/connections/receive-invitation", string(invitation)).Code)
+
+	select {
+	case path := <-notified:
+		require.Equal(t, "/tenants/acme/connections", path)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the webhook was not notified")
+	}
+
+	require.Equal(t, http.StatusOK, send(http.MethodDelete, "/tenants/acme", "").Code)
+	require.Equal(t, http.StatusNotFound, send(http.MethodPost, "/tenants/acme/connections/create-invitation", "").Code)
+}
+
 func generateTempDir(t testing.TB) (string, func()) {
 	path, err := ioutil.TempDir("", "db")
 	if err != nil {
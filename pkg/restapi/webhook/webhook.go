@@ -61,6 +61,27 @@ func (n HTTPNotifier) Notify(topic string, message []byte) error {
 	return allErrs
 }
 
+// TenantNotifier is a webhook dispatcher notifying the topics of the tenant. The topic is scoped by the tenant
+// like the REST endpoints of the tenant: tenants/{tenantID}/topic, e.g. localhost:8080/tenants/acme/topic.
+type TenantNotifier struct {
+	Notifier Notifier
+	TenantID string
+}
+
+// NewTenantNotifier returns a new instance of a TenantNotifier.
+func NewTenantNotifier(notifier Notifier, tenantID string) TenantNotifier {
+	return TenantNotifier{Notifier: notifier, TenantID: tenantID}
+}
+
+// Notify sends the given message to the topic scoped by the tenant.
+func (n TenantNotifier) Notify(topic string, message []byte) error {
+	if topic == "" {
+		return fmt.Errorf(emptyTopicErrMsg)
+	}
+
+	return n.Notifier.Notify(fmt.Sprintf("tenants/%s/%s", n.TenantID, topic), message)
+}
+
 func notify(destination string, message []byte) error {
 	ctx, cancel := context.WithTimeout(context.Background(), notificationSendTimeout)
 	defer cancel()
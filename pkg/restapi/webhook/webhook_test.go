@@ -187,6 +187,16 @@ func TestNotifyEmptyMessage(t *testing.T) {
 	require.Equal(t, emptyMessageErrMsg, err.Error())
 }
 
+func TestTenantNotifier(t *testing.T) {
+	testNotifier := NewTenantNotifier(NewHTTPNotifier([]string{"badURL"}), "acme")
+
+	err := testNotifier.Notify("someTopic", []byte(`someMessage`))
+	require.Contains(t, err.Error(), `failed to post notification to badURL/tenants/acme/someTopic`)
+
+	err = testNotifier.Notify("", []byte(`someMessage`))
+	require.Equal(t, emptyTopicErrMsg, err.Error())
+}
+
 func TestNotifyMultipleErrors(t *testing.T) {
 	testNotifier := NewHTTPNotifier([]string{"badURL1", "badURL2"})
 
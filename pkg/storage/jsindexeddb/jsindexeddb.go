@@ -113,6 +113,22 @@ func (s *store) Get(k string) ([]byte, error) {
 	return []byte(data.Get("value").String()), nil
 }
 
+// Delete deletes the record based on key
+func (s *store) Delete(k string) error {
+	if k == "" {
+		return errors.New("key is mandatory")
+	}
+
+	req := s.db.Call("transaction", s.name, "readwrite").Call("objectStore", s.name).Call("delete", k)
+
+	_, err := getResult(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete data: %w", err)
+	}
+
+	return nil
+}
+
 // Iterator returns iterator for the latest snapshot of the underlying db.
 func (s *store) Iterator(start, limit string) storage.StoreIterator {
 	// TODO Change Store Iterator https://github.com/hyperledger/aries-framework-go/issues/852
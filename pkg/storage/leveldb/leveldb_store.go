@@ -141,6 +141,15 @@ func (s *leveldbStore) Get(k string) ([]byte, error) {
 	return data, nil
 }
 
+// Delete deletes the record based on key
+func (s *leveldbStore) Delete(k string) error {
+	if k == "" {
+		return errors.New("key is mandatory")
+	}
+
+	return s.db.Delete([]byte(k), nil)
+}
+
 // Iterator returns iterator for the latest snapshot of the underlying db.
 func (s *leveldbStore) Iterator(start, limit string) storage.StoreIterator {
 	if start == "" || limit == "" {
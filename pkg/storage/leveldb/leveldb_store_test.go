@@ -9,6 +9,7 @@ SPDX-License-Identifier: Apache-2.0
 package leveldb
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -78,6 +79,28 @@ func TestLevelDBStore(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("Test Leveldb store delete", func(t *testing.T) {
+		prov := NewProvider(path)
+		store, err := prov.OpenStore("test-delete")
+		require.NoError(t, err)
+
+		const key = "did:example:123"
+
+		require.NoError(t, store.Put(key, []byte("value")))
+		require.NoError(t, store.Delete(key))
+
+		_, err = store.Get(key)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		// the missing record
+		require.NoError(t, store.Delete(key))
+
+		// nil key
+		require.Error(t, store.Delete(""))
+
+		require.NoError(t, prov.Close())
+	})
+
 	t.Run("Test Leveldb multi store put and get", func(t *testing.T) {
 		prov := NewProvider(path)
 		const commonKey = "did:example:1"
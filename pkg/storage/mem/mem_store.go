@@ -125,6 +125,19 @@ func (s *memStore) Get(k string) ([]byte, error) {
 	return data, nil
 }
 
+// Delete deletes the record based on key
+func (s *memStore) Delete(k string) error {
+	if k == "" {
+		return errors.New("key is mandatory")
+	}
+
+	s.Lock()
+	delete(s.db, k)
+	s.Unlock()
+
+	return nil
+}
+
 // Iterator returns iterator for the latest snapshot of the underlying db.
 func (s *memStore) Iterator(start, limit string) storage.StoreIterator {
 	// TODO Change Store Iterator https://github.com/hyperledger/aries-framework-go/issues/852
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package mem
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -55,6 +56,28 @@ func TestMemStore(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("Test mem store delete", func(t *testing.T) {
+		prov := NewProvider()
+		store, err := prov.OpenStore("test-delete")
+		require.NoError(t, err)
+
+		const key = "did:example:123"
+
+		require.NoError(t, store.Put(key, []byte("value")))
+		require.NoError(t, store.Delete(key))
+
+		_, err = store.Get(key)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		// the missing record
+		require.NoError(t, store.Delete(key))
+
+		// nil key
+		require.Error(t, store.Delete(""))
+
+		require.NoError(t, prov.Close())
+	})
+
 	t.Run("Test mem multi store put and get", func(t *testing.T) {
 		prov := NewProvider()
 		const commonKey = "did:example:1"
@@ -0,0 +1,79 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package namespace
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+// Provider opens the stores of the underlying provider in the namespace, e.g. the stores of the tenant
+// of the multi-tenant agent. The store opened by the name is the store of the underlying provider
+// named <namespace>_<name>, so the namespaces sharing the provider never see each other's data.
+type Provider struct {
+	provider  storage.Provider
+	namespace string
+
+	mu     sync.Mutex
+	stores map[string]struct{}
+}
+
+// NewProvider returns new provider opening the stores of the given provider in the namespace.
+func NewProvider(provider storage.Provider, namespace string) *Provider {
+	return &Provider{provider: provider, namespace: namespace, stores: make(map[string]struct{})}
+}
+
+// OpenStore opens the store of the given name in the namespace.
+func (p *Provider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.provider.OpenStore(p.storeName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.stores[name] = struct{}{}
+	p.mu.Unlock()
+
+	return store, nil
+}
+
+// CloseStore closes the store of the given name in the namespace.
+func (p *Provider) CloseStore(name string) error {
+	p.mu.Lock()
+	delete(p.stores, name)
+	p.mu.Unlock()
+
+	return p.provider.CloseStore(p.storeName(name))
+}
+
+// Close closes the stores opened in the namespace, the stores of the other namespaces are kept open.
+func (p *Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+
+	for name := range p.stores {
+		if err := p.provider.CloseStore(p.storeName(name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	p.stores = make(map[string]struct{})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close stores of namespace %s: %v", p.namespace, errs)
+	}
+
+	return nil
+}
+
+func (p *Provider) storeName(name string) string {
+	return p.namespace + "_" + name
+}
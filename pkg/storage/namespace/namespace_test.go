@@ -0,0 +1,87 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package namespace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/internal/mock/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+)
+
+func TestProvider(t *testing.T) {
+	shared := mem.NewProvider()
+
+	alice := NewProvider(shared, "alice")
+	bob := NewProvider(shared, "bob")
+
+	aliceStore, err := alice.OpenStore("store")
+	require.NoError(t, err)
+	require.NoError(t, aliceStore.Put("key", []byte("alice")))
+
+	bobStore, err := bob.OpenStore("store")
+	require.NoError(t, err)
+	require.NoError(t, bobStore.Put("key", []byte("bob")))
+
+	// the namespaces are isolated
+	v, err := aliceStore.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("alice"), v)
+
+	v, err = bobStore.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("bob"), v)
+
+	// the store is opened in the underlying provider under the namespace
+	sharedStore, err := shared.OpenStore("alice_store")
+	require.NoError(t, err)
+
+	v, err = sharedStore.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("alice"), v)
+
+	// closing the namespace closes its stores only
+	require.NoError(t, alice.Close())
+
+	_, err = sharedStore.Get("key")
+	require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+	v, err = bobStore.Get("key")
+	require.NoError(t, err)
+	require.Equal(t, []byte("bob"), v)
+
+	require.NoError(t, bob.CloseStore("store"))
+	require.NoError(t, bob.Close())
+}
+
+func TestProvider_Errors(t *testing.T) {
+	p := NewProvider(&mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")}, "alice")
+
+	_, err := p.OpenStore("store")
+	require.EqualError(t, err, "open error")
+
+	p = NewProvider(&failingCloseProvider{MockStoreProvider: mockstorage.NewMockStoreProvider()}, "alice")
+
+	_, err = p.OpenStore("store")
+	require.NoError(t, err)
+
+	err = p.Close()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to close stores of namespace alice")
+}
+
+type failingCloseProvider struct {
+	*mockstorage.MockStoreProvider
+}
+
+func (p *failingCloseProvider) CloseStore(string) error {
+	return errors.New("close error")
+}
@@ -31,6 +31,9 @@ type Store interface {
 	// Get fetches the record based on key
 	Get(k string) ([]byte, error)
 
+	// Delete deletes the record based on key, deleting the missing record is not an error
+	Delete(k string) error
+
 	// Iterator returns an iterator for the latest snapshot of the
 	// underlying store
 	//
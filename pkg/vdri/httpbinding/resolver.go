@@ -6,6 +6,7 @@ SPDX-License-Identifier: Apache-2.0
 package httpbinding
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -17,8 +18,13 @@ import (
 )
 
 // resolveDID makes DID resolution via HTTP
-func (v *VDRI) resolveDID(uri string) ([]byte, error) {
-	resp, err := v.client.Get(uri)
+func (v *VDRI) resolveDID(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP Get request failed: %w", err)
+	}
+
+	resp, err := v.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP Get request failed: %w", err)
 	}
@@ -53,7 +59,19 @@ func containsDIDDocument(resp *http.Response) bool {
 }
 
 // Read implements didresolver.DidMethod.Read interface (https://w3c-ccg.github.io/did-resolution/#resolving-input)
-func (v *VDRI) Read(didID string, _ ...vdriapi.ResolveOpts) (*did.Doc, error) {
+func (v *VDRI) Read(didID string, opts ...vdriapi.ResolveOpts) (*did.Doc, error) {
+	resolveOpts := &vdriapi.ResolveDIDOpts{}
+
+	for _, opt := range opts {
+		opt(resolveOpts)
+	}
+
+	// the resolution without the context cannot be aborted
+	ctx := resolveOpts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	reqURL, err := url.ParseRequestURI(v.endpointURL)
 	if err != nil {
 		return nil, fmt.Errorf("url parse request uri failed: %w", err)
@@ -61,7 +79,7 @@ func (v *VDRI) Read(didID string, _ ...vdriapi.ResolveOpts) (*did.Doc, error) {
 
 	reqURL.Path = path.Join(reqURL.Path, didID)
 
-	data, err := v.resolveDID(reqURL.String())
+	data, err := v.resolveDID(ctx, reqURL.String())
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ SPDX-License-Identifier: Apache-2.0
 package httpbinding
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -109,6 +110,11 @@ func TestRead_DIDDoc(t *testing.T) {
 		didDoc, err := did.ParseDocument([]byte(doc))
 		require.NoError(t, err)
 		require.Equal(t, didDoc.ID, gotDocument.ID)
+
+		// the nil context is the context which cannot be aborted
+		gotDocument, err = resolver.Read("did:example:334455", vdriapi.WithContext(nil)) // nolint: staticcheck
+		require.NoError(t, err)
+		require.Equal(t, didDoc.ID, gotDocument.ID)
 	})
 	t.Run("test empty doc", func(t *testing.T) {
 		testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
@@ -215,6 +221,24 @@ func TestRead_HTTPGetFailed(t *testing.T) {
 	require.Contains(t, err.Error(), "HTTP Get request failed")
 }
 
+func TestRead_ContextDone(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+
+	defer func() { testServer.Close() }()
+
+	resolver, err := New(testServer.URL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = resolver.Read("did:example:334455", vdriapi.WithContext(ctx))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 func TestDIDResolver_Accept(t *testing.T) {
 	resolver, err := New("localhost:8080")
 	require.NoError(t, err)
@@ -24,9 +24,9 @@ import (
 var logger = log.New("aries-framework/vdri/httpbinding")
 
 const (
-	pubKeyIndex1      = "#key-1"
-	pubKeyController  = "controller"
-	svcEndpointIndex1 = "#endpoint-1"
+	pubKeyIndex1            = "#key-1"
+	pubKeyController        = "controller"
+	svcEndpointIndexPattern = "#endpoint-%d"
 )
 
 // VDRI via HTTP(s) endpoint
@@ -97,18 +97,22 @@ func (v *VDRI) Build(pubKey *vdriapi.PubKey, opts ...vdriapi.DocOpts) (*did.Doc,
 	}
 
 	if docOpts.ServiceType != "" {
-		s := did.Service{
-			ID:              svcEndpointIndex1,
-			Type:            docOpts.ServiceType,
-			ServiceEndpoint: docOpts.ServiceEndpoint,
-		}
+		endpoints := append([]string{docOpts.ServiceEndpoint}, docOpts.AdditionalServiceEndpoints...)
 
-		if docOpts.ServiceType == vdriapi.DIDCommServiceType {
-			s.RecipientKeys = []string{publicKey.ID}
-			s.Priority = 0
-		}
+		for i, endpoint := range endpoints {
+			s := did.Service{
+				ID:              fmt.Sprintf(svcEndpointIndexPattern, i+1),
+				Type:            docOpts.ServiceType,
+				ServiceEndpoint: endpoint,
+			}
 
-		didDoc.Service = []did.Service{s}
+			if docOpts.ServiceType == vdriapi.DIDCommServiceType {
+				s.RecipientKeys = []string{publicKey.ID}
+				s.Priority = uint(i)
+			}
+
+			didDoc.Service = append(didDoc.Service, s)
+		}
 	}
 
 	docBytes, err := didDoc.JSONBytes()
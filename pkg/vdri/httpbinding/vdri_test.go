@@ -8,6 +8,7 @@ package httpbinding
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -77,6 +78,35 @@ func TestVDRI_Build(t *testing.T) {
 		require.Equal(t, newDidDoc.PublicKey, didBuilt.PublicKey)
 	})
 
+	t.Run("test HTTP Binding VDRI build with additional service endpoints", func(t *testing.T) {
+		resolver, err := New(testServer.URL)
+		require.NoError(t, err)
+
+		requested := &struct {
+			Service []struct {
+				ID              string `json:"id"`
+				ServiceEndpoint string `json:"serviceEndpoint"`
+				Priority        uint   `json:"priority"`
+			} `json:"service"`
+		}{}
+
+		_, err = resolver.Build(pubKey, vdriapi.WithServiceType(vdriapi.DIDCommServiceType),
+			vdriapi.WithServiceEndpoint(svcEndPoint), vdriapi.WithAdditionalServiceEndpoints("ws://sample-svc:8081"),
+			vdriapi.WithRequestBuilder(
+				func(b []byte) (io.Reader, error) {
+					require.NoError(t, json.Unmarshal(b, requested))
+
+					return bytes.NewReader(b), nil
+				}))
+		require.NoError(t, err)
+		require.Len(t, requested.Service, 2)
+		require.Equal(t, "#endpoint-1", requested.Service[0].ID)
+		require.Equal(t, svcEndPoint, requested.Service[0].ServiceEndpoint)
+		require.Equal(t, "#endpoint-2", requested.Service[1].ID)
+		require.Equal(t, "ws://sample-svc:8081", requested.Service[1].ServiceEndpoint)
+		require.Equal(t, uint(1), requested.Service[1].Priority)
+	})
+
 	t.Run("test HTTP Binding VDRI build with request builder errors", func(t *testing.T) {
 		const sampleErr = "sample-error"
 		resolver, err := New("localhost:8080")
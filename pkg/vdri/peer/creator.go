@@ -42,18 +42,26 @@ func build(pubKey *vdriapi.PubKey, docOpts *vdriapi.CreateDIDOpts) (*did.Doc, er
 	var service []did.Service
 
 	if docOpts.ServiceType != "" {
-		s := did.Service{
-			ID:              "#agent",
-			Type:            docOpts.ServiceType,
-			ServiceEndpoint: docOpts.ServiceEndpoint,
-		}
+		endpoints := append([]string{docOpts.ServiceEndpoint}, docOpts.AdditionalServiceEndpoints...)
 
-		if docOpts.ServiceType == vdriapi.DIDCommServiceType {
-			s.RecipientKeys = []string{publicKey.ID}
-			s.Priority = 0
-		}
+		for i, endpoint := range endpoints {
+			s := did.Service{
+				ID:              "#agent",
+				Type:            docOpts.ServiceType,
+				ServiceEndpoint: endpoint,
+			}
+
+			if i > 0 {
+				s.ID = fmt.Sprintf("#agent-%d", i)
+			}
 
-		service = append(service, s)
+			if docOpts.ServiceType == vdriapi.DIDCommServiceType {
+				s.RecipientKeys = []string{publicKey.ID}
+				s.Priority = uint(i)
+			}
+
+			service = append(service, s)
+		}
 	}
 
 	// Created/Updated time
@@ -52,6 +52,24 @@ func TestDIDCreator(t *testing.T) {
 		require.Equal(t, "request-endpoint", didDoc.Service[0].ServiceEndpoint)
 	})
 
+	t.Run("test additional service endpoints", func(t *testing.T) {
+		c, err := New(&storage.MockStoreProvider{})
+		require.NoError(t, err)
+
+		didDoc, err := c.Build(getSigningKey(), api.WithServiceEndpoint("http://endpoint"),
+			api.WithAdditionalServiceEndpoints("ws://endpoint"), api.WithServiceType(api.DIDCommServiceType))
+		require.NoError(t, err)
+
+		require.Len(t, didDoc.Service, 2)
+		require.Equal(t, "#agent", didDoc.Service[0].ID)
+		require.Equal(t, "http://endpoint", didDoc.Service[0].ServiceEndpoint)
+		require.Equal(t, uint(0), didDoc.Service[0].Priority)
+		require.Equal(t, "#agent-1", didDoc.Service[1].ID)
+		require.Equal(t, "ws://endpoint", didDoc.Service[1].ServiceEndpoint)
+		require.Equal(t, uint(1), didDoc.Service[1].Priority)
+		require.Equal(t, didDoc.Service[0].RecipientKeys, didDoc.Service[1].RecipientKeys)
+	})
+
 	t.Run("test accept", func(t *testing.T) {
 		c, err := New(&storage.MockStoreProvider{})
 		require.NoError(t, err)
@@ -7,10 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package vdri
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	diddoc "github.com/hyperledger/aries-framework-go/pkg/doc/did"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	"github.com/hyperledger/aries-framework-go/pkg/kms"
@@ -30,15 +34,17 @@ type provider interface {
 
 // Registry vdri registry
 type Registry struct {
-	vdri               []vdriapi.VDRI
-	crypto             kms.KeyManager
-	defServiceEndpoint string
-	defServiceType     string
+	vdri                []vdriapi.VDRI
+	crypto              kms.KeyManager
+	defServiceEndpoints []string
+	defServiceType      string
+	metrics             metrics.Sink
+	tracer              trace.Tracer
 }
 
 // New return new instance of vdri
 func New(ctx provider, opts ...Option) *Registry {
-	baseVDRI := &Registry{crypto: ctx.KMS()}
+	baseVDRI := &Registry{crypto: ctx.KMS(), metrics: metrics.Nop, tracer: trace.Noop}
 
 	// Apply options
 	for _, opt := range opts {
@@ -56,6 +62,10 @@ func (r *Registry) Resolve(did string, opts ...vdriapi.ResolveOpts) (*diddoc.Doc
 		opt(resolveOpts)
 	}
 
+	if resolveOpts.Context != nil && resolveOpts.Context.Err() != nil {
+		return nil, fmt.Errorf("resolve %s: %w", did, resolveOpts.Context.Err())
+	}
+
 	didMethod, err := getDidMethod(did)
 	if err != nil {
 		return nil, err
@@ -68,7 +78,7 @@ func (r *Registry) Resolve(did string, opts ...vdriapi.ResolveOpts) (*diddoc.Doc
 	}
 
 	// Obtain the DID Document
-	didDoc, err := method.Read(did, opts...)
+	didDoc, err := r.read(resolveOpts.Context, method, didMethod, did, opts...)
 	if err != nil {
 		if errors.Is(err, vdriapi.ErrNotFound) {
 			return nil, err
@@ -85,6 +95,35 @@ func (r *Registry) Resolve(did string, opts ...vdriapi.ResolveOpts) (*diddoc.Doc
 	return didDoc, nil
 }
 
+// read reads the DID document by the DID method in the child span of the span in the resolution context.
+func (r *Registry) read(ctx context.Context, method vdriapi.VDRI, didMethod, did string,
+	opts ...vdriapi.ResolveOpts) (*diddoc.Doc, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attrs := []trace.KeyValue{trace.String(trace.DIDMethodKey, didMethod)}
+
+	// the resolution is correlated with the DIDComm exchange it is done for
+	if thID := trace.ThreadIDFromContext(ctx); thID != "" {
+		attrs = append(attrs, trace.String(trace.ThreadIDKey, thID))
+	}
+
+	_, span := r.tracer.Start(ctx, trace.ResolveSpan, trace.WithAttributes(attrs...))
+	defer span.End()
+
+	start := time.Now()
+	didDoc, err := method.Read(did, opts...)
+
+	metrics.ObserveSince(r.metrics, metrics.VDRIResolveDuration, start, metrics.Labels{"method": didMethod})
+
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return didDoc, err
+}
+
 // Create returns new DID Document
 func (r *Registry) Create(didMethod string, opts ...vdriapi.DocOpts) (*diddoc.Doc, error) {
 	docOpts := &vdriapi.CreateDIDOpts{KeyType: defaultKeyType}
@@ -122,8 +161,12 @@ func (r *Registry) applyDefaultDocOpts(docOpts *vdriapi.CreateDIDOpts, opts ...v
 		opts = append(opts, vdriapi.WithServiceType(r.defServiceType))
 	}
 
-	if docOpts.ServiceEndpoint == "" {
-		opts = append(opts, vdriapi.WithServiceEndpoint(r.defServiceEndpoint))
+	if docOpts.ServiceEndpoint == "" && len(r.defServiceEndpoints) > 0 {
+		opts = append(opts, vdriapi.WithServiceEndpoint(r.defServiceEndpoints[0]))
+
+		if len(docOpts.AdditionalServiceEndpoints) == 0 {
+			opts = append(opts, vdriapi.WithAdditionalServiceEndpoints(r.defServiceEndpoints[1:]...))
+		}
 	}
 
 	return opts
@@ -179,10 +222,27 @@ func WithDefaultServiceType(serviceType string) Option {
 	}
 }
 
-// WithDefaultServiceEndpoint allows for setting default service endpoint
-func WithDefaultServiceEndpoint(serviceEndpoint string) Option {
+// WithDefaultServiceEndpoint allows for setting default service endpoints, every endpoint is published as
+// a separate service with the priority in the given order
+func WithDefaultServiceEndpoint(serviceEndpoints ...string) Option {
+	return func(opts *Registry) {
+		opts.defServiceEndpoints = serviceEndpoints
+	}
+}
+
+// WithMetrics sets the sink receiving the DID resolution latency by the DID method
+func WithMetrics(sink metrics.Sink) Option {
 	return func(opts *Registry) {
-		opts.defServiceEndpoint = serviceEndpoint
+		opts.metrics = sink
+	}
+}
+
+// WithTracer sets the tracer of the DID resolution, the span is the child of the span in the resolution context
+func WithTracer(tracer trace.Tracer) Option {
+	return func(opts *Registry) {
+		if tracer != nil {
+			opts.tracer = tracer
+		}
 	}
 }
 
@@ -7,11 +7,16 @@ SPDX-License-Identifier: Apache-2.0
 package vdri
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/hyperledger/aries-framework-go/pkg/common/metrics"
+	"github.com/hyperledger/aries-framework-go/pkg/common/trace"
 	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
 	vdriapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdri"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/internal/mock/kms"
@@ -30,7 +35,7 @@ func TestRegistry_New(t *testing.T) {
 		registry := New(&mockprovider.Provider{},
 			WithDefaultServiceEndpoint(sampleSvcEndpoint), WithDefaultServiceType(sampleSvcType))
 		require.NotNil(t, registry)
-		require.Equal(t, sampleSvcEndpoint, registry.defServiceEndpoint)
+		require.Equal(t, []string{sampleSvcEndpoint}, registry.defServiceEndpoints)
 		require.Equal(t, sampleSvcType, registry.defServiceType)
 	})
 }
@@ -111,11 +116,70 @@ func TestRegistry_Resolve(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("test context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		registry := New(&mockprovider.Provider{}, WithVDRI(&mockvdri.MockVDRI{AcceptValue: true}))
+		_, err := registry.Resolve("1:id:123", vdriapi.WithContext(ctx))
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
 	t.Run("test success", func(t *testing.T) {
 		registry := New(&mockprovider.Provider{}, WithVDRI(&mockvdri.MockVDRI{AcceptValue: true}))
 		_, err := registry.Resolve("1:id:123")
 		require.NoError(t, err)
 	})
+
+	t.Run("test resolve latency reported by method", func(t *testing.T) {
+		sink := metrics.NewRegistry()
+
+		registry := New(&mockprovider.Provider{}, WithMetrics(sink), WithVDRI(&mockvdri.MockVDRI{AcceptValue: true}))
+		_, err := registry.Resolve("did:peer:123")
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, sink.WritePrometheus(&buf))
+		require.Contains(t, buf.String(), `aries_vdri_resolve_duration_seconds_count{method="peer"} 1`)
+	})
+
+	t.Run("test resolution traced in the span of the resolution context", func(t *testing.T) {
+		exporter := trace.NewInMemoryExporter()
+		tracer := trace.NewTracer(exporter)
+
+		registry := New(&mockprovider.Provider{}, WithTracer(tracer), WithVDRI(&mockvdri.MockVDRI{AcceptValue: true,
+			ReadFunc: func(didID string, opts ...vdriapi.ResolveOpts) (*did.Doc, error) {
+				return nil, errors.New("read error")
+			}}))
+
+		ctx, parent := tracer.Start(trace.ContextWithThreadID(context.Background(), "thid"), trace.StateSpan)
+
+		_, err := registry.Resolve("did:peer:123", vdriapi.WithContext(ctx))
+		require.Error(t, err)
+
+		_, err = registry.Resolve("did:example:123")
+		require.Error(t, err)
+
+		spans := exporter.Spans()
+		require.Len(t, spans, 2)
+		require.Equal(t, trace.ResolveSpan, spans[0].Name)
+		require.Equal(t, parent.SpanContext(), spans[0].Parent)
+		require.Equal(t, []string{"read error"}, spans[0].Errors)
+		require.False(t, spans[1].Parent.IsValid())
+
+		// the resolution is correlated with the exchange of the context
+		thID, ok := spans[0].Attribute(trace.ThreadIDKey)
+		require.True(t, ok)
+		require.Equal(t, "thid", thID)
+
+		_, ok = spans[1].Attribute(trace.ThreadIDKey)
+		require.False(t, ok)
+
+		method, ok := spans[1].Attribute(trace.DIDMethodKey)
+		require.True(t, ok)
+		require.Equal(t, "example", method)
+	})
 }
 
 func TestRegistry_Store(t *testing.T) {
@@ -172,6 +236,31 @@ func TestRegistry_Create(t *testing.T) {
 		_, err := registry.Create("id", vdriapi.WithKeyType("key1"))
 		require.NoError(t, err)
 	})
+	t.Run("test default service endpoints", func(t *testing.T) {
+		var docOpts *vdriapi.CreateDIDOpts
+
+		registry := New(&mockprovider.Provider{KMSValue: &mockkms.CloseableKMS{}},
+			WithDefaultServiceEndpoint("http://endpoint", "ws://endpoint"),
+			WithVDRI(&mockvdri.MockVDRI{AcceptValue: true,
+				BuildFunc: func(pubKey *vdriapi.PubKey, opts ...vdriapi.DocOpts) (doc *did.Doc, e error) {
+					docOpts = &vdriapi.CreateDIDOpts{}
+					for _, opt := range opts {
+						opt(docOpts)
+					}
+					return &did.Doc{ID: "1:id:123"}, nil
+				}}))
+
+		_, err := registry.Create("id")
+		require.NoError(t, err)
+		require.Equal(t, "http://endpoint", docOpts.ServiceEndpoint)
+		require.Equal(t, []string{"ws://endpoint"}, docOpts.AdditionalServiceEndpoints)
+
+		// the endpoint from the request overrides the default endpoints
+		_, err = registry.Create("id", vdriapi.WithServiceEndpoint("request-endpoint"))
+		require.NoError(t, err)
+		require.Equal(t, "request-endpoint", docOpts.ServiceEndpoint)
+		require.Empty(t, docOpts.AdditionalServiceEndpoints)
+	})
 	t.Run("test error from build doc", func(t *testing.T) {
 		registry := New(&mockprovider.Provider{KMSValue: &mockkms.CloseableKMS{}},
 			WithVDRI(&mockvdri.MockVDRI{AcceptValue: true,